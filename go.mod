@@ -6,4 +6,5 @@ require (
 	github.com/sirupsen/logrus v1.4.2
 	github.com/smartystreets/goconvey v1.6.4
 	github.com/stretchr/testify v1.2.2
+	gopkg.in/yaml.v2 v2.2.2
 )
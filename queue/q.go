@@ -2,49 +2,180 @@ package queue
 
 import (
 	"container/list"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 )
 
+var (
+	// ErrClosed - returned when waiting on (or enqueuing to) a queue which has been closed
+	ErrClosed = errors.New("queue closed")
+
+	// ErrFull - returned when an item is rejected by a queue which is at capacity
+	ErrFull = errors.New("queue full")
+
+	// ErrTimeout - returned when no item is available within the wait timeout
+	ErrTimeout = errors.New("queue wait timeout")
+)
+
+// Policy - what happens when an item is enqueued to a queue which is at capacity
+type Policy int
+
+const (
+	// Block the caller until there is space in the queue
+	Block Policy = iota
+	// Discard the oldest item of the lowest priority lane to make space
+	DropOldest
+	// Reject the item with ErrFull
+	Reject
+)
+
+// ParsePolicy - the policy with the specified name: block, drop_oldest or reject; empty is Block
+func ParsePolicy(s string) (Policy, error) {
+	switch s {
+	case "", "block":
+		return Block, nil
+	case "drop_oldest":
+		return DropOldest, nil
+	case "reject":
+		return Reject, nil
+	}
+	return Block, fmt.Errorf("unknown policy %q, expected block, drop_oldest or reject", s)
+}
+
+// Priority - the lane an item is enqueued to. Items in higher priority
+// lanes are dequeued before items of lower priority lanes
+type Priority int
+
+// NormalPriority - the lane used by Enqueue
+const NormalPriority Priority = 0
+
 // Queue - An interface to queues
 type Queue interface {
-	// EnQueue an element to the queue
-	Enqueue(item interface{})
+	// EnQueue an element to the normal priority lane of the queue
+	Enqueue(item interface{}) error
+	// EnQueue an element to the specified priority lane of the queue
+	EnqueueWithPriority(item interface{}, priority Priority) error
 	// DeQueue an element from the queue
 	Dequeue() (interface{}, bool)
 	// Return the length of the underlying queue
 	Len() int
 	// Wait until an item in the underlying queue is ready
 	// Once an item is available. Dequeue this item and return it
-	WaitForItem() interface{}
+	// Returns ErrClosed once the queue is closed
+	WaitForItem() (interface{}, error)
+	// WaitForItem, giving up with ErrTimeout after the specified timeout
+	WaitForItemTimeout(timeout time.Duration) (interface{}, error)
+	// WaitForItem, giving up with the context's error once it is done
+	WaitForItemContext(ctx context.Context) (interface{}, error)
+	// Return the number of items discarded or rejected because the queue was at capacity
+	Dropped() int
+	// Close the queue, waking up all waiters. Items enqueued
+	// after the queue is closed are discarded
+	Close()
+}
+
+// Options - configure the capacity and lanes of a queue
+type Options struct {
+	// Maximum number of items across all lanes, zero or less is unbounded
+	Capacity int
+
+	// Behaviour of enqueue once the capacity is reached
+	Policy Policy
+
+	// Number of priority lanes, priorities range over [0, Lanes)
+	Lanes int
 }
 
 // ConcurrentQueue - A queue which is go-routine safe
 type ConcurrentQueue struct {
-	// q is the backing linked list for this queue
-	q *list.List
+	// backing linked lists of the lanes of this queue, indexed by priority
+	lanes []*list.List
 	// A cond variable used for th WaitForItem call
 	c *sync.Cond
 	// An underlying mutex to provide go-routine safety
 	mu *sync.Mutex
+
+	// Set once the queue is closed
+	closed bool
+
+	capacity int
+
+	policy Policy
+
+	// Number of items discarded or rejected because the queue was full
+	dropped int
 }
 
 func NewQueue() Queue {
+	return NewBoundedQueue(Options{})
+}
+
+func NewBoundedQueue(opts Options) Queue {
 	mu := &sync.Mutex{}
+	nLanes := opts.Lanes
+	if nLanes < 1 {
+		nLanes = 1
+	}
+	lanes := make([]*list.List, nLanes)
+	for i := range lanes {
+		lanes[i] = list.New()
+	}
 	return &ConcurrentQueue{
-		q:  list.New(),
-		mu: mu,
-		c:  sync.NewCond(mu),
+		lanes:    lanes,
+		mu:       mu,
+		c:        sync.NewCond(mu),
+		capacity: opts.Capacity,
+		policy:   opts.Policy,
 	}
 }
 
-func (mq *ConcurrentQueue) Enqueue(item interface{}) {
+func (mq *ConcurrentQueue) Enqueue(item interface{}) error {
+	return mq.EnqueueWithPriority(item, NormalPriority)
+}
+
+func (mq *ConcurrentQueue) EnqueueWithPriority(item interface{}, priority Priority) error {
+	if priority < 0 || int(priority) >= len(mq.lanes) {
+		log.Panicf("priority %d out of range [0, %d)", priority, len(mq.lanes))
+	}
 	mq.c.L.Lock()
 	defer mq.c.L.Unlock()
-	mq.q.PushBack(item)
+	for !mq.closed && mq.full() {
+		switch mq.policy {
+		case Block:
+			mq.c.Wait()
+		case DropOldest:
+			mq.dropOldest()
+		case Reject:
+			mq.dropped++
+			return ErrFull
+		}
+	}
+	if mq.closed {
+		return ErrClosed
+	}
+	mq.lanes[priority].PushBack(item)
 	// Broadcast all waiting go-routines
 	// ToDo: figure out if signal is sufficient
 	mq.c.Broadcast()
+	return nil
+}
+
+func (mq *ConcurrentQueue) full() bool {
+	return mq.capacity > 0 && mq.len() >= mq.capacity
+}
+
+func (mq *ConcurrentQueue) dropOldest() {
+	for _, lane := range mq.lanes {
+		if lane.Len() > 0 {
+			lane.Remove(lane.Front())
+			mq.dropped++
+			return
+		}
+	}
 }
 
 func (mq *ConcurrentQueue) Dequeue() (interface{}, bool) {
@@ -54,23 +185,81 @@ func (mq *ConcurrentQueue) Dequeue() (interface{}, bool) {
 }
 
 func (mq *ConcurrentQueue) dequeue() (interface{}, bool) {
-	if mq.q.Len() == 0 {
-		return nil, false
+	for i := len(mq.lanes) - 1; i >= 0; i-- {
+		lane := mq.lanes[i]
+		if lane.Len() == 0 {
+			continue
+		}
+		elem := lane.Front()
+		lane.Remove(elem)
+		// wake up producers blocked on a full queue
+		mq.c.Broadcast()
+		return elem.Value, true
 	}
-	elem := mq.q.Front()
-	mq.q.Remove(elem)
-	return elem.Value, true
+	return nil, false
 }
 
 func (mq *ConcurrentQueue) Len() int {
 	mq.c.L.Lock()
-	defer mq.c.L.Lock()
-	return mq.q.Len()
+	defer mq.c.L.Unlock()
+	return mq.len()
+}
+
+func (mq *ConcurrentQueue) len() int {
+	n := 0
+	for _, lane := range mq.lanes {
+		n += lane.Len()
+	}
+	return n
+}
+
+// Dropped - number of items discarded or rejected because the queue was at capacity
+func (mq *ConcurrentQueue) Dropped() int {
+	mq.c.L.Lock()
+	defer mq.c.L.Unlock()
+	return mq.dropped
+}
+
+func (mq *ConcurrentQueue) Close() {
+	mq.c.L.Lock()
+	defer mq.c.L.Unlock()
+	mq.closed = true
+	mq.c.Broadcast()
+}
+
+func (mq *ConcurrentQueue) WaitForItem() (interface{}, error) {
+	return mq.WaitForItemContext(context.Background())
 }
 
-func (mq *ConcurrentQueue) WaitForItem() interface{} {
+func (mq *ConcurrentQueue) WaitForItemTimeout(timeout time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	v, err := mq.WaitForItemContext(ctx)
+	if err == context.DeadlineExceeded {
+		return nil, ErrTimeout
+	}
+	return v, err
+}
+
+func (mq *ConcurrentQueue) WaitForItemContext(ctx context.Context) (interface{}, error) {
+	if ctx.Done() != nil {
+		// cond.Wait cannot select on a channel, so wake up
+		// the waiters once the context is done
+		waiting := make(chan struct{})
+		defer close(waiting)
+		go func() {
+			select {
+			case <-ctx.Done():
+				mq.c.L.Lock()
+				mq.c.Broadcast()
+				mq.c.L.Unlock()
+			case <-waiting:
+			}
+		}()
+	}
+
 	mq.c.L.Lock()
-	for mq.q.Len() == 0 {
+	for mq.len() == 0 && !mq.closed && ctx.Err() == nil {
 		// Refer the comment for cond.Wait
 		// Wait atomically unlocks c.L and suspends execution
 		// of the calling goroutine. After later resuming execution,
@@ -83,9 +272,15 @@ func (mq *ConcurrentQueue) WaitForItem() interface{} {
 		mq.c.Wait()
 	}
 	defer mq.c.L.Unlock()
+	if mq.closed {
+		return nil, ErrClosed
+	}
+	if mq.len() == 0 {
+		return nil, ctx.Err()
+	}
 	v, ok := mq.dequeue()
 	if !ok {
 		log.Fatalf("Fatal error expected to have at least one element")
 	}
-	return v
+	return v, nil
 }
@@ -1,8 +1,10 @@
 package queue
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestNewQueue_MatchesInterface(t *testing.T) {
@@ -11,7 +13,7 @@ func TestNewQueue_MatchesInterface(t *testing.T) {
 
 	mq, ok := q.(*ConcurrentQueue)
 	assert.True(t, ok)
-	assert.NotNil(t, mq.q)
+	assert.NotNil(t, mq.lanes[NormalPriority])
 }
 
 func TestConcurrentQueue_Enqueue_ItemsAreAddedToList(t *testing.T) {
@@ -20,7 +22,7 @@ func TestConcurrentQueue_Enqueue_ItemsAreAddedToList(t *testing.T) {
 
 	q.Enqueue("Garbanzo Beans")
 	q.Enqueue("Falafal")
-	assert.Equal(t, 2, mq.q.Len())
+	assert.Equal(t, 2, mq.lanes[NormalPriority].Len())
 }
 
 func TestConcurrentQueue_Dequeue_ItemsAreDeQueuedInOrder(t *testing.T) {
@@ -55,7 +57,8 @@ func TestConcurrentQueue_WaitForItem_DequeuesItemsInOrder(t *testing.T) {
 	}
 
 	for i := 0; i < len(expectedEntries); i++ {
-		actualEntry := q.WaitForItem()
+		actualEntry, err := q.WaitForItem()
+		assert.Nil(t, err)
 		expectedEntry := expectedEntries[i]
 		assert.Equal(t, expectedEntry, actualEntry)
 	}
@@ -72,8 +75,131 @@ func TestConcurrentQueue_WaitForItem_DeQueuesItemsAcrossGoRoutines(t *testing.T)
 	}(entries)
 
 	for i := 0; i < len(entries); i++ {
-		actualEntry := q.WaitForItem()
+		actualEntry, err := q.WaitForItem()
+		assert.Nil(t, err)
 		expectedEntry := entries[i]
 		assert.Equal(t, expectedEntry, actualEntry)
 	}
 }
+
+func TestConcurrentQueue_Close_WakesUpWaiters(t *testing.T) {
+	q := NewQueue()
+	done := make(chan error)
+
+	go func() {
+		_, err := q.WaitForItem()
+		done <- err
+	}()
+
+	q.Close()
+	assert.Equal(t, ErrClosed, <-done)
+}
+
+func TestConcurrentQueue_Close_DiscardsNewItems(t *testing.T) {
+	q := NewQueue()
+	q.Close()
+	q.Enqueue("Hummus")
+
+	_, ok := q.Dequeue()
+	assert.False(t, ok)
+	_, err := q.WaitForItem()
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestConcurrentQueue_Len_CountsAllLanes(t *testing.T) {
+	q := NewBoundedQueue(Options{Lanes: 2})
+	assert.Nil(t, q.Enqueue("Tahini"))
+	assert.Nil(t, q.EnqueueWithPriority("Pita", 1))
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestConcurrentQueue_EnqueueWithPriority_HigherLanesDequeuedFirst(t *testing.T) {
+	q := NewBoundedQueue(Options{Lanes: 3})
+	q.Enqueue("low")
+	q.EnqueueWithPriority("high", 2)
+	q.EnqueueWithPriority("mid", 1)
+
+	for _, expected := range []string{"high", "mid", "low"} {
+		actual, err := q.WaitForItem()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestConcurrentQueue_Reject_ReturnsErrFullAtCapacity(t *testing.T) {
+	q := NewBoundedQueue(Options{Capacity: 2, Policy: Reject})
+	assert.Nil(t, q.Enqueue("1"))
+	assert.Nil(t, q.Enqueue("2"))
+	assert.Equal(t, ErrFull, q.Enqueue("3"))
+	assert.Equal(t, 2, q.Len())
+	assert.Equal(t, 1, q.Dropped())
+}
+
+func TestConcurrentQueue_DropOldest_DiscardsOldestItemAtCapacity(t *testing.T) {
+	q := NewBoundedQueue(Options{Capacity: 2, Policy: DropOldest})
+	q.Enqueue("1")
+	q.Enqueue("2")
+	assert.Nil(t, q.Enqueue("3"))
+
+	for _, expected := range []string{"2", "3"} {
+		actual, ok := q.Dequeue()
+		assert.True(t, ok)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestConcurrentQueue_Block_WaitsForSpaceAtCapacity(t *testing.T) {
+	q := NewBoundedQueue(Options{Capacity: 1, Policy: Block})
+	q.Enqueue("1")
+	done := make(chan error)
+
+	go func() {
+		done <- q.Enqueue("2")
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected enqueue to block on a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	actual, _ := q.Dequeue()
+	assert.Equal(t, "1", actual)
+	assert.Nil(t, <-done)
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestConcurrentQueue_WaitForItemTimeout_ReturnsErrTimeout(t *testing.T) {
+	q := NewQueue()
+	_, err := q.WaitForItemTimeout(10 * time.Millisecond)
+	assert.Equal(t, ErrTimeout, err)
+
+	q.Enqueue("Baba Ganoush")
+	actual, err := q.WaitForItemTimeout(10 * time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, "Baba Ganoush", actual)
+}
+
+func TestConcurrentQueue_WaitForItemContext_ReturnsOnCancel(t *testing.T) {
+	q := NewQueue()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		_, err := q.WaitForItemContext(ctx)
+		done <- err
+	}()
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestParsePolicy(t *testing.T) {
+	for name, expected := range map[string]Policy{"": Block, "block": Block, "drop_oldest": DropOldest, "reject": Reject} {
+		actual, err := ParsePolicy(name)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	}
+	_, err := ParsePolicy("drop_newest")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,157 @@
+package byzantine
+
+// Byzantine fault injection.
+//
+// Every other component assumes its peers crash but never lie. The behaviors below break that
+// assumption for a single acceptor or leader, and classic Paxos, which tolerates f crash failures
+// out of 2f+1 acceptors but no Byzantine ones, ends up deciding different commands for the same
+// slot at different replicas. invariant.CheckDecisions reports these as R1 violations.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+)
+
+// Names of the behaviors
+const (
+	// An acceptor which reports the pvalues it accepted to some scouts only
+	Equivocate = "equivocate"
+
+	// An acceptor which claims to have adopted or accepted the ballot of every request
+	LieAboutBallot = "lie_about_ballot"
+
+	// A leader which proposes different commands for a slot to different acceptors & replicas
+	ConflictingProposals = "conflicting_proposals"
+)
+
+// Behavior - how a Byzantine process deviates from the protocol. Calls are serialized by the Exchange
+type Behavior interface {
+	// The type of process the behavior applies to
+	ProcessType() v1.ProcessType
+
+	// Observe - a message delivered to the process
+	Observe(m v1.Message)
+
+	// Tamper - the message delivered to dest in place of m, which was sent by the process
+	Tamper(dest v1.Addr, m v1.Message) v1.Message
+}
+
+var behaviors = map[string]func() Behavior{
+	Equivocate:           func() Behavior { return equivocate{} },
+	LieAboutBallot:       func() Behavior { return &lieAboutBallot{ballots: make(map[v1.Addr]types.BallotNumber)} },
+	ConflictingProposals: func() Behavior { return conflictingProposals{} },
+}
+
+// New - a new instance of the named behavior
+func New(name string) (Behavior, error) {
+	f, ok := behaviors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown behavior %q, expected one of %v", name, Names())
+	}
+	return f(), nil
+}
+
+// Names - the names of all behaviors, sorted
+func Names() []string {
+	result := make([]string, 0, len(behaviors))
+	for name := range behaviors {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// odd - splits the destinations of a message in two halves
+func odd(addr v1.Addr) bool {
+	return addr.ID()%2 != 0
+}
+
+// equivocate - an acceptor which tells the scouts with an odd id that it accepted nothing. Their
+// leader may then propose another command for a slot the acceptor helped decide
+type equivocate struct{}
+
+func (equivocate) ProcessType() v1.ProcessType {
+	return v1.Acceptor
+}
+
+func (equivocate) Observe(m v1.Message) {}
+
+func (equivocate) Tamper(dest v1.Addr, m v1.Message) v1.Message {
+	p1b, ok := m.(messages.Phase1bMessage)
+	if !ok || !odd(dest) {
+		return m
+	}
+	return messages.NewPhase1bMessage(p1b.Src(), p1b.BallotNumber, make(types.PValues))
+}
+
+// lieAboutBallot - an acceptor which replies with the ballot of the request, whichever ballot it
+// promised. Scouts count it towards adopting their ballot and commanders towards accepting their
+// pvalue, although it may have promised a higher ballot to another leader
+type lieAboutBallot struct {
+	// ballot of the last request of each scout or commander
+	ballots map[v1.Addr]types.BallotNumber
+}
+
+func (l *lieAboutBallot) ProcessType() v1.ProcessType {
+	return v1.Acceptor
+}
+
+func (l *lieAboutBallot) Observe(m v1.Message) {
+	switch v := m.(type) {
+	case messages.Phase1aMessage:
+		l.ballots[key(v.Src())] = v.BallotNumber
+	case messages.Phase2aMessage:
+		l.ballots[key(v.Src())] = v.PValue.BN
+	}
+}
+
+func (l *lieAboutBallot) Tamper(dest v1.Addr, m v1.Message) v1.Message {
+	bn, ok := l.ballots[key(dest)]
+	if !ok {
+		return m
+	}
+	switch v := m.(type) {
+	case messages.Phase1bMessage:
+		delete(l.ballots, key(dest))
+		return messages.NewPhase1bMessage(v.Src(), bn, v.PValues)
+	case messages.Phase2bMessage:
+		delete(l.ballots, key(dest))
+		return messages.NewPhase2bMessage(v.Src(), bn)
+	}
+	return m
+}
+
+// conflictingProposals - a leader whose commanders ask the acceptors with an odd id to accept
+// another command for the slot, and tell the replicas with an odd id that it was decided
+type conflictingProposals struct{}
+
+func (conflictingProposals) ProcessType() v1.ProcessType {
+	return v1.Leader
+}
+
+func (conflictingProposals) Observe(m v1.Message) {}
+
+func (conflictingProposals) Tamper(dest v1.Addr, m v1.Message) v1.Message {
+	if !odd(dest) {
+		return m
+	}
+	switch v := m.(type) {
+	case messages.Phase2aMessage:
+		pv := v.PValue
+		pv.Command = conflicting(pv.Slot)
+		return messages.NewPhase2aMessage(v.Src(), pv)
+	case messages.DecisionMessage:
+		if dest.Type() == v1.Replica {
+			return messages.NewDecisionMessage(v.Src(), v.Slot, conflicting(v.Slot))
+		}
+	}
+	return m
+}
+
+// conflicting - the command a Byzantine leader proposes in place of the one decided for the slot
+func conflicting(slot types.Slot) types.Command {
+	return types.BasicCommand{ClientID: "byzantine", CommandID: fmt.Sprintf("%d", slot), Op: "CONFLICT"}
+}
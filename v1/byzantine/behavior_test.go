@@ -0,0 +1,137 @@
+package byzantine
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	"github.com/1xyz/paxossim/v1/v1fakes"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// child - a process owned by a leader, like a Scout or a Commander
+type child struct {
+	v1.Process
+
+	owner v1.Addr
+}
+
+func (c child) Owner() v1.Addr {
+	return c.owner
+}
+
+func newPValue(round int, leader v1.Addr, slot types.Slot) types.PValue {
+	return types.PValue{
+		BN:      types.BallotNumber{Round: round, LeaderID: leader},
+		Slot:    slot,
+		Command: types.BasicCommand{ClientID: "client:0", CommandID: "1", Op: "OP"},
+	}
+}
+
+func TestNew(t *testing.T) {
+	Convey("Behaviors are created by name", t, func() {
+		for _, name := range Names() {
+			b, err := New(name)
+			So(err, ShouldBeNil)
+			So(b, ShouldNotBeNil)
+		}
+		_, err := New("honest")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestExchange(t *testing.T) {
+	Convey("Given an exchange with a Byzantine leader", t, func() {
+		inner := &v1fakes.FakeMessageExchange{}
+		be := NewExchange(inner)
+		leader := v1.NewAddress(0, v1.Leader)
+		cmdr := child{Process: v1.NewProcess(7, v1.Commander), owner: leader}
+		So(be.Register(cmdr), ShouldBeNil)
+		b, _ := New(ConflictingProposals)
+		be.SetBehavior(leader, b)
+		So(be.Byzantine(), ShouldResemble, []v1.Addr{leader})
+
+		pv := newPValue(1, leader, 3)
+		even, odd := v1.NewAddress(2, v1.Acceptor), v1.NewAddress(3, v1.Acceptor)
+
+		Convey("the messages of the processes it owns are tampered with", func() {
+			So(be.Send(even, messages.NewPhase2aMessage(cmdr.GetAddr(), pv)), ShouldBeNil)
+			So(be.Send(odd, messages.NewPhase2aMessage(cmdr.GetAddr(), pv)), ShouldBeNil)
+			So(inner.SendCallCount(), ShouldEqual, 2)
+			_, m := inner.SendArgsForCall(0)
+			So(m.(messages.Phase2aMessage).PValue, ShouldResemble, pv)
+			_, m = inner.SendArgsForCall(1)
+			So(m.(messages.Phase2aMessage).PValue.Command, ShouldResemble, conflicting(3))
+		})
+
+		Convey("the decisions sent to half of the replicas are replaced", func() {
+			replica := v1.NewAddress(1, v1.Replica)
+			So(be.Send(replica, messages.NewDecisionMessage(cmdr.GetAddr(), 3, pv.Command)), ShouldBeNil)
+			_, m := inner.SendArgsForCall(0)
+			So(m.(messages.DecisionMessage).Command, ShouldResemble, conflicting(3))
+		})
+
+		Convey("once honest again, messages are delivered as sent", func() {
+			be.SetBehavior(leader, nil)
+			So(be.Send(odd, messages.NewPhase2aMessage(cmdr.GetAddr(), pv)), ShouldBeNil)
+			_, m := inner.SendArgsForCall(0)
+			So(m.(messages.Phase2aMessage).PValue, ShouldResemble, pv)
+		})
+
+		Convey("the processes of honest leaders are left alone", func() {
+			other := child{Process: v1.NewProcess(8, v1.Commander), owner: v1.NewAddress(1, v1.Leader)}
+			So(be.Register(other), ShouldBeNil)
+			So(be.Send(odd, messages.NewPhase2aMessage(other.GetAddr(), pv)), ShouldBeNil)
+			_, m := inner.SendArgsForCall(0)
+			So(m.(messages.Phase2aMessage).PValue, ShouldResemble, pv)
+		})
+	})
+}
+
+func TestEquivocate(t *testing.T) {
+	Convey("Given an equivocating acceptor which accepted a pvalue", t, func() {
+		b, _ := New(Equivocate)
+		acceptor := v1.NewAddress(0, v1.Acceptor)
+		leader := v1.NewAddress(0, v1.Leader)
+		accepted := make(types.PValues)
+		accepted.Set(newPValue(1, leader, 1))
+		m := messages.NewPhase1bMessage(acceptor, types.BallotNumber{Round: 2, LeaderID: leader}, accepted)
+
+		Convey("it reports the pvalue to some scouts and hides it from others", func() {
+			reported := b.Tamper(v1.NewAddress(2, v1.Scout), m).(messages.Phase1bMessage)
+			So(len(reported.PValues), ShouldEqual, 1)
+			hidden := b.Tamper(v1.NewAddress(3, v1.Scout), m).(messages.Phase1bMessage)
+			So(len(hidden.PValues), ShouldEqual, 0)
+			So(hidden.BallotNumber, ShouldResemble, m.BallotNumber)
+		})
+	})
+}
+
+func TestLieAboutBallot(t *testing.T) {
+	Convey("Given an acceptor lying about its ballot, which promised a higher ballot", t, func() {
+		b, _ := New(LieAboutBallot)
+		acceptor := v1.NewAddress(0, v1.Acceptor)
+		leader := v1.NewAddress(0, v1.Leader)
+		promised := types.BallotNumber{Round: 5, LeaderID: v1.NewAddress(1, v1.Leader)}
+		cmdr := v1.NewAddress(4, v1.Commander)
+		pv := newPValue(1, leader, 1)
+
+		Convey("a commander is told its pvalue was accepted", func() {
+			b.Observe(messages.NewPhase2aMessage(cmdr, pv))
+			m := b.Tamper(cmdr, messages.NewPhase2bMessage(acceptor, promised)).(messages.Phase2bMessage)
+			So(m.BallotNumber, ShouldResemble, pv.BN)
+		})
+
+		Convey("a scout is told its ballot was adopted", func() {
+			scout := v1.NewAddress(4, v1.Scout)
+			b.Observe(messages.NewPhase1aMessage(scout, pv.BN))
+			m := b.Tamper(scout, messages.NewPhase1bMessage(acceptor, promised, make(types.PValues))).(messages.Phase1bMessage)
+			So(m.BallotNumber, ShouldResemble, pv.BN)
+		})
+
+		Convey("replies to processes which sent no request are left alone", func() {
+			m := b.Tamper(cmdr, messages.NewPhase2bMessage(acceptor, promised)).(messages.Phase2bMessage)
+			So(m.BallotNumber, ShouldResemble, promised)
+		})
+	})
+}
@@ -0,0 +1,102 @@
+package byzantine
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"sync"
+)
+
+// Exchange - A MessageExchange which lets some processes deviate from the protocol: the messages
+// sent by a Byzantine process (or by the scouts & commanders it owns) are tampered with by its
+// behavior before they are delivered. Broadcasts are only tampered with once expanded to a Send per
+// destination, so this exchange is meant to be wrapped by one which does so (e.g. v1.FaultyMessageExchange)
+type Exchange struct {
+	v1.MessageExchange
+
+	// guards the behaviors, which are not safe for concurrent use
+	mu *sync.Mutex
+
+	behaviors map[v1.Addr]Behavior
+
+	// owner of a spawned process (a Scout's or a Commander's leader)
+	owners map[v1.Addr]v1.Addr
+}
+
+func NewExchange(inner v1.MessageExchange) *Exchange {
+	return &Exchange{
+		MessageExchange: inner,
+		mu:              &sync.Mutex{},
+		behaviors:       make(map[v1.Addr]Behavior),
+		owners:          make(map[v1.Addr]v1.Addr),
+	}
+}
+
+// SetBehavior - the process behaves as specified from now on, or honestly again if b is nil
+func (be *Exchange) SetBehavior(addr v1.Addr, b Behavior) {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	if b == nil {
+		delete(be.behaviors, key(addr))
+		return
+	}
+	be.behaviors[key(addr)] = b
+}
+
+// Byzantine - the processes which currently deviate from the protocol
+func (be *Exchange) Byzantine() []v1.Addr {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	result := make([]v1.Addr, 0, len(be.behaviors))
+	for addr := range be.behaviors {
+		result = append(result, addr)
+	}
+	return result
+}
+
+func (be *Exchange) Send(dest v1.Addr, m v1.Message) error {
+	be.mu.Lock()
+	if b, ok := be.behaviors[be.resolve(m.Src())]; ok {
+		m = b.Tamper(dest, m)
+	}
+	// observed before the process gets to respond to it
+	if b, ok := be.behaviors[be.resolve(dest)]; ok {
+		b.Observe(m)
+	}
+	be.mu.Unlock()
+	return be.MessageExchange.Send(dest, m)
+}
+
+func (be *Exchange) Register(p v1.ProcessInbox) error {
+	if err := be.MessageExchange.Register(p); err != nil {
+		return err
+	}
+	if o, ok := p.(v1.Owned); ok && o.Owner() != nil {
+		be.mu.Lock()
+		be.owners[key(p)] = key(o.Owner())
+		be.mu.Unlock()
+	}
+	return nil
+}
+
+func (be *Exchange) UnRegister(p v1.ProcessInbox) error {
+	if err := be.MessageExchange.UnRegister(p); err != nil {
+		return err
+	}
+	be.mu.Lock()
+	delete(be.owners, key(p))
+	be.mu.Unlock()
+	return nil
+}
+
+// resolve - the process whose behavior applies to addr
+func (be *Exchange) resolve(addr v1.Addr) v1.Addr {
+	addr = key(addr)
+	if owner, ok := be.owners[addr]; ok {
+		return owner
+	}
+	return addr
+}
+
+// key - addresses are compared by value
+func key(addr v1.Addr) v1.Addr {
+	return v1.NewAddress(addr.ID(), addr.Type())
+}
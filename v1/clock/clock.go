@@ -0,0 +1,296 @@
+package clock
+
+// Clocks of the processes, and of the drivers of a run.
+//
+// The processes read the time, and wait for timeouts & heartbeats, through a Clock. The Real
+// clock is the time of the host; a Fake clock stands still until it is advanced, so that a run
+// proceeds in virtual time: a driver which sleeps on a Fake clock (see Sleep) advances it
+// instead, firing every timer & ticker which is due, in order.
+//
+// A Skewed clock runs off another clock, ahead of or behind it and faster or slower than it, to
+// model a process whose clock drifts from its peers'.
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock - the source of the time, timers & tickers
+type Clock interface {
+	Now() time.Time
+
+	// After - a channel which receives the time once the duration has elapsed
+	After(d time.Duration) <-chan time.Time
+
+	// AfterFunc - call f in its own goroutine once the duration has elapsed
+	AfterFunc(d time.Duration, f func()) Timer
+
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer - a pending call of AfterFunc
+type Timer interface {
+	// Stop - prevent the call, returns false if it was made or stopped already
+	Stop() bool
+}
+
+// Ticker - delivers the time on C every period; ticks are dropped for a slow receiver
+type Ticker interface {
+	C() <-chan time.Time
+
+	Stop()
+}
+
+// Real - the clock of the host
+func Real() Clock {
+	return realClock{}
+}
+
+// OrReal - the clock, or the Real clock if it is nil
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+	return c
+}
+
+// Sleep - block for the duration on the clock. A Fake clock is advanced by the duration instead,
+// so the caller drives virtual time
+func Sleep(c Clock, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if f, ok := c.(*Fake); ok {
+		f.Advance(d)
+		return
+	}
+	<-c.After(d)
+}
+
+// Since - the time elapsed on the clock since t
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// Fake - a clock which only moves when it is advanced
+type Fake struct {
+	mu *sync.Mutex
+
+	now time.Time
+
+	// pending timers & tickers, the earliest first
+	waiters []*waiter
+
+	// numbers the waiters, so that those due at the same time fire in the order they were created
+	seq int
+
+	// called after every firing, see SetSettle
+	settle func()
+}
+
+// waiter - a timer, an After channel or a ticker of a Fake clock
+type waiter struct {
+	clock *Fake
+
+	at time.Time
+
+	seq int
+
+	// zero but for tickers
+	period time.Duration
+
+	// the channel of After & tickers, nil for AfterFunc
+	ch chan time.Time
+
+	f func()
+}
+
+// NewFake - a Fake clock set at the time
+func NewFake(now time.Time) *Fake {
+	return &Fake{mu: &sync.Mutex{}, now: now}
+}
+
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Fake) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	c.add(d, 0, ch, nil)
+	return ch
+}
+
+func (c *Fake) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(d, 0, nil, f)
+}
+
+func (c *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.add(d, d, make(chan time.Time, 1), nil)}
+}
+
+// SetSettle - call settle after every timer & ticker fired by Advance, to let the processes handle
+// what the firing caused before the clock moves on. Otherwise the other goroutines are merely
+// given a chance to run
+func (c *Fake) SetSettle(settle func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.settle = settle
+}
+
+// Waiters - the number of pending timers & tickers, e.g. to wait for a process to set its ticker
+// before advancing the clock
+func (c *Fake) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// WaitTickers - block until at least n tickers are pending, e.g. until the processes of a run have
+// set their tickers, before advancing the clock
+func (c *Fake) WaitTickers(n int) {
+	for c.tickers() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (c *Fake) tickers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := 0
+	for _, w := range c.waiters {
+		if w.period > 0 {
+			result++
+		}
+	}
+	return result
+}
+
+// Advance - move the clock forward by the duration, firing the timers & tickers on the way in the
+// order they are due. The processes settle after every firing (see SetSettle), so that e.g. a
+// timeout set in response to a tick is fired in the same Advance
+func (c *Fake) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		if len(c.waiters) == 0 || c.waiters[0].at.After(end) {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		w := c.waiters[0]
+		c.now = w.at
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			c.seq++
+			w.seq = c.seq
+			c.sort()
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+		now := c.now
+		settle := c.settle
+		c.mu.Unlock()
+
+		w.fire(now)
+		if settle != nil {
+			settle()
+		} else {
+			runtime.Gosched()
+		}
+	}
+}
+
+func (c *Fake) add(d time.Duration, period time.Duration, ch chan time.Time, f func()) *waiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	w := &waiter{clock: c, at: c.now.Add(d), seq: c.seq, period: period, ch: ch, f: f}
+	c.waiters = append(c.waiters, w)
+	c.sort()
+	return w
+}
+
+func (c *Fake) sort() {
+	sort.Slice(c.waiters, func(i, j int) bool {
+		if c.waiters[i].at.Equal(c.waiters[j].at) {
+			return c.waiters[i].seq < c.waiters[j].seq
+		}
+		return c.waiters[i].at.Before(c.waiters[j].at)
+	})
+}
+
+// remove - false if the waiter is not pending
+func (c *Fake) remove(w *waiter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *waiter) fire(now time.Time) {
+	if w.f != nil {
+		go w.f()
+		return
+	}
+	// as a time.Ticker, drop the tick if the previous one was not received
+	select {
+	case w.ch <- now:
+	default:
+	}
+}
+
+func (w *waiter) Stop() bool {
+	return w.clock.remove(w)
+}
+
+type fakeTicker struct {
+	w *waiter
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t fakeTicker) Stop() {
+	t.w.Stop()
+}
@@ -0,0 +1,136 @@
+package clock
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake(t *testing.T) {
+	Convey("Given a fake clock", t, func() {
+		c := NewFake(epoch)
+
+		Convey("it stands still until it is advanced", func() {
+			So(c.Now(), ShouldEqual, epoch)
+			c.Advance(time.Second)
+			So(c.Now(), ShouldEqual, epoch.Add(time.Second))
+		})
+
+		Convey("After fires once the duration has elapsed", func() {
+			ch := c.After(time.Second)
+			c.Advance(999 * time.Millisecond)
+			So(ch, ShouldBeEmpty)
+			c.Advance(time.Millisecond)
+			So(<-ch, ShouldEqual, epoch.Add(time.Second))
+			So(c.Waiters(), ShouldEqual, 0)
+		})
+
+		Convey("AfterFunc calls the func unless it is stopped", func() {
+			called := make(chan time.Time, 1)
+			c.AfterFunc(time.Second, func() { called <- c.Now() })
+			stopped := c.AfterFunc(time.Second, func() { called <- epoch })
+			So(stopped.Stop(), ShouldBeTrue)
+			So(stopped.Stop(), ShouldBeFalse)
+			c.Advance(2 * time.Second)
+			select {
+			case at := <-called:
+				So(at, ShouldHappenOnOrAfter, epoch.Add(time.Second))
+			case <-time.After(time.Second):
+				So("AfterFunc was not called", ShouldBeEmpty)
+			}
+			So(called, ShouldBeEmpty)
+		})
+
+		Convey("a ticker ticks every period, in order with the timers", func() {
+			ticker := c.NewTicker(100 * time.Millisecond)
+			timer := c.After(150 * time.Millisecond)
+			c.Advance(100 * time.Millisecond)
+			So(<-ticker.C(), ShouldEqual, epoch.Add(100*time.Millisecond))
+			c.Advance(100 * time.Millisecond)
+			So(<-timer, ShouldEqual, epoch.Add(150*time.Millisecond))
+			So(<-ticker.C(), ShouldEqual, epoch.Add(200*time.Millisecond))
+
+			Convey("dropping the ticks of a slow receiver", func() {
+				c.Advance(time.Second)
+				So(<-ticker.C(), ShouldEqual, epoch.Add(300*time.Millisecond))
+				So(ticker.C(), ShouldBeEmpty)
+			})
+
+			Convey("until it is stopped", func() {
+				ticker.Stop()
+				c.Advance(time.Second)
+				So(ticker.C(), ShouldBeEmpty)
+				So(c.Waiters(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("Sleep advances it", func() {
+			ch := c.After(time.Minute)
+			Sleep(c, time.Hour)
+			So(c.Now(), ShouldEqual, epoch.Add(time.Hour))
+			So(<-ch, ShouldEqual, epoch.Add(time.Minute))
+			So(Since(c, epoch), ShouldEqual, time.Hour)
+		})
+	})
+}
+
+func TestReal(t *testing.T) {
+	Convey("Given the real clock", t, func() {
+		c := OrReal(nil)
+
+		Convey("Sleep blocks for the duration", func() {
+			start := c.Now()
+			Sleep(c, 10*time.Millisecond)
+			So(Since(c, start), ShouldBeGreaterThanOrEqualTo, 10*time.Millisecond)
+		})
+
+		Convey("a ticker ticks", func() {
+			ticker := c.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			So(<-ticker.C(), ShouldHappenAfter, time.Time{})
+		})
+	})
+}
+
+func TestSkewed(t *testing.T) {
+	Convey("Given a clock skewed off a fake clock", t, func() {
+		base := NewFake(epoch)
+		c := NewSkewed(base)
+
+		Convey("it reads the time of the base clock until it is skewed", func() {
+			base.Advance(time.Second)
+			So(c.Now(), ShouldEqual, epoch.Add(time.Second))
+			So(c.Offset(), ShouldEqual, 0)
+		})
+
+		Convey("once skewed ahead at twice the rate", func() {
+			c.Skew(100*time.Millisecond, 2)
+
+			Convey("it jumps ahead, and runs twice as fast", func() {
+				So(c.Now(), ShouldEqual, epoch.Add(100*time.Millisecond))
+				base.Advance(time.Second)
+				So(c.Now(), ShouldEqual, epoch.Add(2100*time.Millisecond))
+				So(c.Offset(), ShouldEqual, 1100*time.Millisecond)
+			})
+
+			Convey("its timers fire in half the base time", func() {
+				fired := make(chan bool, 1)
+				c.AfterFunc(time.Second, func() { fired <- true })
+				base.Advance(500 * time.Millisecond)
+				So(<-fired, ShouldBeTrue)
+			})
+
+			Convey("it reads the base time again once restored", func() {
+				base.Advance(time.Second)
+				c.Skew(0, 1)
+				So(c.Now(), ShouldEqual, base.Now())
+			})
+		})
+
+		Convey("a non-positive rate is rejected", func() {
+			So(func() { c.Skew(0, 0) }, ShouldPanic)
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package clock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Skewed - a clock of a single process, which runs off a base clock but reads ahead of (or behind)
+// it, and runs faster (or slower) than it once skewed. Timers & tickers take the rate in effect
+// when they are set
+type Skewed struct {
+	base Clock
+
+	mu *sync.Mutex
+
+	// the base time at which the clock was last skewed, and the time the clock read then
+	since time.Time
+	at    time.Time
+
+	// the clock advances rate times as fast as the base clock
+	rate float64
+}
+
+// NewSkewed - a clock which reads the time of the base clock until it is skewed
+func NewSkewed(base Clock) *Skewed {
+	base = OrReal(base)
+	now := base.Now()
+	return &Skewed{base: base, mu: &sync.Mutex{}, since: now, at: now, rate: 1}
+}
+
+// Skew - from now on, the clock reads offset ahead of the base clock (behind if negative) and runs
+// rate times as fast as it. Skew(0, 1) sets the clock back to the time of the base clock
+func (s *Skewed) Skew(offset time.Duration, rate float64) {
+	if rate <= 0 {
+		panic(fmt.Sprintf("non-positive clock rate %v", rate))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.base.Now()
+	s.since, s.at, s.rate = now, now.Add(offset), rate
+}
+
+// Offset - how far the clock is ahead of the base clock, negative if it is behind
+func (s *Skewed) Offset() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.base.Now()
+	return s.now(now).Sub(now)
+}
+
+func (s *Skewed) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now(s.base.Now())
+}
+
+func (s *Skewed) now(base time.Time) time.Time {
+	return s.at.Add(time.Duration(float64(base.Sub(s.since)) * s.rate))
+}
+
+func (s *Skewed) After(d time.Duration) <-chan time.Time {
+	return s.base.After(s.scale(d))
+}
+
+func (s *Skewed) AfterFunc(d time.Duration, f func()) Timer {
+	return s.base.AfterFunc(s.scale(d), f)
+}
+
+func (s *Skewed) NewTicker(d time.Duration) Ticker {
+	return s.base.NewTicker(s.scale(d))
+}
+
+// scale - the base duration in which the clock advances by d
+func (s *Skewed) scale(d time.Duration) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d <= 0 || s.rate == 1 {
+		return d
+	}
+	if scaled := time.Duration(float64(d) / s.rate); scaled > 0 {
+		return scaled
+	}
+	return 1
+}
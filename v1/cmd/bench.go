@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/scenario"
+	"os"
+	"strings"
+)
+
+func benchCmd(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	rf := &runFlags{}
+	rf.register(fs)
+	runs := fs.Int("runs", 5, "number of runs, each with a consecutive seed")
+	compare := fs.String("compare", "",
+		"comma separated protocols to run the same scenario with, e.g. classic,raft; overrides -protocol")
+	// per-request logs drown the benchmark output
+	_ = fs.Set("log-level", "error")
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := rf.apply(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	s, err := rf.resolve(fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+
+	protocols := []string{s.Cluster.Protocol}
+	if *compare != "" {
+		protocols = strings.Split(*compare, ",")
+	}
+
+	code := ExitOK
+	seed := s.Seed
+	fmt.Printf("%-10s %-8s %-10s %-12s %-14s %-11s %s\n",
+		"protocol", "seed", "decided", "decided/s", "latency(ms)", "recoveries", "failures")
+	for _, protocol := range protocols {
+		s.Cluster.Protocol = strings.TrimSpace(protocol)
+		if err := s.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		p, _ := env.ParseProtocol(s.Cluster.Protocol)
+		for i := 0; i < *runs; i++ {
+			s.Seed = seed + int64(i)
+			registry := metrics.NewRegistry()
+			result, err := scenario.Run(s, scenario.WithMetrics(registry))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return ExitError
+			}
+			decided := -1
+			for _, n := range result.Decisions {
+				if decided < 0 || n < decided {
+					decided = n
+				}
+			}
+			rate := float64(decided) / s.Duration.Seconds()
+			latency, requests := registry.Total("paxos_client_latency_seconds")
+			if requests > 0 {
+				latency = latency / float64(requests) * 1000
+			}
+			fmt.Printf("%-10s %-8d %-10d %-12.1f %-14.1f %-11.0f %d\n",
+				p, s.Seed, decided, rate, latency, recoveries(registry), len(result.Failures))
+			if !result.Passed() {
+				code = ExitViolation
+			}
+		}
+	}
+	return code
+}
+
+// recoveries - the number of times the protocol had to recover from a failure or a
+// collision: fast round recoveries, EPaxos explicit prepares & Raft elections after the first
+func recoveries(registry *metrics.Registry) float64 {
+	fast, _ := registry.Total("paxos_fast_recoveries_total")
+	prepares, _ := registry.Total("epaxos_recoveries_total")
+	elections, _ := registry.Total("raft_elections_total")
+	if elections > 0 {
+		elections--
+	}
+	return fast + prepares + elections
+}
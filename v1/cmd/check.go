@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/scenario"
+	"os"
+)
+
+func checkCmd(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: paxossim check <scenario-file>...\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return ExitError
+	}
+
+	code := ExitOK
+	for _, path := range fs.Args() {
+		s, err := scenario.Load(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid: %v\n", err)
+			code = ExitError
+			continue
+		}
+		fmt.Printf("ok: %s (%s)\n", path, s.Name)
+	}
+	return code
+}
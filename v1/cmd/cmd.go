@@ -1,30 +1,103 @@
 package main
 
 import (
-	"github.com/1xyz/paxossim/v1/env"
+	"flag"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"os"
-	"time"
 )
 
+// Exit codes of the simulator
 const (
-	NClients  = 2
-	NFailures = 1
+	// the run completed and all invariants held
+	ExitOK = 0
+
+	// the run completed but an invariant or assertion did not hold
+	ExitViolation = 1
+
+	// the simulator could not be run, e.g. bad flags or an invalid scenario
+	ExitError = 2
 )
 
+type command struct {
+	name string
+
+	usage string
+
+	run func(args []string) int
+}
+
+var commands = []command{
+	{name: "run", usage: "run a simulation from flags or a scenario file", run: runCmd},
+	{name: "replay", usage: "re-run a previously recorded run from its output directory", run: replayCmd},
+	{name: "check", usage: "validate scenario files without running them", run: checkCmd},
+	{name: "bench", usage: "run a simulation repeatedly across seeds and report throughput", run: benchCmd},
+	{name: "diagram", usage: "draw a message sequence diagram of a recorded run", run: diagramCmd},
+	{name: "model", usage: "exhaustively check the message orders of a small cluster", run: modelCmd},
+	{name: "property", usage: "run random clusters, workloads & faults, and shrink a failing case", run: propertyCmd},
+	{name: "nemesis", usage: "run a cluster under composed nemeses and check its history", run: nemesisCmd},
+}
+
 func init() {
-	// Log as JSON instead of the default ASCII formatter.
-	// log.SetFormatter(&log.JSONFormatter{})
 	log.SetFormatter(&log.TextFormatter{})
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.InfoLevel)
 }
 
 func main() {
-	e := env.NewEnv(NFailures, NClients)
-	log.Debug("Constructed environment")
-	e.Run()
-	time.Sleep(10 * time.Second)
-	e.Stop()
-	time.Sleep(1000 * time.Second)
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return ExitError
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	}
+	usage()
+	return ExitError
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: paxossim <command> [flags]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun 'paxossim <command> -h' for the flags of a command\n")
+}
+
+// logFlags - logging flags shared by every command
+type logFlags struct {
+	level string
+
+	format string
+}
+
+func (lf *logFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&lf.level, "log-level", "info", "log level: panic, fatal, error, warn, info, debug or trace")
+	fs.StringVar(&lf.format, "log-format", "text", "log format: text or json")
+}
+
+func (lf *logFlags) apply() error {
+	level, err := log.ParseLevel(lf.level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	switch lf.format {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q", lf.format)
+	}
+	return nil
 }
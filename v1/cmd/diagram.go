@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/trace"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var diagramFormats = map[string]func(w io.Writer, entries []trace.Entry) error{
+	"mermaid":  trace.Mermaid,
+	"plantuml": trace.PlantUML,
+	"svg":      trace.SVG,
+}
+
+func diagramCmd(args []string) int {
+	fs := flag.NewFlagSet("diagram", flag.ContinueOnError)
+	dir := fs.String("dir", "", "output directory of a previous run, containing "+traceFile)
+	tracePath := fs.String("trace", "", "trace file of a previous run; overrides -dir")
+	format := fs.String("format", "mermaid", "diagram format: mermaid, plantuml or svg")
+	from := fs.Uint64("from", 0, "first step included in the diagram")
+	to := fs.Uint64("to", 0, "last step included in the diagram; zero includes every step after -from")
+	out := fs.String("o", "", "output file; defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	path := *tracePath
+	if path == "" && *dir != "" {
+		path = filepath.Join(*dir, traceFile)
+	}
+	render, ok := diagramFormats[*format]
+	if path == "" || !ok {
+		fmt.Fprintln(os.Stderr, "diagram requires -dir or -trace, and a -format of mermaid, plantuml or svg")
+		return ExitError
+	}
+
+	entries, err := trace.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := render(w, trace.Window(entries, *from, *to)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	return ExitOK
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/modelcheck"
+	"github.com/1xyz/paxossim/v1/scenario"
+	"github.com/1xyz/paxossim/v1/trace"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func modelCmd(args []string) int {
+	fs := flag.NewFlagSet("model", flag.ContinueOnError)
+	lf := &logFlags{}
+	lf.register(fs)
+	cfg := modelcheck.DefaultConfig()
+	fs.IntVar(&cfg.Failures, "failures", cfg.Failures, "acceptor failures tolerated; the cluster has 2f+1 acceptors")
+	fs.IntVar(&cfg.Leaders, "leaders", cfg.Leaders, "number of leaders; more than one requires -max-depth")
+	fs.IntVar(&cfg.Replicas, "replicas", cfg.Replicas, "number of replicas")
+	fs.IntVar(&cfg.Commands, "commands", cfg.Commands, "commands requested by the client, each sent to every replica")
+	fs.IntVar(&cfg.Drops, "drops", cfg.Drops, "messages which may be lost along a path")
+	fs.IntVar(&cfg.Duplicates, "duplicates", cfg.Duplicates, "messages which may be delivered twice along a path")
+	fs.IntVar(&cfg.Crashes, "crashes", cfg.Crashes, "acceptors, leaders & replicas which may crash along a path")
+	fs.IntVar(&cfg.MaxDepth, "max-depth", cfg.MaxDepth, "paths are cut off after this many transitions; zero for no bound")
+	fs.IntVar(&cfg.MaxStates, "max-states", cfg.MaxStates, "stop after visiting this many states; zero for no bound")
+	byz := fs.String("byzantine", "",
+		"comma separated Byzantine processes, e.g. leader:0=conflicting_proposals")
+	out := fs.String("out", "", "directory the counterexample is written to, as "+traceFile)
+	verbose := fs.Bool("v", false, "print the deliveries of the counterexample")
+	// every replica logs the commands it performs, along every path
+	_ = fs.Set("log-level", "warn")
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := lf.apply(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	behaviors, err := parseBehaviors(*byz)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	cfg.Byzantine = behaviors
+
+	result, err := modelcheck.Check(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	fmt.Printf("states %d transitions %d complete %v\n", result.States, result.Transitions, result.Complete)
+	if len(result.Violations) == 0 {
+		return ExitOK
+	}
+
+	for _, v := range result.Violations {
+		log.Errorf("invariant violated: %v", v)
+	}
+	if *verbose {
+		for _, e := range result.Counterexample {
+			fmt.Println(e)
+		}
+	}
+	if *out != "" {
+		if err := writeCounterexample(filepath.Join(*out, traceFile), result.Counterexample); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		log.Infof("counterexample of %d deliveries written to %s", len(result.Counterexample), *out)
+	}
+	return ExitViolation
+}
+
+// parseBehaviors - the behaviors of "<type>:<index>=<behavior>,..."
+func parseBehaviors(s string) (map[v1.Addr]string, error) {
+	result := make(map[v1.Addr]string)
+	if s == "" {
+		return result, nil
+	}
+	for _, spec := range strings.Split(s, ",") {
+		parts := strings.Split(spec, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid Byzantine process %q, expected <type>:<index>=<behavior>", spec)
+		}
+		target, err := scenario.ParseTarget(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		if target.IsCoordinator() {
+			return nil, fmt.Errorf("invalid Byzantine process %q, the coordinator is not a process", spec)
+		}
+		result[v1.NewAddress(v1.ProcessID(target.Index), target.ProcessType())] = strings.TrimSpace(parts[1])
+	}
+	return result, nil
+}
+
+func writeCounterexample(path string, entries []trace.Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	fw, err := trace.CreateFile(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := fw.Record(e); err != nil {
+			fw.Close()
+			return err
+		}
+	}
+	return fw.Close()
+}
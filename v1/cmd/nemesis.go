@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/nemesis"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// reportFile - the report of a run under nemeses, in the output directory
+const reportFile = "report.json"
+
+func nemesisCmd(args []string) int {
+	fs := flag.NewFlagSet("nemesis", flag.ContinueOnError)
+	rf := &runFlags{}
+	rf.register(fs)
+	names := fs.String("nemesis", strings.Join(nemesis.Names(), ","),
+		"comma separated nemeses, composed into one: "+strings.Join(nemesis.Names(), ", "))
+	every := fs.Duration("nemesis-interval", 2*time.Second, "the nemesis is started and stopped in turn, every interval")
+	_ = fs.Set("log-level", "warn")
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := rf.apply(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	s, err := rf.resolve(fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	n, err := nemesis.Parse(*names)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+
+	// the nemeses replace the timeline of a scenario
+	faults := nemesis.Alternate(n, *every, s.Duration.Duration)
+	report := nemesis.Test(s.Config(rf.options()...), faults, s.Duration.Duration, s.Seed)
+	report.Write(os.Stdout)
+	if rf.out != "" {
+		if err := os.MkdirAll(rf.out, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		if err := writeJSON(filepath.Join(rf.out, reportFile), report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+	}
+	if !report.Passed() {
+		return ExitViolation
+	}
+	return ExitOK
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/property"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func propertyCmd(args []string) int {
+	fs := flag.NewFlagSet("property", flag.ContinueOnError)
+	lf := &logFlags{}
+	lf.register(fs)
+	g := property.DefaultGenerator()
+	cases := fs.Int("cases", 100, "number of cases to generate")
+	seed := fs.Int64("seed", 1, "seed the cases are drawn from")
+	fs.IntVar(&g.MaxFailures, "max-failures", g.MaxFailures, "most acceptor failures tolerated by a cluster")
+	fs.IntVar(&g.MaxLeaders, "max-leaders", g.MaxLeaders, "most leaders of a cluster")
+	fs.IntVar(&g.MaxReplicas, "max-replicas", g.MaxReplicas, "most replicas of a cluster")
+	fs.IntVar(&g.MaxCommands, "max-commands", g.MaxCommands, "most commands requested by the client")
+	fs.IntVar(&g.MaxDrops, "max-drops", g.MaxDrops, "most messages lost in a case")
+	fs.IntVar(&g.MaxDuplicates, "max-duplicates", g.MaxDuplicates, "most messages delivered twice in a case")
+	fs.IntVar(&g.MaxCrashes, "max-crashes", g.MaxCrashes, "most processes crashed in a case")
+	fs.IntVar(&g.MaxSteps, "max-steps", g.MaxSteps, "most transitions of a case")
+	byz := fs.String("byzantine", "",
+		"comma separated behaviors, one of which is assigned to a process of half of the cases, e.g. conflicting_proposals")
+	out := fs.String("out", "", "directory the trace of the shrunk case is written to, as "+traceFile)
+	verbose := fs.Bool("v", false, "print the transitions of the shrunk case")
+	// every replica logs the commands it performs, in every case
+	_ = fs.Set("log-level", "warn")
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := lf.apply(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	if *byz != "" {
+		for _, name := range strings.Split(*byz, ",") {
+			g.Behaviors = append(g.Behaviors, strings.TrimSpace(name))
+		}
+	}
+
+	report, err := property.Check(g, *seed, *cases)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	fmt.Printf("cases %d transitions %d\n", report.Cases, report.Transitions)
+	f := report.Failure
+	if f == nil {
+		return ExitOK
+	}
+
+	log.Errorf("case failed: %v", f)
+	for _, v := range f.Violations {
+		log.Errorf("invariant violated: %v", v)
+	}
+	if *verbose {
+		for _, t := range f.Schedule {
+			fmt.Println(t)
+		}
+	}
+	if *out != "" {
+		if err := writeCounterexample(filepath.Join(*out, traceFile), f.Trace); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		log.Infof("trace of the shrunk case written to %s", *out)
+	}
+	return ExitViolation
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/replay"
+	"github.com/1xyz/paxossim/v1/trace"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+)
+
+func replayCmd(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	lf := &logFlags{}
+	lf.register(fs)
+	dir := fs.String("dir", "", "output directory of a previous run, containing "+traceFile)
+	tracePath := fs.String("trace", "", "trace file of a previous run; overrides -dir")
+	verbose := fs.Bool("v", false, "print every delivery as it is replayed")
+	until := fs.Uint64("until", 0, "stop after the delivery with this step; zero replays the entire trace")
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := lf.apply(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	path := *tracePath
+	if path == "" && *dir != "" {
+		path = filepath.Join(*dir, traceFile)
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "replay requires -dir or -trace")
+		return ExitError
+	}
+
+	entries, err := trace.Load(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	r, err := replay.New(entries)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	defer r.Close()
+
+	delivered := 0
+	for {
+		e, ok, err := r.Step()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		if !ok {
+			break
+		}
+		delivered++
+		if *verbose {
+			fmt.Println(e)
+		}
+		if *until != 0 && e.Step >= *until {
+			break
+		}
+	}
+
+	logs := r.DecisionLogs()
+	for _, l := range logs {
+		log.Infof("replica %v decided %d slots", l.Replica, len(l.Decisions))
+	}
+	violations := invariant.CheckDecisions(logs)
+	for _, v := range violations {
+		log.Errorf("invariant violated: %v", v)
+	}
+	log.Infof("replayed %d deliveries", delivered)
+	if len(violations) > 0 {
+		return ExitViolation
+	}
+	return ExitOK
+}
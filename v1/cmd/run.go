@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/dashboard"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/quorum"
+	"github.com/1xyz/paxossim/v1/scenario"
+	"github.com/1xyz/paxossim/v1/shard"
+	"github.com/1xyz/paxossim/v1/trace"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	scenarioFile = "scenario.json"
+	resultFile   = "result.json"
+	traceFile    = "trace.jsonl"
+	metricsFile  = "metrics.txt"
+	eventsFile   = "events.jsonl"
+)
+
+// runFlags - flags describing a simulation run
+type runFlags struct {
+	logFlags
+
+	failures int
+
+	protocol string
+
+	acceptors int
+
+	quorum string
+
+	groups int
+
+	partition string
+
+	clients int
+
+	keys int
+
+	interval time.Duration
+
+	seed int64
+
+	duration time.Duration
+
+	scenario string
+
+	out string
+
+	metricsAddr string
+
+	dashboardAddr string
+
+	logEvents bool
+
+	virtual bool
+}
+
+func (rf *runFlags) register(fs *flag.FlagSet) {
+	rf.logFlags.register(fs)
+	fs.IntVar(&rf.failures, "failures", 1, "number of failures tolerated by the cluster")
+	fs.StringVar(&rf.protocol, "protocol", "classic", "consensus protocol: classic, fast, epaxos, raft or cheap")
+	fs.IntVar(&rf.acceptors, "acceptors", 0, "number of acceptors; 2 * failures + 1 if zero")
+	fs.StringVar(&rf.quorum, "quorum", "majority",
+		"phase 1 & 2 quorums: majority, sizes:Q1,Q2, grid:ROWS or weighted:W1,W2,...")
+	fs.IntVar(&rf.groups, "groups", 1, "number of Paxos groups the keys are partitioned across")
+	fs.StringVar(&rf.partition, "partition", "hash", "partitioning of the keys across the groups: hash or range:B1,B2,...")
+	fs.IntVar(&rf.clients, "clients", 2, "number of clients")
+	fs.IntVar(&rf.keys, "keys", 0, "number of keys the clients write to; opaque commands if zero")
+	fs.DurationVar(&rf.interval, "interval", time.Second, "interval between requests of a client")
+	fs.Int64Var(&rf.seed, "seed", 1, "seed for the random decisions made by the network")
+	fs.DurationVar(&rf.duration, "duration", 10*time.Second, "duration of the run")
+	fs.StringVar(&rf.scenario, "scenario", "", "scenario file (.yaml, .yml or .json); overrides the cluster flags")
+	fs.StringVar(&rf.out, "out", "", "output directory for the scenario and result of the run")
+	fs.StringVar(&rf.metricsAddr, "metrics-addr", "",
+		"serve metrics at http://<addr>/metrics during the run, e.g. localhost:9090")
+	fs.StringVar(&rf.dashboardAddr, "dashboard-addr", "",
+		"serve a live dashboard at http://<addr>/ during the run, e.g. localhost:8080")
+	fs.BoolVar(&rf.logEvents, "log-events", false, "log every protocol event at the info level")
+	fs.BoolVar(&rf.virtual, "virtual", false,
+		"run in virtual time, as fast as the processes keep up; timeouts may expire before a slow process responds")
+}
+
+// options - the scenario options of the flags which apply to every run
+func (rf *runFlags) options() []scenario.Option {
+	if !rf.virtual {
+		return nil
+	}
+	return []scenario.Option{scenario.WithClock(clock.NewFake(time.Now()))}
+}
+
+// resolve - the scenario to run; explicitly set flags override the scenario file
+func (rf *runFlags) resolve(fs *flag.FlagSet) (*scenario.Scenario, error) {
+	spec, err := quorum.ParseSpec(rf.quorum)
+	if err != nil {
+		return nil, err
+	}
+	partition, err := shard.ParseSpec(rf.partition)
+	if err != nil {
+		return nil, err
+	}
+	if rf.scenario == "" {
+		s := &scenario.Scenario{
+			Name:     "cli",
+			Seed:     rf.seed,
+			Duration: scenario.Duration{Duration: rf.duration},
+			Cluster: scenario.Cluster{
+				Failures:  rf.failures,
+				Protocol:  rf.protocol,
+				Acceptors: rf.acceptors,
+				Quorum:    spec,
+				Groups:    rf.groups,
+				Partition: partition,
+			},
+			Workload: scenario.Workload{
+				Clients:         rf.clients,
+				RequestInterval: scenario.Duration{Duration: rf.interval},
+				Keys:            rf.keys,
+			},
+			Assertions: scenario.Assertions{NoConflictingDecisions: true},
+		}
+		return s, s.Validate()
+	}
+
+	s, err := scenario.Load(rf.scenario)
+	if err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "failures":
+			s.Cluster.Failures = rf.failures
+		case "protocol":
+			s.Cluster.Protocol = rf.protocol
+		case "acceptors":
+			s.Cluster.Acceptors = rf.acceptors
+		case "quorum":
+			s.Cluster.Quorum = spec
+		case "groups":
+			s.Cluster.Groups = rf.groups
+		case "partition":
+			s.Cluster.Partition = partition
+		case "clients":
+			s.Workload.Clients = rf.clients
+		case "keys":
+			s.Workload.Keys = rf.keys
+		case "interval":
+			s.Workload.RequestInterval.Duration = rf.interval
+		case "seed":
+			s.Seed = rf.seed
+		case "duration":
+			s.Duration.Duration = rf.duration
+		}
+	})
+	return s, s.Validate()
+}
+
+func runCmd(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	rf := &runFlags{}
+	rf.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return ExitError
+	}
+	if err := rf.apply(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	s, err := rf.resolve(fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	return runScenario(s, rf)
+}
+
+// runScenario - run the scenario, report & persist the result and map it to an exit code
+func runScenario(s *scenario.Scenario, rf *runFlags) int {
+	out, metricsAddr, dashboardAddr := rf.out, rf.metricsAddr, rf.dashboardAddr
+	if out != "" {
+		if err := os.MkdirAll(out, 0755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		if err := writeJSON(filepath.Join(out, scenarioFile), s); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	opts := append(rf.options(), scenario.WithMetrics(registry))
+	if metricsAddr != "" {
+		srv, err := metrics.Serve(metricsAddr, registry)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		defer srv.Close()
+		log.Infof("serving metrics at http://%s/metrics", srv.Addr)
+	}
+	sinks := make([]trace.Sink, 0)
+	if out != "" {
+		tw, err := trace.CreateFile(filepath.Join(out, traceFile))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		defer tw.Close()
+		sinks = append(sinks, tw)
+	}
+	eventSinks := make([]events.Sink, 0)
+	if out != "" {
+		f, err := os.Create(filepath.Join(out, eventsFile))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		defer f.Close()
+		buf := bufio.NewWriter(f)
+		defer buf.Flush()
+		eventSinks = append(eventSinks, events.NewWriter(buf))
+	}
+	if rf.logEvents {
+		eventSinks = append(eventSinks, events.NewLogger(log.InfoLevel))
+	}
+	if len(eventSinks) > 0 {
+		opts = append(opts, scenario.WithEvents(events.Tee(eventSinks...)))
+	}
+
+	var feed *dashboard.Feed
+	if dashboardAddr != "" {
+		feed = dashboard.NewFeed()
+		sinks = append(sinks, feed)
+	}
+	if len(sinks) > 0 {
+		opts = append(opts, scenario.WithTrace(trace.Tee(sinks...)))
+	}
+
+	e := s.NewEnv(opts...)
+	if dashboardAddr != "" {
+		srv, err := dashboard.Serve(dashboardAddr, dashboard.New(e, feed))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		defer srv.Close()
+		log.Infof("serving the dashboard at http://%s/", srv.Addr)
+	}
+
+	result, err := scenario.RunEnv(s, e)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitError
+	}
+	report(result)
+	reportStatus(s.Name, e.Status())
+
+	if out != "" {
+		if err := writeJSON(filepath.Join(out, resultFile), result); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+		if err := writeMetrics(filepath.Join(out, metricsFile), registry); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitError
+		}
+	}
+	if !result.Passed() {
+		return ExitViolation
+	}
+	return ExitOK
+}
+
+func report(result *scenario.Result) {
+	ctxLog := log.WithFields(log.Fields{"Scenario": result.Scenario})
+	for replica, n := range result.Decisions {
+		ctxLog.Infof("replica %v decided %d slots", replica, n)
+	}
+	for _, failure := range result.Failures {
+		ctxLog.Errorf("assertion failed: %s", failure)
+	}
+	if !result.ExpectViolations {
+		for _, v := range result.Violations {
+			ctxLog.Errorf("invariant violated: %v", v)
+		}
+	}
+	if result.Passed() {
+		ctxLog.Infof("all assertions held")
+	}
+}
+
+// reportStatus - log the final state of the leaders and replicas
+func reportStatus(name string, status env.Status) {
+	ctxLog := log.WithFields(log.Fields{"Scenario": name})
+	for _, l := range status.Leaders {
+		ctxLog.Infof("leader %v ballot %v active %v proposals %d", l.Addr, l.BallotNumber, l.Active, l.Proposals)
+	}
+	for _, r := range status.Replicas {
+		ctxLog.Infof("replica %v slot_in %d slot_out %d pending requests %d proposals %d",
+			r.Addr, r.SlotIn, r.SlotOut, r.Requests, len(r.Proposals))
+	}
+}
+
+func writeMetrics(path string, r *metrics.Registry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.WriteText(f)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// lyingAcceptor - a scenario which decides conflicting commands, without asserting anything
+const lyingAcceptor = `name: lying-acceptor
+seed: 1
+duration: 2s
+cluster:
+  failures: 1
+workload:
+  clients: 3
+  request_interval: 5ms
+network:
+  min_delay: 1ms
+  max_delay: 5ms
+timeline:
+  - at: 100ms
+    action: byzantine
+    target: acceptor:0
+    behavior: lie_about_ballot
+  - at: 200ms
+    action: partition
+    groups: [[leader:0, acceptor:1], [leader:1, acceptor:2]]
+assertions: {}
+`
+
+func TestRunCmd_Violations(t *testing.T) {
+	Convey("Given a scenario without assertions whose run violates an invariant", t, func() {
+		dir, err := ioutil.TempDir("", "paxossim")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "lying_acceptor.yaml")
+		So(ioutil.WriteFile(path, []byte(lyingAcceptor), 0644), ShouldBeNil)
+
+		Convey("the run exits with ExitViolation", func() {
+			So(dispatch([]string{"run", "-scenario", path, "-virtual"}), ShouldEqual, ExitViolation)
+		})
+	})
+}
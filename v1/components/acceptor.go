@@ -2,34 +2,84 @@ package components
 
 import (
 	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
 	"github.com/1xyz/paxossim/v1/messages"
 	"github.com/1xyz/paxossim/v1/types"
 	log "github.com/sirupsen/logrus"
+	"sync"
 )
 
-var acceptorCount = 0
-
 type Acceptor struct {
 	v1.Process
 
+	AcceptorState
+
 	exchange v1.MessageExchange
 
+	// guards the acceptor's state against concurrent readers
+	mu *sync.Mutex
+
+	events events.Sink
+}
+
+// AcceptorState - the state of an acceptor, transitioned by Step
+type AcceptorState struct {
+	// the acceptor's address, the source of its messages
+	self v1.Addr
+
 	// Set of PValues accepted so far
 	Accepted types.PValues
 
 	// Last Adopted ballot number
 	BN *types.BallotNumber
-}
 
-func NewAcceptor(exchange v1.MessageExchange) *Acceptor {
-	processId := v1.ProcessID(acceptorCount)
-	acceptorCount++
+	// Fast Paxos: the ballot of the open fast round, if any
+	anyBN *types.BallotNumber
 
-	a := &Acceptor{
-		Process:  v1.NewProcess(processId, v1.Acceptor),
+	// Fast Paxos: the slot the next client command is accepted in
+	nextFastSlot types.Slot
+
+	// Fast Paxos: the commands accepted in the open fast round
+	fastAccepted map[types.Command]bool
+
+	// Fast Paxos: client commands received while no fast round is open
+	pending []types.Command
+}
+
+// NewAcceptorState - the state of an acceptor which adopted no ballot yet
+func NewAcceptorState(self v1.Addr) AcceptorState {
+	return AcceptorState{
+		self:     self,
 		Accepted: make(types.PValues),
 		BN:       nil,
-		exchange: exchange,
+	}
+}
+
+// Copy - a copy of the state, sharing nothing which a step changes
+func (s AcceptorState) Copy() AcceptorState {
+	result := s
+	result.Accepted = s.Accepted.Copy()
+	if s.fastAccepted != nil {
+		result.fastAccepted = make(map[types.Command]bool, len(s.fastAccepted))
+		for command := range s.fastAccepted {
+			result.fastAccepted[command] = true
+		}
+	}
+	result.pending = append([]types.Command(nil), s.pending...)
+	return result
+}
+
+func NewAcceptor(exchange v1.MessageExchange, opts ...Option) *Acceptor {
+	o := newOptions(opts)
+	processId := v1.AllocateID(exchange, v1.Acceptor)
+
+	p := o.newProcess(processId, v1.Acceptor)
+	a := &Acceptor{
+		Process:       p,
+		AcceptorState: NewAcceptorState(p.GetAddr()),
+		exchange:      exchange,
+		mu:            &sync.Mutex{},
+		events:        o.events,
 	}
 	log.Debugf("Created acceptor")
 
@@ -47,54 +97,65 @@ func (accp *Acceptor) Run() {
 
 	for {
 		msg, err := accp.Process.Recv()
+		if err == v1.ErrProcessClosed {
+			ctxLog.Debugf("process closed")
+			return
+		}
 		if err != nil {
 			ctxLog.Panicf("error in inbox recv %v", err)
 		}
 
-		accp.handleMessage(msg)
+		accp.Handle(msg)
 	}
 }
 
-func (accp *Acceptor) handleMessage(message v1.Message) {
-	ctxLog := log.WithFields(log.Fields{"Addr": accp.GetAddr(), "Method": "Acceptor.handleMessage"})
+// Handle - synchronously process a single message, as Run does for every message in the inbox
+func (accp *Acceptor) Handle(message v1.Message) {
+	accp.mu.Lock()
+	defer accp.mu.Unlock()
+	carryOut(accp.exchange, accp.events, accp.Step(message))
+}
+
+// Step - transition the state on the message
+func (s *AcceptorState) Step(message v1.Message) Effects {
+	ctxLog := log.WithFields(log.Fields{"Addr": s.self, "Method": "Acceptor.Step"})
 	ctxLog.Debugf("Recd a message of type %T", message)
+	eff := Effects{}
 	switch v := message.(type) {
 	case messages.Phase1aMessage:
-		phase1aMessage := message.(messages.Phase1aMessage)
-		ctxLog.Debugf("ReceivedMessage %T", phase1aMessage)
-		if accp.BN == nil || types.Compare(&phase1aMessage.BallotNumber, accp.BN) > 0 {
-			ctxLog.Debugf("Adopting ballot %v", phase1aMessage.BallotNumber)
-			accp.BN = &phase1aMessage.BallotNumber
+		if s.BN == nil || types.Compare(&v.BallotNumber, s.BN) > 0 {
+			ctxLog.Debugf("Adopting ballot %v", v.BallotNumber)
+			bn := v.BallotNumber
+			s.BN = &bn
 		}
 
-		phase1bMessage := messages.NewPhase1bMessage(accp.GetAddr(), *accp.BN, accp.Accepted)
-		err := accp.exchange.Send(phase1aMessage.Src(), phase1bMessage)
-		if err != nil {
-			log.Debugf("accp.exchange.send failed %v", err)
-		}
-
-		return
+		// send a copy, the message may be read while this acceptor accepts more values
+		eff.reply(v.Src(), messages.NewPhase1bMessage(s.self, *s.BN, s.Accepted.Copy()))
 
 	case messages.Phase2aMessage:
-		if accp.BN == nil {
-			log.Panicf("unexpected: acceptor.bn is nil")
+		if s.BN == nil {
+			// the acceptor promised no ballot yet, e.g. a Cheap Paxos auxiliary acceptor
+			// engaged by a commander
+			ctxLog.Debugf("Adopting ballot %v", v.PValue.BN)
+			bn := v.PValue.BN
+			s.BN = &bn
 		}
-
-		phase2aMessage := message.(messages.Phase2aMessage)
-		if types.Compare(accp.BN, &phase2aMessage.PValue.BN) == 0 {
-			ctxLog.Debugf("Accepted pvalue %v", phase2aMessage.PValue)
-			accp.Accepted.Set(phase2aMessage.PValue)
+		if types.Compare(s.BN, &v.PValue.BN) == 0 {
+			ctxLog.Debugf("Accepted pvalue %v", v.PValue)
+			s.Accepted.Set(v.PValue)
+			eff.emit(events.PValueAccepted{Acceptor: s.self, PValue: v.PValue})
 		}
 
-		phase2bMessage := messages.NewPhase2bMessage(accp.GetAddr(), *accp.BN)
-		err := accp.exchange.Send(phase2aMessage.Src(), phase2bMessage)
-		if err != nil {
-			log.Debugf("accp.exchange.send failed %v", err)
-		}
+		eff.reply(v.Src(), messages.NewPhase2bMessage(s.self, *s.BN))
+
+	case messages.Phase2aAnyMessage:
+		s.handlePhase2aAny(v, &eff)
 
-		return
+	case messages.FastProposeMessage:
+		s.handleFastPropose(v, &eff)
 
 	default:
 		ctxLog.Panicf("Unknown message type %v", v)
 	}
+	return eff
 }
@@ -3,14 +3,13 @@ package components
 import (
 	v1 "github.com/1xyz/paxossim/v1"
 	"github.com/1xyz/paxossim/v1/messages"
-	"github.com/1xyz/paxossim/v1/v1fakes"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 )
 
 func TestNewAcceptor(t *testing.T) {
 	Convey("Initializing a new Acceptor", t, func() {
-		acceptor := NewAcceptor(&v1fakes.FakeMessageExchange{})
+		acceptor := NewAcceptor(newFakeExchange())
 
 		Convey("returns a valid ptr", func() {
 			So(acceptor, ShouldNotBeNil)
@@ -20,14 +19,14 @@ func TestNewAcceptor(t *testing.T) {
 
 func TestAcceptor_Run_Phase1(t *testing.T) {
 	Convey("Given an acceptor", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		acceptor := NewAcceptor(exchange)
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		scout := newFakeAddr(fakeScoutID, v1.Scout)
 
 		Convey("Encounters a ballot for the first time from a scout", func() {
 			bn := newFakeBallot(10, leader)
-			acceptor.handleMessage(messages.NewPhase1aMessage(scout, bn))
+			acceptor.Handle(messages.NewPhase1aMessage(scout, bn))
 
 			Convey("the ballot is adopted", func() {
 				So(*acceptor.BN, ShouldResemble, bn)
@@ -46,7 +45,7 @@ func TestAcceptor_Run_Phase1(t *testing.T) {
 
 			Convey("Encounters an older ballot from a scout", func() {
 				olderBN := newFakeBallot(2, leader)
-				acceptor.handleMessage(messages.NewPhase1aMessage(scout, olderBN))
+				acceptor.Handle(messages.NewPhase1aMessage(scout, olderBN))
 
 				Convey("the ballot is not adopted", func() {
 					So(*acceptor.BN, ShouldNotResemble, olderBN)
@@ -67,7 +66,7 @@ func TestAcceptor_Run_Phase1(t *testing.T) {
 
 			Convey("Encounters a newer ballot from a scout", func() {
 				newerBN := newFakeBallot(20, leader)
-				acceptor.handleMessage(messages.NewPhase1aMessage(scout, newerBN))
+				acceptor.Handle(messages.NewPhase1aMessage(scout, newerBN))
 
 				Convey("the ballot is adopted", func() {
 					So(*acceptor.BN, ShouldResemble, newerBN)
@@ -91,19 +90,19 @@ func TestAcceptor_Run_Phase1(t *testing.T) {
 
 func TestAcceptor_Run_Phase2(t *testing.T) {
 	Convey("Given an acceptor", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		acceptor := NewAcceptor(exchange)
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		scout := newFakeAddr(fakeScoutID, v1.Scout)
 		cmdr := newFakeAddr(fakeCommanderID, v1.Commander)
 
 		bn := newFakeBallot(10, leader)
-		acceptor.handleMessage(messages.NewPhase1aMessage(scout, bn))
+		acceptor.Handle(messages.NewPhase1aMessage(scout, bn))
 
 		Convey("Encounters a phase2 request matching its adopted ballot", func() {
 			pValue := newFakePValue(10, leader)
 			phase2aMessage := messages.NewPhase2aMessage(cmdr, pValue)
-			acceptor.handleMessage(phase2aMessage)
+			acceptor.Handle(phase2aMessage)
 
 			Convey("the PValue is accepted", func() {
 				So(len(acceptor.Accepted), ShouldEqual, 1)
@@ -124,7 +123,7 @@ func TestAcceptor_Run_Phase2(t *testing.T) {
 		Convey("Encounters a phase2 request with not matching its adopted ballot", func() {
 			pValue := newFakePValue(20, leader)
 			phase2aMessage := messages.NewPhase2aMessage(cmdr, pValue)
-			acceptor.handleMessage(phase2aMessage)
+			acceptor.Handle(phase2aMessage)
 
 			Convey("the PValue is rejected", func() {
 				So(len(acceptor.Accepted), ShouldEqual, 0)
@@ -0,0 +1,157 @@
+package components
+
+// Cheap Paxos (Lamport & Massa, 2004).
+//
+// Of the 2f+1 acceptors only f+1 main acceptors take part in the protocol while there are
+// no failures; a quorum of the main acceptors is all of them. The f auxiliary acceptors are
+// engaged by a scout or a commander only when the main acceptors did not respond in time,
+// and complete a majority with the main acceptors which are still up. Every quorum is a
+// majority of all acceptors, so engaging the auxiliaries is always safe.
+//
+// The leader which learns of a failed main acceptor proposes a reconfiguration (a
+// ReConfigCommand with NewAcceptors) replacing it with an auxiliary acceptor. Once the
+// replicas apply it they let the leaders know, and the leaders go back to contacting the
+// main acceptors only. The auxiliaries receive no messages in the meantime, which shows in
+// paxos_messages_received_total.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	// AuxiliaryTimeout - time a scout or a commander waits for the main acceptors, before
+	// engaging the auxiliary acceptors
+	AuxiliaryTimeout = 50 * time.Millisecond
+
+	// ReconfigureRetry - time after which a leader proposes the reconfiguration of the main
+	// acceptors again, if the previous one has not been applied
+	ReconfigureRetry = 1 * time.Second
+)
+
+// engageMessage - sent by a scout or a commander to itself once AuxiliaryTimeout expires
+type engageMessage struct {
+	src v1.Addr
+}
+
+func (m engageMessage) Src() v1.Addr {
+	return m.src
+}
+
+// scheduleEngage - deliver an engageMessage to the process after AuxiliaryTimeout on the clock; the
+// returned timer is stopped by the process once it is done
+func scheduleEngage(p v1.Process, c clock.Clock) clock.Timer {
+	return c.AfterFunc(AuxiliaryTimeout, func() {
+		// discarded if the process is closed already
+		p.Send(engageMessage{src: p.GetAddr()})
+	})
+}
+
+// engageAuxiliaries - send the message to the auxiliary acceptors and wait for them as well. The
+// leader is told of the main acceptors which had not responded, unless report is false
+func engageAuxiliaries(eff *Effects, self v1.Addr, leader v1.Addr, bn types.BallotNumber,
+	m v1.Message, auxiliaries []v1.Addr, waitFor v1.AddrSet, report bool) {
+	missing := sortedAddrs(waitFor)
+	for _, aux := range auxiliaries {
+		eff.send(aux, m)
+		waitFor.Add(aux)
+	}
+	if !report {
+		return
+	}
+	eff.send(leader, messages.NewAuxiliariesEngagedMessage(self, bn, missing))
+}
+
+// handleAuxiliariesEngaged - a main acceptor may have failed; engage the auxiliaries right away until
+// the main acceptors are reconfigured, and propose the reconfiguration
+func (s *LeaderState) handleAuxiliariesEngaged(m messages.AuxiliariesEngagedMessage, now time.Time, eff *Effects) {
+	if types.Compare(&m.BallotNumber, &s.ballotNumber) != 0 {
+		return
+	}
+	main := make([]v1.Addr, 0, len(s.acceptors))
+	missing := make(v1.AddrSet)
+	for _, addr := range m.Missing {
+		missing.Add(addr)
+	}
+	for _, addr := range s.acceptors {
+		if !missing.Contains(addr) {
+			main = append(main, addr)
+		}
+	}
+	if len(main) == len(s.acceptors) {
+		// the missing acceptors were reconfigured to be auxiliaries already
+		return
+	}
+	eff.engagements++
+	s.engaged = true
+	if now.Sub(s.reconfiguredAt) < ReconfigureRetry {
+		return
+	}
+
+	// promote an auxiliary acceptor for every missing main acceptor
+	for _, aux := range s.auxiliaries {
+		if len(main) == len(s.acceptors) {
+			break
+		}
+		main = append(main, aux)
+	}
+
+	s.reconfigCount++
+	s.reconfiguredAt = now
+	command := &types.ReConfigCommand{
+		BasicCommand: types.BasicCommand{
+			ClientID:  fmt.Sprintf("%v", s.self),
+			CommandID: fmt.Sprintf("acceptors-%d", s.reconfigCount),
+			Op:        "RECONFIG",
+		},
+		NewAcceptors: main,
+	}
+	log.WithFields(log.Fields{"Addr": s.self}).Infof(
+		"main acceptors %v missing, proposing main acceptors %v", m.Missing, main)
+	eff.sendAll(v1.Replica, messages.NewRequestMessage(s.self, command))
+}
+
+// handleAcceptorConfig - switch to the main acceptors decided at the slot, unless a later
+// configuration was applied already
+func (s *LeaderState) handleAcceptorConfig(m messages.AcceptorConfigMessage) {
+	if m.Slot <= s.configSlot {
+		return
+	}
+	s.configSlot = m.Slot
+	main := make(v1.AddrSet)
+	for _, addr := range m.Acceptors {
+		main.Add(addr)
+	}
+	auxiliaries := make([]v1.Addr, 0, len(s.auxiliaries))
+	for _, addr := range append(append([]v1.Addr{}, s.auxiliaries...), s.acceptors...) {
+		if !main.Contains(addr) {
+			auxiliaries = append(auxiliaries, addr)
+		}
+	}
+	s.acceptors = append([]v1.Addr{}, m.Acceptors...)
+	s.auxiliaries = auxiliaries
+	s.engaged = false
+	s.reconfiguredAt = time.Time{}
+	log.WithFields(log.Fields{"Addr": s.self}).Infof(
+		"main acceptors %v, auxiliary acceptors %v", s.acceptors, s.auxiliaries)
+}
+
+// childOptions - the options of the requested scout or commander
+func (leader *Leader) childOptions(r SpawnRequest) []Option {
+	opts := []Option{WithQuorum(leader.quorum), WithAuxiliaryAcceptors(r.Auxiliaries), WithClock(leader.clock)}
+	if r.Engaged {
+		opts = append(opts, withAuxiliariesEngaged())
+	}
+	if r.Type == v1.Commander && leader.notifyClients {
+		opts = append(opts, WithClientNotifications())
+	}
+	if leader.inbox != nil {
+		opts = append(opts, WithInbox(*leader.inbox))
+	}
+	return opts
+}
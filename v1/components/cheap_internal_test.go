@@ -0,0 +1,132 @@
+package components
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/quorum"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCommander_EngagesAuxiliaries(t *testing.T) {
+	Convey("Given a commander contacting two main acceptors of three", t, func() {
+		exchange := newFakeExchange()
+		leader := newFakeAddr(fakeLeaderID, v1.Leader)
+		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
+		main, aux := acceptors[:2], acceptors[2:]
+		pValue := newFakePValue(1, leader)
+		cmdr := NewCommander(exchange, leader, main, pValue,
+			WithQuorum(quorum.NewMajority(acceptors)), WithAuxiliaryAcceptors(aux))
+
+		cmdr.Start()
+		responders := cmdr.waitFor
+		So(exchange.SendCallCount(), ShouldEqual, 2)
+		So(cmdr.Handle(messages.NewPhase2bMessage(main[1], pValue.BN)), ShouldBeTrue)
+
+		Convey("when a main acceptor does not respond the auxiliary acceptor is engaged", func() {
+			So(cmdr.Handle(engageMessage{src: cmdr.GetAddr()}), ShouldBeTrue)
+			So(responders.Contains(aux[0]), ShouldBeTrue)
+			So(exchange.SendCallCount(), ShouldEqual, 5)
+
+			addr, msg := exchange.SendArgsForCall(2)
+			So(addr, ShouldEqual, aux[0])
+			_, ok := msg.(messages.Phase1aMessage)
+			So(ok, ShouldBeTrue)
+			addr, msg = exchange.SendArgsForCall(3)
+			So(addr, ShouldEqual, aux[0])
+			_, ok = msg.(messages.Phase2aMessage)
+			So(ok, ShouldBeTrue)
+
+			Convey("and the leader is told of the missing main acceptor", func() {
+				addr, msg := exchange.SendArgsForCall(4)
+				So(addr, ShouldEqual, leader)
+				em, ok := msg.(messages.AuxiliariesEngagedMessage)
+				So(ok, ShouldBeTrue)
+				So(em.BallotNumber, ShouldResemble, pValue.BN)
+				So(em.Missing, ShouldResemble, []v1.Addr{main[0]})
+			})
+
+			Convey("and completes a majority with the remaining main acceptor", func() {
+				So(cmdr.Handle(messages.NewPhase2bMessage(aux[0], pValue.BN)), ShouldBeFalse)
+				So(exchange.SendAllCallCount(), ShouldEqual, 1)
+			})
+
+			Convey("an auxiliary acceptor which missed phase 1 of the ballot is sent it again", func() {
+				lower := newFakeBallot(0, leader)
+				So(cmdr.Handle(messages.NewPhase2bMessage(aux[0], lower)), ShouldBeTrue)
+				So(exchange.SendCallCount(), ShouldEqual, 7)
+				addr, msg := exchange.SendArgsForCall(5)
+				So(addr, ShouldEqual, aux[0])
+				_, ok := msg.(messages.Phase1aMessage)
+				So(ok, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestLeader_CheapPaxos(t *testing.T) {
+	Convey("Given a leader with two main acceptors and an auxiliary acceptor", t, func() {
+		exchange := newFakeExchange()
+		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
+		main, aux := acceptors[:2], acceptors[2:]
+		leader := NewLeader(exchange, main, WithAuxiliaryAcceptors(aux))
+		cmdr := newFakeAddr(fakeCommanderID, v1.Commander)
+		scoutOptions := func() options {
+			eff := Effects{}
+			leader.spawnScout(&eff)
+			return newOptions(leader.childOptions(eff.Spawns[0]))
+		}
+		So(scoutOptions().engaged, ShouldBeFalse)
+
+		Convey("when a commander reports a missing main acceptor", func() {
+			leader.Handle(messages.NewAuxiliariesEngagedMessage(cmdr, leader.ballotNumber, []v1.Addr{main[0]}))
+
+			Convey("its scouts & commanders engage the auxiliary acceptor right away", func() {
+				So(leader.engaged, ShouldBeTrue)
+				So(scoutOptions().engaged, ShouldBeTrue)
+			})
+
+			Convey("the replicas are requested to promote the auxiliary acceptor", func() {
+				So(exchange.SendAllCallCount(), ShouldEqual, 1)
+				pt, msg := exchange.SendAllArgsForCall(0)
+				So(pt, ShouldEqual, v1.Replica)
+				rm, ok := msg.(messages.RequestMessage)
+				So(ok, ShouldBeTrue)
+				rc, ok := rm.Command.(*types.ReConfigCommand)
+				So(ok, ShouldBeTrue)
+				So(rc.NewLeaders, ShouldBeNil)
+				So(rc.NewAcceptors, ShouldResemble, []v1.Addr{main[1], aux[0]})
+
+				Convey("once per retry interval", func() {
+					leader.Handle(messages.NewAuxiliariesEngagedMessage(cmdr, leader.ballotNumber, []v1.Addr{main[0]}))
+					So(exchange.SendAllCallCount(), ShouldEqual, 1)
+				})
+			})
+
+			Convey("the decided configuration replaces the main acceptors", func() {
+				replica := newFakeAddr(fakeLeaderID+50, v1.Replica)
+				leader.Handle(messages.NewAcceptorConfigMessage(replica, 10, []v1.Addr{main[1], aux[0]}))
+				So(leader.acceptors, ShouldResemble, []v1.Addr{main[1], aux[0]})
+				So(leader.auxiliaries, ShouldResemble, []v1.Addr{main[0]})
+				So(leader.engaged, ShouldBeFalse)
+
+				Convey("and an earlier configuration is ignored", func() {
+					leader.Handle(messages.NewAcceptorConfigMessage(replica, 5, main))
+					So(leader.acceptors, ShouldResemble, []v1.Addr{main[1], aux[0]})
+				})
+
+				Convey("and a late report of the replaced acceptor is ignored", func() {
+					leader.Handle(messages.NewAuxiliariesEngagedMessage(cmdr, leader.ballotNumber, []v1.Addr{main[0]}))
+					So(leader.engaged, ShouldBeFalse)
+				})
+			})
+		})
+
+		Convey("a report of an earlier ballot is ignored", func() {
+			leader.Handle(messages.NewAuxiliariesEngagedMessage(cmdr, newFakeBallot(-1, cmdr), []v1.Addr{main[0]}))
+			So(leader.engaged, ShouldBeFalse)
+			So(exchange.SendAllCallCount(), ShouldEqual, 0)
+		})
+	})
+}
@@ -3,14 +3,18 @@ package components
 import (
 	"fmt"
 	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/history"
 	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/ops"
 	"github.com/1xyz/paxossim/v1/types"
 	log "github.com/sirupsen/logrus"
+	"strconv"
+	"sync"
 	"time"
 )
 
-var clientCount = 0
-
 type Client struct {
 	v1.Process
 
@@ -18,36 +22,119 @@ type Client struct {
 
 	interval time.Duration
 
-	done chan bool
+	// requests are sent on the ticks of this clock
+	clock clock.Clock
+
+	done chan struct{}
+
+	stopOnce *sync.Once
 
 	commandCount int
 
-	ticker *time.Ticker
+	// guards commandCount & sentAt against concurrent readers
+	mu *sync.Mutex
+
+	// send requests directly to the acceptors (Fast Paxos)
+	fast bool
+
+	// receive decisions, to measure the latency of requests
+	notified bool
+
+	// requests are sent to one of these in turn, if set
+	targets []v1.Addr
+
+	// index of the next target
+	nextTarget int
+
+	// commands write to one of this many keys, if set
+	keys int
+
+	// the commands requested are recorded to this history, if set
+	history *history.History
+
+	// time at which each request awaiting its decision was sent, by command id
+	sentAt map[string]time.Time
+
+	metrics clientMetrics
+
+	// label identifying this client in its metrics
+	label string
 }
 
-func NewClient(exchange v1.MessageExchange, interval time.Duration) *Client {
-	processId := v1.ProcessID(clientCount)
-	clientCount++
+func NewClient(exchange v1.MessageExchange, interval time.Duration, opts ...Option) *Client {
+	o := newOptions(opts)
+	processId := v1.AllocateID(exchange, v1.Client)
 
-	return &Client{
-		Process:      v1.NewProcess(processId, v1.Client),
+	p := o.newProcess(processId, v1.Client)
+	c := &Client{
+		Process:      p,
 		exchange:     exchange,
 		interval:     interval,
-		done:         make(chan bool),
+		clock:        o.clockOf(p.GetAddr()),
+		done:         make(chan struct{}),
+		stopOnce:     &sync.Once{},
 		commandCount: 1,
-		ticker:       nil,
+		mu:           &sync.Mutex{},
+		fast:         o.fast,
+		notified:     o.notifyClients,
+		targets:      o.targets,
+		keys:         o.keys,
+		history:      o.history,
+		sentAt:       make(map[string]time.Time),
+		metrics:      newClientMetrics(o.metrics),
+		label:        metrics.Label(p.GetAddr()),
 	}
+	if c.notified {
+		if err := exchange.Register(c); err != nil {
+			log.Panicf("exchange.Register error %v", err)
+		}
+	}
+	return c
 }
 
 func (c *Client) nextCommandID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	result := fmt.Sprintf("%d", c.commandCount)
 	c.commandCount++
 	return result
 }
 
+// command - the command of the specified id, a PUT to one of the keys if set
+func (c *Client) command(commandID string) types.Command {
+	clientID := fmt.Sprintf("%v", c.GetAddr())
+	if c.keys <= 0 {
+		return types.BasicCommand{ClientID: clientID, CommandID: commandID, Op: "OP"}
+	}
+	n, _ := strconv.Atoi(commandID)
+	return ops.NewCommand(clientID, commandID, ops.Put{
+		Key:   fmt.Sprintf("k%d", (int(c.ID())+n)%c.keys),
+		Value: fmt.Sprintf("%v/%s", c.GetAddr(), commandID),
+	})
+}
+
+// send - send the request to the next target, or to every replica
+func (c *Client) send(m messages.RequestMessage) {
+	if len(c.targets) == 0 {
+		c.exchange.SendAll(v1.Replica, m)
+		return
+	}
+	c.exchange.Send(c.targets[c.nextTarget], m)
+	c.nextTarget = (c.nextTarget + 1) % len(c.targets)
+}
+
 func (c *Client) Run() {
-	c.ticker = time.NewTicker(c.interval)
+	ticker := c.clock.NewTicker(c.interval)
+	defer ticker.Stop()
 	ctxLog := log.WithFields(log.Fields{"id": c.GetAddr()})
+	if c.notified {
+		received := make(chan struct{})
+		go func() {
+			defer close(received)
+			c.receiveDecisions()
+		}()
+		defer func() { <-received }()
+	}
 
 	for {
 		select {
@@ -55,21 +142,52 @@ func (c *Client) Run() {
 			ctxLog.Debug("done recvd")
 			return
 
-		case <-c.ticker.C:
-			requestMessage := messages.NewRequestMessage(c.GetAddr(), types.BasicCommand{
-				ClientID:  fmt.Sprintf("%v", c.GetAddr()),
-				CommandID: c.nextCommandID(),
-				Op:        "OP",
-			})
-			c.exchange.SendAll(v1.Replica, requestMessage)
+		case <-ticker.C():
+			commandID := c.nextCommandID()
+			command := c.command(commandID)
+			if c.notified {
+				c.mu.Lock()
+				c.sentAt[commandID] = c.clock.Now()
+				c.mu.Unlock()
+			}
+			if c.history != nil {
+				c.history.Invoke(command)
+			}
+			if c.fast {
+				c.exchange.SendAll(v1.Acceptor, messages.NewFastProposeMessage(c.GetAddr(), command))
+			} else {
+				c.send(messages.NewRequestMessage(c.GetAddr(), command))
+			}
 		}
 	}
 }
 
-func (c *Client) Stop() {
-	if c.ticker == nil {
-		return
+// receiveDecisions - observe the latency of this client's requests, until the client is stopped
+func (c *Client) receiveDecisions() {
+	clientID := fmt.Sprintf("%v", c.GetAddr())
+	for {
+		msg, err := c.Process.Recv()
+		if err != nil {
+			return
+		}
+		dm, ok := msg.(messages.DecisionMessage)
+		if !ok || dm.Command.GetClientID() != clientID {
+			continue
+		}
+		c.mu.Lock()
+		sent, ok := c.sentAt[dm.Command.GetCommandID()]
+		delete(c.sentAt, dm.Command.GetCommandID())
+		c.mu.Unlock()
+		if ok {
+			c.metrics.latency.Observe(clock.Since(c.clock, sent).Seconds(), c.label)
+		}
 	}
-	c.ticker.Stop()
-	c.done <- true
+}
+
+// Stop - signal the client to stop issuing requests, Run returns once it observes the signal
+func (c *Client) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+		c.Process.Close()
+	})
 }
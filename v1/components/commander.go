@@ -2,36 +2,97 @@ package components
 
 import (
 	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
 	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/quorum"
 	"github.com/1xyz/paxossim/v1/types"
 	log "github.com/sirupsen/logrus"
-	"sync/atomic"
+	"sync"
 )
 
-var commanderCount int32 = 0
-
 type Commander struct {
 	v1.Process
 
+	CommanderState
+
 	exchange v1.MessageExchange
 
+	clock clock.Clock
+
+	// guards the commander's state against concurrent readers
+	mu *sync.Mutex
+}
+
+// CommanderState - the state of a commander, transitioned by Step
+type CommanderState struct {
+	// the commander's address, the source of its messages
+	self v1.Addr
+
 	leader v1.Addr
 
 	acceptors []v1.Addr
 
 	pvalue types.PValue
-}
 
-func NewCommander(exchange v1.MessageExchange, leader v1.Addr, acceptors []v1.Addr, pvalue types.PValue) *Commander {
-	// it is possibl for leaders across go-routines to increment this
-	processID := v1.ProcessID(atomic.AddInt32(&commanderCount, 1))
+	// acceptors which have not responded yet
+	waitFor v1.AddrSet
 
-	cmdr := &Commander{
-		Process:   v1.NewProcess(processID, v1.Commander),
-		exchange:  exchange,
+	// acceptors which accepted the pvalue
+	acks v1.AddrSet
+
+	quorum quorum.System
+
+	// Cheap Paxos: auxiliary acceptors contacted only if the main acceptors do not respond
+	auxiliaries []v1.Addr
+
+	// contact the auxiliary acceptors right away
+	engaged bool
+
+	// send the decision to the clients as well
+	notifyClients bool
+
+	// the pvalue was decided or preempted, the commander exits
+	done bool
+}
+
+// NewCommanderState - the state of a commander of the leader's pvalue, which contacted no acceptor yet
+func NewCommanderState(self v1.Addr, leader v1.Addr, acceptors []v1.Addr, pvalue types.PValue, opts ...Option) CommanderState {
+	o := newOptions(opts)
+	return CommanderState{
+		self:      self,
 		leader:    leader,
 		acceptors: acceptors,
 		pvalue:    pvalue,
+		waitFor:   make(v1.AddrSet),
+		acks:      make(v1.AddrSet),
+		quorum:    o.quorumOf(acceptors),
+
+		auxiliaries: o.auxiliaries,
+		engaged:     o.engaged,
+
+		notifyClients: o.notifyClients,
+	}
+}
+
+// Copy - a copy of the state, sharing nothing which a step changes
+func (s CommanderState) Copy() CommanderState {
+	result := s
+	result.waitFor = copyAddrSet(s.waitFor)
+	result.acks = copyAddrSet(s.acks)
+	return result
+}
+
+func NewCommander(exchange v1.MessageExchange, leader v1.Addr, acceptors []v1.Addr, pvalue types.PValue, opts ...Option) *Commander {
+	// leaders across go-routines allocate from the same exchange
+	processID := v1.AllocateID(exchange, v1.Commander)
+	p := newOptions(opts).newProcess(processID, v1.Commander)
+
+	cmdr := &Commander{
+		Process:        p,
+		CommanderState: NewCommanderState(p.GetAddr(), leader, acceptors, pvalue, opts...),
+		exchange:       exchange,
+		clock:          newOptions(opts).clock,
+		mu:             &sync.Mutex{},
 	}
 
 	exchange.Register(cmdr)
@@ -40,20 +101,23 @@ func NewCommander(exchange v1.MessageExchange, leader v1.Addr, acceptors []v1.Ad
 
 func (cmdr *Commander) Run() {
 	ctxLog := log.WithFields(log.Fields{"Addr": cmdr.GetAddr(), "Method": "Commander.Run"})
-	addrSet := cmdr.broadcastToAcceptors()
+	cmdr.Start()
+	if !cmdr.engaged && len(cmdr.auxiliaries) > 0 {
+		timer := scheduleEngage(cmdr, cmdr.clock)
+		defer timer.Stop()
+	}
 
 	for {
 		msg, err := cmdr.Process.Recv()
+		if err == v1.ErrProcessClosed {
+			ctxLog.Debugf("process closed")
+			break
+		}
 		if err != nil {
 			ctxLog.Panicf("error in inbox recv %v", err)
 		}
 
-		phase2bMessage, ok := msg.(messages.Phase2bMessage)
-		if !ok {
-			ctxLog.Panicf("unknown message type %v", msg)
-		}
-
-		if !cmdr.handleMessage(phase2bMessage, &addrSet) {
+		if !cmdr.Handle(msg) {
 			break
 		}
 	}
@@ -64,43 +128,107 @@ func (cmdr *Commander) Run() {
 	}
 }
 
-func (cmdr *Commander) broadcastToAcceptors() v1.AddrSet {
-	addrSet := make(v1.AddrSet)
-	phase2aMessage := messages.NewPhase2aMessage(cmdr.GetAddr(), cmdr.pvalue)
-	for _, acceptor := range cmdr.acceptors {
-		err := cmdr.exchange.Send(acceptor, phase2aMessage)
-		if err != nil {
-			log.Panicf("cmdr.exchange.send failed %v", err)
-		}
+// Start - send the phase 2a messages to the acceptors, before any response is handled
+func (cmdr *Commander) Start() {
+	cmdr.mu.Lock()
+	defer cmdr.mu.Unlock()
+	carryOut(cmdr.exchange, nil, cmdr.Init())
+}
+
+// Handle - synchronously process a single message, as Run does for every message in the inbox.
+// Returns false once the commander is done
+func (cmdr *Commander) Handle(message v1.Message) bool {
+	cmdr.mu.Lock()
+	defer cmdr.mu.Unlock()
+	carryOut(cmdr.exchange, nil, cmdr.Step(message))
+	return !cmdr.done
+}
+
+// Owner - the leader which spawned this commander
+func (cmdr *Commander) Owner() v1.Addr {
+	return cmdr.leader
+}
+
+// Init - the effects of starting the commander: the phase 2a messages to the acceptors
+func (s *CommanderState) Init() Effects {
+	eff := Effects{}
+	phase2aMessage := messages.NewPhase2aMessage(s.self, s.pvalue)
+	s.waitFor = make(v1.AddrSet)
+	for _, acceptor := range s.acceptors {
+		eff.send(acceptor, phase2aMessage)
+		s.waitFor.Add(acceptor)
+	}
+	if s.engaged {
+		s.engage(&eff, false)
+	}
+	return eff
+}
 
-		addrSet.Add(acceptor)
+// Step - transition the state on the message
+func (s *CommanderState) Step(message v1.Message) Effects {
+	eff := Effects{}
+	switch v := message.(type) {
+	case engageMessage:
+		s.engage(&eff, true)
+	case messages.Phase1bMessage:
+		// an auxiliary acceptor adopted the ballot, its phase 2b follows
+	case messages.Phase2bMessage:
+		s.handlePhase2b(v, &eff)
+	default:
+		log.WithFields(log.Fields{"Addr": s.self}).Panicf("unknown message type %v", message)
 	}
+	return eff
+}
 
-	return addrSet
+// engage - contact the auxiliary acceptors as well
+func (s *CommanderState) engage(eff *Effects, report bool) {
+	if len(s.auxiliaries) == 0 {
+		return
+	}
+	for _, aux := range s.auxiliaries {
+		s.sendPhase1a(aux, eff)
+	}
+	engageAuxiliaries(eff, s.self, s.leader, s.pvalue.BN,
+		messages.NewPhase2aMessage(s.self, s.pvalue), s.auxiliaries, s.waitFor, report)
 }
 
-func (cmdr *Commander) handleMessage(phase2bMessage messages.Phase2bMessage, addrSet *v1.AddrSet) bool {
-	majority := float64(len(cmdr.acceptors)) / 2
-	if types.Compare(&cmdr.pvalue.BN, &phase2bMessage.BallotNumber) == 0 && addrSet.Contains(phase2bMessage.Src()) {
-		addrSet.Remove(phase2bMessage.Src())
-		if float64(addrSet.Len()) < majority {
-			decisionMessage := messages.NewDecisionMessage(cmdr.GetAddr(), cmdr.pvalue.Slot, cmdr.pvalue.Command)
-			err := cmdr.exchange.SendAll(v1.Replica, decisionMessage)
-			if err != nil {
-				log.Panicf("cmdr.exchange.sendAll failed %v", err)
-			}
+// sendPhase1a - the auxiliary acceptors did not take part in phase 1 of the ballot; they adopt
+// it before its phase 2a, or reject it if they adopted a higher one
+func (s *CommanderState) sendPhase1a(aux v1.Addr, eff *Effects) {
+	eff.send(aux, messages.NewPhase1aMessage(s.self, s.pvalue.BN))
+}
 
-			return false
+// isAuxiliary - true if the acceptor is one of the auxiliary acceptors
+func (s *CommanderState) isAuxiliary(addr v1.Addr) bool {
+	for _, aux := range s.auxiliaries {
+		if aux.ID() == addr.ID() && aux.Type() == addr.Type() {
+			return true
 		}
-	} else {
-		premptedMessage := messages.NewPremptedMessage(cmdr.GetAddr(), phase2bMessage.BallotNumber)
-		err := cmdr.exchange.Send(cmdr.leader, premptedMessage)
-		if err != nil {
-			log.Panicf("cmdr.exchange.send failed %v", err)
-		}
-
-		return false
 	}
+	return false
+}
 
-	return true
+// handlePhase2b - count the acceptor if it accepted the pvalue, and give up on a higher ballot.
+// Other responses are ignored, e.g. a duplicate from an acceptor counted already
+func (s *CommanderState) handlePhase2b(phase2bMessage messages.Phase2bMessage, eff *Effects) {
+	cmp := types.Compare(&phase2bMessage.BallotNumber, &s.pvalue.BN)
+	if cmp == 0 && s.waitFor.Contains(phase2bMessage.Src()) {
+		s.waitFor.Remove(phase2bMessage.Src())
+		s.acks.Add(phase2bMessage.Src())
+		if s.quorum.Phase2(s.acks) {
+			decisionMessage := messages.NewDecisionMessage(s.self, s.pvalue.Slot, s.pvalue.Command)
+			eff.sendAll(v1.Replica, decisionMessage)
+			if s.notifyClients {
+				eff.notifyClients(decisionMessage)
+			}
+			s.done = true
+		}
+	} else if cmp < 0 && s.isAuxiliary(phase2bMessage.Src()) {
+		// the phase 2a overtook the phase 1a sent to the auxiliary acceptor, send both again
+		s.sendPhase1a(phase2bMessage.Src(), eff)
+		eff.send(phase2bMessage.Src(), messages.NewPhase2aMessage(s.self, s.pvalue))
+	} else if cmp > 0 {
+		eff.send(s.leader, messages.NewPremptedMessage(s.self, phase2bMessage.BallotNumber))
+		s.done = true
+	}
 }
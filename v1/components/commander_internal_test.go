@@ -3,14 +3,14 @@ package components
 import (
 	v1 "github.com/1xyz/paxossim/v1"
 	"github.com/1xyz/paxossim/v1/messages"
-	"github.com/1xyz/paxossim/v1/v1fakes"
+	"github.com/1xyz/paxossim/v1/quorum"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 )
 
 func TestNewCommander(t *testing.T) {
 	Convey("when a new commander is initialized", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
 		cmdr := NewCommander(exchange, leader, acceptors, newFakePValue(0, leader))
@@ -23,7 +23,7 @@ func TestNewCommander(t *testing.T) {
 
 func TestCommander_BroadcastToAcceptors(t *testing.T) {
 	Convey("when a new commander is initialized", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		nAcceptors := 3
 		acceptors := newFakeAddrs(nAcceptors, fakeAcceptorID, v1.Acceptor)
@@ -31,7 +31,8 @@ func TestCommander_BroadcastToAcceptors(t *testing.T) {
 		cmdr := NewCommander(exchange, leader, acceptors, pValue)
 
 		Convey("ensure a message is sent to all acceptors", func() {
-			result := cmdr.broadcastToAcceptors()
+			cmdr.Start()
+			result := cmdr.waitFor
 
 			So(result.Contains(acceptors[0]), ShouldBeTrue)
 			So(result.Contains(acceptors[1]), ShouldBeTrue)
@@ -54,7 +55,7 @@ func TestCommander_BroadcastToAcceptors(t *testing.T) {
 
 func TestCommander_PreEmptsOnNewerBallot(t *testing.T) {
 	Convey("Given a commander configured for a ballot number", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
 		cmdr := NewCommander(exchange, leader, acceptors, newFakePValue(0, leader))
@@ -62,7 +63,8 @@ func TestCommander_PreEmptsOnNewerBallot(t *testing.T) {
 		Convey("when it receives a newer Ballot number", func() {
 			newBN := newFakeBallot(3, newFakeAddr(fakeLeaderID+10, v1.Leader))
 			responders := makeSet(acceptors)
-			bContinue := cmdr.handleMessage(messages.NewPhase2bMessage(acceptors[0], newBN), &responders)
+			cmdr.waitFor = responders
+			bContinue := cmdr.Handle(messages.NewPhase2bMessage(acceptors[0], newBN))
 
 			Convey("the commander signals an exit", func() {
 				So(bContinue, ShouldBeFalse)
@@ -91,7 +93,7 @@ func TestCommander_PreEmptsOnNewerBallot(t *testing.T) {
 
 func TestCommander_SendsDecisionToReplicas(t *testing.T) {
 	Convey("Given a commander configured for a ballot number", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
 		pValue := newFakePValue(0, leader)
@@ -99,9 +101,10 @@ func TestCommander_SendsDecisionToReplicas(t *testing.T) {
 
 		Convey("when it receives the same Ballot ", func() {
 			responders := makeSet(acceptors)
+			cmdr.waitFor = responders
 
 			Convey("from one acceptor", func() {
-				bContinue := cmdr.handleMessage(messages.NewPhase2bMessage(acceptors[0], pValue.BN), &responders)
+				bContinue := cmdr.Handle(messages.NewPhase2bMessage(acceptors[0], pValue.BN))
 
 				Convey("it continues to wait for more responses", func() {
 					So(bContinue, ShouldBeTrue)
@@ -109,7 +112,7 @@ func TestCommander_SendsDecisionToReplicas(t *testing.T) {
 				})
 
 				Convey("from a majority of acceptors", func() {
-					bContinue := cmdr.handleMessage(messages.NewPhase2bMessage(acceptors[2], pValue.BN), &responders)
+					bContinue := cmdr.Handle(messages.NewPhase2bMessage(acceptors[2], pValue.BN))
 
 					Convey("it signals an exit", func() {
 						So(bContinue, ShouldBeFalse)
@@ -139,3 +142,44 @@ func TestCommander_SendsDecisionToReplicas(t *testing.T) {
 		})
 	})
 }
+
+func TestCommander_FlexibleQuorum(t *testing.T) {
+	Convey("Given a commander of 4 acceptors waiting for phase 2 quorums of 2", t, func() {
+		exchange := newFakeExchange()
+		leader := newFakeAddr(fakeLeaderID, v1.Leader)
+		acceptors := newFakeAddrs(4, fakeAcceptorID, v1.Acceptor)
+		pValue := newFakePValue(0, leader)
+		cmdr := NewCommander(exchange, leader, acceptors, pValue, WithQuorum(quorum.NewSizes(acceptors, 3, 2)))
+		cmdr.Start()
+
+		Convey("the decision is made once two acceptors accepted the pvalue", func() {
+			So(cmdr.Handle(messages.NewPhase2bMessage(acceptors[0], pValue.BN)), ShouldBeTrue)
+			So(cmdr.Handle(messages.NewPhase2bMessage(acceptors[3], pValue.BN)), ShouldBeFalse)
+			So(exchange.SendAllCallCount(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestCommander_IgnoresDuplicateResponses(t *testing.T) {
+	Convey("Given a commander which counted the phase 2b of one of its 3 acceptors", t, func() {
+		exchange := newFakeExchange()
+		leader := newFakeAddr(fakeLeaderID, v1.Leader)
+		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
+		pValue := newFakePValue(2, leader)
+		cmdr := NewCommander(exchange, leader, acceptors, pValue)
+		cmdr.Start()
+		So(cmdr.Handle(messages.NewPhase2bMessage(acceptors[0], pValue.BN)), ShouldBeTrue)
+		sent := exchange.SendCallCount()
+
+		Convey("a duplicate of the phase 2b, or a response of a lower ballot, is ignored", func() {
+			So(cmdr.Handle(messages.NewPhase2bMessage(acceptors[0], pValue.BN)), ShouldBeTrue)
+			So(cmdr.Handle(messages.NewPhase2bMessage(acceptors[1], newFakeBallot(1, leader))), ShouldBeTrue)
+			So(exchange.SendCallCount(), ShouldEqual, sent)
+
+			Convey("and the decision is made once another acceptor accepted the pvalue", func() {
+				So(cmdr.Handle(messages.NewPhase2bMessage(acceptors[1], pValue.BN)), ShouldBeFalse)
+				So(exchange.SendAllCallCount(), ShouldEqual, 1)
+			})
+		})
+	})
+}
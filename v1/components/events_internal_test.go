@@ -0,0 +1,53 @@
+package components
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLeader_Events(t *testing.T) {
+	Convey("Given a leader emitting events", t, func() {
+		sink := events.NewMemory()
+		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
+		leader := NewLeader(newFakeExchange(), acceptors, WithEventSink(sink))
+		scout := newFakeAddr(fakeScoutID, v1.Scout)
+
+		Convey("adopting its ballot emits BallotAdopted", func() {
+			leader.Handle(messages.NewAdoptedMessage(scout, leader.ballotNumber, make(types.PValues)))
+			adopted := sink.OfKind(events.KindBallotAdopted)
+			So(len(adopted), ShouldEqual, 1)
+			So(adopted[0].(events.BallotAdopted).Ballot.Round, ShouldEqual, 0)
+		})
+
+		Convey("a higher ballot emits BallotPreempted", func() {
+			other := newFakeAddr(fakeLeaderID, v1.Leader)
+			leader.Handle(messages.NewPremptedMessage(scout, newFakeBallot(5, other)))
+			leader.stopChildren()
+			preempted := sink.OfKind(events.KindBallotPreempted)
+			So(len(preempted), ShouldEqual, 1)
+			So(preempted[0].(events.BallotPreempted).By.Round, ShouldEqual, 5)
+		})
+	})
+}
+
+func TestReplica_Events(t *testing.T) {
+	Convey("Given a replica emitting events", t, func() {
+		sink := events.NewMemory()
+		r := NewReplica(newFakeExchange(), newLeaders(), WithEventSink(sink))
+		commander := newFakeAddr(fakeCommanderID, v1.Commander)
+		command := newTestRequestMessage("1").Command
+
+		Convey("a decision emits SlotDecided and CommandPerformed once", func() {
+			r.Handle(messages.NewDecisionMessage(commander, InitialSlotID, command))
+			r.Handle(messages.NewDecisionMessage(commander, InitialSlotID, command))
+			So(len(sink.OfKind(events.KindSlotDecided)), ShouldEqual, 1)
+			performed := sink.OfKind(events.KindCommandPerformed)
+			So(len(performed), ShouldEqual, 1)
+			So(performed[0].(events.CommandPerformed).Slot, ShouldEqual, InitialSlotID)
+		})
+	})
+}
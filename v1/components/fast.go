@@ -0,0 +1,294 @@
+package components
+
+// Fast Paxos (Lamport, 2006) on top of the van Renesse Multi-Paxos components.
+//
+// Once a leader's ballot is adopted, the leader recovers the slots reported by the
+// acceptors in a classic round (commanders), and sends a Phase2aAny message opening
+// a fast round for all later slots. In a fast round clients send their commands
+// directly to the acceptors, and every acceptor accepts the commands in the order it
+// receives them, in consecutive slots, reporting each vote to the leader. A slot is
+// decided once a fast quorum of acceptors voted for the same command.
+//
+// Acceptors may receive commands in different orders, so different commands can be
+// voted for in a slot. Once no command can reach a fast quorum (a collision), or a
+// slot is stalled because votes were lost, the leader starts a new ballot. Its
+// adoption recovers every slot in a classic round, picking for a slot the command
+// which might have been chosen in the fast round, and re-proposes the commands which
+// lost in a collision in new slots.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+const (
+	// A fast round is recovered once a slot is undecided while this many later slots are decided
+	FastStallGap types.Slot = Window
+
+	// Maximum number of client commands an acceptor buffers until a fast round is opened
+	FastPendingLimit = 1000
+
+	// Op of the commands filling slots for which no command was accepted, an ops.NoOp
+	NoOp = ops.NameNoOp
+)
+
+// FastQuorum - the size of a fast quorum of n acceptors, ceil(3n/4)
+func FastQuorum(n int) int {
+	return (3*n + 3) / 4
+}
+
+// ClassicQuorum - the size of a classic quorum (a majority) of n acceptors
+func ClassicQuorum(n int) int {
+	return n/2 + 1
+}
+
+// handlePhase2aAny - accept client commands in the ballot, starting at the specified slot
+func (s *AcceptorState) handlePhase2aAny(m messages.Phase2aAnyMessage, eff *Effects) {
+	ctxLog := log.WithFields(log.Fields{"Addr": s.self, "Method": "Acceptor.handlePhase2aAny"})
+	if s.BN != nil && types.Compare(&m.BallotNumber, s.BN) < 0 {
+		// let the leader know that its ballot was superseded
+		eff.reply(m.Src(), messages.NewPremptedMessage(s.self, *s.BN))
+		return
+	}
+
+	ctxLog.Debugf("Opening fast round %v from slot %v", m.BallotNumber, m.FromSlot)
+	bn := m.BallotNumber
+	s.BN = &bn
+	anyBN := bn
+	s.anyBN = &anyBN
+	s.nextFastSlot = m.FromSlot
+	s.fastAccepted = make(map[types.Command]bool)
+
+	pending := s.pending
+	s.pending = nil
+	for _, command := range pending {
+		s.fastAccept(command, eff)
+	}
+}
+
+// handleFastPropose - accept a client command in the next free slot of the fast round, if one is open
+func (s *AcceptorState) handleFastPropose(m messages.FastProposeMessage, eff *Effects) {
+	if s.anyBN == nil || types.Compare(s.BN, s.anyBN) != 0 {
+		if len(s.pending) >= FastPendingLimit {
+			log.WithFields(log.Fields{"Addr": s.self}).Debugf("dropping fast proposal %v", m.Command)
+			return
+		}
+		s.pending = append(s.pending, m.Command)
+		return
+	}
+	s.fastAccept(m.Command, eff)
+}
+
+func (s *AcceptorState) fastAccept(command types.Command, eff *Effects) {
+	// a command sent more than once (e.g. duplicated by the network) takes a single slot
+	if s.fastAccepted[command] {
+		return
+	}
+	s.fastAccepted[command] = true
+
+	pv := types.PValue{BN: *s.BN, Slot: s.nextFastSlot, Command: command}
+	s.nextFastSlot++
+	s.Accepted.Set(pv)
+	eff.emit(events.PValueAccepted{Acceptor: s.self, PValue: pv})
+	eff.reply(pv.BN.LeaderID, messages.NewFastVoteMessage(s.self, pv))
+}
+
+// adoptFast - the leader's ballot was adopted: recover the reported slots in a
+// classic round and open a fast round for the slots after them
+func (s *LeaderState) adoptFast(am messages.AdoptedMessage, eff *Effects) {
+	ctxLog := log.WithFields(log.Fields{"Addr": s.self, "Method": "leader.adoptFast"})
+	n := len(s.acceptors)
+	// a command chosen in a fast round was reported by at least this many acceptors of the adopting majority
+	threshold := FastQuorum(n) + ClassicQuorum(n) - n
+
+	// the votes for every slot in the highest ballot any command was accepted in
+	highest := make(map[types.Slot]types.BallotNumber)
+	for pv := range am.Accepted {
+		bn, ok := highest[pv.Slot]
+		if !ok || types.Compare(&bn, &pv.BN) < 0 {
+			highest[pv.Slot] = pv.BN
+		}
+	}
+	counts := make(map[types.Slot]map[types.Command]int)
+	for pv := range am.Accepted {
+		bn := highest[pv.Slot]
+		if types.Compare(&bn, &pv.BN) != 0 {
+			continue
+		}
+		if counts[pv.Slot] == nil {
+			counts[pv.Slot] = make(map[types.Command]int)
+		}
+		votes, ok := am.Votes[pv]
+		if !ok {
+			votes = 1
+		}
+		counts[pv.Slot][pv.Command] += votes
+	}
+
+	for slot, votes := range counts {
+		s.proposals.Assign(slot, selectCommand(votes, threshold))
+	}
+
+	// fill the holes, and re-propose the commands which lost a collision in new slots
+	maxSlot := types.Slot(0)
+	proposed := make(map[types.Command]bool)
+	for slot, command := range s.proposals {
+		proposed[command] = true
+		if slot > maxSlot {
+			maxSlot = slot
+		}
+	}
+	for slot := InitialSlotID; slot < maxSlot; slot++ {
+		if !s.proposals.Contains(slot) {
+			s.proposals.Assign(slot, ops.NewCommand("", fmt.Sprintf("noop-%d", slot), ops.NoOp{}))
+		}
+	}
+	for _, command := range sortedCommands(am.Accepted) {
+		if !proposed[command] {
+			maxSlot++
+			s.proposals.Assign(maxSlot, command)
+			proposed[command] = true
+		}
+	}
+
+	for _, slot := range sortedSlots(s.proposals) {
+		s.spawnCommander(slot, eff)
+	}
+
+	from := maxSlot + 1
+	if from < InitialSlotID {
+		from = InitialSlotID
+	}
+	s.active = true
+	s.votes = make(map[types.Slot]map[v1.Addr]types.Command)
+	s.fastDecided = make(map[types.Slot]bool)
+	s.nextUndecided = from
+	s.highestDecided = from - 1
+	anyMessage := messages.NewPhase2aAnyMessage(s.self, s.ballotNumber, from)
+	for _, acceptor := range s.acceptors {
+		eff.send(acceptor, anyMessage)
+	}
+	ctxLog.Debugf("Recovered %d slots, opened fast round %v from slot %v", len(s.proposals), s.ballotNumber, from)
+	eff.emit(events.BallotAdopted{
+		Leader:  s.self,
+		Ballot:  s.ballotNumber,
+		PValues: len(am.Accepted),
+	})
+}
+
+// selectCommand - the command which might have been chosen, i.e. was voted for by at least
+// threshold acceptors. Otherwise none was chosen, and the command with the most votes is picked
+func selectCommand(votes map[types.Command]int, threshold int) types.Command {
+	commands := make([]types.Command, 0, len(votes))
+	for command := range votes {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		a, b := commands[i], commands[j]
+		if votes[a] != votes[b] {
+			return votes[a] > votes[b]
+		}
+		return commandKey(a) < commandKey(b)
+	})
+	for _, command := range commands {
+		if votes[command] >= threshold {
+			return command
+		}
+	}
+	return commands[0]
+}
+
+// sortedCommands - the distinct commands of the pvalues, in a stable order
+func sortedCommands(pvalues types.PValues) []types.Command {
+	seen := make(map[types.Command]bool)
+	result := make([]types.Command, 0)
+	for pv := range pvalues {
+		if !seen[pv.Command] {
+			seen[pv.Command] = true
+			result = append(result, pv.Command)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return commandKey(result[i]) < commandKey(result[j]) })
+	return result
+}
+
+func commandKey(c types.Command) string {
+	return c.GetClientID() + "/" + c.GetCommandID()
+}
+
+// handleFastVote - tally an acceptor's vote in the current fast round
+func (s *LeaderState) handleFastVote(m messages.FastVoteMessage, eff *Effects) {
+	pv := m.PValue
+	if !s.fast || !s.active || types.Compare(&pv.BN, &s.ballotNumber) != 0 {
+		return
+	}
+	if pv.Slot < s.nextUndecided || s.fastDecided[pv.Slot] {
+		return
+	}
+
+	votes, ok := s.votes[pv.Slot]
+	if !ok {
+		votes = make(map[v1.Addr]types.Command)
+		s.votes[pv.Slot] = votes
+	}
+	votes[v1.NewAddress(m.Src().ID(), m.Src().Type())] = pv.Command
+
+	counts := make(map[types.Command]int)
+	best := 0
+	var chosen types.Command
+	for _, command := range votes {
+		counts[command]++
+		if counts[command] > best {
+			best, chosen = counts[command], command
+		}
+	}
+
+	quorum := FastQuorum(len(s.acceptors))
+	switch {
+	case best >= quorum:
+		s.decideFast(pv.Slot, chosen, eff)
+	case best+len(s.acceptors)-len(votes) < quorum:
+		s.recoverFast("collision", eff)
+		return
+	}
+	if s.highestDecided-s.nextUndecided >= FastStallGap {
+		s.recoverFast("stall", eff)
+	}
+}
+
+func (s *LeaderState) decideFast(slot types.Slot, command types.Command, eff *Effects) {
+	s.fastDecided[slot] = true
+	delete(s.votes, slot)
+	s.proposals.Assign(slot, command)
+	eff.fastDecisions++
+
+	dm := messages.NewDecisionMessage(s.self, slot, command)
+	eff.sendAll(v1.Replica, dm)
+	if s.notifyClients {
+		eff.notifyClients(dm)
+	}
+
+	if slot > s.highestDecided {
+		s.highestDecided = slot
+	}
+	for s.fastDecided[s.nextUndecided] {
+		delete(s.fastDecided, s.nextUndecided)
+		s.nextUndecided++
+	}
+}
+
+// recoverFast - give up the fast round, and recover its slots in a new ballot
+func (s *LeaderState) recoverFast(reason string, eff *Effects) {
+	log.WithFields(log.Fields{"Addr": s.self}).Debugf("Recovering fast round %v: %s",
+		s.ballotNumber, reason)
+	eff.recoveries = append(eff.recoveries, reason)
+	s.active = false
+	s.ballotNumber.Round++
+	s.spawnScout(eff)
+}
@@ -0,0 +1,135 @@
+package components
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func newFastCommand(commandID string) types.Command {
+	return newTestRequestMessage(commandID).Command
+}
+
+func TestFastQuorum(t *testing.T) {
+	Convey("Fast quorums are ceil(3n/4), classic quorums a majority", t, func() {
+		So(FastQuorum(3), ShouldEqual, 3)
+		So(FastQuorum(4), ShouldEqual, 3)
+		So(FastQuorum(5), ShouldEqual, 4)
+		So(FastQuorum(7), ShouldEqual, 6)
+		So(ClassicQuorum(3), ShouldEqual, 2)
+		So(ClassicQuorum(5), ShouldEqual, 3)
+	})
+}
+
+func TestAcceptor_FastRound(t *testing.T) {
+	Convey("Given an acceptor", t, func() {
+		exchange := newFakeExchange()
+		acceptor := NewAcceptor(exchange)
+		leader := newFakeAddr(fakeLeaderID, v1.Leader)
+		client := newFakeAddr(1, v1.Client)
+		bn := newFakeBallot(1, leader)
+
+		Convey("client commands sent before a fast round is opened are buffered", func() {
+			acceptor.Handle(messages.NewFastProposeMessage(client, newFastCommand("1")))
+			So(exchange.SendCallCount(), ShouldEqual, 0)
+			So(len(acceptor.pending), ShouldEqual, 1)
+
+			Convey("and accepted in consecutive slots once it is opened", func() {
+				acceptor.Handle(messages.NewPhase2aAnyMessage(leader, bn, 3))
+				acceptor.Handle(messages.NewFastProposeMessage(client, newFastCommand("2")))
+				So(exchange.SendCallCount(), ShouldEqual, 2)
+
+				for i, slot := range []types.Slot{3, 4} {
+					addr, msg := exchange.SendArgsForCall(i)
+					So(addr, ShouldEqual, leader)
+					vote, ok := msg.(messages.FastVoteMessage)
+					So(ok, ShouldBeTrue)
+					So(vote.PValue.Slot, ShouldEqual, slot)
+					So(vote.PValue.BN, ShouldResemble, bn)
+				}
+				So(len(acceptor.Accepted), ShouldEqual, 2)
+			})
+		})
+
+		Convey("a duplicated command takes a single slot", func() {
+			acceptor.Handle(messages.NewPhase2aAnyMessage(leader, bn, InitialSlotID))
+			acceptor.Handle(messages.NewFastProposeMessage(client, newFastCommand("1")))
+			acceptor.Handle(messages.NewFastProposeMessage(client, newFastCommand("1")))
+			So(exchange.SendCallCount(), ShouldEqual, 1)
+		})
+
+		Convey("a fast round of a lower ballot is preempted", func() {
+			acceptor.Handle(messages.NewPhase1aMessage(newFakeAddr(fakeScoutID, v1.Scout), newFakeBallot(5, leader)))
+			acceptor.Handle(messages.NewPhase2aAnyMessage(leader, bn, InitialSlotID))
+			So(acceptor.anyBN, ShouldBeNil)
+			_, msg := exchange.SendArgsForCall(1)
+			_, ok := msg.(messages.PreemptMessage)
+			So(ok, ShouldBeTrue)
+		})
+	})
+}
+
+func TestLeader_FastRound(t *testing.T) {
+	Convey("Given a leader in Fast Paxos mode with an adopted ballot", t, func() {
+		exchange := newFakeExchange()
+		acceptors := newFakeAddrs(4, fakeAcceptorID, v1.Acceptor)
+		leader := NewLeader(exchange, acceptors, WithFastPaxos())
+		scout := newFakeAddr(fakeScoutID, v1.Scout)
+		leader.Handle(messages.NewAdoptedMessage(scout, leader.ballotNumber, make(types.PValues)))
+		defer leader.stopChildren()
+
+		So(leader.active, ShouldBeTrue)
+		So(exchange.SendCallCount(), ShouldEqual, len(acceptors))
+		_, msg := exchange.SendArgsForCall(0)
+		anyMessage, ok := msg.(messages.Phase2aAnyMessage)
+		So(ok, ShouldBeTrue)
+		So(anyMessage.FromSlot, ShouldEqual, InitialSlotID)
+
+		vote := func(acceptor v1.Addr, slot types.Slot, command types.Command) {
+			pv := types.PValue{BN: leader.ballotNumber, Slot: slot, Command: command}
+			leader.Handle(messages.NewFastVoteMessage(acceptor, pv))
+		}
+
+		Convey("a slot is decided once a fast quorum voted for the same command", func() {
+			command := newFastCommand("1")
+			vote(acceptors[0], InitialSlotID, command)
+			vote(acceptors[1], InitialSlotID, command)
+			So(exchange.SendAllCallCount(), ShouldEqual, 0)
+			vote(acceptors[2], InitialSlotID, command)
+			So(exchange.SendAllCallCount(), ShouldEqual, 1)
+
+			pt, msg := exchange.SendAllArgsForCall(0)
+			So(pt, ShouldEqual, v1.Replica)
+			dm, ok := msg.(messages.DecisionMessage)
+			So(ok, ShouldBeTrue)
+			So(dm.Slot, ShouldEqual, InitialSlotID)
+			So(leader.nextUndecided, ShouldEqual, InitialSlotID+1)
+		})
+
+		Convey("a collision starts a new ballot", func() {
+			round := leader.ballotNumber.Round
+			vote(acceptors[0], InitialSlotID, newFastCommand("1"))
+			vote(acceptors[1], InitialSlotID, newFastCommand("2"))
+			So(leader.active, ShouldBeTrue)
+			vote(acceptors[2], InitialSlotID, newFastCommand("3"))
+			So(leader.active, ShouldBeFalse)
+			So(leader.ballotNumber.Round, ShouldEqual, round+1)
+		})
+	})
+}
+
+func TestSelectCommand(t *testing.T) {
+	Convey("Given the votes for a slot", t, func() {
+		a, b := newFastCommand("a"), newFastCommand("b")
+
+		Convey("a command which reaches the threshold is selected", func() {
+			So(selectCommand(map[types.Command]int{a: 1, b: 2}, 2), ShouldResemble, b)
+		})
+
+		Convey("otherwise the command with the most votes is selected, ties broken by id", func() {
+			So(selectCommand(map[types.Command]int{a: 1, b: 1}, 2), ShouldResemble, a)
+		})
+	})
+}
@@ -1,19 +1,62 @@
 package components
 
 import (
+	"github.com/1xyz/paxossim/queue"
 	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
 	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/quorum"
 	"github.com/1xyz/paxossim/v1/types"
 	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
 )
 
-var leaderCount = 0
-
 type Leader struct {
 	v1.Process
 
+	LeaderState
+
 	exchange v1.MessageExchange
 
+	// phase 1 & phase 2 quorums of the acceptors
+	quorum quorum.System
+
+	// running scouts & commanders spawned by this leader
+	children map[v1.Process]bool
+
+	childrenMu *sync.Mutex
+
+	childrenWg *sync.WaitGroup
+
+	metrics leaderMetrics
+
+	// label identifying this leader in its metrics
+	label string
+
+	// guards the leader's state against concurrent readers
+	mu *sync.Mutex
+
+	events events.Sink
+
+	// receives the spawned scouts & commanders instead of running them, if set
+	spawnHook func(c Child)
+
+	// the time of the steps, and of the scouts & commanders
+	clock clock.Clock
+
+	// inbox of the leader, and of the scouts & commanders; unbounded if nil
+	inbox *queue.Options
+}
+
+// LeaderState - the state of a leader, transitioned by Step
+type LeaderState struct {
+	// the leader's address, the source of its messages
+	self v1.Addr
+
 	ballotNumber types.BallotNumber
 
 	active bool
@@ -21,23 +64,100 @@ type Leader struct {
 	proposals types.SlotCommandMap
 
 	acceptors []v1.Addr
+
+	// leaders & commanders send decisions to the clients as well
+	notifyClients bool
+
+	// Fast Paxos: open a fast round once the ballot is adopted
+	fast bool
+
+	// Fast Paxos: the votes of the acceptors for every undecided slot of the fast round
+	votes map[types.Slot]map[v1.Addr]types.Command
+
+	// Fast Paxos: slots decided in the fast round, at or after nextUndecided
+	fastDecided map[types.Slot]bool
+
+	// Fast Paxos: the lowest slot of the fast round which is not decided
+	nextUndecided types.Slot
+
+	// Fast Paxos: the highest slot decided in the fast round
+	highestDecided types.Slot
+
+	// Cheap Paxos: acceptors contacted only if the main acceptors (acceptors) fail to respond
+	auxiliaries []v1.Addr
+
+	// Cheap Paxos: a main acceptor failed, scouts & commanders engage the auxiliaries right away
+	engaged bool
+
+	// Cheap Paxos: slot of the reconfiguration which determined the main acceptors
+	configSlot types.Slot
+
+	// Cheap Paxos: time this leader last proposed a reconfiguration of the main acceptors
+	reconfiguredAt time.Time
+
+	// Cheap Paxos: number of reconfigurations proposed by this leader
+	reconfigCount int
 }
 
-func NewLeader(exchange v1.MessageExchange, acceptors []v1.Addr) *Leader {
-	processID := leaderCount
-	leaderCount++
-	p := v1.NewProcess(v1.ProcessID(processID), v1.Leader)
-	l := &Leader{
-		Process:   p,
-		exchange:  exchange,
-		proposals: make(types.SlotCommandMap),
-		active:    false,
-		acceptors: acceptors,
+// NewLeaderState - the state of a leader which is about to scout its first ballot
+func NewLeaderState(self v1.Addr, acceptors []v1.Addr, opts ...Option) LeaderState {
+	o := newOptions(opts)
+	return LeaderState{
+		self:          self,
+		proposals:     make(types.SlotCommandMap),
+		active:        false,
+		acceptors:     acceptors,
+		fast:          o.fast,
+		notifyClients: o.notifyClients,
+		votes:         make(map[types.Slot]map[v1.Addr]types.Command),
+		fastDecided:   make(map[types.Slot]bool),
+		auxiliaries:   o.auxiliaries,
 		ballotNumber: types.BallotNumber{
 			Round:    0,
-			LeaderID: p.GetAddr(),
+			LeaderID: self,
 		},
 	}
+}
+
+// Copy - a copy of the state, sharing nothing which a step changes
+func (s LeaderState) Copy() LeaderState {
+	result := s
+	result.proposals = copySlotCommands(s.proposals)
+	result.votes = make(map[types.Slot]map[v1.Addr]types.Command, len(s.votes))
+	for slot, votes := range s.votes {
+		result.votes[slot] = make(map[v1.Addr]types.Command, len(votes))
+		for addr, command := range votes {
+			result.votes[slot][addr] = command
+		}
+	}
+	result.fastDecided = make(map[types.Slot]bool, len(s.fastDecided))
+	for slot := range s.fastDecided {
+		result.fastDecided[slot] = true
+	}
+	return result
+}
+
+func NewLeader(exchange v1.MessageExchange, acceptors []v1.Addr, opts ...Option) *Leader {
+	o := newOptions(opts)
+	p := o.newProcess(v1.AllocateID(exchange, v1.Leader), v1.Leader)
+	l := &Leader{
+		Process:     p,
+		LeaderState: NewLeaderState(p.GetAddr(), acceptors, opts...),
+		exchange:    exchange,
+		quorum:      o.quorumOf(append(append([]v1.Addr{}, acceptors...), o.auxiliaries...)),
+		children:    make(map[v1.Process]bool),
+		childrenMu:  &sync.Mutex{},
+		childrenWg:  &sync.WaitGroup{},
+		metrics:     newLeaderMetrics(o.metrics),
+		label:       metrics.Label(p.GetAddr()),
+		mu:          &sync.Mutex{},
+		events:      o.events,
+		spawnHook:   o.spawn,
+		clock:       o.clockOf(p.GetAddr()),
+		inbox:       o.inbox,
+	}
+
+	l.metrics.mainAcceptors.Set(float64(len(acceptors)), l.label)
 
 	ctxLog := log.WithFields(log.Fields{"Addr": l.GetAddr()})
 	ctxLog.Debugf("Created leader")
@@ -52,100 +172,261 @@ func NewLeader(exchange v1.MessageExchange, acceptors []v1.Addr) *Leader {
 func (leader *Leader) Run() {
 	ctxLog := log.WithFields(log.Fields{"Addr": leader.GetAddr()})
 	ctxLog.Debugf("Running Leader")
-	leader.spawnNewScout()
+	leader.Start()
 	for {
 		msg, err := leader.Process.Recv()
+		if err == v1.ErrProcessClosed {
+			ctxLog.Debugf("process closed")
+			leader.stopChildren()
+			return
+		}
 		if err != nil {
 			ctxLog.Panicf("error in inbox recv %v", err)
 		}
 
-		leader.handleMessage(msg)
+		leader.Handle(msg)
 	}
 }
 
-func (leader *Leader) spawnNewScout() {
-	ctxLog := log.WithFields(log.Fields{"Addr": leader.GetAddr()})
-	s := NewScout(leader.exchange, leader.GetAddr(), leader.acceptors, leader.ballotNumber)
-	go s.Run()
-	ctxLog.Debugf("Spawned a new Scout")
+// Start - spawn the scout of the initial ballot, before any message is handled
+func (leader *Leader) Start() {
+	leader.mu.Lock()
+	defer leader.mu.Unlock()
+	leader.carryOut(leader.Init())
+}
+
+// Handle - synchronously process a single message, as Run does for every message in the inbox
+func (leader *Leader) Handle(message v1.Message) {
+	leader.mu.Lock()
+	defer leader.mu.Unlock()
+	leader.carryOut(leader.Step(message, leader.clock.Now()))
+}
+
+// Close - close the leader and the scouts & commanders it spawned
+func (leader *Leader) Close() {
+	leader.Process.Close()
+	leader.stopChildren()
 }
 
-func (leader *Leader) spawnNewCommander(slot types.Slot) {
+// carryOut - spawn the scouts & commanders of the effects, send their messages, and record them
+// in the leader's metrics
+func (leader *Leader) carryOut(eff Effects) {
+	for _, r := range eff.Spawns {
+		leader.spawn(r)
+	}
+	carryOut(leader.exchange, leader.events, eff)
+
+	for _, r := range eff.Spawns {
+		if r.Type == v1.Scout {
+			leader.metrics.scouts.Inc(leader.label)
+			leader.metrics.round.Set(float64(r.Ballot.Round), leader.label)
+		} else {
+			leader.metrics.commanders.Inc(leader.label)
+		}
+	}
+	for _, e := range eff.Events {
+		if _, ok := e.(events.BallotPreempted); ok {
+			leader.metrics.preemptions.Inc(leader.label)
+		}
+	}
+	leader.metrics.fastDecisions.Add(float64(eff.fastDecisions), leader.label)
+	for _, reason := range eff.recoveries {
+		leader.metrics.fastRecoveries.Inc(leader.label, reason)
+	}
+	leader.metrics.engagements.Add(float64(eff.engagements), leader.label)
+	leader.metrics.mainAcceptors.Set(float64(len(leader.acceptors)), leader.label)
+}
+
+// Child - a Scout or a Commander spawned by a leader
+type Child interface {
+	v1.Process
+	v1.Owned
+
+	// Run - start, and handle the messages in the inbox until done
+	Run()
+
+	// Start - send the first messages to the acceptors
+	Start()
+
+	// Handle - synchronously process a single message, returns false once the child is done
+	Handle(message v1.Message) bool
+}
+
+// spawn - create the requested scout or commander, and run it or hand it to the spawn hook
+func (leader *Leader) spawn(r SpawnRequest) {
 	ctxLog := log.WithFields(log.Fields{"Addr": leader.GetAddr()})
-	command, found := leader.proposals.Get(slot)
+	var c Child
+	if r.Type == v1.Scout {
+		c = NewScout(leader.exchange, leader.GetAddr(), r.Acceptors, r.Ballot, leader.childOptions(r)...)
+	} else {
+		c = NewCommander(leader.exchange, leader.GetAddr(), r.Acceptors, r.PValue, leader.childOptions(r)...)
+	}
+	ctxLog.Debugf("Spawned a new %v", r.Type)
+
+	if leader.spawnHook != nil {
+		leader.spawnHook(c)
+		return
+	}
+
+	leader.childrenMu.Lock()
+	leader.children[c] = true
+	leader.childrenMu.Unlock()
+
+	leader.childrenWg.Add(1)
+	go func() {
+		defer leader.childrenWg.Done()
+		c.Run()
+		leader.childrenMu.Lock()
+		delete(leader.children, c)
+		leader.childrenMu.Unlock()
+	}()
+}
+
+// stopChildren - close all running scouts & commanders, and wait for them to exit
+func (leader *Leader) stopChildren() {
+	leader.childrenMu.Lock()
+	for p := range leader.children {
+		p.Close()
+	}
+	leader.childrenMu.Unlock()
+	leader.childrenWg.Wait()
+}
+
+// Init - the effects of starting the leader: the scout of its initial ballot
+func (s *LeaderState) Init() Effects {
+	eff := Effects{}
+	s.spawnScout(&eff)
+	return eff
+}
+
+func (s *LeaderState) spawnScout(eff *Effects) {
+	eff.spawn(SpawnRequest{
+		Type:        v1.Scout,
+		Ballot:      s.ballotNumber,
+		Acceptors:   s.acceptors,
+		Auxiliaries: s.auxiliaries,
+		Engaged:     s.engaged,
+	})
+}
+
+func (s *LeaderState) spawnCommander(slot types.Slot, eff *Effects) {
+	command, found := s.proposals.Get(slot)
 	if !found {
 		log.Panicf("no command found for slot %v", slot)
 	}
 
 	pValue := types.PValue{
-		BN:      leader.ballotNumber,
+		BN:      s.ballotNumber,
 		Slot:    slot,
 		Command: command,
 	}
-	c := NewCommander(leader.exchange, leader.GetAddr(), leader.acceptors, pValue)
-	go c.Run()
-	ctxLog.Debugf("Spawned a new Commander")
+	eff.spawn(SpawnRequest{
+		Type:        v1.Commander,
+		Ballot:      s.ballotNumber,
+		PValue:      pValue,
+		Acceptors:   s.acceptors,
+		Auxiliaries: s.auxiliaries,
+		Engaged:     s.engaged,
+	})
 }
 
-func (leader *Leader) handleMessage(message v1.Message) {
+// Step - transition the state on the message, received at the time now
+func (s *LeaderState) Step(message v1.Message, now time.Time) Effects {
 	ctxLog := log.WithFields(log.Fields{
-		"Addr":   leader.GetAddr(),
-		"Method": "leader.handleMessage",
+		"Addr":   s.self,
+		"Method": "leader.Step",
 	})
 	ctxLog.Debugf("Recd a message of type %T", message)
 
+	eff := Effects{}
 	switch v := message.(type) {
 	case messages.ProposeMessage:
-		pm := message.(messages.ProposeMessage)
+		if s.fast {
+			// slots are assigned by the acceptors in fast rounds
+			ctxLog.Debugf("ignoring the proposal for slot %v in fast mode", v.Slot)
+			break
+		}
 		// Check if this slot has already been assigned here
-		if leader.proposals.Contains(pm.Slot) {
-			ctxLog.Debugf("the corresponding slot %v has been assigned", pm.Slot)
-			return
+		if s.proposals.Contains(v.Slot) {
+			ctxLog.Debugf("the corresponding slot %v has been assigned", v.Slot)
+			break
 		}
 
 		// Assign the slot to this command in this leader and spawn a new commander
-		leader.proposals.Assign(pm.Slot, pm.Command)
-		if !leader.active {
-			return
+		s.proposals.Assign(v.Slot, v.Command)
+		if !s.active {
+			break
 		}
 
-		leader.spawnNewCommander(pm.Slot)
+		s.spawnCommander(v.Slot, &eff)
 
 	case messages.AdoptedMessage:
-		am := message.(messages.AdoptedMessage)
-		if types.Compare(&leader.ballotNumber, &am.BallotNumber) != 0 {
-			return
+		if types.Compare(&s.ballotNumber, &v.BallotNumber) != 0 {
+			break
+		}
+		if s.fast {
+			s.adoptFast(v, &eff)
+			break
 		}
 
 		pMax := make(map[types.Slot]types.BallotNumber)
-		for pv, _ := range am.Accepted {
+		for pv, _ := range v.Accepted {
 			e, ok := pMax[pv.Slot]
 			if !ok || (types.Compare(&e, &pv.BN) < 0) {
 				pMax[pv.Slot] = pv.BN
-				leader.proposals.Assign(pv.Slot, pv.Command)
+				s.proposals.Assign(pv.Slot, pv.Command)
 			}
 		}
 
-		for slot, _ := range leader.proposals {
-			leader.spawnNewCommander(slot)
+		for _, slot := range sortedSlots(s.proposals) {
+			s.spawnCommander(slot, &eff)
 		}
 
 		// Activate the leader
-		leader.active = true
+		s.active = true
+		eff.emit(events.BallotAdopted{
+			Leader:  s.self,
+			Ballot:  s.ballotNumber,
+			PValues: len(v.Accepted),
+		})
 
 	case messages.PreemptMessage:
-		pm := message.(messages.PreemptMessage)
-		res := types.Compare(&pm.BallotNumber, &leader.ballotNumber)
+		res := types.Compare(&v.BallotNumber, &s.ballotNumber)
 		if res <= 0 {
 			ctxLog.Debugf("expected remote ballot-number to be greater could be a delayed message")
-			return
+			break
 		}
 
-		leader.active = false
-		leader.ballotNumber.Round++
-		leader.spawnNewScout()
+		s.active = false
+		eff.emit(events.BallotPreempted{
+			Leader: s.self,
+			Ballot: s.ballotNumber,
+			By:     v.BallotNumber,
+		})
+		s.ballotNumber.Round++
+		s.spawnScout(&eff)
+
+	case messages.FastVoteMessage:
+		s.handleFastVote(v, &eff)
+
+	case messages.AuxiliariesEngagedMessage:
+		s.handleAuxiliariesEngaged(v, now, &eff)
+
+	case messages.AcceptorConfigMessage:
+		s.handleAcceptorConfig(v)
 
 	default:
 		log.Panicf("Unknown message type %v", v)
 	}
+	return eff
+}
+
+// sortedSlots - the slots of the map, in ascending order
+func sortedSlots(m types.SlotCommandMap) []types.Slot {
+	result := make([]types.Slot, 0, len(m))
+	for slot := range m {
+		result = append(result, slot)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
 }
@@ -0,0 +1,49 @@
+package components
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestLeader_SpawnHook(t *testing.T) {
+	Convey("Given a leader which hands its scouts & commanders to a spawn hook", t, func() {
+		exchange := newFakeExchange()
+		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
+		spawned := make([]Child, 0)
+		leader := NewLeader(exchange, acceptors, WithSpawnHook(func(c Child) {
+			spawned = append(spawned, c)
+		}))
+
+		Convey("the scout of the initial ballot is spawned, but not started", func() {
+			leader.Start()
+			So(len(spawned), ShouldEqual, 1)
+			scout, ok := spawned[0].(*Scout)
+			So(ok, ShouldBeTrue)
+			So(scout.Owner(), ShouldResemble, leader.GetAddr())
+			So(exchange.SendCallCount(), ShouldEqual, 0)
+			So(leader.Snapshot().Scouts, ShouldBeEmpty)
+
+			Convey("once started it is driven one message at a time", func() {
+				scout.Start()
+				So(exchange.SendCallCount(), ShouldEqual, 3)
+				So(scout.Handle(messages.NewPhase1bMessage(acceptors[0], scout.bn, make(types.PValues))), ShouldBeTrue)
+				So(scout.Handle(messages.NewPhase1bMessage(acceptors[1], scout.bn, make(types.PValues))), ShouldBeFalse)
+				_, msg := exchange.SendArgsForCall(3)
+				_, ok := msg.(messages.AdoptedMessage)
+				So(ok, ShouldBeTrue)
+			})
+		})
+
+		Convey("a commander is spawned for a proposal once the ballot is adopted", func() {
+			leader.Handle(messages.NewAdoptedMessage(newFakeAddr(fakeScoutID, v1.Scout), leader.ballotNumber, make(types.PValues)))
+			leader.Handle(messages.NewProposedMessage(newFakeAddr(fakeLeaderID+50, v1.Replica), 1, newFakePValue(0, leader).Command))
+			So(len(spawned), ShouldEqual, 1)
+			cmdr, ok := spawned[0].(*Commander)
+			So(ok, ShouldBeTrue)
+			So(cmdr.Snapshot().PValue.Slot, ShouldEqual, types.Slot(1))
+		})
+	})
+}
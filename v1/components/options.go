@@ -0,0 +1,285 @@
+package components
+
+import (
+	"github.com/1xyz/paxossim/queue"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/history"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/quorum"
+	"github.com/1xyz/paxossim/v1/statemachine"
+)
+
+// Option - configures optional behaviour of a component
+type Option func(*options)
+
+type options struct {
+	// metrics are recorded to this registry, if set
+	metrics *metrics.Registry
+
+	// protocol events are emitted to this sink, if set
+	events events.Sink
+
+	// run Fast Paxos rounds, see fast.go
+	fast bool
+
+	// decisions are sent to the clients as well as the replicas
+	notifyClients bool
+
+	// phase 1 & phase 2 quorums of the scouts & commanders, a majority if nil
+	quorum quorum.System
+
+	// clients send each request to one of these, in turn, instead of every replica
+	targets []v1.Addr
+
+	// clients issue PUTs to this many keys, instead of opaque commands
+	keys int
+
+	// clients record the commands they request to this history, if set
+	history *history.History
+
+	// replicas apply the decided commands to this state machine, if set
+	stateMachine statemachine.StateMachine
+
+	// Cheap Paxos: acceptors contacted only when the main acceptors fail to respond, see cheap.go
+	auxiliaries []v1.Addr
+
+	// Cheap Paxos: scouts & commanders contact the auxiliaries right away
+	engaged bool
+
+	// the time, timeouts & tickers of the component, the real clock if nil
+	clock clock.Clock
+
+	// creates the clock of the component, instead of clock, if set
+	newClock func(addr v1.Addr) clock.Clock
+
+	// leaders hand the scouts & commanders they spawn to this func, instead of running them
+	spawn func(c Child)
+
+	// capacity & overflow policy of the component's inbox, unbounded if nil
+	inbox *queue.Options
+}
+
+func newOptions(opts []Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.clock = clock.OrReal(o.clock)
+	return o
+}
+
+// WithMetrics - record the component's metrics to the specified registry
+func WithMetrics(r *metrics.Registry) Option {
+	return func(o *options) {
+		o.metrics = r
+	}
+}
+
+// WithEventSink - emit the component's protocol events to the specified sink
+func WithEventSink(sink events.Sink) Option {
+	return func(o *options) {
+		o.events = sink
+	}
+}
+
+// WithFastPaxos - leaders open fast rounds once their ballot is adopted, and clients
+// send their requests directly to the acceptors
+func WithFastPaxos() Option {
+	return func(o *options) {
+		o.fast = true
+	}
+}
+
+// WithClientNotifications - leaders & commanders send every decision to the clients as well,
+// so that clients can measure the latency of their requests
+func WithClientNotifications() Option {
+	return func(o *options) {
+		o.notifyClients = true
+	}
+}
+
+// WithQuorum - scouts & commanders wait for the quorums of the specified system,
+// instead of a majority of the acceptors
+func WithQuorum(q quorum.System) Option {
+	return func(o *options) {
+		o.quorum = q
+	}
+}
+
+// WithRequestTargets - the client sends each request to one of the specified processes in
+// turn, instead of to every replica. Used by protocols in which any replica leads a command
+func WithRequestTargets(targets []v1.Addr) Option {
+	return func(o *options) {
+		o.targets = targets
+	}
+}
+
+// WithWorkloadKeys - the client issues "PUT k<j> <value>" commands over n keys, so that
+// commands interfere when they write the same key
+func WithWorkloadKeys(n int) Option {
+	return func(o *options) {
+		o.keys = n
+	}
+}
+
+// WithHistory - the client records every command it requests to the history
+func WithHistory(h *history.History) Option {
+	return func(o *options) {
+		o.history = h
+	}
+}
+
+// WithStateMachine - the replica applies every decided command to the specified state machine
+func WithStateMachine(sm statemachine.StateMachine) Option {
+	return func(o *options) {
+		o.stateMachine = sm
+	}
+}
+
+// WithAuxiliaryAcceptors - leaders, scouts & commanders contact their acceptors (the main
+// acceptors) only, and engage the auxiliary acceptors when the main ones do not form a quorum
+// in time (Cheap Paxos). Quorums are counted over the main & auxiliary acceptors alike
+func WithAuxiliaryAcceptors(auxiliaries []v1.Addr) Option {
+	return func(o *options) {
+		o.auxiliaries = auxiliaries
+	}
+}
+
+// withAuxiliariesEngaged - scouts & commanders contact the auxiliary acceptors right away
+func withAuxiliariesEngaged() Option {
+	return func(o *options) {
+		o.engaged = true
+	}
+}
+
+// WithSpawnHook - the leader hands every scout & commander it spawns to spawn, instead of running
+// it in a goroutine of its own. The caller starts the child and delivers its messages with Handle,
+// so that a cluster can be driven one message at a time (see package modelcheck)
+func WithSpawnHook(spawn func(c Child)) Option {
+	return func(o *options) {
+		o.spawn = spawn
+	}
+}
+
+// WithClock - the component reads the time, and waits for its timeouts & ticks, on the specified
+// clock instead of the host's, e.g. a clock.Fake advanced by a test
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithInbox - the component's inbox is a queue bounded by the specified options, instead of an
+// unbounded queue. Leaders pass the option on to the scouts & commanders they spawn. With
+// queue.Block, components which send to each other's full inboxes stall until they are stopped
+func WithInbox(inbox queue.Options) Option {
+	return func(o *options) {
+		o.inbox = &inbox
+	}
+}
+
+// newProcess - a process whose inbox is bounded by the configured options, if any
+func (o options) newProcess(id v1.ProcessID, pt v1.ProcessType) v1.Process {
+	if o.inbox == nil {
+		return v1.NewProcess(id, pt)
+	}
+	return v1.NewProcessWithInbox(id, pt, queue.NewBoundedQueue(*o.inbox))
+}
+
+// WithClocks - the component reads the time, and waits for its timeouts & ticks, on a clock of its
+// own created by the specified function, e.g. to skew the clock of a single process. The scouts &
+// commanders of a leader share the leader's clock
+func WithClocks(newClock func(addr v1.Addr) clock.Clock) Option {
+	return func(o *options) {
+		o.newClock = newClock
+	}
+}
+
+// clockOf - the clock of the component, the configured clock unless it has one of its own
+func (o options) clockOf(addr v1.Addr) clock.Clock {
+	if o.newClock == nil {
+		return o.clock
+	}
+	return clock.OrReal(o.newClock(addr))
+}
+
+// quorumOf - the configured quorum system, or a majority of the acceptors
+func (o options) quorumOf(acceptors []v1.Addr) quorum.System {
+	if o.quorum != nil {
+		return o.quorum
+	}
+	return quorum.NewMajority(acceptors)
+}
+
+// leaderMetrics - metrics recorded by a leader, labelled by the leader
+type leaderMetrics struct {
+	scouts      *metrics.CounterVec
+	commanders  *metrics.CounterVec
+	preemptions *metrics.CounterVec
+	round       *metrics.GaugeVec
+
+	fastDecisions  *metrics.CounterVec
+	fastRecoveries *metrics.CounterVec
+
+	engagements   *metrics.CounterVec
+	mainAcceptors *metrics.GaugeVec
+}
+
+func newLeaderMetrics(r *metrics.Registry) leaderMetrics {
+	return leaderMetrics{
+		scouts: r.Counter("paxos_scouts_spawned_total",
+			"Scouts spawned, by leader", "leader"),
+		commanders: r.Counter("paxos_commanders_spawned_total",
+			"Commanders spawned, by leader", "leader"),
+		preemptions: r.Counter("paxos_preemptions_total",
+			"Ballots of a leader preempted by a higher ballot", "leader"),
+		round: r.Gauge("paxos_ballot_round",
+			"Round of the leader's current ballot", "leader"),
+		fastDecisions: r.Counter("paxos_fast_decisions_total",
+			"Slots decided by a fast quorum of votes, by leader", "leader"),
+		fastRecoveries: r.Counter("paxos_fast_recoveries_total",
+			"Classic rounds started to recover from a collision or a stalled slot in a fast round", "leader", "reason"),
+		engagements: r.Counter("paxos_auxiliary_engagements_total",
+			"Scouts & commanders which engaged the auxiliary acceptors, by leader (Cheap Paxos)", "leader"),
+		mainAcceptors: r.Gauge("paxos_main_acceptors",
+			"Acceptors the leader contacts while the auxiliary acceptors are not engaged", "leader"),
+	}
+}
+
+// replicaMetrics - metrics recorded by a replica, labelled by the replica
+type replicaMetrics struct {
+	slotIn  *metrics.GaugeVec
+	slotOut *metrics.GaugeVec
+	slotLag *metrics.GaugeVec
+	latency *metrics.HistogramVec
+	decided *metrics.CounterVec
+}
+
+func newReplicaMetrics(r *metrics.Registry) replicaMetrics {
+	return replicaMetrics{
+		slotIn: r.Gauge("paxos_replica_slot_in",
+			"Next slot the replica can propose to", "replica"),
+		slotOut: r.Gauge("paxos_replica_slot_out",
+			"Next slot the replica needs a decision for", "replica"),
+		slotLag: r.Gauge("paxos_replica_slot_lag",
+			"Slots proposed by the replica which are not decided yet (slot_in - slot_out)", "replica"),
+		latency: r.Histogram("paxos_decision_latency_seconds",
+			"Time from the replica proposing a slot to learning its decision", metrics.DefBuckets, "replica"),
+		decided: r.Counter("paxos_decisions_total",
+			"Decision messages received by the replica", "replica"),
+	}
+}
+
+// clientMetrics - metrics recorded by a client, labelled by the client
+type clientMetrics struct {
+	latency *metrics.HistogramVec
+}
+
+func newClientMetrics(r *metrics.Registry) clientMetrics {
+	return clientMetrics{
+		latency: r.Histogram("paxos_client_latency_seconds",
+			"Time from the client sending a request to receiving its decision", metrics.DefBuckets, "client"),
+	}
+}
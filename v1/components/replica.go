@@ -2,9 +2,15 @@ package components
 
 import (
 	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
 	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/statemachine"
 	"github.com/1xyz/paxossim/v1/types"
 	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
 )
 
 const (
@@ -13,13 +19,38 @@ const (
 	InitialRequestSize            = 100
 )
 
-var replicaCount = 0
-
 type Replica struct {
 	v1.Process
 
+	ReplicaState
+
 	exchange v1.MessageExchange
 
+	// guards the replica's state against concurrent readers
+	mu *sync.Mutex
+
+	// time at which this replica proposed a slot which is not decided yet
+	proposedAt map[types.Slot]time.Time
+
+	metrics replicaMetrics
+
+	// label identifying this replica in its metrics
+	label string
+
+	events events.Sink
+
+	// decided commands are applied to this state machine, if set
+	stateMachine statemachine.StateMachine
+
+	// the time at which slots are proposed & decided
+	clock clock.Clock
+}
+
+// ReplicaState - the state of a replica, transitioned by Step
+type ReplicaState struct {
+	// the replica's address, the source of its messages
+	self v1.Addr
+
 	// Index of the next slot which can be proposed
 	slotIn types.Slot
 
@@ -39,20 +70,43 @@ type Replica struct {
 	leaders []v1.Addr
 }
 
-func NewReplica(exchange v1.MessageExchange, leaders []v1.Addr) *Replica {
-	processID := replicaCount
-	replicaCount++
-
-	r := &Replica{
-		Process:   v1.NewProcess(v1.ProcessID(processID), v1.Replica),
+// NewReplicaState - the state of a replica which proposed nothing yet
+func NewReplicaState(self v1.Addr, leaders []v1.Addr) ReplicaState {
+	return ReplicaState{
+		self:      self,
 		slotIn:    InitialSlotID,
 		slotOut:   InitialSlotID,
 		requests:  make([]types.Command, 0, InitialRequestSize),
 		proposals: make(types.SlotCommandMap),
 		decisions: make(types.SlotCommandMap),
-		exchange:  exchange,
 		leaders:   leaders,
 	}
+}
+
+// Copy - a copy of the state, sharing nothing which a step changes
+func (s ReplicaState) Copy() ReplicaState {
+	result := s
+	result.requests = append(make([]types.Command, 0, len(s.requests)), s.requests...)
+	result.proposals = copySlotCommands(s.proposals)
+	result.decisions = copySlotCommands(s.decisions)
+	return result
+}
+
+func NewReplica(exchange v1.MessageExchange, leaders []v1.Addr, opts ...Option) *Replica {
+	o := newOptions(opts)
+	p := o.newProcess(v1.AllocateID(exchange, v1.Replica), v1.Replica)
+	r := &Replica{
+		Process:      p,
+		ReplicaState: NewReplicaState(p.GetAddr(), leaders),
+		exchange:     exchange,
+		mu:           &sync.Mutex{},
+		proposedAt:   make(map[types.Slot]time.Time),
+		metrics:      newReplicaMetrics(o.metrics),
+		label:        metrics.Label(p.GetAddr()),
+		events:       o.events,
+		stateMachine: o.stateMachine,
+		clock:        o.clockOf(p.GetAddr()),
+	}
 
 	err := exchange.Register(r)
 	if err != nil {
@@ -66,50 +120,123 @@ func (r *Replica) Run() {
 
 	for {
 		msg, err := r.Process.Recv()
+		if err == v1.ErrProcessClosed {
+			ctxLog.Debugf("process closed")
+			return
+		}
 		if err != nil {
 			ctxLog.Panicf("error in inbox recv %v", err)
 		}
 
-		r.handleMessage(msg)
-		r.propose()
+		r.Handle(msg)
 	}
 }
 
-func (r *Replica) handleMessage(message v1.Message) {
-	ctxLog := log.WithFields(log.Fields{"Addr": r.GetAddr(), "Method": "handleMessage"})
+// Handle - synchronously process a single message, as Run does for every message in the inbox
+func (r *Replica) Handle(message v1.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := message.(messages.DecisionMessage); ok {
+		r.metrics.decided.Inc(r.label)
+	}
+	r.carryOut(r.Step(message))
+}
+
+// carryOut - apply the performed commands to the state machine, send the messages of the effects
+// and emit their events, and record them in the replica's metrics
+func (r *Replica) carryOut(eff Effects) {
+	for i, e := range eff.Events {
+		if p, ok := e.(events.CommandPerformed); ok && r.stateMachine != nil {
+			p.Result = r.stateMachine.Apply(p.Command)
+			eff.Events[i] = p
+		}
+	}
+	carryOut(r.exchange, r.events, eff)
+
+	for _, e := range eff.Events {
+		if d, ok := e.(events.SlotDecided); ok {
+			if t, ok := r.proposedAt[d.Slot]; ok {
+				r.metrics.latency.Observe(clock.Since(r.clock, t).Seconds(), r.label)
+				delete(r.proposedAt, d.Slot)
+			}
+		}
+	}
+	for _, o := range eff.Outbound {
+		if pm, ok := o.Message.(messages.ProposeMessage); ok {
+			r.proposedAt[pm.Slot] = r.clock.Now()
+		}
+	}
+	r.recordSlots()
+}
+
+// recordSlots - export the replica's slot window to its metrics
+func (r *Replica) recordSlots() {
+	r.metrics.slotIn.Set(float64(r.slotIn), r.label)
+	r.metrics.slotOut.Set(float64(r.slotOut), r.label)
+	r.metrics.slotLag.Set(float64(r.slotIn-r.slotOut), r.label)
+}
+
+// Decisions - a copy of the commands decided so far, indexed by slot
+func (r *Replica) Decisions() types.SlotCommandMap {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return copySlotCommands(r.decisions)
+}
+
+// Step - transition the state on the message, and propose the pending requests the window admits
+func (s *ReplicaState) Step(message v1.Message) Effects {
+	eff := Effects{}
+	s.handleMessage(message, &eff)
+	s.propose(&eff)
+	return eff
+}
+
+func (s *ReplicaState) handleMessage(message v1.Message, eff *Effects) {
+	ctxLog := log.WithFields(log.Fields{"Addr": s.self, "Method": "handleMessage"})
 
 	switch v := message.(type) {
 	case messages.RequestMessage:
-		rm := message.(messages.RequestMessage)
-		ctxLog.Debugf("Received Requestmessage: [%v]", rm)
-		r.requests = append(r.requests, rm.Command)
+		ctxLog.Debugf("Received Requestmessage: [%v]", v)
+		if _, ok := v.Command.(*types.ReConfigCommand); ok {
+			// proposed ahead of the client requests, e.g. to replace a failed acceptor
+			s.requests = append([]types.Command{v.Command}, s.requests...)
+		} else {
+			s.requests = append(s.requests, v.Command)
+		}
 
 	case messages.DecisionMessage:
-		dm := message.(messages.DecisionMessage)
-		ctxLog.Debugf("%v", dm)
+		ctxLog.Debugf("%v", v)
 
-		// ToDo: check to see if a command already exists
+		if prev, ok := s.decisions[v.Slot]; ok && prev != v.Command {
+			// only a Byzantine process can decide a slot twice, keep the command this
+			// replica may have performed already
+			ctxLog.Warnf("slot %v decided as [%v] and as [%v]", v.Slot, prev, v.Command)
+			return
+		}
 		// record the slot for the decided command
-		r.decisions[dm.Slot] = dm.Command
+		if !s.decisions.Contains(v.Slot) {
+			eff.emit(events.SlotDecided{Replica: s.self, Slot: v.Slot, Command: v.Command})
+		}
+		s.decisions[v.Slot] = v.Command
 
 		// run through all decisions starting from slotOut
 		// and attempt to apply them until we find an undecided slot
-		for r.decisions.Contains(r.slotOut) {
-			decidedCmd := r.decisions[r.slotOut]
+		for s.decisions.Contains(s.slotOut) {
+			decidedCmd := s.decisions[s.slotOut]
 			// check to see if this replica made a proposal for this slotOut
-			if r.proposals.Contains(r.slotOut) {
-				proposedCmd := r.proposals[r.slotOut]
+			if s.proposals.Contains(s.slotOut) {
+				proposedCmd := s.proposals[s.slotOut]
 				if proposedCmd != decidedCmd {
 					// looks like the leader decided another slot for slotOut
 					// ReQueue this command back to the request queue
-					r.requests = append(r.requests, proposedCmd)
+					s.requests = append(s.requests, proposedCmd)
 				}
 				// this command is either re-queued or decided so remove
 				// from the proposal queue
-				r.proposals.Remove(r.slotOut)
+				s.proposals.Remove(s.slotOut)
 			}
-			r.perform(decidedCmd)
-			r.slotOut++
+			s.perform(decidedCmd, eff)
+			s.slotOut++
 		}
 
 	default:
@@ -119,59 +246,68 @@ func (r *Replica) handleMessage(message v1.Message) {
 
 // propose - if there are any pending requests, create proposals by assigning slots to
 // the request's command and send to leaders
-func (r *Replica) propose() {
+func (s *ReplicaState) propose(eff *Effects) {
 	for {
 		// check to see if the requests queue is empty or if we have reached the window limit
-		if len(r.requests) == 0 || r.slotIn >= (r.slotOut+Window) {
+		if len(s.requests) == 0 || s.slotIn >= (s.slotOut+Window) {
 			break
 		}
 
 		// Dequeue this request from the requests queue
-		req := r.requests[0]
-		r.requests = r.requests[1:]
+		req := s.requests[0]
+		s.requests = s.requests[1:]
 
 		// check to see if a reconfiguration command needs to be applied
-		if r.slotIn > Window && r.decisions.Contains(r.slotIn-Window) {
-			cmd, ok := r.proposals[r.slotIn-Window].(types.ReConfigCommand)
+		if s.slotIn > Window && s.decisions.Contains(s.slotIn-Window) {
+			cmd, ok := s.decisions[s.slotIn-Window].(*types.ReConfigCommand)
 			if ok {
-				log.Debugf("Updating configuration %v", cmd.NewLeaders)
-				r.leaders = cmd.NewLeaders
+				log.Debugf("Updating configuration %v %v", cmd.NewLeaders, cmd.NewAcceptors)
+				if cmd.NewLeaders != nil {
+					s.leaders = cmd.NewLeaders
+				}
+				if cmd.NewAcceptors != nil {
+					// the leaders switch to the new main acceptors
+					eff.sendAll(v1.Leader, messages.NewAcceptorConfigMessage(s.self, s.slotIn-Window, cmd.NewAcceptors))
+				}
+				eff.emit(events.ConfigChanged{
+					Replica:   s.self,
+					Slot:      s.slotIn - Window,
+					Leaders:   cmd.NewLeaders,
+					Acceptors: cmd.NewAcceptors,
+				})
 			}
 		}
 
 		// enqueue this proposal and sent it to all leaders
-		r.proposals[r.slotIn] = req
-		pm := messages.NewProposedMessage(r.GetAddr(), r.slotIn, req)
-		for _, addr := range r.leaders {
-			err := r.exchange.Send(addr, pm)
-			if err != nil {
-				log.Panicf("exchange.Send error %v", err)
-			}
+		s.proposals[s.slotIn] = req
+		pm := messages.NewProposedMessage(s.self, s.slotIn, req)
+		for _, addr := range s.leaders {
+			eff.send(addr, pm)
 		}
-		r.slotIn++
+		s.slotIn++
 	}
 }
 
-func (r *Replica) perform(command types.Command) {
+func (s *ReplicaState) perform(command types.Command, eff *Effects) {
 	// Different replicas might have proposed the same command for
 	// different slots. In this case we don't really want to apply
 	// the command at this replica more than once
-	for slot := InitialSlotID; slot < r.slotOut; slot++ {
+	for slot := InitialSlotID; slot < s.slotOut; slot++ {
 		// log.Infof("slot %v command %v decisions[slot]: %v", slot, command, r.Decisions[slot])
-		if r.decisions[slot] == command {
+		if s.decisions[slot] == command {
 			// log.Infof("Command %v detected in decision history", command)
 			return
 		}
 	}
 
-	recfgCommand, ok := command.(types.ReConfigCommand)
+	recfgCommand, ok := command.(*types.ReConfigCommand)
 	if ok {
 		log.Debugf("Reconfig command %v", recfgCommand)
 		// ToDo: we needd to apply the updated configuration
 		return
 	}
 
-	// ToDo: Apply state here!!
+	eff.emit(events.CommandPerformed{Replica: s.self, Slot: s.slotOut, Command: command})
 	log.Infof("(%v, %v, %v) r=%v-%v",
-		command.GetClientID(), command.GetCommandID(), command.GetOp(), r.Type(), r.ID())
+		command.GetClientID(), command.GetCommandID(), command.GetOp(), s.self.Type(), s.self.ID())
 }
@@ -5,14 +5,13 @@ import (
 	v1 "github.com/1xyz/paxossim/v1"
 	"github.com/1xyz/paxossim/v1/messages"
 	"github.com/1xyz/paxossim/v1/types"
-	"github.com/1xyz/paxossim/v1/v1fakes"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 )
 
 func TestNewReplica(t *testing.T) {
 	Convey("When a new replica is created", t, func() {
-		r := NewReplica(&v1fakes.FakeMessageExchange{}, make([]v1.Addr, 0, 3))
+		r := NewReplica(newFakeExchange(), make([]v1.Addr, 0, 3))
 
 		Convey("the resulting ptr should not be nil", func() {
 			So(r, ShouldNotBeNil)
@@ -37,19 +36,19 @@ func TestNewReplica(t *testing.T) {
 func TestReplica_Proposal(t *testing.T) {
 	Convey("Given a replica", t, func() {
 
-		fakeExchange := v1fakes.FakeMessageExchange{}
+		fakeExchange := newFakeExchange()
 		leaders := newLeaders()
-		r := NewReplica(&fakeExchange, leaders)
+		r := NewReplica(fakeExchange, leaders)
 
 		Convey("When a new request is sent to it", func() {
-			r.handleMessage(newTestRequestMessage("1"))
+			r.handleMessage(newTestRequestMessage("1"), &Effects{})
 
 			Convey("the request is queued", func() {
 				So(1, ShouldEqual, len(r.requests))
 			})
 
 			Convey("When a command is proposed for that request", func() {
-				r.propose()
+				propose(r)
 
 				Convey("The slotIn should increment", func() {
 					So(r.slotIn, ShouldEqual, types.Slot(2))
@@ -89,15 +88,15 @@ func TestReplica_Proposal(t *testing.T) {
 
 func TestReplica_ProposalReachesWindowLimit(t *testing.T) {
 	Convey("Given a new replica", t, func() {
-		fakeExchange := v1fakes.FakeMessageExchange{}
+		fakeExchange := newFakeExchange()
 		leaders := newLeaders()
 
-		r := NewReplica(&fakeExchange, leaders)
+		r := NewReplica(fakeExchange, leaders)
 
 		Convey("When the window limit is reached", func() {
 			for i := 0; i < int(Window)+1; i++ {
-				r.handleMessage(newTestRequestMessage(fmt.Sprintf("%d", i)))
-				r.propose()
+				r.handleMessage(newTestRequestMessage(fmt.Sprintf("%d", i)), &Effects{})
+				propose(r)
 			}
 
 			Convey("new requests are queued to the request queue", func() {
@@ -109,20 +108,20 @@ func TestReplica_ProposalReachesWindowLimit(t *testing.T) {
 
 func TestReplica_NewDecisionMatchingProposal(t *testing.T) {
 	Convey("Given a new replica", t, func() {
-		fakeExchange := v1fakes.FakeMessageExchange{}
+		fakeExchange := newFakeExchange()
 		leaders := newLeaders()
 
-		r := NewReplica(&fakeExchange, leaders)
+		r := NewReplica(fakeExchange, leaders)
 		requestMessage := newTestRequestMessage("1")
 		slot := r.slotIn
 
 		Convey("And new proposal is sent to the leades", func() {
-			r.handleMessage(requestMessage)
-			r.propose()
+			r.handleMessage(requestMessage, &Effects{})
+			propose(r)
 
 			Convey("And a decision is received matching the proposal", func() {
 				decisionMessage := messages.NewDecisionMessage(leaders[0], slot, requestMessage.Command)
-				r.handleMessage(decisionMessage)
+				r.handleMessage(decisionMessage, &Effects{})
 
 				Convey("Decision is added to the decision map", func() {
 					So(1, ShouldEqual, len(r.decisions))
@@ -144,16 +143,16 @@ func TestReplica_NewDecisionMatchingProposal(t *testing.T) {
 func TestReplica_NewDecisionNotMatchingProposal(t *testing.T) {
 	Convey("Given a new replica", t, func() {
 
-		fakeExchange := v1fakes.FakeMessageExchange{}
+		fakeExchange := newFakeExchange()
 		leaders := newLeaders()
 
-		r := NewReplica(&fakeExchange, leaders)
+		r := NewReplica(fakeExchange, leaders)
 		requestMessage := newTestRequestMessage("1")
 		slot := r.slotIn
 
 		Convey("And new proposal is sent to the leades", func() {
-			r.handleMessage(requestMessage)
-			r.propose()
+			r.handleMessage(requestMessage, &Effects{})
+			propose(r)
 
 			Convey("And a decision is received not-matching the proposal for that slot", func() {
 				unmatchedCommand := types.BasicCommand{
@@ -163,7 +162,7 @@ func TestReplica_NewDecisionNotMatchingProposal(t *testing.T) {
 				}
 
 				decisionMessage := messages.NewDecisionMessage(leaders[0], slot, unmatchedCommand)
-				r.handleMessage(decisionMessage)
+				r.handleMessage(decisionMessage, &Effects{})
 
 				Convey("Decision is added to the decision map", func() {
 					So(1, ShouldEqual, len(r.decisions))
@@ -184,3 +183,10 @@ func TestReplica_NewDecisionNotMatchingProposal(t *testing.T) {
 		})
 	})
 }
+
+// propose - propose the pending requests of the replica to its leaders
+func propose(r *Replica) {
+	eff := Effects{}
+	r.propose(&eff)
+	r.carryOut(eff)
+}
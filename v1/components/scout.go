@@ -2,19 +2,32 @@ package components
 
 import (
 	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
 	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/quorum"
 	"github.com/1xyz/paxossim/v1/types"
 	log "github.com/sirupsen/logrus"
-	"sync/atomic"
+	"sync"
 )
 
-var scoutCount int32 = 0
-
 type Scout struct {
 	v1.Process
 
+	ScoutState
+
 	exchange v1.MessageExchange
 
+	clock clock.Clock
+
+	// guards the scout's state against concurrent readers
+	mu *sync.Mutex
+}
+
+// ScoutState - the state of a scout, transitioned by Step
+type ScoutState struct {
+	// the scout's address, the source of its messages
+	self v1.Addr
+
 	leader v1.Addr
 
 	acceptors []v1.Addr
@@ -22,18 +35,68 @@ type Scout struct {
 	bn types.BallotNumber
 
 	pvalues types.PValues
+
+	// number of acceptors which reported each pvalue
+	votes map[types.PValue]int
+
+	// acceptors which have not responded yet
+	waitFor v1.AddrSet
+
+	// acceptors which adopted the ballot
+	acks v1.AddrSet
+
+	quorum quorum.System
+
+	// Cheap Paxos: auxiliary acceptors contacted only if the main acceptors do not respond
+	auxiliaries []v1.Addr
+
+	// contact the auxiliary acceptors right away
+	engaged bool
+
+	// the ballot was adopted or preempted, the scout exits
+	done bool
 }
 
-func NewScout(exchange v1.MessageExchange, leader v1.Addr, acceptors []v1.Addr, number types.BallotNumber) *Scout {
-	id := atomic.AddInt32(&scoutCount, 1)
-	processID := v1.ProcessID(id)
-	s := &Scout{
-		exchange:  exchange,
-		Process:   v1.NewProcess(processID, v1.Scout),
+// NewScoutState - the state of a scout of the leader's ballot, which contacted no acceptor yet
+func NewScoutState(self v1.Addr, leader v1.Addr, acceptors []v1.Addr, number types.BallotNumber, opts ...Option) ScoutState {
+	o := newOptions(opts)
+	return ScoutState{
+		self:      self,
 		leader:    leader,
 		acceptors: acceptors,
 		bn:        number,
 		pvalues:   make(types.PValues),
+		votes:     make(map[types.PValue]int),
+		waitFor:   make(v1.AddrSet),
+		acks:      make(v1.AddrSet),
+		quorum:    o.quorumOf(acceptors),
+
+		auxiliaries: o.auxiliaries,
+		engaged:     o.engaged,
+	}
+}
+
+// Copy - a copy of the state, sharing nothing which a step changes
+func (s ScoutState) Copy() ScoutState {
+	result := s
+	result.pvalues = s.pvalues.Copy()
+	result.votes = make(map[types.PValue]int, len(s.votes))
+	for pv, n := range s.votes {
+		result.votes[pv] = n
+	}
+	result.waitFor = copyAddrSet(s.waitFor)
+	result.acks = copyAddrSet(s.acks)
+	return result
+}
+
+func NewScout(exchange v1.MessageExchange, leader v1.Addr, acceptors []v1.Addr, number types.BallotNumber, opts ...Option) *Scout {
+	p := newOptions(opts).newProcess(v1.AllocateID(exchange, v1.Scout), v1.Scout)
+	s := &Scout{
+		Process:    p,
+		ScoutState: NewScoutState(p.GetAddr(), leader, acceptors, number, opts...),
+		exchange:   exchange,
+		clock:      newOptions(opts).clock,
+		mu:         &sync.Mutex{},
 	}
 
 	exchange.Register(s)
@@ -42,20 +105,23 @@ func NewScout(exchange v1.MessageExchange, leader v1.Addr, acceptors []v1.Addr,
 
 func (scout *Scout) Run() {
 	ctxLog := log.WithFields(log.Fields{"Addr": scout.GetAddr(), "Method": "Scout.Run"})
-	addrSet := scout.broadcastToAcceptors()
+	scout.Start()
+	if !scout.engaged && len(scout.auxiliaries) > 0 {
+		timer := scheduleEngage(scout, scout.clock)
+		defer timer.Stop()
+	}
 
 	for {
 		msg, err := scout.Process.Recv()
+		if err == v1.ErrProcessClosed {
+			ctxLog.Debugf("process closed")
+			break
+		}
 		if err != nil {
 			ctxLog.Panicf("error in inbox recv %v", err)
 		}
 
-		phase1bMessage, ok := msg.(messages.Phase1bMessage)
-		if !ok {
-			ctxLog.Panicf("unknown message type %v", msg)
-		}
-
-		if !scout.handleMessage(phase1bMessage, &addrSet) {
+		if !scout.Handle(msg) {
 			break
 		}
 	}
@@ -65,45 +131,85 @@ func (scout *Scout) Run() {
 		ctxLog.Panicf("scout.exchange.UnRegister %v", err)
 	}
 }
-func (scout *Scout) broadcastToAcceptors() v1.AddrSet {
-	addrSet := make(v1.AddrSet)
-	phase1aMessage := messages.NewPhase1aMessage(scout.GetAddr(), scout.bn)
-	for _, acceptor := range scout.acceptors {
-		err := scout.exchange.Send(acceptor, phase1aMessage)
-		if err != nil {
-			log.Panicf("scout.exchange.send failed %v", err)
-		}
 
-		addrSet.Add(acceptor)
-	}
+// Start - send the phase 1a messages to the acceptors, before any response is handled
+func (scout *Scout) Start() {
+	scout.mu.Lock()
+	defer scout.mu.Unlock()
+	carryOut(scout.exchange, nil, scout.Init())
+}
+
+// Handle - synchronously process a single message, as Run does for every message in the inbox.
+// Returns false once the scout is done
+func (scout *Scout) Handle(message v1.Message) bool {
+	scout.mu.Lock()
+	defer scout.mu.Unlock()
+	carryOut(scout.exchange, nil, scout.Step(message))
+	return !scout.done
+}
 
-	return addrSet
+// Owner - the leader which spawned this scout
+func (scout *Scout) Owner() v1.Addr {
+	return scout.leader
 }
 
-func (scout *Scout) handleMessage(phase1bMessage messages.Phase1bMessage, addrSet *v1.AddrSet) bool {
-	majority := float64(len(scout.acceptors)) / 2
+// Init - the effects of starting the scout: the phase 1a messages to the acceptors
+func (s *ScoutState) Init() Effects {
+	eff := Effects{}
+	phase1aMessage := messages.NewPhase1aMessage(s.self, s.bn)
+	s.waitFor = make(v1.AddrSet)
+	for _, acceptor := range s.acceptors {
+		eff.send(acceptor, phase1aMessage)
+		s.waitFor.Add(acceptor)
+	}
+	if s.engaged {
+		s.engage(&eff, false)
+	}
+	return eff
+}
 
-	if types.Compare(&scout.bn, &phase1bMessage.BallotNumber) == 0 && addrSet.Contains(phase1bMessage.Src()) {
-		addrSet.Remove(phase1bMessage.Src())
-		scout.pvalues.Update(phase1bMessage.PValues)
-		if float64(addrSet.Len()) < majority {
-			adoptedMessage := messages.NewAdoptedMessage(scout.GetAddr(), scout.bn, scout.pvalues)
-			err := scout.exchange.Send(scout.leader, adoptedMessage)
-			if err != nil {
-				log.Panicf("scout.exchange.send failed %v", err)
-			}
+// Step - transition the state on the message
+func (s *ScoutState) Step(message v1.Message) Effects {
+	eff := Effects{}
+	switch v := message.(type) {
+	case engageMessage:
+		s.engage(&eff, true)
+	case messages.Phase1bMessage:
+		s.handlePhase1b(v, &eff)
+	default:
+		log.WithFields(log.Fields{"Addr": s.self}).Panicf("unknown message type %v", message)
+	}
+	return eff
+}
 
-			return false
+// engage - contact the auxiliary acceptors as well
+func (s *ScoutState) engage(eff *Effects, report bool) {
+	if len(s.auxiliaries) == 0 {
+		return
+	}
+	engageAuxiliaries(eff, s.self, s.leader, s.bn,
+		messages.NewPhase1aMessage(s.self, s.bn), s.auxiliaries, s.waitFor, report)
+}
+
+// handlePhase1b - count the acceptor if it promised the ballot, and give up on a higher ballot.
+// Other responses are ignored, e.g. a duplicate from an acceptor counted already
+func (s *ScoutState) handlePhase1b(phase1bMessage messages.Phase1bMessage, eff *Effects) {
+	cmp := types.Compare(&phase1bMessage.BallotNumber, &s.bn)
+	if cmp == 0 && s.waitFor.Contains(phase1bMessage.Src()) {
+		s.waitFor.Remove(phase1bMessage.Src())
+		s.acks.Add(phase1bMessage.Src())
+		s.pvalues.Update(phase1bMessage.PValues)
+		for pv := range phase1bMessage.PValues {
+			s.votes[pv]++
 		}
-	} else {
-		premptedMessage := messages.NewPremptedMessage(scout.GetAddr(), phase1bMessage.BallotNumber)
-		err := scout.exchange.Send(scout.leader, premptedMessage)
-		if err != nil {
-			log.Panicf("scout.exchange.send failed %v", err)
+		if s.quorum.Phase1(s.acks) {
+			adoptedMessage := messages.NewAdoptedMessage(s.self, s.bn, s.pvalues)
+			adoptedMessage.Votes = s.votes
+			eff.send(s.leader, adoptedMessage)
+			s.done = true
 		}
-
-		return false
+	} else if cmp > 0 {
+		eff.send(s.leader, messages.NewPremptedMessage(s.self, phase1bMessage.BallotNumber))
+		s.done = true
 	}
-
-	return true
 }
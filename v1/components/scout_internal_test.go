@@ -4,14 +4,13 @@ import (
 	v1 "github.com/1xyz/paxossim/v1"
 	"github.com/1xyz/paxossim/v1/messages"
 	"github.com/1xyz/paxossim/v1/types"
-	"github.com/1xyz/paxossim/v1/v1fakes"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
 )
 
 func TestNewScout(t *testing.T) {
 	Convey("when a new scout is initialized", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
 		scout := NewScout(exchange, leader, acceptors, newFakeBallot(0, leader))
@@ -24,7 +23,7 @@ func TestNewScout(t *testing.T) {
 
 func TestScout_PreEmptsOnNewerBallot(t *testing.T) {
 	Convey("Given a commander configured for a ballot number", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
 		scout := NewScout(exchange, leader, acceptors, newFakeBallot(0, leader))
@@ -32,7 +31,8 @@ func TestScout_PreEmptsOnNewerBallot(t *testing.T) {
 		Convey("when it receives a phase1 response with a newer Ballot number", func() {
 			newBN := newFakeBallot(3, newFakeAddr(fakeLeaderID+10, v1.Leader))
 			responders := makeSet(acceptors)
-			bContinue := scout.handleMessage(messages.NewPhase1bMessage(acceptors[0], newBN, nil), &responders)
+			scout.waitFor = responders
+			bContinue := scout.Handle(messages.NewPhase1bMessage(acceptors[0], newBN, nil))
 
 			Convey("the scout signals an exit", func() {
 				So(bContinue, ShouldBeFalse)
@@ -61,7 +61,7 @@ func TestScout_PreEmptsOnNewerBallot(t *testing.T) {
 
 func TestScout_AdoptsOnMatchingBallot(t *testing.T) {
 	Convey("Given a scout configured for a ballot number", t, func() {
-		exchange := &v1fakes.FakeMessageExchange{}
+		exchange := newFakeExchange()
 		leader := newFakeAddr(fakeLeaderID, v1.Leader)
 		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
 		bn := newFakeBallot(10, leader)
@@ -69,11 +69,12 @@ func TestScout_AdoptsOnMatchingBallot(t *testing.T) {
 
 		Convey("when it receives a phase1response for the same ballotNumber", func() {
 			responders := makeSet(acceptors)
+			scout.waitFor = responders
 			pValues := make(types.PValues)
 			pValues.Set(newFakePValue(8, leader))
 
 			Convey("from one acceptor", func() {
-				bContinue := scout.handleMessage(messages.NewPhase1bMessage(acceptors[0], bn, pValues), &responders)
+				bContinue := scout.Handle(messages.NewPhase1bMessage(acceptors[0], bn, pValues))
 
 				Convey("it continues to wait for more responses", func() {
 					So(bContinue, ShouldBeTrue)
@@ -86,7 +87,7 @@ func TestScout_AdoptsOnMatchingBallot(t *testing.T) {
 
 				Convey("and from a majority of acceptors", func() {
 					pValues.Set(newFakePValue(7, leader))
-					bContinue := scout.handleMessage(messages.NewPhase1bMessage(acceptors[1], bn, pValues), &responders)
+					bContinue := scout.Handle(messages.NewPhase1bMessage(acceptors[1], bn, pValues))
 
 					Convey("it signals an exit", func() {
 						So(bContinue, ShouldBeFalse)
@@ -125,3 +126,29 @@ func TestScout_AdoptsOnMatchingBallot(t *testing.T) {
 }
 
 //
+
+func TestScout_IgnoresDuplicateResponses(t *testing.T) {
+	Convey("Given a scout which counted the phase 1b of one of its 3 acceptors", t, func() {
+		exchange := newFakeExchange()
+		leader := newFakeAddr(fakeLeaderID, v1.Leader)
+		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
+		bn := newFakeBallot(2, leader)
+		scout := NewScout(exchange, leader, acceptors, bn)
+		scout.Start()
+		So(scout.Handle(messages.NewPhase1bMessage(acceptors[0], bn, nil)), ShouldBeTrue)
+		sent := exchange.SendCallCount()
+
+		Convey("a duplicate of the phase 1b, or a response of a lower ballot, is ignored", func() {
+			So(scout.Handle(messages.NewPhase1bMessage(acceptors[0], bn, nil)), ShouldBeTrue)
+			So(scout.Handle(messages.NewPhase1bMessage(acceptors[1], newFakeBallot(1, leader), nil)), ShouldBeTrue)
+			So(exchange.SendCallCount(), ShouldEqual, sent)
+
+			Convey("and the ballot is adopted once another acceptor promised it", func() {
+				So(scout.Handle(messages.NewPhase1bMessage(acceptors[1], bn, nil)), ShouldBeFalse)
+				_, msg := exchange.SendArgsForCall(sent)
+				_, ok := msg.(messages.AdoptedMessage)
+				So(ok, ShouldBeTrue)
+			})
+		})
+	})
+}
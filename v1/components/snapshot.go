@@ -0,0 +1,253 @@
+package components
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+)
+
+// AcceptorSnapshot - the state of an acceptor at a point in time
+type AcceptorSnapshot struct {
+	Addr v1.Addr
+
+	// Last adopted ballot number, nil if no ballot was adopted yet
+	BallotNumber *types.BallotNumber
+
+	// Number of pvalues accepted so far
+	Accepted int
+
+	// Number of messages waiting in the inbox
+	InboxLen int
+}
+
+// Snapshot - a copy of the acceptor's state, safe to take while it runs
+func (accp *Acceptor) Snapshot() AcceptorSnapshot {
+	accp.mu.Lock()
+	defer accp.mu.Unlock()
+	var bn *types.BallotNumber
+	if accp.BN != nil {
+		b := *accp.BN
+		bn = &b
+	}
+	return AcceptorSnapshot{
+		Addr:         accp.GetAddr(),
+		BallotNumber: bn,
+		Accepted:     len(accp.Accepted),
+		InboxLen:     accp.InboxLen(),
+	}
+}
+
+// ScoutSnapshot - the state of a scout at a point in time
+type ScoutSnapshot struct {
+	Addr v1.Addr
+
+	// Leader which spawned this scout
+	Leader v1.Addr
+
+	BallotNumber types.BallotNumber
+
+	// Acceptors which have not responded yet
+	WaitFor []v1.Addr
+
+	// Number of pvalues reported by the acceptors so far
+	PValues int
+}
+
+// Snapshot - a copy of the scout's state, safe to take while it runs
+func (scout *Scout) Snapshot() ScoutSnapshot {
+	scout.mu.Lock()
+	defer scout.mu.Unlock()
+	return ScoutSnapshot{
+		Addr:         scout.GetAddr(),
+		Leader:       scout.leader,
+		BallotNumber: scout.bn,
+		WaitFor:      sortedAddrs(scout.waitFor),
+		PValues:      len(scout.pvalues),
+	}
+}
+
+// CommanderSnapshot - the state of a commander at a point in time
+type CommanderSnapshot struct {
+	Addr v1.Addr
+
+	// Leader which spawned this commander
+	Leader v1.Addr
+
+	// The pvalue this commander is trying to get accepted
+	PValue types.PValue
+
+	// Acceptors which have not responded yet
+	WaitFor []v1.Addr
+}
+
+// Snapshot - a copy of the commander's state, safe to take while it runs
+func (cmdr *Commander) Snapshot() CommanderSnapshot {
+	cmdr.mu.Lock()
+	defer cmdr.mu.Unlock()
+	return CommanderSnapshot{
+		Addr:    cmdr.GetAddr(),
+		Leader:  cmdr.leader,
+		PValue:  cmdr.pvalue,
+		WaitFor: sortedAddrs(cmdr.waitFor),
+	}
+}
+
+// LeaderSnapshot - the state of a leader, and its running scouts & commanders, at a point in time
+type LeaderSnapshot struct {
+	Addr v1.Addr
+
+	BallotNumber types.BallotNumber
+
+	// true once the leader's ballot is adopted by a majority of acceptors
+	Active bool
+
+	// Number of slots this leader has a proposal for
+	Proposals int
+
+	// The command proposed for each slot
+	Commands types.SlotCommandMap
+
+	// Running scouts & commanders, by ascending id
+	Scouts     []ScoutSnapshot
+	Commanders []CommanderSnapshot
+
+	// Number of messages waiting in the inbox
+	InboxLen int
+
+	// The acceptors contacted by the scouts & commanders; with Cheap Paxos the main acceptors
+	Acceptors []v1.Addr
+
+	// Cheap Paxos: true while the auxiliary acceptors are engaged, until the main acceptors are reconfigured
+	AuxiliariesEngaged bool
+}
+
+// Snapshot - a copy of the leader's state, including its scouts & commanders
+func (leader *Leader) Snapshot() LeaderSnapshot {
+	leader.mu.Lock()
+	result := LeaderSnapshot{
+		Addr:         leader.GetAddr(),
+		BallotNumber: leader.ballotNumber,
+		Active:       leader.active,
+		Proposals:    len(leader.proposals),
+		Commands:     copySlotCommands(leader.proposals),
+		Scouts:       make([]ScoutSnapshot, 0),
+		Commanders:   make([]CommanderSnapshot, 0),
+		InboxLen:     leader.InboxLen(),
+
+		Acceptors:          append([]v1.Addr{}, leader.acceptors...),
+		AuxiliariesEngaged: leader.engaged,
+	}
+	// a child may be blocked on the leader's full inbox while holding its own lock
+	leader.mu.Unlock()
+
+	leader.childrenMu.Lock()
+	children := make([]v1.Process, 0, len(leader.children))
+	for p := range leader.children {
+		children = append(children, p)
+	}
+	leader.childrenMu.Unlock()
+	sort.Slice(children, func(i, j int) bool { return children[i].ID() < children[j].ID() })
+	for _, p := range children {
+		switch child := p.(type) {
+		case *Scout:
+			result.Scouts = append(result.Scouts, child.Snapshot())
+		case *Commander:
+			result.Commanders = append(result.Commanders, child.Snapshot())
+		}
+	}
+	return result
+}
+
+// ReplicaSnapshot - the state of a replica at a point in time
+type ReplicaSnapshot struct {
+	Addr v1.Addr
+
+	// Next slot which can be proposed
+	SlotIn types.Slot
+
+	// Next slot for which a decision needs to be made
+	SlotOut types.Slot
+
+	// Number of requests which have not been proposed yet
+	Requests int
+
+	// The requests which have not been proposed yet, in the order they will be
+	Pending []types.Command
+
+	// Proposals which are not decided yet, indexed by slot
+	Proposals types.SlotCommandMap
+
+	// Decisions made so far, indexed by slot
+	Decisions types.SlotCommandMap
+
+	// Current leader configuration
+	Leaders []v1.Addr
+
+	// Number of messages waiting in the inbox
+	InboxLen int
+}
+
+// Snapshot - a copy of the replica's state, sharing no maps or slices with it
+func (r *Replica) Snapshot() ReplicaSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	leaders := make([]v1.Addr, len(r.leaders))
+	copy(leaders, r.leaders)
+	return ReplicaSnapshot{
+		Addr:      r.GetAddr(),
+		SlotIn:    r.slotIn,
+		SlotOut:   r.slotOut,
+		Requests:  len(r.requests),
+		Pending:   append([]types.Command{}, r.requests...),
+		Proposals: copySlotCommands(r.proposals),
+		Decisions: copySlotCommands(r.decisions),
+		Leaders:   leaders,
+		InboxLen:  r.InboxLen(),
+	}
+}
+
+// ClientSnapshot - the state of a client at a point in time
+type ClientSnapshot struct {
+	Addr v1.Addr
+
+	// Number of requests issued so far
+	Requests int
+
+	// Number of messages waiting in the inbox
+	InboxLen int
+}
+
+// Snapshot - a copy of the client's state, safe to take while it runs
+func (c *Client) Snapshot() ClientSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientSnapshot{
+		Addr:     c.GetAddr(),
+		Requests: c.commandCount - 1,
+		InboxLen: c.InboxLen(),
+	}
+}
+
+// copySlotCommands - a copy of the slot to command map
+func copySlotCommands(m types.SlotCommandMap) types.SlotCommandMap {
+	result := make(types.SlotCommandMap, len(m))
+	for slot, command := range m {
+		result.Assign(slot, command)
+	}
+	return result
+}
+
+// sortedAddrs - the addresses of the set, by type & id
+func sortedAddrs(set v1.AddrSet) []v1.Addr {
+	result := make([]v1.Addr, 0, len(set))
+	for addr := range set {
+		result = append(result, addr)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Type() != result[j].Type() {
+			return result[i].Type() < result[j].Type()
+		}
+		return result[i].ID() < result[j].ID()
+	})
+	return result
+}
@@ -0,0 +1,81 @@
+package components
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestReplica_Snapshot(t *testing.T) {
+	Convey("Given a replica which proposed a command", t, func() {
+		r := NewReplica(newFakeExchange(), newLeaders())
+		r.Handle(newTestRequestMessage("1"))
+
+		Convey("the snapshot reports the proposal", func() {
+			snap := r.Snapshot()
+			So(snap.SlotIn, ShouldEqual, types.Slot(2))
+			So(snap.SlotOut, ShouldEqual, InitialSlotID)
+			So(len(snap.Proposals), ShouldEqual, 1)
+			So(len(snap.Decisions), ShouldEqual, 0)
+			So(len(snap.Leaders), ShouldEqual, 2)
+		})
+
+		Convey("the snapshot is not affected by later messages", func() {
+			snap := r.Snapshot()
+			command := newTestRequestMessage("1").Command
+			r.Handle(messages.NewDecisionMessage(newFakeAddr(fakeCommanderID, v1.Commander), InitialSlotID, command))
+			So(len(snap.Decisions), ShouldEqual, 0)
+			So(len(r.Snapshot().Decisions), ShouldEqual, 1)
+			So(r.Snapshot().SlotOut, ShouldEqual, types.Slot(2))
+		})
+	})
+}
+
+func TestAcceptor_Snapshot(t *testing.T) {
+	Convey("Given an acceptor which adopted a ballot", t, func() {
+		acceptor := NewAcceptor(newFakeExchange())
+		leader := newFakeAddr(fakeLeaderID, v1.Leader)
+		scout := newFakeAddr(fakeScoutID, v1.Scout)
+		acceptor.Handle(messages.NewPhase1aMessage(scout, newFakeBallot(1, leader)))
+
+		Convey("the snapshot holds a copy of the ballot", func() {
+			snap := acceptor.Snapshot()
+			So(snap.BallotNumber, ShouldNotBeNil)
+			So(snap.BallotNumber.Round, ShouldEqual, 1)
+			snap.BallotNumber.Round = 10
+			So(acceptor.Snapshot().BallotNumber.Round, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestScout_Snapshot(t *testing.T) {
+	Convey("Given a scout which started on three acceptors", t, func() {
+		acceptors := newFakeAddrs(3, fakeAcceptorID, v1.Acceptor)
+		leader := newFakeAddr(fakeLeaderID, v1.Leader)
+		bn := newFakeBallot(1, leader)
+		scout := NewScout(newFakeExchange(), leader, acceptors, bn)
+		scout.Start()
+
+		Convey("the snapshot lists the acceptors it waits for", func() {
+			snap := scout.Snapshot()
+			So(len(snap.WaitFor), ShouldEqual, 3)
+			So(snap.WaitFor[0].ID(), ShouldEqual, fakeAcceptorID)
+			So(snap.BallotNumber.Round, ShouldEqual, 1)
+		})
+
+		Convey("when one acceptor responds", func() {
+			pValues := make(types.PValues)
+			pValues.Set(newFakePValue(8, leader))
+			scout.Handle(messages.NewPhase1bMessage(acceptors[0], bn, pValues))
+
+			Convey("the snapshot no longer lists it, and reports its pvalues", func() {
+				snap := scout.Snapshot()
+				So(len(snap.WaitFor), ShouldEqual, 2)
+				So(snap.WaitFor[0], ShouldEqual, acceptors[1])
+				So(snap.PValues, ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,123 @@
+package components
+
+// Step functions.
+//
+// The protocol of every component is a step function on its state, e.g. AcceptorState.Step,
+// which transitions the state on a single message. A step neither sends nor spawns: it returns
+// the messages to send, the scouts & commanders to spawn and the events to emit as Effects.
+// Steps are deterministic and change nothing but their state, so the same code is driven by the
+// goroutines of a simulation (the Run & Handle methods of the components, which carry out the
+// effects through the exchange), by a model checker or by a property test. A state can be
+// copied, to explore the steps of a state more than once.
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Outbound - a message to send, to a process or to every process of a type
+type Outbound struct {
+	// the destination, nil if the message is sent to every process of type All
+	Dest v1.Addr
+
+	All v1.ProcessType
+
+	Message v1.Message
+
+	// a failure to send is not fatal, e.g. the requester of a reply may be gone, or there
+	// may be no client listening for decisions
+	BestEffort bool
+}
+
+// SpawnRequest - a scout or a commander a leader asks to run on its behalf
+type SpawnRequest struct {
+	// v1.Scout or v1.Commander
+	Type v1.ProcessType
+
+	// the ballot of the scout, or the pvalue the commander gets accepted
+	Ballot types.BallotNumber
+
+	PValue types.PValue
+
+	// the (main) acceptors contacted by the child
+	Acceptors []v1.Addr
+
+	// Cheap Paxos: auxiliary acceptors, and whether to engage them right away
+	Auxiliaries []v1.Addr
+
+	Engaged bool
+}
+
+// Effects - what a step asks of the environment, in order
+type Effects struct {
+	Outbound []Outbound
+
+	Spawns []SpawnRequest
+
+	Events []events.Event
+
+	// counted in the leader's metrics; shown by no message, spawn or event
+	fastDecisions int
+	recoveries    []string
+	engagements   int
+}
+
+func (e *Effects) send(dest v1.Addr, m v1.Message) {
+	e.Outbound = append(e.Outbound, Outbound{Dest: dest, Message: m})
+}
+
+// reply - send a response, which may be lost if the requester is gone
+func (e *Effects) reply(dest v1.Addr, m v1.Message) {
+	e.Outbound = append(e.Outbound, Outbound{Dest: dest, Message: m, BestEffort: true})
+}
+
+func (e *Effects) sendAll(pt v1.ProcessType, m v1.Message) {
+	e.Outbound = append(e.Outbound, Outbound{All: pt, Message: m})
+}
+
+// notifyClients - notify the clients of a decision, so they can measure their latency
+func (e *Effects) notifyClients(m v1.Message) {
+	e.Outbound = append(e.Outbound, Outbound{All: v1.Client, Message: m, BestEffort: true})
+}
+
+func (e *Effects) spawn(r SpawnRequest) {
+	e.Spawns = append(e.Spawns, r)
+}
+
+func (e *Effects) emit(ev events.Event) {
+	e.Events = append(e.Events, ev)
+}
+
+// carryOut - send the messages of the effects through the exchange, and emit their events to the
+// sink. Spawns are carried out by the leader
+func carryOut(exchange v1.MessageExchange, sink events.Sink, eff Effects) {
+	for _, o := range eff.Outbound {
+		var err error
+		if o.Dest == nil {
+			err = exchange.SendAll(o.All, o.Message)
+		} else {
+			err = exchange.Send(o.Dest, o.Message)
+		}
+		if err == nil {
+			continue
+		}
+		if o.BestEffort {
+			log.Debugf("exchange.send %T failed %v", o.Message, err)
+		} else {
+			log.Panicf("exchange.send %T failed %v", o.Message, err)
+		}
+	}
+	for _, e := range eff.Events {
+		events.Emit(sink, e)
+	}
+}
+
+func copyAddrSet(set v1.AddrSet) v1.AddrSet {
+	result := make(v1.AddrSet, len(set))
+	for addr := range set {
+		result.Add(addr)
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+package components
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+// stepper - a cluster of states driven by their step functions, delivering messages in the order
+// they were sent
+type stepper struct {
+	acceptors map[v1.Addr]*AcceptorState
+	leader    *LeaderState
+	replica   *ReplicaState
+	children  map[v1.Addr]interface{ Step(v1.Message) Effects }
+
+	queue []Outbound
+
+	performed []events.CommandPerformed
+}
+
+func newStepper(nAcceptors int) *stepper {
+	st := &stepper{
+		acceptors: make(map[v1.Addr]*AcceptorState),
+		children:  make(map[v1.Addr]interface{ Step(v1.Message) Effects }),
+	}
+	addrs := make([]v1.Addr, nAcceptors)
+	for i := range addrs {
+		addrs[i] = v1.NewAddress(v1.ProcessID(i), v1.Acceptor)
+		s := NewAcceptorState(addrs[i])
+		st.acceptors[addrs[i]] = &s
+	}
+	leader := v1.NewAddress(0, v1.Leader)
+	l := NewLeaderState(leader, addrs)
+	st.leader = &l
+	r := NewReplicaState(v1.NewAddress(0, v1.Replica), []v1.Addr{leader})
+	st.replica = &r
+	st.apply(st.leader.Init())
+	return st
+}
+
+func (st *stepper) apply(eff Effects) {
+	for _, r := range eff.Spawns {
+		addr := v1.NewAddress(v1.ProcessID(len(st.children)), r.Type)
+		if r.Type == v1.Scout {
+			s := NewScoutState(addr, st.leader.self, r.Acceptors, r.Ballot)
+			st.children[addr] = &s
+			st.apply(s.Init())
+		} else {
+			c := NewCommanderState(addr, st.leader.self, r.Acceptors, r.PValue)
+			st.children[addr] = &c
+			st.apply(c.Init())
+		}
+	}
+	for _, o := range eff.Outbound {
+		if o.Dest == nil {
+			o.Dest = v1.NewAddress(0, o.All)
+		}
+		st.queue = append(st.queue, o)
+	}
+	for _, e := range eff.Events {
+		if p, ok := e.(events.CommandPerformed); ok {
+			st.performed = append(st.performed, p)
+		}
+	}
+}
+
+// run - deliver the messages in flight until there are none
+func (st *stepper) run() {
+	for len(st.queue) > 0 {
+		o := st.queue[0]
+		st.queue = st.queue[1:]
+		dest := v1.NewAddress(o.Dest.ID(), o.Dest.Type())
+		switch dest.Type() {
+		case v1.Acceptor:
+			st.apply(st.acceptors[dest].Step(o.Message))
+		case v1.Leader:
+			st.apply(st.leader.Step(o.Message, time.Time{}))
+		case v1.Replica:
+			st.apply(st.replica.Step(o.Message))
+		case v1.Scout, v1.Commander:
+			st.apply(st.children[dest].Step(o.Message))
+		}
+	}
+}
+
+func TestSteps(t *testing.T) {
+	Convey("Given a cluster driven by its step functions alone", t, func() {
+		st := newStepper(3)
+		So(len(st.queue), ShouldEqual, 3)
+		st.run()
+		So(st.leader.active, ShouldBeTrue)
+
+		Convey("a requested command is decided and performed", func() {
+			command := newTestRequestMessage("1").Command
+			st.apply(st.replica.Step(messages.NewRequestMessage(v1.NewAddress(0, v1.Client), command)))
+			st.run()
+			So(len(st.performed), ShouldEqual, 1)
+			So(st.performed[0].Command, ShouldResemble, command)
+			So(st.performed[0].Slot, ShouldEqual, InitialSlotID)
+		})
+	})
+
+	Convey("Given the state of an acceptor which adopted a ballot", t, func() {
+		acceptor := v1.NewAddress(0, v1.Acceptor)
+		scout := v1.NewAddress(0, v1.Scout)
+		leader := v1.NewAddress(0, v1.Leader)
+		s := NewAcceptorState(acceptor)
+		eff := s.Step(messages.NewPhase1aMessage(scout, types.BallotNumber{Round: 1, LeaderID: leader}))
+		So(eff.Outbound, ShouldHaveLength, 1)
+		So(eff.Outbound[0].Dest, ShouldResemble, scout)
+
+		Convey("a step of a copy leaves the state as it was", func() {
+			c := s.Copy()
+			pv := types.PValue{BN: *s.BN, Slot: InitialSlotID, Command: newTestRequestMessage("1").Command}
+			eff := c.Step(messages.NewPhase2aMessage(v1.NewAddress(0, v1.Commander), pv))
+			So(eff.Events, ShouldHaveLength, 1)
+			So(len(c.Accepted), ShouldEqual, 1)
+			So(len(s.Accepted), ShouldEqual, 0)
+		})
+	})
+}
@@ -7,6 +7,13 @@ import (
 	"github.com/1xyz/paxossim/v1/v1fakes"
 )
 
+// newFakeExchange - a fake exchange which allocates the ids of the processes constructed with it
+func newFakeExchange() *v1fakes.FakeMessageExchange {
+	exchange := &v1fakes.FakeMessageExchange{}
+	exchange.IDsReturns(v1.NewIDAllocator())
+	return exchange
+}
+
 func makeSet(acceptors []v1.Addr) v1.AddrSet {
 	result := make(v1.AddrSet)
 	for _, e := range acceptors {
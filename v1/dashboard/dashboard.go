@@ -0,0 +1,340 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/scenario"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"sort"
+)
+
+// MaxDecisions - number of most recent decisions reported per replica
+const MaxDecisions = 50
+
+// Server - serves a live view of a running Env: the state of every process, a feed of
+// the messages delivered and controls to crash/restart processes and cut links
+type Server struct {
+	env *env.Env
+
+	feed *Feed
+
+	mux *http.ServeMux
+}
+
+// New - a dashboard of the Env; feed must be recording the Env's deliveries
+// (see env.Config.Trace). The message feed is disabled if feed is nil
+func New(e *env.Env, feed *Feed) *Server {
+	s := &Server{env: e, feed: feed, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/", s.handleIndex)
+	s.mux.HandleFunc("/api/state", s.handleState)
+	s.mux.HandleFunc("/api/events", s.handleEvents)
+	s.mux.HandleFunc("/api/crash", s.handleProcessAction)
+	s.mux.HandleFunc("/api/restart", s.handleProcessAction)
+	s.mux.HandleFunc("/api/cut", s.handleLinkAction)
+	s.mux.HandleFunc("/api/heal-link", s.handleLinkAction)
+	s.mux.HandleFunc("/api/heal", s.handleHeal)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve - serve the dashboard on the specified address, e.g. localhost:8080
+// The returned server is already listening; Close it to stop serving
+func Serve(addr string, s *Server) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Addr: ln.Addr().String(), Handler: s}
+	go srv.Serve(ln)
+	return srv, nil
+}
+
+// State - the cluster as shown by the dashboard
+type State struct {
+	Acceptors []AcceptorState `json:"acceptors"`
+	Leaders   []LeaderState   `json:"leaders"`
+	Replicas  []ReplicaState  `json:"replicas"`
+
+	// Cut links, as ordered pairs of targets
+	CutLinks [][2]string `json:"cut_links"`
+}
+
+// Process - fields common to the state of every process
+type Process struct {
+	// Target identifying the process in the controls, e.g. acceptor:0
+	Target string `json:"target"`
+
+	Addr string `json:"addr"`
+
+	Crashed bool `json:"crashed"`
+
+	InboxLen int `json:"inbox_len"`
+}
+
+type AcceptorState struct {
+	Process
+
+	Ballot string `json:"ballot"`
+
+	Accepted int `json:"accepted"`
+}
+
+type LeaderState struct {
+	Process
+
+	Ballot string `json:"ballot"`
+
+	Active bool `json:"active"`
+
+	Proposals int `json:"proposals"`
+
+	// Number of running scouts & commanders
+	Scouts     int `json:"scouts"`
+	Commanders int `json:"commanders"`
+}
+
+type ReplicaState struct {
+	Process
+
+	SlotIn types.Slot `json:"slot_in"`
+
+	SlotOut types.Slot `json:"slot_out"`
+
+	Requests int `json:"requests"`
+
+	Proposals int `json:"proposals"`
+
+	// Total number of decisions
+	Decided int `json:"decided"`
+
+	// The most recent decisions, by descending slot
+	Decisions []Decision `json:"decisions"`
+}
+
+type Decision struct {
+	Slot types.Slot `json:"slot"`
+
+	Command string `json:"command"`
+}
+
+// State - the current state of the Env
+func (s *Server) State() State {
+	status := s.env.Status()
+	targets := make(map[string]string)
+	process := func(name string, index int, addr v1.Addr, inboxLen int) Process {
+		target := fmt.Sprintf("%s:%d", name, index)
+		targets[key(addr)] = target
+		return Process{
+			Target:   target,
+			Addr:     fmt.Sprintf("%v", addr),
+			Crashed:  status.IsCrashed(addr),
+			InboxLen: inboxLen,
+		}
+	}
+
+	state := State{
+		Acceptors: make([]AcceptorState, 0),
+		Leaders:   make([]LeaderState, 0),
+		Replicas:  make([]ReplicaState, 0),
+		CutLinks:  make([][2]string, 0),
+	}
+	for i, a := range status.Acceptors {
+		ballot := ""
+		if a.BallotNumber != nil {
+			ballot = a.BallotNumber.String()
+		}
+		state.Acceptors = append(state.Acceptors, AcceptorState{
+			Process:  process("acceptor", i, a.Addr, a.InboxLen),
+			Ballot:   ballot,
+			Accepted: a.Accepted,
+		})
+	}
+	for i, l := range status.Leaders {
+		state.Leaders = append(state.Leaders, LeaderState{
+			Process:    process("leader", i, l.Addr, l.InboxLen),
+			Ballot:     l.BallotNumber.String(),
+			Active:     l.Active,
+			Proposals:  l.Proposals,
+			Scouts:     len(l.Scouts),
+			Commanders: len(l.Commanders),
+		})
+	}
+	for i, r := range status.Replicas {
+		state.Replicas = append(state.Replicas, ReplicaState{
+			Process:   process("replica", i, r.Addr, r.InboxLen),
+			SlotIn:    r.SlotIn,
+			SlotOut:   r.SlotOut,
+			Requests:  r.Requests,
+			Proposals: len(r.Proposals),
+			Decided:   len(r.Decisions),
+			Decisions: recentDecisions(r.Decisions),
+		})
+	}
+	for i, c := range status.Clients {
+		targets[key(c.Addr)] = fmt.Sprintf("client:%d", i)
+	}
+	for _, l := range status.CutLinks {
+		a, ok1 := targets[key(l[0])]
+		b, ok2 := targets[key(l[1])]
+		if b < a {
+			a, b = b, a
+		}
+		if ok1 && ok2 {
+			state.CutLinks = append(state.CutLinks, [2]string{a, b})
+		}
+	}
+	sort.Slice(state.CutLinks, func(i, j int) bool {
+		return state.CutLinks[i][0]+state.CutLinks[i][1] < state.CutLinks[j][0]+state.CutLinks[j][1]
+	})
+	return state
+}
+
+func key(addr v1.Addr) string {
+	return fmt.Sprintf("%v", v1.NewAddress(addr.ID(), addr.Type()))
+}
+
+func recentDecisions(decisions types.SlotCommandMap) []Decision {
+	slots := make([]types.Slot, 0, len(decisions))
+	for slot := range decisions {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] > slots[j] })
+	if len(slots) > MaxDecisions {
+		slots = slots[:MaxDecisions]
+	}
+	result := make([]Decision, 0, len(slots))
+	for _, slot := range slots {
+		c := decisions[slot]
+		result = append(result, Decision{
+			Slot:    slot,
+			Command: fmt.Sprintf("%s/%s %s", c.GetClientID(), c.GetCommandID(), c.GetOp()),
+		})
+	}
+	return result
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.State())
+}
+
+// handleEvents - stream the delivered messages as server-sent events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || s.feed == nil {
+		http.Error(w, "streaming not supported", http.StatusNotImplemented)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	entries, cancel := s.feed.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-entries:
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Debugf("dashboard: marshal entry failed %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handleProcessAction - POST /api/crash?target=acceptor:0 or /api/restart?target=acceptor:0
+func (s *Server) handleProcessAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	addr, err := s.resolve(r.FormValue("target"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Path == "/api/crash" {
+		s.env.Network().Crash(addr)
+	} else {
+		s.env.Network().Restart(addr)
+	}
+	log.Infof("dashboard: %s %v", r.URL.Path, addr)
+	writeJSON(w, s.State())
+}
+
+// handleLinkAction - POST /api/cut?a=leader:0&b=acceptor:1 or /api/heal-link?a=leader:0&b=acceptor:1
+func (s *Server) handleLinkAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a, err := s.resolve(r.FormValue("a"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := s.resolve(r.FormValue("b"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.URL.Path == "/api/cut" {
+		s.env.Network().CutLink(a, b)
+	} else {
+		s.env.Network().HealLink(a, b)
+	}
+	log.Infof("dashboard: %s %v <-> %v", r.URL.Path, a, b)
+	writeJSON(w, s.State())
+}
+
+// handleHeal - POST /api/heal removes all partitions and cut links
+func (s *Server) handleHeal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.env.Network().Heal()
+	writeJSON(w, s.State())
+}
+
+func (s *Server) resolve(target string) (v1.Addr, error) {
+	t, err := scenario.ParseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if t.IsCoordinator() {
+		return nil, fmt.Errorf("invalid target %q, the coordinator is not a process", target)
+	}
+	return s.env.Addr(t.ProcessType(), t.Index)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("dashboard: write response failed %v", err)
+	}
+}
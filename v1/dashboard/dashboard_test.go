@@ -0,0 +1,83 @@
+package dashboard
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/1xyz/paxossim/v1/env"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getState(url string) State {
+	resp, err := http.Get(url + "/api/state")
+	So(err, ShouldBeNil)
+	defer resp.Body.Close()
+	var s State
+	So(json.NewDecoder(resp.Body).Decode(&s), ShouldBeNil)
+	return s
+}
+
+func post(url string) *http.Response {
+	resp, err := http.Post(url, "", nil)
+	So(err, ShouldBeNil)
+	resp.Body.Close()
+	return resp
+}
+
+func TestServer(t *testing.T) {
+	Convey("Given a dashboard of a running Env", t, func() {
+		feed := NewFeed()
+		e := env.NewEnvWithConfig(env.Config{
+			NFailures:         1,
+			NClients:          1,
+			ClientReqInterval: 5 * time.Millisecond,
+			Trace:             feed,
+		})
+		srv := httptest.NewServer(New(e, feed))
+		e.Run()
+		defer func() {
+			srv.Close()
+			e.Stop()
+		}()
+
+		Convey("the state lists every process", func() {
+			s := getState(srv.URL)
+			So(len(s.Acceptors), ShouldEqual, 3)
+			So(len(s.Leaders), ShouldEqual, 2)
+			So(len(s.Replicas), ShouldEqual, 2)
+			So(s.Acceptors[0].Target, ShouldEqual, "acceptor:0")
+		})
+
+		Convey("a process can be crashed and restarted", func() {
+			So(post(srv.URL+"/api/crash?target=acceptor:1").StatusCode, ShouldEqual, http.StatusOK)
+			So(getState(srv.URL).Acceptors[1].Crashed, ShouldBeTrue)
+			So(post(srv.URL+"/api/restart?target=acceptor:1").StatusCode, ShouldEqual, http.StatusOK)
+			So(getState(srv.URL).Acceptors[1].Crashed, ShouldBeFalse)
+		})
+
+		Convey("a link can be cut and healed", func() {
+			post(srv.URL + "/api/cut?a=leader:0&b=acceptor:2")
+			So(getState(srv.URL).CutLinks, ShouldResemble, [][2]string{{"acceptor:2", "leader:0"}})
+			post(srv.URL + "/api/heal-link?a=acceptor:2&b=leader:0")
+			So(getState(srv.URL).CutLinks, ShouldBeEmpty)
+		})
+
+		Convey("an unknown target is rejected", func() {
+			So(post(srv.URL+"/api/crash?target=acceptor:9").StatusCode, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("delivered messages are streamed", func() {
+			resp, err := http.Get(srv.URL + "/api/events")
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+			line, err := bufio.NewReader(resp.Body).ReadString('\n')
+			So(err, ShouldBeNil)
+			So(strings.HasPrefix(line, "data: {"), ShouldBeTrue)
+		})
+	})
+}
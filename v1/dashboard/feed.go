@@ -0,0 +1,52 @@
+package dashboard
+
+import (
+	"github.com/1xyz/paxossim/v1/trace"
+	"sync"
+)
+
+// FeedBuffer - number of entries buffered per subscriber before entries are dropped
+const FeedBuffer = 256
+
+// Feed - a trace.Sink broadcasting every entry to its subscribers. Recording never
+// blocks the exchange: entries are dropped for subscribers which fall behind
+type Feed struct {
+	mu *sync.Mutex
+
+	subscribers map[chan trace.Entry]bool
+}
+
+func NewFeed() *Feed {
+	return &Feed{
+		mu:          &sync.Mutex{},
+		subscribers: make(map[chan trace.Entry]bool),
+	}
+}
+
+func (f *Feed) Record(e trace.Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe - receive the entries recorded from now on, until cancel is called
+func (f *Feed) Subscribe() (entries <-chan trace.Entry, cancel func()) {
+	ch := make(chan trace.Entry, FeedBuffer)
+	f.mu.Lock()
+	f.subscribers[ch] = true
+	f.mu.Unlock()
+	once := &sync.Once{}
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			delete(f.subscribers, ch)
+			f.mu.Unlock()
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package dashboard
+
+// page - the dashboard's single page; polls /api/state and streams /api/events
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>paxossim</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+h2 { margin-top: 1.2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; vertical-align: top; }
+tr.crashed td { background: #fdd; }
+#feed { font-family: monospace; font-size: 12px; height: 20em; overflow-y: scroll; border: 1px solid #ccc; padding: 4px; }
+.decisions { font-family: monospace; font-size: 12px; max-height: 8em; overflow-y: auto; }
+</style>
+</head>
+<body>
+<h1>paxossim</h1>
+
+<h2>Acceptors</h2>
+<table id="acceptors"></table>
+
+<h2>Leaders</h2>
+<table id="leaders"></table>
+
+<h2>Replicas</h2>
+<table id="replicas"></table>
+
+<h2>Links</h2>
+<p>
+<input id="link-a" placeholder="leader:0" size="12">
+<input id="link-b" placeholder="acceptor:1" size="12">
+<button onclick="link('/api/cut')">cut link</button>
+<button onclick="link('/api/heal-link')">heal link</button>
+<button onclick="post('/api/heal')">heal all</button>
+</p>
+<ul id="cut-links"></ul>
+
+<h2>Messages <button id="pause" onclick="paused = !paused; this.textContent = paused ? 'resume' : 'pause'">pause</button></h2>
+<div id="feed"></div>
+
+<script>
+var paused = false;
+var maxFeed = 200;
+
+function esc(s) {
+  return String(s).replace(/[&<>"]/g, function (c) {
+    return {'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;'}[c];
+  });
+}
+
+function post(url) {
+  fetch(url, {method: 'POST'}).then(function (r) {
+    if (!r.ok) { r.text().then(alert); return; }
+    r.json().then(render);
+  });
+}
+
+function link(url) {
+  var a = document.getElementById('link-a').value, b = document.getElementById('link-b').value;
+  post(url + '?a=' + encodeURIComponent(a) + '&b=' + encodeURIComponent(b));
+}
+
+function controls(p) {
+  var action = p.crashed ? 'restart' : 'crash';
+  return '<button onclick="post(\'/api/' + action + '?target=' + p.target + '\')">' + action + '</button>';
+}
+
+function table(id, header, rows) {
+  var html = '<tr>' + header.map(function (h) { return '<th>' + h + '</th>'; }).join('') + '</tr>';
+  rows.forEach(function (r) {
+    html += '<tr class="' + (r.crashed ? 'crashed' : '') + '">' +
+      r.cells.map(function (c) { return '<td>' + c + '</td>'; }).join('') + '</tr>';
+  });
+  document.getElementById(id).innerHTML = html;
+}
+
+function render(s) {
+  table('acceptors', ['target', 'addr', 'ballot', 'accepted', 'inbox', ''], s.acceptors.map(function (a) {
+    return {crashed: a.crashed, cells: [a.target, esc(a.addr), esc(a.ballot), a.accepted, a.inbox_len, controls(a)]};
+  }));
+  table('leaders', ['target', 'addr', 'ballot', 'active', 'proposals', 'scouts', 'commanders', 'inbox', ''], s.leaders.map(function (l) {
+    return {crashed: l.crashed, cells: [l.target, esc(l.addr), esc(l.ballot), l.active, l.proposals, l.scouts, l.commanders, l.inbox_len, controls(l)]};
+  }));
+  table('replicas', ['target', 'addr', 'slot_in', 'slot_out', 'requests', 'proposals', 'decided', 'decisions', 'inbox', ''], s.replicas.map(function (r) {
+    var log = r.decisions.map(function (d) { return d.slot + ': ' + esc(d.command); }).join('<br>');
+    return {crashed: r.crashed, cells: [r.target, esc(r.addr), r.slot_in, r.slot_out, r.requests, r.proposals, r.decided,
+      '<div class="decisions">' + log + '</div>', r.inbox_len, controls(r)]};
+  }));
+  document.getElementById('cut-links').innerHTML = s.cut_links.map(function (l) {
+    return '<li>' + l[0] + ' &harr; ' + l[1] + '</li>';
+  }).join('');
+}
+
+function refresh() {
+  fetch('/api/state').then(function (r) { return r.json(); }).then(render);
+}
+refresh();
+setInterval(refresh, 500);
+
+var feed = document.getElementById('feed');
+var events = new EventSource('/api/events');
+events.onmessage = function (m) {
+  if (paused) { return; }
+  var e = JSON.parse(m.data);
+  if (e.kind !== 'deliver') { return; }
+  var line = document.createElement('div');
+  line.textContent = '#' + e.step + ' ' + e.src.type + '-' + e.src.id + ' -> ' + e.dest.type + '-' + e.dest.id + ' ' + e.type;
+  feed.appendChild(line);
+  while (feed.childNodes.length > maxFeed) { feed.removeChild(feed.firstChild); }
+  feed.scrollTop = feed.scrollHeight;
+};
+</script>
+</body>
+</html>
+`
@@ -1,9 +1,28 @@
 package env
 
 import (
+	"fmt"
+	"github.com/1xyz/paxossim/queue"
 	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/clock"
 	"github.com/1xyz/paxossim/v1/components"
+	"github.com/1xyz/paxossim/v1/epaxos"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/history"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/quorum"
+	"github.com/1xyz/paxossim/v1/raft"
+	"github.com/1xyz/paxossim/v1/shard"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/trace"
+	"github.com/1xyz/paxossim/v1/types"
 	log "github.com/sirupsen/logrus"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -11,8 +30,181 @@ const (
 	ClientReqInterval = 1 * time.Second
 )
 
+// Protocol - the consensus protocol run by the cluster
+type Protocol string
+
+const (
+	// van Renesse's Multi-Paxos: clients send requests to the replicas, which propose slots to the leaders
+	Classic Protocol = "classic"
+
+	// Fast Paxos: clients send requests directly to the acceptors in fast rounds, the
+	// leaders recover collisions in classic rounds. Reconfiguration is not supported
+	Fast Protocol = "fast"
+
+	// EPaxos: every replica leads the requests sent to it, ordering interfering commands by
+	// their dependencies. There are no leaders & acceptors, and no reconfiguration
+	EPaxos Protocol = "epaxos"
+
+	// Raft: the elected leader appends the requests to its log and replicates it to the
+	// followers. There are no separate leaders & acceptors, and no reconfiguration
+	Raft Protocol = "raft"
+
+	// Cheap Paxos: the leaders contact the first f+1 acceptors only, the other f acceptors are
+	// auxiliaries engaged when a main acceptor fails, until it is reconfigured away
+	Cheap Protocol = "cheap"
+)
+
+// ParseProtocol - the protocol with the specified name; empty is Classic
+func ParseProtocol(s string) (Protocol, error) {
+	switch Protocol(strings.ToLower(s)) {
+	case "", Classic:
+		return Classic, nil
+	case Fast:
+		return Fast, nil
+	case EPaxos:
+		return EPaxos, nil
+	case Raft:
+		return Raft, nil
+	case Cheap:
+		return Cheap, nil
+	}
+	return "", fmt.Errorf("unknown protocol %q, expected classic, fast, epaxos, raft or cheap", s)
+}
+
+// Config - describes the cluster constructed by an Env
+type Config struct {
+	// Number of failures the cluster should tolerate
+	NFailures int
+
+	// Number of clients issuing requests
+	NClients int
+
+	// Interval between consecutive requests of a client
+	ClientReqInterval time.Duration
+
+	// Network fault model applied to every message
+	Faults v1.FaultModel
+
+	// Seed for the random decisions made by the network
+	Seed int64
+
+	// If set, every message delivered to a process is recorded to this sink
+	Trace trace.Sink
+
+	// If set, the metrics of every process are recorded to this registry
+	Metrics *metrics.Registry
+
+	// If set, the protocol events of every process are recorded to this sink
+	Events events.Sink
+
+	// If set, the clients record the commands they request to this history, and the replicas
+	// the commands they perform
+	History *history.History
+
+	// Consensus protocol, Classic if empty
+	Protocol Protocol
+
+	// Number of acceptors, 2 * NFailures + 1 if zero
+	NAcceptors int
+
+	// Phase 1 & phase 2 quorums of the acceptors, a majority if empty
+	Quorum quorum.Spec
+
+	// Number of keys the clients write to, opaque commands if zero
+	Keys int
+
+	// Clock of the processes & the network, the real clock if nil. The processes of an Env on a
+	// clock.Fake stand still until the clock is advanced, e.g. by clock.Sleep
+	Clock clock.Clock
+
+	// Number of independent Paxos groups, each with acceptors, leaders & replicas of its own, which
+	// the keys are partitioned across; one if zero
+	Groups int
+
+	// Partitioning of the keys across the groups, by hash if empty
+	Partition shard.Spec
+
+	// Capacity & overflow policy of the inbox of every process, unbounded if the capacity is zero
+	Inbox queue.Options
+}
+
+// bounded - true if the inboxes of the processes are bounded
+func (cfg Config) bounded() bool {
+	return cfg.Inbox.Capacity > 0
+}
+
+// acceptorCount - the number of acceptors of the cluster
+func (cfg Config) acceptorCount() int {
+	if cfg.NAcceptors > 0 {
+		return cfg.NAcceptors
+	}
+	return (2 * cfg.NFailures) + 1
+}
+
+// groupCount - the number of Paxos groups of the cluster
+func (cfg Config) groupCount() int {
+	if cfg.Groups > 0 {
+		return cfg.Groups
+	}
+	return 1
+}
+
+// replicated - true if the protocol replaces the replicas, leaders & acceptors with nodes of its own
+func (p Protocol) replicated() bool {
+	return p == EPaxos || p == Raft
+}
+
+// SupportsReconfiguration - true if the leaders of the protocol can be reconfigured
+func (p Protocol) SupportsReconfiguration() bool {
+	return p == Classic || p == "" || p == Cheap
+}
+
+// Validate - whether a cluster can be constructed from the config; the phase 1 and
+// phase 2 quorums have to intersect
+func (cfg Config) Validate() error {
+	if cfg.NAcceptors < 0 {
+		return fmt.Errorf("number of acceptors must not be negative")
+	}
+	if err := cfg.Quorum.Check(cfg.acceptorCount()); err != nil {
+		return fmt.Errorf("quorum: %v", err)
+	}
+	if cfg.Protocol != Classic && cfg.Protocol != "" && !cfg.Quorum.IsMajority() {
+		return fmt.Errorf("quorum: the %s protocol requires majority quorums", cfg.Protocol)
+	}
+	if cfg.Keys < 0 {
+		return fmt.Errorf("number of keys must not be negative")
+	}
+	if cfg.Inbox.Capacity < 0 {
+		return fmt.Errorf("inbox capacity must not be negative")
+	}
+	if cfg.Groups < 0 {
+		return fmt.Errorf("number of groups must not be negative")
+	}
+	if cfg.Groups > 1 && cfg.Protocol.replicated() {
+		return fmt.Errorf("groups: the %s protocol does not support sharding", cfg.Protocol)
+	}
+	if err := cfg.Partition.Check(cfg.groupCount()); err != nil {
+		return fmt.Errorf("partition: %v", err)
+	}
+	return nil
+}
+
+// node - a process of a protocol without separate leaders & acceptors, addressed as a v1.Replica
+type node interface {
+	v1.Process
+
+	Run()
+
+	Snapshot() components.ReplicaSnapshot
+
+	Decisions() types.SlotCommandMap
+}
+
 type Env struct {
-	exchange v1.MessageExchange
+	exchange *v1.FaultyMessageExchange
+
+	// lets processes deviate from the protocol
+	byzantine *byzantine.Exchange
 
 	replicas []*components.Replica
 
@@ -21,74 +213,584 @@ type Env struct {
 	clients []*components.Client
 
 	acceptors []*components.Acceptor
+
+	// nodes of the EPaxos or Raft protocol, which replace all of the above but the clients
+	nodes []node
+
+	// the Paxos groups of a sharded cluster, the router of its clients and the coordinator of its
+	// transactions; nil otherwise
+	groups []*shard.Group
+
+	router *shard.Router
+
+	coordinator *shard.Coordinator
+
+	reconfigCount int
+
+	protocol Protocol
+
+	clock clock.Clock
+
+	// the clock of every process which reads the time, off clock; see SkewClock
+	clocks map[v1.Addr]*clock.Skewed
+
+	// tracks the Run go-routine of every process
+	wg *sync.WaitGroup
 }
 
 func NewEnv(nFailures int, nClients int) *Env {
+	return NewEnvWithConfig(Config{
+		NFailures:         nFailures,
+		NClients:          nClients,
+		ClientReqInterval: ClientReqInterval,
+	})
+}
+
+// NewEnvWithConfig - construct the cluster described by the config; panics if the config is invalid
+func NewEnvWithConfig(cfg Config) *Env {
+	if err := cfg.Validate(); err != nil {
+		log.Panicf("invalid config: %v", err)
+	}
+	if cfg.History != nil {
+		cfg.Events = tee(cfg.Events, cfg.History)
+	}
+	cfg.Clock = clock.OrReal(cfg.Clock)
+	nFailures := cfg.NFailures
+	nClients := cfg.NClients
 	nReplicas := nFailures + 1
 	nLeaders := nFailures + 1
-	nAcceptors := (2 * nFailures) + 1
-	exchange := v1.NewMessageExchange()
-
-	acceptorAddr := make([]v1.Addr, nAcceptors, nAcceptors)
-	acceptors := make([]*components.Acceptor, nAcceptors, nAcceptors)
-	for i := 0; i < nAcceptors; i++ {
-		acceptors[i] = components.NewAcceptor(exchange)
-		acceptorAddr[i] = acceptors[i].GetAddr()
+	nAcceptors := cfg.acceptorCount()
+	// record the deliveries which made it past the faulty network
+	var delivery v1.MessageExchange = v1.NewMessageExchange()
+	var traced *trace.Exchange
+	if cfg.Trace != nil {
+		traced = trace.NewExchange(delivery, cfg.Trace)
+		delivery = traced
+	}
+	if cfg.Metrics != nil {
+		delivery = metrics.NewReceivedExchange(delivery, cfg.Metrics)
+	}
+	// tampered messages are traced & counted as delivered
+	byz := byzantine.NewExchange(delivery)
+	delivery = byz
+	exchange := v1.NewFaultyMessageExchange(delivery, cfg.Faults, cfg.Seed)
+	exchange.SetClock(cfg.Clock)
+	// messages are counted as sent before the faulty network gets to drop them
+	var network v1.MessageExchange = exchange
+	if cfg.Metrics != nil {
+		network = metrics.NewSentExchange(exchange, cfg.Metrics)
+	}
+	// every group broadcasts to its own members, the clients send through the router
+	groupNetworks := []v1.MessageExchange{network}
+	clientNetwork := network
+	var groups []*shard.Group
+	var router *shard.Router
+	var coordinator *shard.Coordinator
+	if cfg.groupCount() > 1 {
+		groupNetworks = nil
+		for i := 0; i < cfg.groupCount(); i++ {
+			groups = append(groups, shard.NewGroup(network, i))
+			groupNetworks = append(groupNetworks, groups[i])
+		}
+		partitioner, err := cfg.Partition.Build(len(groups))
+		if err != nil {
+			log.Panicf("shard.Build: %v", err)
+		}
+		router = shard.NewRouter(network, groups, partitioner)
+		coordinator = shard.NewCoordinator(router)
+		clientNetwork = router
+		cfg.Events = tee(cfg.Events, events.Tee(router, coordinator))
+	}
+	opts := []components.Option{
+		components.WithMetrics(cfg.Metrics),
+		components.WithEventSink(cfg.Events),
+		components.WithClock(cfg.Clock),
+	}
+	if cfg.Protocol == Fast {
+		opts = append(opts, components.WithFastPaxos())
+	}
+	if cfg.bounded() {
+		opts = append(opts, components.WithInbox(cfg.Inbox))
+	}
+	if cfg.Metrics != nil {
+		// clients measure the latency of their requests
+		opts = append(opts, components.WithClientNotifications())
+	}
+	clientOpts := opts
+	if cfg.History != nil {
+		clientOpts = append([]components.Option{components.WithHistory(cfg.History)}, clientOpts...)
+	}
+	if cfg.Keys > 0 {
+		clientOpts = append([]components.Option{components.WithWorkloadKeys(cfg.Keys)}, clientOpts...)
+	}
+	interval := cfg.ClientReqInterval
+	if interval <= 0 {
+		interval = ClientReqInterval
 	}
 
-	leaderAddr := make([]v1.Addr, nLeaders, nLeaders)
-	leaders := make([]*components.Leader, nLeaders, nLeaders)
-	for i := 0; i < nLeaders; i++ {
-		leaders[i] = components.NewLeader(exchange, acceptorAddr)
-		leaderAddr[i] = leaders[i].GetAddr()
+	e := &Env{
+		exchange:    exchange,
+		byzantine:   byz,
+		wg:          &sync.WaitGroup{},
+		protocol:    cfg.Protocol,
+		clock:       cfg.Clock,
+		groups:      groups,
+		router:      router,
+		coordinator: coordinator,
+		clocks:      make(map[v1.Addr]*clock.Skewed),
+	}
+	opts = append(opts, components.WithClocks(e.processClock))
+	clientOpts = append(clientOpts, components.WithClocks(e.processClock))
+	if cfg.Protocol.replicated() {
+		if cfg.Protocol == EPaxos {
+			e.nodes = newEPaxosReplicas(network, cfg, e.processClock)
+		} else {
+			e.nodes = newRaftNodes(network, cfg, e.processClock)
+		}
+		targets := e.Addrs(v1.Replica)
+		clientOpts = append([]components.Option{components.WithRequestTargets(targets)}, clientOpts...)
+		for i := 0; i < nClients; i++ {
+			e.clients = append(e.clients, components.NewClient(network, interval, clientOpts...))
+		}
+		log.WithFields(log.Fields{
+			"protocol":  cfg.Protocol,
+			"nFailures": nFailures,
+			"nReplicas": len(e.nodes),
+			"nClients":  nClients,
+		}).Debug("Components constructed")
+		e.registerInboxDepth(cfg.Metrics)
+		return e
 	}
 
-	replicas := make([]*components.Replica, nReplicas, nReplicas)
-	for i := 0; i < nReplicas; i++ {
-		replicas[i] = components.NewReplica(exchange, leaderAddr)
+	// replay rebuilds the cluster from its recorded configuration
+	cluster := trace.Cluster{Fast: cfg.Protocol == Fast, Quorum: cfg.Quorum}
+	for g, groupNetwork := range groupNetworks {
+		acceptorAddr := make([]v1.Addr, nAcceptors, nAcceptors)
+		acceptors := make([]*components.Acceptor, nAcceptors, nAcceptors)
+		for i := 0; i < nAcceptors; i++ {
+			acceptors[i] = components.NewAcceptor(groupNetwork, opts...)
+			acceptorAddr[i] = acceptors[i].GetAddr()
+		}
+
+		system, err := cfg.Quorum.Build(acceptorAddr)
+		if err != nil {
+			log.Panicf("quorum.Build: %v", err)
+		}
+		leaderOpts := append([]components.Option{components.WithQuorum(system)}, opts...)
+		mainAddr, auxAddr := acceptorAddr, []v1.Addr{}
+		if cfg.Protocol == Cheap {
+			// a majority of main acceptors, the rest are auxiliaries
+			mainAddr, auxAddr = acceptorAddr[:nAcceptors/2+1], acceptorAddr[nAcceptors/2+1:]
+			leaderOpts = append(leaderOpts, components.WithAuxiliaryAcceptors(auxAddr))
+		}
+		leaderAddr := make([]v1.Addr, nLeaders, nLeaders)
+		leaders := make([]*components.Leader, nLeaders, nLeaders)
+		for i := 0; i < nLeaders; i++ {
+			leaders[i] = components.NewLeader(groupNetwork, mainAddr, leaderOpts...)
+			leaderAddr[i] = leaders[i].GetAddr()
+		}
+
+		replicas := make([]*components.Replica, nReplicas, nReplicas)
+		for i := 0; i < nReplicas; i++ {
+			replicaOpts := append([]components.Option{components.WithStateMachine(statemachine.NewKV())}, opts...)
+			replicas[i] = components.NewReplica(groupNetwork, leaderAddr, replicaOpts...)
+		}
+
+		e.acceptors = append(e.acceptors, acceptors...)
+		e.leaders = append(e.leaders, leaders...)
+		e.replicas = append(e.replicas, replicas...)
+		replicaAddr := make([]v1.Addr, nReplicas, nReplicas)
+		for i, r := range replicas {
+			replicaAddr[i] = r.GetAddr()
+		}
+		cluster.Groups = append(cluster.Groups, trace.Group{
+			Acceptors:   trace.NewAddrs(mainAddr),
+			Auxiliaries: trace.NewAddrs(auxAddr),
+			Leaders:     trace.NewAddrs(leaderAddr),
+			Replicas:    trace.NewAddrs(replicaAddr),
+		})
+		log.WithFields(log.Fields{
+			"protocol":   cfg.Protocol,
+			"quorum":     system,
+			"group":      g,
+			"nFailures":  nFailures,
+			"nReplicas":  nReplicas,
+			"nLeaders":   nLeaders,
+			"nAcceptors": nAcceptors,
+		}).Debug("Components constructed")
 	}
 
-	log.WithFields(log.Fields{
-		"nFailures":  nFailures,
-		"nReplicas":  nReplicas,
-		"nClients":   nClients,
-		"nLeaders":   nLeaders,
-		"nAcceptors": nAcceptors,
-	}).Debug("Components constructed")
+	if traced != nil {
+		if err := traced.RecordCluster(cluster); err != nil {
+			log.Panicf("trace.RecordCluster: %v", err)
+		}
+	}
 
 	// construct the clients
-	clients := make([]*components.Client, nClients, nClients)
 	for i := 0; i < nClients; i++ {
-		clients[i] = components.NewClient(exchange, ClientReqInterval)
+		e.clients = append(e.clients, components.NewClient(clientNetwork, interval, clientOpts...))
+	}
+	e.registerInboxDepth(cfg.Metrics)
+	return e
+}
+
+// tee - the events recorded to the sink, if any, and to the other sink
+func tee(sink events.Sink, other events.Sink) events.Sink {
+	if sink == nil {
+		return other
+	}
+	return events.Tee(sink, other)
+}
+
+// newEPaxosReplicas - 2 * NFailures + 1 EPaxos replicas, each applying its commands to a KV store
+func newEPaxosReplicas(network v1.MessageExchange, cfg Config, newClock func(addr v1.Addr) clock.Clock) []node {
+	opts := []epaxos.Option{
+		epaxos.WithMetrics(cfg.Metrics),
+		epaxos.WithEventSink(cfg.Events),
+		epaxos.WithStateMachines(func() statemachine.StateMachine { return statemachine.NewKV() }),
+		epaxos.WithClock(cfg.Clock),
+		epaxos.WithClocks(newClock),
+	}
+	if cfg.Metrics != nil {
+		opts = append(opts, epaxos.WithClientNotifications())
+	}
+	if cfg.bounded() {
+		opts = append(opts, epaxos.WithInbox(cfg.Inbox))
 	}
+	nodes := make([]node, 0)
+	for _, r := range epaxos.NewReplicas(network, (2*cfg.NFailures)+1, opts...) {
+		nodes = append(nodes, r)
+	}
+	return nodes
+}
+
+// newRaftNodes - 2 * NFailures + 1 Raft nodes, each applying its commands to a KV store
+func newRaftNodes(network v1.MessageExchange, cfg Config, newClock func(addr v1.Addr) clock.Clock) []node {
+	opts := []raft.Option{
+		raft.WithMetrics(cfg.Metrics),
+		raft.WithEventSink(cfg.Events),
+		raft.WithStateMachines(func() statemachine.StateMachine { return statemachine.NewKV() }),
+		raft.WithSeed(cfg.Seed),
+		raft.WithClock(cfg.Clock),
+		raft.WithClocks(newClock),
+	}
+	if cfg.Metrics != nil {
+		opts = append(opts, raft.WithClientNotifications())
+	}
+	if cfg.bounded() {
+		opts = append(opts, raft.WithInbox(cfg.Inbox))
+	}
+	nodes := make([]node, 0)
+	for _, n := range raft.NewNodes(network, (2*cfg.NFailures)+1, opts...) {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// Clock - the clock of the processes & the network
+func (e *Env) Clock() clock.Clock {
+	return e.clock
+}
+
+// processClock - a clock of the process's own, which runs off the clock of the Env until it is skewed
+func (e *Env) processClock(addr v1.Addr) clock.Clock {
+	c := clock.NewSkewed(e.clock)
+	e.clocks[v1.NewAddress(addr.ID(), addr.Type())] = c
+	return c
+}
 
-	return &Env{
-		exchange:  exchange,
-		leaders:   leaders,
-		replicas:  replicas,
-		clients:   clients,
-		acceptors: acceptors,
+// SkewClock - the clock of the process reads offset ahead of the clock of the Env (behind if
+// negative) and runs rate times as fast as it; SkewClock(addr, 0, 1) restores it. The acceptors
+// do not read the time, and have no clock to skew
+func (e *Env) SkewClock(addr v1.Addr, offset time.Duration, rate float64) error {
+	if rate <= 0 {
+		return fmt.Errorf("clock rate must be positive, got %v", rate)
 	}
+	c, ok := e.clocks[v1.NewAddress(addr.ID(), addr.Type())]
+	if !ok {
+		return fmt.Errorf("not-found: process %v has no clock of its own", addr)
+	}
+	c.Skew(offset, rate)
+	return nil
+}
+
+// ClockOffset - how far the clock of the process is ahead of the clock of the Env
+func (e *Env) ClockOffset(addr v1.Addr) (time.Duration, error) {
+	c, ok := e.clocks[v1.NewAddress(addr.ID(), addr.Type())]
+	if !ok {
+		return 0, fmt.Errorf("not-found: process %v has no clock of its own", addr)
+	}
+	return c.Offset(), nil
 }
 
+// registerInboxDepth - export the number of messages waiting in the inbox of every process
+func (e *Env) registerInboxDepth(r *metrics.Registry) {
+	depth := r.Gauge("paxos_inbox_depth", "Messages waiting in the inbox of a process", "process")
+	processes := make([]v1.Process, 0)
+	for _, a := range e.acceptors {
+		processes = append(processes, a)
+	}
+	for _, l := range e.leaders {
+		processes = append(processes, l)
+	}
+	for _, rp := range e.replicas {
+		processes = append(processes, rp)
+	}
+	for _, n := range e.nodes {
+		processes = append(processes, n)
+	}
+	for _, c := range e.clients {
+		processes = append(processes, c)
+	}
+	for _, p := range processes {
+		p := p
+		depth.Func(func() float64 { return float64(p.InboxLen()) }, metrics.Label(p.GetAddr()))
+	}
+}
+
+// Run - run every process in a go-routine of its own. On a clock.Fake, Run returns once the
+// clients & nodes have set their tickers, so that the ticks of advancing the clock reach them, and
+// the processes settle (see settle) after every tick & timeout
 func (e *Env) Run() {
 	for _, a := range e.acceptors {
-		go a.Run()
+		e.goRun(a.Run)
 	}
 	for _, l := range e.leaders {
-		go l.Run()
+		e.goRun(l.Run)
 	}
 	for _, r := range e.replicas {
-		go r.Run()
+		e.goRun(r.Run)
+	}
+	for _, n := range e.nodes {
+		e.goRun(n.Run)
 	}
 	for _, c := range e.clients {
-		go c.Run()
+		e.goRun(c.Run)
+	}
+	if f, ok := e.clock.(*clock.Fake); ok {
+		f.SetSettle(e.settle)
+		f.WaitTickers(len(e.clients) + len(e.nodes))
+	}
+}
+
+// MaxSettle - the longest a clock.Fake waits for the processes to settle, in real time. Processes
+// which never settle, e.g. leaders preempting each other, hold up virtual time this long
+const MaxSettle = time.Millisecond
+
+// settle - yield to the processes until the messages in their inboxes are handled, so that the
+// virtual time of a clock.Fake does not outrun them
+func (e *Env) settle() {
+	deadline := time.Now().Add(MaxSettle)
+	runtime.Gosched()
+	for e.exchange.Pending() > 0 && time.Now().Before(deadline) {
+		runtime.Gosched()
 	}
 }
 
+func (e *Env) goRun(run func()) {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		run()
+	}()
+}
+
+// Stop - stop the clients, close every process and wait for all of them to exit
 func (e *Env) Stop() {
 	for _, c := range e.clients {
-		log.Infof("Stopping client %v", c)
+		log.Debugf("Stopping client %v", c.GetAddr())
 		c.Stop()
 	}
+	for _, r := range e.replicas {
+		r.Close()
+	}
+	for _, n := range e.nodes {
+		n.Close()
+	}
+	for _, a := range e.acceptors {
+		a.Close()
+	}
+	// every inbox is closed before waiting on the scouts & commanders of the leaders, which may be
+	// blocked on the full inbox of another process
+	for _, l := range e.leaders {
+		l.Process.Close()
+	}
+	for _, l := range e.leaders {
+		l.Close()
+	}
+	e.wg.Wait()
+	log.Debugf("All processes stopped")
+}
+
+// Network - the fault injecting exchange connecting all processes of this Env
+func (e *Env) Network() *v1.FaultyMessageExchange {
+	return e.exchange
+}
+
+// Byzantine - the exchange which lets processes of the cluster deviate from the protocol
+func (e *Env) Byzantine() *byzantine.Exchange {
+	return e.byzantine
+}
+
+// Status - the state of the cluster at a point in time. Processes are listed in
+// construction order, i.e. Acceptors[i] is the process addressed by Addr(v1.Acceptor, i)
+type Status struct {
+	Acceptors []components.AcceptorSnapshot
+	Leaders   []components.LeaderSnapshot
+	Replicas  []components.ReplicaSnapshot
+	Clients   []components.ClientSnapshot
+
+	// Processes which are crashed
+	Crashed []v1.Addr
+
+	// Links which are cut
+	CutLinks [][2]v1.Addr
+
+	// Processes which deviate from the protocol
+	Byzantine []v1.Addr
+}
+
+// IsCrashed - true if the process is crashed
+func (s Status) IsCrashed(addr v1.Addr) bool {
+	for _, c := range s.Crashed {
+		if c.ID() == addr.ID() && c.Type() == addr.Type() {
+			return true
+		}
+	}
+	return false
+}
+
+// Status - a snapshot of every process and of the network; safe to call while the Env runs
+func (e *Env) Status() Status {
+	status := Status{
+		Acceptors: make([]components.AcceptorSnapshot, 0, len(e.acceptors)),
+		Leaders:   make([]components.LeaderSnapshot, 0, len(e.leaders)),
+		Replicas:  make([]components.ReplicaSnapshot, 0, len(e.replicas)+len(e.nodes)),
+		Clients:   make([]components.ClientSnapshot, 0, len(e.clients)),
+		Crashed:   e.exchange.Crashed(),
+		CutLinks:  e.exchange.CutLinks(),
+		Byzantine: e.byzantine.Byzantine(),
+	}
+	for _, a := range e.acceptors {
+		status.Acceptors = append(status.Acceptors, a.Snapshot())
+	}
+	for _, l := range e.leaders {
+		status.Leaders = append(status.Leaders, l.Snapshot())
+	}
+	for _, r := range e.replicas {
+		status.Replicas = append(status.Replicas, r.Snapshot())
+	}
+	for _, n := range e.nodes {
+		status.Replicas = append(status.Replicas, n.Snapshot())
+	}
+	for _, c := range e.clients {
+		status.Clients = append(status.Clients, c.Snapshot())
+	}
+	return status
+}
+
+// Addrs - addresses of all processes of the specified type, in construction order
+func (e *Env) Addrs(pt v1.ProcessType) []v1.Addr {
+	result := make([]v1.Addr, 0)
+	switch pt {
+	case v1.Acceptor:
+		for _, a := range e.acceptors {
+			result = append(result, a.GetAddr())
+		}
+	case v1.Leader:
+		for _, l := range e.leaders {
+			result = append(result, l.GetAddr())
+		}
+	case v1.Replica:
+		for _, r := range e.replicas {
+			result = append(result, r.GetAddr())
+		}
+		for _, n := range e.nodes {
+			result = append(result, n.GetAddr())
+		}
+	case v1.Client:
+		for _, c := range e.clients {
+			result = append(result, c.GetAddr())
+		}
+	}
+	return result
+}
+
+// Addr - address of the index'th process of the specified type
+func (e *Env) Addr(pt v1.ProcessType, index int) (v1.Addr, error) {
+	addrs := e.Addrs(pt)
+	if index < 0 || index >= len(addrs) {
+		return nil, fmt.Errorf("not-found: no %v with index %d", pt, index)
+	}
+	return addrs[index], nil
+}
+
+// Reconfigure - request the replicas to switch to the specified leader configuration
+func (e *Env) Reconfigure(leaders []v1.Addr) error {
+	if !e.protocol.SupportsReconfiguration() {
+		return fmt.Errorf("not-supported: reconfiguration in the %s protocol", e.protocol)
+	}
+	if e.router != nil {
+		return fmt.Errorf("not-supported: reconfiguration of a sharded cluster")
+	}
+	e.reconfigCount++
+	src := v1.NewAddress(v1.ProcessID(-1), v1.Client)
+	command := &types.ReConfigCommand{
+		BasicCommand: types.BasicCommand{
+			ClientID:  fmt.Sprintf("%v", src),
+			CommandID: fmt.Sprintf("reconfig-%d", e.reconfigCount),
+			Op:        "RECONFIG",
+		},
+		NewLeaders: leaders,
+	}
+	return e.exchange.SendAll(v1.Replica, messages.NewRequestMessage(src, command))
+}
+
+// DecisionLogs - the decisions made so far at every replica
+func (e *Env) DecisionLogs() []invariant.DecisionLog {
+	result := make([]invariant.DecisionLog, 0, len(e.replicas)+len(e.nodes))
+	for _, r := range e.replicas {
+		result = append(result, invariant.DecisionLog{
+			Replica:   r.GetAddr(),
+			Group:     e.Group(r.GetAddr()),
+			Decisions: r.Decisions(),
+		})
+	}
+	for _, n := range e.nodes {
+		result = append(result, invariant.DecisionLog{
+			Replica:   n.GetAddr(),
+			Decisions: n.Decisions(),
+		})
+	}
+	return result
+}
+
+// Router - the router of the clients of a sharded cluster, nil unless the cluster has more than
+// one group
+func (e *Env) Router() *shard.Router {
+	return e.router
+}
+
+// Coordinator - the coordinator of the transactions across the groups of a sharded cluster, nil
+// unless the cluster has more than one group
+func (e *Env) Coordinator() *shard.Coordinator {
+	return e.coordinator
+}
+
+// Group - the index of the Paxos group of the process, 0 unless the cluster is sharded
+func (e *Env) Group(addr v1.Addr) int {
+	for _, g := range e.groups {
+		if g.Contains(addr) {
+			return g.Index()
+		}
+	}
+	return 0
+}
+
+// MoveRange - move the range of keys to the group, see shard.Router.Move
+func (e *Env) MoveRange(keys statemachine.KeyRange, group int) error {
+	if e.router == nil {
+		return fmt.Errorf("not-supported: moving keys in a cluster of one group")
+	}
+	return e.router.Move(keys, group)
 }
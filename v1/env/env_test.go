@@ -0,0 +1,686 @@
+package env
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/1xyz/paxossim/queue"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/history"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/quorum"
+	"github.com/1xyz/paxossim/v1/shard"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	. "github.com/smartystreets/goconvey/convey"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEnv_Stop(t *testing.T) {
+	Convey("Given a running Env", t, func() {
+		before := runtime.NumGoroutine()
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          2,
+			ClientReqInterval: 5 * time.Millisecond,
+		})
+		e.Run()
+		time.Sleep(100 * time.Millisecond)
+
+		Convey("Stop returns once every process has exited", func() {
+			stopped := make(chan bool)
+			go func() {
+				e.Stop()
+				stopped <- true
+			}()
+
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the Env to stop")
+			}
+			So(runtime.NumGoroutine(), ShouldBeLessThanOrEqualTo, before)
+		})
+	})
+}
+
+func TestEnv_Metrics(t *testing.T) {
+	Convey("Given an Env recording metrics", t, func() {
+		r := metrics.NewRegistry()
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          1,
+			ClientReqInterval: 5 * time.Millisecond,
+			Metrics:           r,
+		})
+		e.Run()
+		time.Sleep(200 * time.Millisecond)
+		e.Stop()
+
+		Convey("every leader spawned a scout", func() {
+			for _, addr := range e.Addrs(v1.Leader) {
+				v, ok := r.Value("paxos_scouts_spawned_total", metrics.Label(addr))
+				So(ok, ShouldBeTrue)
+				So(v, ShouldBeGreaterThanOrEqualTo, 1)
+			}
+		})
+
+		Convey("the inbox depth of every acceptor is exported", func() {
+			for _, addr := range e.Addrs(v1.Acceptor) {
+				_, ok := r.Value("paxos_inbox_depth", metrics.Label(addr))
+				So(ok, ShouldBeTrue)
+			}
+		})
+
+		Convey("the replicas decided slots", func() {
+			buf := &bytes.Buffer{}
+			So(r.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, "paxos_decision_latency_seconds_count")
+			So(buf.String(), ShouldContainSubstring, "paxos_messages_sent_total")
+		})
+	})
+}
+
+func TestEnv_Status(t *testing.T) {
+	Convey("Given a running Env", t, func() {
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          1,
+			ClientReqInterval: 5 * time.Millisecond,
+		})
+		e.Run()
+		time.Sleep(200 * time.Millisecond)
+		defer e.Stop()
+
+		Convey("the status lists every process in construction order", func() {
+			status := e.Status()
+			So(len(status.Acceptors), ShouldEqual, 3)
+			So(len(status.Leaders), ShouldEqual, 2)
+			So(len(status.Replicas), ShouldEqual, 2)
+			So(len(status.Clients), ShouldEqual, 1)
+			addr, _ := e.Addr(v1.Replica, 1)
+			So(status.Replicas[1].Addr.ID(), ShouldEqual, addr.ID())
+			So(status.Clients[0].Requests, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("the status reports crashed processes", func() {
+			addr, _ := e.Addr(v1.Leader, 0)
+			e.Network().Crash(addr)
+			So(e.Status().IsCrashed(addr), ShouldBeTrue)
+		})
+	})
+}
+
+func TestEnv_FastPaxos(t *testing.T) {
+	Convey("Given an Env running Fast Paxos", t, func() {
+		r := metrics.NewRegistry()
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          2,
+			ClientReqInterval: 5 * time.Millisecond,
+			Metrics:           r,
+			Protocol:          Fast,
+		})
+		e.Run()
+		time.Sleep(300 * time.Millisecond)
+		e.Stop()
+
+		Convey("the replicas decide the same command in every slot", func() {
+			status := e.Status()
+			decided := 0
+			for _, replica := range status.Replicas {
+				for slot, command := range replica.Decisions {
+					for _, other := range status.Replicas {
+						if c, ok := other.Decisions[slot]; ok {
+							So(c, ShouldResemble, command)
+						}
+					}
+				}
+				if len(replica.Decisions) > decided {
+					decided = len(replica.Decisions)
+				}
+			}
+			So(decided, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("the clients measured the latency of their requests", func() {
+			_, count := r.Total("paxos_client_latency_seconds")
+			So(count, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("reconfiguration is not supported", func() {
+			So(e.Reconfigure(e.Addrs(v1.Leader)), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEnv_EPaxos(t *testing.T) {
+	Convey("Given an Env running EPaxos over a few keys", t, func() {
+		r := metrics.NewRegistry()
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          3,
+			ClientReqInterval: 5 * time.Millisecond,
+			Metrics:           r,
+			Protocol:          EPaxos,
+			Keys:              2,
+		})
+		e.Run()
+		time.Sleep(300 * time.Millisecond)
+		e.Stop()
+
+		Convey("there are 2F+1 replicas and neither leaders nor acceptors", func() {
+			So(len(e.Addrs(v1.Replica)), ShouldEqual, 3)
+			So(len(e.Addrs(v1.Leader)), ShouldEqual, 0)
+			So(len(e.Addrs(v1.Acceptor)), ShouldEqual, 0)
+		})
+
+		Convey("the replicas commit the same command in every instance", func() {
+			So(invariant.CheckDecisions(e.DecisionLogs()), ShouldBeEmpty)
+			v, _ := r.Total("epaxos_executed_total")
+			So(v, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("the clients measured the latency of their requests", func() {
+			_, count := r.Total("paxos_client_latency_seconds")
+			So(count, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("reconfiguration is not supported", func() {
+			So(e.Reconfigure(e.Addrs(v1.Replica)), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEnv_Raft(t *testing.T) {
+	Convey("Given an Env running Raft and an Env running the classic protocol", t, func() {
+		envs := make(map[Protocol]*Env)
+		for _, p := range []Protocol{Classic, Raft} {
+			envs[p] = NewEnvWithConfig(Config{
+				NFailures:         1,
+				NClients:          2,
+				ClientReqInterval: 5 * time.Millisecond,
+				Protocol:          p,
+			})
+			envs[p].Run()
+		}
+		time.Sleep(500 * time.Millisecond)
+		for _, e := range envs {
+			e.Stop()
+		}
+
+		Convey("the Raft cluster is made of 2F+1 nodes addressed as replicas", func() {
+			So(len(envs[Raft].Addrs(v1.Replica)), ShouldEqual, 3)
+			So(len(envs[Raft].Addrs(v1.Leader)), ShouldEqual, 0)
+		})
+
+		Convey("both decision logs pass the same invariant checker", func() {
+			for _, e := range envs {
+				logs := e.DecisionLogs()
+				So(invariant.CheckDecisions(logs), ShouldBeEmpty)
+				So(len(logs[0].Decisions), ShouldBeGreaterThan, 0)
+			}
+		})
+
+		Convey("one node knows itself to be the leader", func() {
+			leaders := 0
+			for _, r := range envs[Raft].Status().Replicas {
+				if len(r.Leaders) == 1 && r.Leaders[0] == r.Addr {
+					leaders++
+				}
+			}
+			So(leaders, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestEnv_BoundedInbox(t *testing.T) {
+	inboxes := map[Protocol]queue.Options{
+		Classic: {Capacity: 32, Policy: queue.Block},
+		Raft:    {Capacity: 16, Policy: queue.DropOldest},
+	}
+	for _, p := range []Protocol{Classic, Raft} {
+		inbox := inboxes[p]
+		Convey(fmt.Sprintf("Given an Env running %s whose processes have inboxes of %d messages", p, inbox.Capacity), t, func() {
+			capacity := inbox.Capacity
+			e := NewEnvWithConfig(Config{
+				NFailures:         1,
+				NClients:          3,
+				ClientReqInterval: 2 * time.Millisecond,
+				Protocol:          p,
+				Inbox:             inbox,
+			})
+			e.Run()
+			time.Sleep(500 * time.Millisecond)
+			status := e.Status()
+			e.Stop()
+
+			Convey("no inbox holds more messages than its capacity", func() {
+				for _, r := range status.Replicas {
+					So(r.InboxLen, ShouldBeLessThanOrEqualTo, capacity)
+				}
+				for _, l := range status.Leaders {
+					So(l.InboxLen, ShouldBeLessThanOrEqualTo, capacity)
+				}
+			})
+
+			Convey("the cluster decides commands without conflicts", func() {
+				logs := e.DecisionLogs()
+				So(invariant.CheckDecisions(logs), ShouldBeEmpty)
+				So(len(logs[0].Decisions), ShouldBeGreaterThan, 0)
+			})
+		})
+	}
+}
+
+func TestEnv_Clock(t *testing.T) {
+	Convey("Given Envs of every protocol on a fake clock", t, func() {
+		envs := make(map[Protocol]*Env)
+		fakes := make(map[Protocol]*clock.Fake)
+		for _, p := range []Protocol{Classic, Cheap, EPaxos, Raft} {
+			fakes[p] = clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			envs[p] = NewEnvWithConfig(Config{
+				NFailures:         1,
+				NClients:          2,
+				ClientReqInterval: time.Second,
+				Protocol:          p,
+				Clock:             fakes[p],
+			})
+			envs[p].Run()
+		}
+
+		Convey("the clients send no request while the clock stands still", func() {
+			time.Sleep(50 * time.Millisecond)
+			for _, e := range envs {
+				e.Stop()
+				for _, l := range e.DecisionLogs() {
+					So(l.Decisions, ShouldBeEmpty)
+				}
+			}
+		})
+
+		Convey("ten seconds of virtual time take no time", func() {
+			start := time.Now()
+			for p, e := range envs {
+				clock.Sleep(e.Clock(), 10*time.Second)
+				So(fakes[p].Now(), ShouldEqual, time.Date(2020, 1, 1, 0, 0, 10, 0, time.UTC))
+			}
+			// the processes catch up with the last requests
+			time.Sleep(100 * time.Millisecond)
+			for _, e := range envs {
+				e.Stop()
+			}
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+			for p, e := range envs {
+				logs := e.DecisionLogs()
+				So(invariant.CheckDecisions(logs), ShouldBeEmpty)
+				decided := 0
+				for _, l := range logs {
+					if len(l.Decisions) > decided {
+						decided = len(l.Decisions)
+					}
+				}
+				So(fmt.Sprintf("%v decided %d", p, decided), ShouldNotEndWith, " decided 0")
+			}
+		})
+	})
+}
+
+func TestEnv_Duplicates(t *testing.T) {
+	Convey("Given an Env whose network duplicates half of the messages", t, func() {
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          1,
+			ClientReqInterval: 5 * time.Millisecond,
+			Faults:            v1.FaultModel{DuplicateRate: 0.5},
+		})
+		e.Run()
+		time.Sleep(time.Second)
+		e.Stop()
+
+		Convey("the scouts & commanders ignore the duplicate responses, and the cluster keeps deciding", func() {
+			logs := e.DecisionLogs()
+			So(invariant.CheckDecisions(logs), ShouldBeEmpty)
+			So(len(logs[0].Decisions), ShouldBeGreaterThan, 10)
+		})
+	})
+}
+
+func TestEnv_IDs(t *testing.T) {
+	Convey("Given two Envs of the same config", t, func() {
+		cfg := Config{NFailures: 1, NClients: 2, ClientReqInterval: 5 * time.Millisecond}
+		envs := []*Env{NewEnvWithConfig(cfg), NewEnvWithConfig(cfg)}
+
+		Convey("their processes have the same addresses, from zero", func() {
+			for _, pt := range []v1.ProcessType{v1.Acceptor, v1.Leader, v1.Replica} {
+				So(envs[0].Addrs(pt), ShouldResemble, envs[1].Addrs(pt))
+				So(envs[0].Addrs(pt)[0].ID(), ShouldEqual, v1.ProcessID(0))
+			}
+		})
+
+		Convey("they run side by side as independent clusters", func() {
+			for _, e := range envs {
+				e.Run()
+			}
+			time.Sleep(200 * time.Millisecond)
+			for _, e := range envs {
+				e.Stop()
+			}
+			for _, e := range envs {
+				logs := e.DecisionLogs()
+				So(invariant.CheckDecisions(logs), ShouldBeEmpty)
+				So(len(logs[0].Decisions), ShouldBeGreaterThan, 0)
+			}
+		})
+	})
+}
+
+func TestEnv_CheapPaxos(t *testing.T) {
+	Convey("Given an Env running Cheap Paxos with one auxiliary acceptor", t, func() {
+		r := metrics.NewRegistry()
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          2,
+			ClientReqInterval: 5 * time.Millisecond,
+			Protocol:          Cheap,
+			Metrics:           r,
+		})
+		acceptors := e.Addrs(v1.Acceptor)
+		received := func(addr v1.Addr) float64 {
+			total := 0.0
+			for _, t := range []string{"Phase1a", "Phase2a"} {
+				v, _ := r.Value("paxos_messages_received_total", t, metrics.Label(addr))
+				total += v
+			}
+			return total
+		}
+		e.Run()
+		time.Sleep(300 * time.Millisecond)
+
+		Convey("only the main acceptors take part while there are no failures", func() {
+			So(received(acceptors[0]), ShouldBeGreaterThan, 0)
+			So(received(acceptors[1]), ShouldBeGreaterThan, 0)
+			So(received(acceptors[2]), ShouldEqual, 0)
+			e.Stop()
+		})
+
+		Convey("the auxiliary acceptor replaces a main acceptor which crashed", func() {
+			e.Network().Crash(acceptors[0])
+			before := len(e.DecisionLogs()[0].Decisions)
+			reconfigured := func() bool {
+				for _, l := range e.Status().Leaders {
+					if l.Acceptors[0] == acceptors[0] {
+						return false
+					}
+				}
+				return true
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for !reconfigured() && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+			}
+			So(reconfigured(), ShouldBeTrue)
+			time.Sleep(200 * time.Millisecond)
+			e.Stop()
+
+			So(received(acceptors[2]), ShouldBeGreaterThan, 0)
+			engagements, _ := r.Total("paxos_auxiliary_engagements_total")
+			So(engagements, ShouldBeGreaterThan, 0)
+			logs := e.DecisionLogs()
+			So(invariant.CheckDecisions(logs), ShouldBeEmpty)
+			So(len(logs[0].Decisions), ShouldBeGreaterThan, before)
+		})
+	})
+}
+
+func TestEnv_Byzantine(t *testing.T) {
+	Convey("Given an Env whose leaders propose conflicting commands", t, func() {
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          2,
+			ClientReqInterval: 5 * time.Millisecond,
+		})
+		for _, addr := range e.Addrs(v1.Leader) {
+			b, err := byzantine.New(byzantine.ConflictingProposals)
+			So(err, ShouldBeNil)
+			e.Byzantine().SetBehavior(addr, b)
+		}
+		So(len(e.Status().Byzantine), ShouldEqual, 2)
+		e.Run()
+		time.Sleep(300 * time.Millisecond)
+		e.Stop()
+
+		Convey("the invariant checker reports conflicting decisions", func() {
+			violations := invariant.CheckDecisions(e.DecisionLogs())
+			So(violations, ShouldNotBeEmpty)
+			So(violations[0].Invariant, ShouldEqual, "R1")
+		})
+	})
+}
+
+func TestParseProtocol(t *testing.T) {
+	Convey("Protocols are parsed case insensitively, empty is classic", t, func() {
+		p, err := ParseProtocol("")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, Classic)
+		p, err = ParseProtocol("Fast")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, Fast)
+		p, err = ParseProtocol("EPaxos")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, EPaxos)
+		p, err = ParseProtocol("raft")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, Raft)
+		p, err = ParseProtocol("cheap")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, Cheap)
+		_, err = ParseProtocol("mencius")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	Convey("Given the config of a cluster of 6 acceptors", t, func() {
+		cfg := Config{NFailures: 1, NAcceptors: 6}
+
+		Convey("majority quorums are valid", func() {
+			So(cfg.Validate(), ShouldBeNil)
+		})
+
+		Convey("a grid of 2 rows is valid", func() {
+			cfg.Quorum = quorum.Spec{Kind: quorum.KindGrid, Rows: 2}
+			So(cfg.Validate(), ShouldBeNil)
+		})
+
+		Convey("phase 1 & phase 2 quorums which do not intersect are rejected", func() {
+			cfg.Quorum = quorum.Spec{Kind: quorum.KindSizes, Phase1: 3, Phase2: 3}
+			So(cfg.Validate(), ShouldNotBeNil)
+			So(func() { NewEnvWithConfig(cfg) }, ShouldPanic)
+		})
+
+		Convey("sharding requires a Paxos protocol, and a bound between every two groups", func() {
+			cfg.Groups = 3
+			cfg.Partition = shard.Spec{Kind: shard.KindRange, Bounds: []string{"k3", "k6"}}
+			So(cfg.Validate(), ShouldBeNil)
+			cfg.Protocol = Raft
+			So(cfg.Validate(), ShouldNotBeNil)
+			cfg.Protocol = Classic
+			cfg.Partition.Bounds = []string{"k3"}
+			So(cfg.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("a negative inbox capacity is rejected", func() {
+			cfg.Inbox = queue.Options{Capacity: -1}
+			So(cfg.Validate(), ShouldNotBeNil)
+		})
+
+		Convey("Fast Paxos requires majority quorums", func() {
+			cfg.Protocol = Fast
+			cfg.Quorum = quorum.Spec{Kind: quorum.KindGrid, Rows: 2}
+			So(cfg.Validate(), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEnv_FlexibleQuorum(t *testing.T) {
+	Convey("Given an Env with phase 2 quorums smaller than a majority", t, func() {
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          1,
+			ClientReqInterval: 5 * time.Millisecond,
+			NAcceptors:        6,
+			Quorum:            quorum.Spec{Kind: quorum.KindSizes, Phase1: 5, Phase2: 2},
+		})
+		e.Run()
+		time.Sleep(200 * time.Millisecond)
+		e.Stop()
+
+		Convey("the replicas decide slots", func() {
+			status := e.Status()
+			So(len(status.Acceptors), ShouldEqual, 6)
+			So(len(status.Replicas[0].Decisions), ShouldBeGreaterThan, 0)
+		})
+	})
+}
+
+func TestEnv_Sharded(t *testing.T) {
+	Convey("Given an Env of two groups, partitioning the keys by range", t, func() {
+		sink := events.NewMemory()
+		h := history.New()
+		e := NewEnvWithConfig(Config{
+			NFailures:         1,
+			NClients:          2,
+			ClientReqInterval: 5 * time.Millisecond,
+			Keys:              8,
+			Groups:            2,
+			Partition:         shard.Spec{Kind: shard.KindRange, Bounds: []string{"k4"}},
+			Events:            sink,
+			History:           h,
+		})
+		keys := statemachine.KeyRange{Start: "k2", End: "k4"}
+		// the groups of the replicas which performed a PUT of the key with effect, -1 for a replica
+		// which did so after it moved the key away
+		putAt := func(key string) map[int]bool {
+			groups := make(map[int]bool)
+			moved := make(map[string]bool)
+			for _, ev := range sink.OfKind(events.KindCommandPerformed) {
+				p := ev.(events.CommandPerformed)
+				replica := fmt.Sprintf("%v", p.Replica)
+				switch {
+				case p.Command.GetClientID() == shard.RouterID:
+					moved[replica] = moved[replica] || e.Group(p.Replica) == 0
+				case statemachine.Keys(p.Command)[0] == key && p.Result != statemachine.ResultMoved:
+					if moved[replica] && keys.Contains(key) {
+						groups[-1] = true
+					} else {
+						groups[e.Group(p.Replica)] = true
+					}
+				}
+			}
+			return groups
+		}
+		e.Run()
+		time.Sleep(200 * time.Millisecond)
+
+		Convey("every group has processes of its own, and decides the requests for its keys", func() {
+			e.Stop()
+			So(len(e.Addrs(v1.Replica)), ShouldEqual, 4)
+			So(len(e.Addrs(v1.Acceptor)), ShouldEqual, 6)
+			logs := e.DecisionLogs()
+			So(invariant.CheckDecisions(logs), ShouldBeEmpty)
+			So(logs[0].Group, ShouldEqual, 0)
+			So(logs[3].Group, ShouldEqual, 1)
+			So(len(logs[0].Decisions), ShouldBeGreaterThan, 0)
+			So(len(logs[3].Decisions), ShouldBeGreaterThan, 0)
+			So(putAt("k1"), ShouldResemble, map[int]bool{0: true})
+			So(putAt("k5"), ShouldResemble, map[int]bool{1: true})
+		})
+
+		Convey("a range of keys moves to the other group", func() {
+			So(e.MoveRange(keys, 1), ShouldBeNil)
+			deadline := time.Now().Add(5 * time.Second)
+			for e.Router().Moving() && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(e.Router().Moving(), ShouldBeFalse)
+			for !putAt("k3")[1] && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			e.Stop()
+
+			So(e.Router().Group("k3"), ShouldEqual, 1)
+			So(putAt("k3"), ShouldResemble, map[int]bool{0: true, 1: true})
+			So(putAt("k1"), ShouldResemble, map[int]bool{0: true})
+			So(invariant.CheckDecisions(e.DecisionLogs()), ShouldBeEmpty)
+			So(history.CheckLinearizable(h.Ops(), h.Orders()), ShouldBeEmpty)
+			So(e.Reconfigure(e.Addrs(v1.Leader)[:1]), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEnv_Transactions(t *testing.T) {
+	Convey("Given an Env of two groups, running transactions over keys of both", t, func() {
+		e := NewEnvWithConfig(Config{
+			NFailures: 1,
+			Keys:      8,
+			Groups:    2,
+			Partition: shard.Spec{Kind: shard.KindRange, Bounds: []string{"k4"}},
+		})
+		coordinator := e.Coordinator()
+		// the transaction, once it committed or aborted
+		await := func(txid string) shard.Transaction {
+			deadline := time.Now().Add(5 * time.Second)
+			for time.Now().Before(deadline) {
+				if txn, ok := coordinator.Transaction(txid); ok && txn.Status != shard.TxnPending {
+					return txn
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			txn, _ := coordinator.Transaction(txid)
+			return txn
+		}
+		e.Run()
+		defer e.Stop()
+
+		Convey("a transaction commits at every group", func() {
+			txid, err := coordinator.Submit(ops.Put{Key: "k1", Value: "a"}, ops.Put{Key: "k5", Value: "b"})
+			So(err, ShouldBeNil)
+			So(await(txid).Status, ShouldEqual, shard.TxnCommitted)
+
+			txid, err = coordinator.Submit(ops.Get{Key: "k1"}, ops.Get{Key: "k5"})
+			So(err, ShouldBeNil)
+			txn := await(txid)
+			So(txn.Status, ShouldEqual, shard.TxnCommitted)
+			So(txn.Reads, ShouldResemble, map[string]string{"k1": "a", "k5": "b"})
+			So(txn.Parts[0].Ops, ShouldResemble, []ops.Operation{ops.Get{Key: "k1"}})
+			So(coordinator.Violations(), ShouldBeEmpty)
+		})
+
+		Convey("a transaction in doubt is completed after the coordinator restarts", func() {
+			txid, err := coordinator.Submit(ops.Put{Key: "k1", Value: "a"}, ops.Put{Key: "k5", Value: "b"})
+			So(err, ShouldBeNil)
+			coordinator.Crash()
+			time.Sleep(200 * time.Millisecond)
+			_, ok := coordinator.Transaction(txid)
+			So(ok, ShouldBeFalse)
+
+			So(coordinator.Restart(), ShouldBeNil)
+			So(await(txid).Status, ShouldNotEqual, shard.TxnPending)
+
+			txid, err = coordinator.Submit(ops.Get{Key: "k1"}, ops.Get{Key: "k5"})
+			So(err, ShouldBeNil)
+			txn := await(txid)
+			So(txn.Status, ShouldEqual, shard.TxnCommitted)
+			So(txn.Reads, ShouldBeIn, []map[string]string{{"k1": "", "k5": ""}, {"k1": "a", "k5": "b"}})
+			So(coordinator.Violations(), ShouldBeEmpty)
+			So(invariant.CheckDecisions(e.DecisionLogs()), ShouldBeEmpty)
+		})
+	})
+}
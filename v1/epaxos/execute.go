@@ -0,0 +1,163 @@
+package epaxos
+
+import (
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+	"time"
+)
+
+// execute - execute every committed instance whose dependencies are all committed
+func (r *Replica) execute(now time.Time) {
+	ids := make([]InstanceID, 0)
+	for id, inst := range r.instances {
+		if inst.status == Committed {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return lessInstance(ids[i], ids[j]) })
+	for _, id := range ids {
+		if r.instances[id].status != Committed {
+			continue
+		}
+		if graph, ok := r.dependencyGraph(id, now); ok {
+			r.executeGraph(graph)
+		}
+	}
+}
+
+// dependencyGraph - the instances reachable from id which are not executed yet, unless one
+// of them is not committed; its execution then waits for the commit (or the recovery) of it
+func (r *Replica) dependencyGraph(id InstanceID, now time.Time) ([]InstanceID, bool) {
+	visited := map[InstanceID]bool{id: true}
+	stack := []InstanceID{id}
+	graph := make([]InstanceID, 0)
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		inst, ok := r.instances[next]
+		if !ok || inst.status < Committed {
+			// learn of a dependency which was never received, so that it is recovered in time
+			r.get(next, now)
+			return nil, false
+		}
+		if inst.status == Executed {
+			continue
+		}
+		graph = append(graph, next)
+		for _, dep := range inst.attrs.Deps {
+			if !visited[dep] {
+				visited[dep] = true
+				stack = append(stack, dep)
+			}
+		}
+	}
+	sort.Slice(graph, func(i, j int) bool { return lessInstance(graph[i], graph[j]) })
+	return graph, true
+}
+
+// executeGraph - execute the strongly connected components of the committed dependency graph in
+// reverse topological order (Tarjan's algorithm yields them in that order), and the instances of
+// a component by sequence number
+func (r *Replica) executeGraph(graph []InstanceID) {
+	index := 0
+	indexes := make(map[InstanceID]int)
+	lowlinks := make(map[InstanceID]int)
+	onStack := make(map[InstanceID]bool)
+	stack := make([]InstanceID, 0)
+
+	var connect func(id InstanceID)
+	connect = func(id InstanceID) {
+		indexes[id] = index
+		lowlinks[id] = index
+		index++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, dep := range r.instances[id].attrs.Deps {
+			if r.instances[dep].status == Executed {
+				continue
+			}
+			if _, ok := indexes[dep]; !ok {
+				connect(dep)
+				if lowlinks[dep] < lowlinks[id] {
+					lowlinks[id] = lowlinks[dep]
+				}
+			} else if onStack[dep] && indexes[dep] < lowlinks[id] {
+				lowlinks[id] = indexes[dep]
+			}
+		}
+
+		if lowlinks[id] == indexes[id] {
+			component := make([]InstanceID, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == id {
+					break
+				}
+			}
+			r.executeComponent(component)
+		}
+	}
+
+	for _, id := range graph {
+		if _, ok := indexes[id]; !ok && r.instances[id].status == Committed {
+			connect(id)
+		}
+	}
+}
+
+func (r *Replica) executeComponent(component []InstanceID) {
+	sort.Slice(component, func(i, j int) bool {
+		a, b := r.instances[component[i]], r.instances[component[j]]
+		if a.attrs.Seq != b.attrs.Seq {
+			return a.attrs.Seq < b.attrs.Seq
+		}
+		return lessInstance(a.id, b.id)
+	})
+	for _, id := range component {
+		inst := r.instances[id]
+		inst.status = Executed
+		r.executed = append(r.executed, id)
+		r.metrics.executed.Inc(r.label)
+		if isNoOp(inst.command) || r.performed[commandKey(inst.command)] {
+			continue
+		}
+		r.performed[commandKey(inst.command)] = true
+		result := ""
+		if r.stateMachine != nil {
+			result = r.stateMachine.Apply(inst.command)
+		}
+		events.Emit(r.events, events.CommandPerformed{
+			Replica: r.GetAddr(), Slot: r.slotOf(id), Command: inst.command, Result: result})
+	}
+}
+
+// Decisions - a copy of the commands committed so far, indexed by the slots of their instances
+func (r *Replica) Decisions() types.SlotCommandMap {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make(types.SlotCommandMap)
+	for id, inst := range r.instances {
+		if inst.status >= Committed {
+			result[r.slotOf(id)] = inst.command
+		}
+	}
+	return result
+}
+
+// Executed - the commands executed so far, in execution order; no-ops are left out
+func (r *Replica) Executed() []types.Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]types.Command, 0, len(r.executed))
+	for _, id := range r.executed {
+		if command := r.instances[id].command; !isNoOp(command) {
+			result = append(result, command)
+		}
+	}
+	return result
+}
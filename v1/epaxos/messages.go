@@ -0,0 +1,223 @@
+package epaxos
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+)
+
+// InstanceID - identifies an instance, the Index'th command led by a replica
+type InstanceID struct {
+	Replica v1.ProcessID
+
+	Index int
+}
+
+func (id InstanceID) String() string {
+	return fmt.Sprintf("%d.%d", id.Replica, id.Index)
+}
+
+func lessInstance(a InstanceID, b InstanceID) bool {
+	if a.Replica != b.Replica {
+		return a.Replica < b.Replica
+	}
+	return a.Index < b.Index
+}
+
+// Attributes - the sequence number and the dependencies of an instance, which order its
+// execution relative to the interfering instances
+type Attributes struct {
+	Seq int
+
+	// sorted by replica & index
+	Deps []InstanceID
+}
+
+// union - the attributes which order an instance after both a and b
+func union(a Attributes, b Attributes) Attributes {
+	seen := make(map[InstanceID]bool)
+	deps := make([]InstanceID, 0, len(a.Deps)+len(b.Deps))
+	for _, d := range append(append([]InstanceID{}, a.Deps...), b.Deps...) {
+		if !seen[d] {
+			seen[d] = true
+			deps = append(deps, d)
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool { return lessInstance(deps[i], deps[j]) })
+	seq := a.Seq
+	if b.Seq > seq {
+		seq = b.Seq
+	}
+	return Attributes{Seq: seq, Deps: deps}
+}
+
+func (a Attributes) equal(b Attributes) bool {
+	if a.Seq != b.Seq || len(a.Deps) != len(b.Deps) {
+		return false
+	}
+	for i := range a.Deps {
+		if a.Deps[i] != b.Deps[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type basicMessage struct {
+	src v1.Addr
+}
+
+func (bm basicMessage) Src() v1.Addr {
+	return bm.src
+}
+
+// PreAcceptMessage - sent by the leader of an instance to every other replica, proposing
+// the command with the attributes computed by the leader (phase 1)
+type PreAcceptMessage struct {
+	basicMessage
+	Ballot   types.BallotNumber
+	Instance InstanceID
+	Command  types.Command
+	Attrs    Attributes
+}
+
+func NewPreAcceptMessage(source v1.Addr, ballot types.BallotNumber, id InstanceID, command types.Command, attrs Attributes) PreAcceptMessage {
+	return PreAcceptMessage{
+		basicMessage: basicMessage{src: source},
+		Ballot:       ballot,
+		Instance:     id,
+		Command:      command,
+		Attrs:        attrs,
+	}
+}
+
+func (m PreAcceptMessage) MessageName() string { return "PreAcceptMessage" }
+
+// PreAcceptReplyMessage - the attributes of the instance at a replica, updated with the
+// interfering instances the replica knows of
+type PreAcceptReplyMessage struct {
+	basicMessage
+	Ballot   types.BallotNumber
+	Instance InstanceID
+	OK       bool
+	Attrs    Attributes
+
+	// the replica added dependencies, or a higher sequence number
+	Changed bool
+}
+
+func NewPreAcceptReplyMessage(source v1.Addr, ballot types.BallotNumber, id InstanceID, ok bool, attrs Attributes, changed bool) PreAcceptReplyMessage {
+	return PreAcceptReplyMessage{
+		basicMessage: basicMessage{src: source},
+		Ballot:       ballot,
+		Instance:     id,
+		OK:           ok,
+		Attrs:        attrs,
+		Changed:      changed,
+	}
+}
+
+func (m PreAcceptReplyMessage) MessageName() string { return "PreAcceptReplyMessage" }
+
+// AcceptMessage - sent by the leader of an instance to every other replica if the fast path
+// failed, to accept the union of the attributes reported in phase 1 (phase 2)
+type AcceptMessage struct {
+	basicMessage
+	Ballot   types.BallotNumber
+	Instance InstanceID
+	Command  types.Command
+	Attrs    Attributes
+}
+
+func NewAcceptMessage(source v1.Addr, ballot types.BallotNumber, id InstanceID, command types.Command, attrs Attributes) AcceptMessage {
+	return AcceptMessage{
+		basicMessage: basicMessage{src: source},
+		Ballot:       ballot,
+		Instance:     id,
+		Command:      command,
+		Attrs:        attrs,
+	}
+}
+
+func (m AcceptMessage) MessageName() string { return "AcceptMessage" }
+
+// AcceptReplyMessage - whether a replica accepted the attributes in the ballot
+type AcceptReplyMessage struct {
+	basicMessage
+	Ballot   types.BallotNumber
+	Instance InstanceID
+	OK       bool
+}
+
+func NewAcceptReplyMessage(source v1.Addr, ballot types.BallotNumber, id InstanceID, ok bool) AcceptReplyMessage {
+	return AcceptReplyMessage{
+		basicMessage: basicMessage{src: source},
+		Ballot:       ballot,
+		Instance:     id,
+		OK:           ok,
+	}
+}
+
+func (m AcceptReplyMessage) MessageName() string { return "AcceptReplyMessage" }
+
+// CommitMessage - the command and attributes of an instance are decided
+type CommitMessage struct {
+	basicMessage
+	Instance InstanceID
+	Command  types.Command
+	Attrs    Attributes
+}
+
+func NewCommitMessage(source v1.Addr, id InstanceID, command types.Command, attrs Attributes) CommitMessage {
+	return CommitMessage{
+		basicMessage: basicMessage{src: source},
+		Instance:     id,
+		Command:      command,
+		Attrs:        attrs,
+	}
+}
+
+func (m CommitMessage) MessageName() string { return "CommitMessage" }
+
+// PrepareMessage - sent by a replica recovering an instance whose leader may have failed
+type PrepareMessage struct {
+	basicMessage
+	Ballot   types.BallotNumber
+	Instance InstanceID
+}
+
+func NewPrepareMessage(source v1.Addr, ballot types.BallotNumber, id InstanceID) PrepareMessage {
+	return PrepareMessage{
+		basicMessage: basicMessage{src: source},
+		Ballot:       ballot,
+		Instance:     id,
+	}
+}
+
+func (m PrepareMessage) MessageName() string { return "PrepareMessage" }
+
+// PrepareReplyMessage - the state of the instance at a replica, once the replica promised
+// to ignore lower ballots
+type PrepareReplyMessage struct {
+	basicMessage
+	Ballot   types.BallotNumber
+	Instance InstanceID
+	OK       bool
+	Status   Status
+	Command  types.Command
+	Attrs    Attributes
+
+	// the replica reported additional dependencies when it pre-accepted the instance
+	Changed bool
+
+	// ballot in which the attributes were pre-accepted or accepted
+	AcceptedBallot types.BallotNumber
+}
+
+func (m PrepareReplyMessage) MessageName() string { return "PrepareReplyMessage" }
+
+// tickMessage - sent by a replica to itself, to recover stalled instances
+type tickMessage struct {
+	basicMessage
+}
@@ -0,0 +1,149 @@
+package epaxos
+
+import (
+	"github.com/1xyz/paxossim/queue"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"time"
+)
+
+// DefaultRecoveryTimeout - time after which a replica recovers an instance which is not committed
+const DefaultRecoveryTimeout = 100 * time.Millisecond
+
+// Option - configures optional behaviour of a replica
+type Option func(*options)
+
+type options struct {
+	metrics *metrics.Registry
+
+	events events.Sink
+
+	// the command leader sends each commit to the clients as well
+	notifyClients bool
+
+	// creates the state machine every replica applies its executed commands to, if set
+	newStateMachine func() statemachine.StateMachine
+
+	recoveryTimeout time.Duration
+
+	// timeouts & ticks are measured on this clock, the real clock if nil
+	clock clock.Clock
+
+	// creates the clock of every replica, instead of sharing clock, if set
+	newClock func(addr v1.Addr) clock.Clock
+
+	// capacity & overflow policy of the replicas' inboxes, unbounded if nil
+	inbox *queue.Options
+}
+
+func newOptions(opts []Option) options {
+	o := options{recoveryTimeout: DefaultRecoveryTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.clock = clock.OrReal(o.clock)
+	return o
+}
+
+// stateMachine - a new state machine for a replica, nil if none is configured
+func (o options) stateMachine() statemachine.StateMachine {
+	if o.newStateMachine == nil {
+		return nil
+	}
+	return o.newStateMachine()
+}
+
+// WithMetrics - record the replica's metrics to the specified registry
+func WithMetrics(r *metrics.Registry) Option {
+	return func(o *options) {
+		o.metrics = r
+	}
+}
+
+// WithEventSink - emit the replica's protocol events to the specified sink
+func WithEventSink(sink events.Sink) Option {
+	return func(o *options) {
+		o.events = sink
+	}
+}
+
+// WithClientNotifications - send every commit of a command led by the replica to the clients
+func WithClientNotifications() Option {
+	return func(o *options) {
+		o.notifyClients = true
+	}
+}
+
+// WithStateMachines - every replica applies the executed commands to a state machine of its
+// own, created by the specified function
+func WithStateMachines(newStateMachine func() statemachine.StateMachine) Option {
+	return func(o *options) {
+		o.newStateMachine = newStateMachine
+	}
+}
+
+// WithRecoveryTimeout - recover instances which are not committed within the timeout
+func WithRecoveryTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.recoveryTimeout = d
+	}
+}
+
+// WithClock - the replicas read the time, and tick, on the specified clock instead of the host's
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithClocks - every replica reads the time, and measures its timeouts & ticks, on a clock of its
+// own created by the specified function, e.g. to skew the clock of a single replica
+func WithClocks(newClock func(addr v1.Addr) clock.Clock) Option {
+	return func(o *options) {
+		o.newClock = newClock
+	}
+}
+
+// clockOf - the clock of the replica, the shared clock unless every replica has its own
+func (o options) clockOf(addr v1.Addr) clock.Clock {
+	if o.newClock == nil {
+		return o.clock
+	}
+	return clock.OrReal(o.newClock(addr))
+}
+
+// WithInbox - the inbox of every replica is a queue bounded by the specified options
+func WithInbox(inbox queue.Options) Option {
+	return func(o *options) {
+		o.inbox = &inbox
+	}
+}
+
+// newProcess - a process whose inbox is bounded by the configured options, if any
+func (o options) newProcess(id v1.ProcessID, pt v1.ProcessType) v1.Process {
+	if o.inbox == nil {
+		return v1.NewProcess(id, pt)
+	}
+	return v1.NewProcessWithInbox(id, pt, queue.NewBoundedQueue(*o.inbox))
+}
+
+// replicaMetrics - metrics recorded by a replica, labelled by the replica
+type replicaMetrics struct {
+	commits    *metrics.CounterVec
+	recoveries *metrics.CounterVec
+	executed   *metrics.CounterVec
+}
+
+func newReplicaMetrics(r *metrics.Registry) replicaMetrics {
+	return replicaMetrics{
+		commits: r.Counter("epaxos_commits_total",
+			"Instances committed by their leader, by replica and path (fast, slow or recovery)", "replica", "path"),
+		recoveries: r.Counter("epaxos_recoveries_total",
+			"Explicit prepares started to recover an instance, by replica", "replica"),
+		executed: r.Counter("epaxos_executed_total",
+			"Instances executed, by replica", "replica"),
+	}
+}
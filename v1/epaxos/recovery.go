@@ -0,0 +1,164 @@
+package epaxos
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+	"time"
+)
+
+// recover - start an explicit prepare for every instance which did not make progress in time.
+// Replicas wait longer the later they are in the cluster, so they rarely compete for an instance
+func (r *Replica) recover(now time.Time) {
+	timeout := r.recoveryTimeout * time.Duration(1+r.positions[r.ID()])
+	stalled := make([]InstanceID, 0)
+	for id, inst := range r.instances {
+		if inst.status < Committed && now.Sub(inst.updatedAt) >= timeout {
+			stalled = append(stalled, id)
+		}
+	}
+	sort.Slice(stalled, func(i, j int) bool { return lessInstance(stalled[i], stalled[j]) })
+
+	for _, id := range stalled {
+		inst := r.instances[id]
+		lead := inst.lead
+		if lead != nil && !lead.accepting && !lead.preparing && inst.status == PreAccepted &&
+			len(lead.replied) >= r.majority() {
+			// the fast quorum did not reply in time, take the slow path
+			r.accept(inst, inst.command, lead.merged, now)
+			continue
+		}
+		r.prepare(inst, now)
+	}
+}
+
+// prepare - take over the instance in a ballot higher than any this replica has seen
+func (r *Replica) prepare(inst *instance, now time.Time) {
+	r.metrics.recoveries.Inc(r.label)
+	own := r.prepareReply(inst, true)
+	inst.ballot = types.BallotNumber{Round: inst.ballot.Round + 1, LeaderID: r.GetAddr()}
+	inst.updatedAt = now
+	lead := newLeadState(r.ID())
+	lead.preparing = true
+	lead.prepares = []PrepareReplyMessage{own}
+	inst.lead = lead
+	r.broadcast(NewPrepareMessage(r.GetAddr(), inst.ballot, inst.id))
+	r.checkPrepared(inst, now)
+}
+
+func (r *Replica) prepareReply(inst *instance, ok bool) PrepareReplyMessage {
+	return PrepareReplyMessage{
+		basicMessage:   basicMessage{src: r.GetAddr()},
+		Ballot:         inst.ballot,
+		Instance:       inst.id,
+		OK:             ok,
+		Status:         inst.status,
+		Command:        inst.command,
+		Attrs:          inst.attrs,
+		Changed:        inst.changed,
+		AcceptedBallot: inst.acceptedBallot,
+	}
+}
+
+func (r *Replica) handlePrepare(m PrepareMessage, now time.Time) {
+	inst := r.get(m.Instance, now)
+	if inst.status >= Committed {
+		r.send(m.Src(), NewCommitMessage(r.GetAddr(), inst.id, inst.command, inst.attrs))
+		return
+	}
+	if types.Compare(&m.Ballot, &inst.ballot) < 0 {
+		r.send(m.Src(), r.prepareReply(inst, false))
+		return
+	}
+	inst.ballot = m.Ballot
+	inst.updatedAt = now
+	inst.lead = nil
+	r.send(m.Src(), r.prepareReply(inst, true))
+}
+
+func (r *Replica) handlePrepareReply(m PrepareReplyMessage, now time.Time) {
+	inst := r.get(m.Instance, now)
+	if !m.OK {
+		r.reject(inst, m.Ballot, now)
+		return
+	}
+	lead := inst.lead
+	if lead == nil || !lead.preparing || types.Compare(&m.Ballot, &inst.ballot) != 0 || lead.replied[m.Src().ID()] {
+		return
+	}
+	lead.replied[m.Src().ID()] = true
+	lead.prepares = append(lead.prepares, m)
+	r.checkPrepared(inst, now)
+}
+
+// checkPrepared - once a majority replied, pick the only value which may have been chosen:
+//  1. the committed command & attributes, if a replica committed the instance
+//  2. the attributes accepted in the highest ballot, if a replica accepted the instance
+//  3. the attributes pre-accepted unchanged by F replicas other than the leader, which
+//     may have committed on the fast path
+//  4. otherwise phase 1 is restarted for a pre-accepted command, without the fast path
+//  5. a no-op if no replica knows of the command
+func (r *Replica) checkPrepared(inst *instance, now time.Time) {
+	if len(inst.lead.replied) < r.majority() {
+		return
+	}
+	prepares := inst.lead.prepares
+	inst.lead.preparing = false
+
+	var accepted *PrepareReplyMessage
+	var preAccepted *PrepareReplyMessage
+	// replies which pre-accepted the leader's attributes unchanged, by attributes
+	identical := make(map[string][]*PrepareReplyMessage)
+	leaderReplied := false
+	for i := range prepares {
+		p := &prepares[i]
+		if p.Src().ID() == inst.id.Replica {
+			leaderReplied = true
+		}
+		switch p.Status {
+		case Committed, Executed:
+			r.lead(inst, p.Command, p.Attrs, "recovery", now)
+			return
+		case Accepted:
+			if accepted == nil || types.Compare(&p.AcceptedBallot, &accepted.AcceptedBallot) > 0 {
+				accepted = p
+			}
+		case PreAccepted:
+			preAccepted = p
+			if p.AcceptedBallot.Round == 0 && !p.Changed {
+				identical[attrsKey(p.Attrs)] = append(identical[attrsKey(p.Attrs)], p)
+			}
+		}
+	}
+
+	f := len(r.peers) - r.majority()
+	var fast *PrepareReplyMessage
+	for _, group := range identical {
+		if !leaderReplied && f > 0 && len(group) >= f {
+			fast = group[0]
+		}
+	}
+	switch {
+	case accepted != nil:
+		r.accept(inst, accepted.Command, accepted.Attrs, now)
+	case fast != nil:
+		r.accept(inst, fast.Command, fast.Attrs, now)
+	case preAccepted != nil:
+		attrs := r.localAttrs(inst.id, preAccepted.Command)
+		for _, p := range prepares {
+			if p.Status == PreAccepted {
+				attrs = union(attrs, p.Attrs)
+			}
+		}
+		r.preAccept(inst, preAccepted.Command, attrs, now)
+	default:
+		noop := ops.NewCommand(fmt.Sprintf("%v", v1.NewAddress(inst.id.Replica, v1.Replica)), fmt.Sprintf("noop-%v", inst.id), ops.NoOp{})
+		r.accept(inst, noop, Attributes{Seq: 1, Deps: make([]InstanceID, 0)}, now)
+	}
+}
+
+func attrsKey(a Attributes) string {
+	return fmt.Sprintf("%d %v", a.Seq, a.Deps)
+}
@@ -0,0 +1,557 @@
+package epaxos
+
+// Egalitarian Paxos (Moraru, Andersen & Kaminsky, 2013).
+//
+// There is no distinguished leader: every replica leads the commands its clients send
+// to it, each in an instance of its own. The leader pre-accepts the command with the
+// interfering instances it knows of as dependencies (phase 1). If a fast quorum of
+// replicas reports no further dependencies the instance commits right away (the fast
+// path); otherwise the union of the reported dependencies is accepted by a majority
+// (the slow path) before committing. Committed instances are executed once their
+// dependencies are committed, strongly connected components of the dependency graph
+// in reverse topological order and the instances of a component by sequence number, so
+// every replica executes interfering commands in the same order.
+//
+// An instance which is not committed in time, e.g. because its leader crashed, is
+// recovered by another replica with an explicit prepare in a higher ballot. This is
+// the recovery of basic EPaxos, with fast quorums of 2F replicas.
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NoOp - the op of the command committed for an instance whose command was lost, an ops.NoOp
+const NoOp = ops.NameNoOp
+
+// Status - the progress of an instance at a replica
+type Status int
+
+const (
+	None Status = iota
+	PreAccepted
+	Accepted
+	Committed
+	Executed
+)
+
+var statusStrings = map[Status]string{
+	None:        "none",
+	PreAccepted: "pre-accepted",
+	Accepted:    "accepted",
+	Committed:   "committed",
+	Executed:    "executed",
+}
+
+func (s Status) String() string {
+	return statusStrings[s]
+}
+
+type instance struct {
+	id InstanceID
+
+	// nil until the replica learns the command
+	command types.Command
+
+	attrs Attributes
+
+	status Status
+
+	// highest ballot this replica took part in for the instance
+	ballot types.BallotNumber
+
+	// ballot in which attrs were pre-accepted or accepted
+	acceptedBallot types.BallotNumber
+
+	// the replica reported additional dependencies when it pre-accepted the instance
+	changed bool
+
+	// time the instance last made progress at this replica
+	updatedAt time.Time
+
+	// set while this replica leads the instance, or recovers it
+	lead *leadState
+}
+
+// leadState - the replies collected by the replica leading an instance in its current phase
+type leadState struct {
+	replied map[v1.ProcessID]bool
+
+	// union of the attributes reported in phase 1
+	merged Attributes
+
+	// a replica reported additional dependencies in phase 1
+	changed bool
+
+	// phase 2 was started
+	accepting bool
+
+	// an explicit prepare is collecting the state of the instance
+	preparing bool
+
+	prepares []PrepareReplyMessage
+
+	// phase 1 was restarted by a recovery, the fast path is not safe
+	slowOnly bool
+
+	// phase 2 runs in a recovery ballot
+	recovery bool
+}
+
+func newLeadState(self v1.ProcessID) *leadState {
+	return &leadState{replied: map[v1.ProcessID]bool{self: true}}
+}
+
+// Replica - an EPaxos replica; it is addressed as a v1.Replica
+type Replica struct {
+	v1.Process
+
+	exchange v1.MessageExchange
+
+	// every replica of the cluster, including this one
+	peers []v1.Addr
+
+	// position of every replica in peers
+	positions map[v1.ProcessID]int
+
+	instances map[InstanceID]*instance
+
+	// index of the next instance led by this replica
+	nextIndex int
+
+	// the latest instance of every leader touching a key
+	conflicts map[string]map[v1.ProcessID]InstanceID
+
+	// commands led by this replica, so a duplicated request is led once
+	led map[string]bool
+
+	// commands executed, so a command proposed twice is applied once
+	performed map[string]bool
+
+	// instances in the order they were executed
+	executed []InstanceID
+
+	stateMachine statemachine.StateMachine
+
+	recoveryTimeout time.Duration
+
+	notifyClients bool
+
+	metrics replicaMetrics
+
+	// label identifying this replica in its metrics
+	label string
+
+	events events.Sink
+
+	// the time of the recovery timeouts
+	clock clock.Clock
+
+	// guards the replica's state against concurrent readers
+	mu *sync.Mutex
+}
+
+// NewReplicas - a cluster of n replicas, each registered with the exchange
+func NewReplicas(exchange v1.MessageExchange, n int, opts ...Option) []*Replica {
+	o := newOptions(opts)
+	replicas := make([]*Replica, n)
+	peers := make([]v1.Addr, n)
+	positions := make(map[v1.ProcessID]int)
+	for i := 0; i < n; i++ {
+		p := o.newProcess(v1.AllocateID(exchange, v1.Replica), v1.Replica)
+		replicas[i] = &Replica{
+			Process:         p,
+			exchange:        exchange,
+			peers:           peers,
+			positions:       positions,
+			instances:       make(map[InstanceID]*instance),
+			conflicts:       make(map[string]map[v1.ProcessID]InstanceID),
+			led:             make(map[string]bool),
+			performed:       make(map[string]bool),
+			executed:        make([]InstanceID, 0),
+			stateMachine:    o.stateMachine(),
+			recoveryTimeout: o.recoveryTimeout,
+			notifyClients:   o.notifyClients,
+			metrics:         newReplicaMetrics(o.metrics),
+			label:           metrics.Label(p.GetAddr()),
+			events:          o.events,
+			clock:           o.clockOf(p.GetAddr()),
+			mu:              &sync.Mutex{},
+		}
+		peers[i] = p.GetAddr()
+		positions[p.ID()] = i
+		if err := exchange.Register(replicas[i]); err != nil {
+			log.Panicf("exchange.Register error %v", err)
+		}
+	}
+	return replicas
+}
+
+// Run - handle messages until the replica is closed, recovering stalled instances periodically
+func (r *Replica) Run() {
+	ctxLog := log.WithFields(log.Fields{"Addr": r.GetAddr()})
+	done := make(chan struct{})
+	defer close(done)
+	go r.tick(done)
+
+	for {
+		msg, err := r.Process.Recv()
+		if err == v1.ErrProcessClosed {
+			ctxLog.Debugf("process closed")
+			return
+		}
+		if err != nil {
+			ctxLog.Panicf("error in inbox recv %v", err)
+		}
+
+		r.Handle(msg)
+	}
+}
+
+func (r *Replica) tick(done chan struct{}) {
+	ticker := r.clock.NewTicker(r.recoveryTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			// bypasses the exchange; a crashed replica's recovery messages are dropped by the network
+			r.Process.Send(tickMessage{basicMessage{src: r.GetAddr()}})
+		}
+	}
+}
+
+// Handle - synchronously process a single message, as Run does for every message in the inbox
+func (r *Replica) Handle(message v1.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handleMessage(message, r.clock.Now())
+}
+
+func (r *Replica) handleMessage(message v1.Message, now time.Time) {
+	switch m := message.(type) {
+	case messages.RequestMessage:
+		r.handleRequest(m, now)
+	case PreAcceptMessage:
+		r.handlePreAccept(m, now)
+	case PreAcceptReplyMessage:
+		r.handlePreAcceptReply(m, now)
+	case AcceptMessage:
+		r.handleAccept(m, now)
+	case AcceptReplyMessage:
+		r.handleAcceptReply(m, now)
+	case CommitMessage:
+		r.commit(r.get(m.Instance, now), m.Command, m.Attrs, now)
+	case PrepareMessage:
+		r.handlePrepare(m, now)
+	case PrepareReplyMessage:
+		r.handlePrepareReply(m, now)
+	case tickMessage:
+		r.recover(now)
+	default:
+		log.Panicf("Unknown message type %T", m)
+	}
+}
+
+func (r *Replica) majority() int {
+	return len(r.peers)/2 + 1
+}
+
+// fastQuorum - 2F replicas, where F is the number of failures tolerated
+func (r *Replica) fastQuorum() int {
+	f := len(r.peers) - r.majority()
+	if 2*f > r.majority() {
+		return 2 * f
+	}
+	return r.majority()
+}
+
+// defaultBallot - the ballot in which the leader of an instance runs it
+func defaultBallot(id InstanceID) types.BallotNumber {
+	return types.BallotNumber{Round: 0, LeaderID: v1.NewAddress(id.Replica, v1.Replica)}
+}
+
+// get - the instance, created if the replica has not seen it yet
+func (r *Replica) get(id InstanceID, now time.Time) *instance {
+	inst, ok := r.instances[id]
+	if !ok {
+		ballot := defaultBallot(id)
+		inst = &instance{id: id, ballot: ballot, acceptedBallot: ballot, updatedAt: now}
+		r.instances[id] = inst
+	}
+	return inst
+}
+
+func isNoOp(command types.Command) bool {
+	operation, _ := ops.OperationOf(command)
+	_, ok := operation.(ops.NoOp)
+	return ok
+}
+
+func commandKey(command types.Command) string {
+	return command.GetClientID() + "/" + command.GetCommandID()
+}
+
+// localAttrs - the attributes ordering the instance after every interfering instance this replica knows of
+func (r *Replica) localAttrs(id InstanceID, command types.Command) Attributes {
+	attrs := Attributes{Seq: 1, Deps: make([]InstanceID, 0)}
+	if isNoOp(command) {
+		return attrs
+	}
+	latest := make(map[InstanceID]bool)
+	for _, key := range statemachine.Keys(command) {
+		for k, byLeader := range r.conflicts {
+			if k != key && k != statemachine.GlobalKey && key != statemachine.GlobalKey {
+				continue
+			}
+			for _, dep := range byLeader {
+				if dep != id {
+					latest[dep] = true
+				}
+			}
+		}
+	}
+	for dep := range latest {
+		attrs.Deps = append(attrs.Deps, dep)
+		if inst, ok := r.instances[dep]; ok && inst.attrs.Seq >= attrs.Seq {
+			attrs.Seq = inst.attrs.Seq + 1
+		}
+	}
+	sort.Slice(attrs.Deps, func(i, j int) bool { return lessInstance(attrs.Deps[i], attrs.Deps[j]) })
+	return attrs
+}
+
+// recordConflicts - remember the instance as the latest of its leader touching its keys
+func (r *Replica) recordConflicts(id InstanceID, command types.Command) {
+	if command == nil || isNoOp(command) {
+		return
+	}
+	for _, key := range statemachine.Keys(command) {
+		byLeader, ok := r.conflicts[key]
+		if !ok {
+			byLeader = make(map[v1.ProcessID]InstanceID)
+			r.conflicts[key] = byLeader
+		}
+		if latest, ok := byLeader[id.Replica]; !ok || latest.Index < id.Index {
+			byLeader[id.Replica] = id
+		}
+	}
+}
+
+// broadcast - send the message to every other replica
+func (r *Replica) broadcast(m v1.Message) {
+	for _, peer := range r.peers {
+		if peer.ID() == r.ID() {
+			continue
+		}
+		r.send(peer, m)
+	}
+}
+
+func (r *Replica) send(dest v1.Addr, m v1.Message) {
+	if err := r.exchange.Send(dest, m); err != nil {
+		log.WithFields(log.Fields{"Addr": r.GetAddr()}).Debugf("exchange.Send failed %v", err)
+	}
+}
+
+// handleRequest - lead the client's command in a new instance
+func (r *Replica) handleRequest(m messages.RequestMessage, now time.Time) {
+	key := commandKey(m.Command)
+	if r.led[key] {
+		return
+	}
+	r.led[key] = true
+
+	id := InstanceID{Replica: r.ID(), Index: r.nextIndex}
+	r.nextIndex++
+	inst := r.get(id, now)
+	r.preAccept(inst, m.Command, r.localAttrs(id, m.Command), now)
+}
+
+// preAccept - run phase 1 for the command in the instance's current ballot
+func (r *Replica) preAccept(inst *instance, command types.Command, attrs Attributes, now time.Time) {
+	inst.command = command
+	inst.attrs = attrs
+	inst.status = PreAccepted
+	inst.acceptedBallot = inst.ballot
+	inst.updatedAt = now
+	r.recordConflicts(inst.id, command)
+
+	lead := newLeadState(r.ID())
+	lead.merged = attrs
+	lead.slowOnly = inst.ballot.Round > 0
+	inst.lead = lead
+	r.broadcast(NewPreAcceptMessage(r.GetAddr(), inst.ballot, inst.id, command, attrs))
+	r.checkPreAccepted(inst, now)
+}
+
+func (r *Replica) handlePreAccept(m PreAcceptMessage, now time.Time) {
+	inst := r.get(m.Instance, now)
+	if inst.status >= Committed {
+		r.send(m.Src(), NewCommitMessage(r.GetAddr(), inst.id, inst.command, inst.attrs))
+		return
+	}
+	if types.Compare(&m.Ballot, &inst.ballot) < 0 {
+		r.send(m.Src(), NewPreAcceptReplyMessage(r.GetAddr(), inst.ballot, inst.id, false, inst.attrs, false))
+		return
+	}
+
+	attrs := union(m.Attrs, r.localAttrs(m.Instance, m.Command))
+	inst.ballot = m.Ballot
+	inst.acceptedBallot = m.Ballot
+	inst.command = m.Command
+	inst.attrs = attrs
+	inst.status = PreAccepted
+	inst.changed = !attrs.equal(m.Attrs)
+	inst.updatedAt = now
+	inst.lead = nil
+	r.recordConflicts(inst.id, m.Command)
+	r.send(m.Src(), NewPreAcceptReplyMessage(r.GetAddr(), m.Ballot, inst.id, true, attrs, inst.changed))
+}
+
+// reject - a replica took part in a higher ballot; give up leading the instance
+func (r *Replica) reject(inst *instance, ballot types.BallotNumber, now time.Time) {
+	if types.Compare(&ballot, &inst.ballot) > 0 {
+		inst.ballot = ballot
+		inst.lead = nil
+		inst.updatedAt = now
+	}
+}
+
+func (r *Replica) handlePreAcceptReply(m PreAcceptReplyMessage, now time.Time) {
+	inst := r.get(m.Instance, now)
+	if !m.OK {
+		r.reject(inst, m.Ballot, now)
+		return
+	}
+	lead := inst.lead
+	if lead == nil || lead.accepting || lead.preparing || inst.status != PreAccepted ||
+		types.Compare(&m.Ballot, &inst.ballot) != 0 {
+		return
+	}
+	lead.replied[m.Src().ID()] = true
+	lead.merged = union(lead.merged, m.Attrs)
+	lead.changed = lead.changed || m.Changed
+	r.checkPreAccepted(inst, now)
+}
+
+// checkPreAccepted - commit on the fast path, or fall back to the slow path once a majority replied
+func (r *Replica) checkPreAccepted(inst *instance, now time.Time) {
+	lead := inst.lead
+	replies := len(lead.replied)
+	switch {
+	case replies >= r.fastQuorum() && !lead.changed && !lead.slowOnly:
+		r.lead(inst, inst.command, inst.attrs, "fast", now)
+	case replies >= r.majority() && (lead.changed || lead.slowOnly):
+		r.accept(inst, inst.command, lead.merged, now)
+	}
+}
+
+// accept - run phase 2 for the command & attributes in the instance's current ballot
+func (r *Replica) accept(inst *instance, command types.Command, attrs Attributes, now time.Time) {
+	inst.command = command
+	inst.attrs = attrs
+	inst.status = Accepted
+	inst.acceptedBallot = inst.ballot
+	inst.updatedAt = now
+	r.recordConflicts(inst.id, command)
+
+	lead := newLeadState(r.ID())
+	lead.accepting = true
+	lead.recovery = inst.ballot.Round > 0
+	inst.lead = lead
+	r.broadcast(NewAcceptMessage(r.GetAddr(), inst.ballot, inst.id, command, attrs))
+	r.checkAccepted(inst, now)
+}
+
+func (r *Replica) handleAccept(m AcceptMessage, now time.Time) {
+	inst := r.get(m.Instance, now)
+	if inst.status >= Committed {
+		r.send(m.Src(), NewCommitMessage(r.GetAddr(), inst.id, inst.command, inst.attrs))
+		return
+	}
+	if types.Compare(&m.Ballot, &inst.ballot) < 0 {
+		r.send(m.Src(), NewAcceptReplyMessage(r.GetAddr(), inst.ballot, inst.id, false))
+		return
+	}
+
+	inst.ballot = m.Ballot
+	inst.acceptedBallot = m.Ballot
+	inst.command = m.Command
+	inst.attrs = m.Attrs
+	inst.status = Accepted
+	inst.updatedAt = now
+	inst.lead = nil
+	r.recordConflicts(inst.id, m.Command)
+	r.send(m.Src(), NewAcceptReplyMessage(r.GetAddr(), m.Ballot, inst.id, true))
+}
+
+func (r *Replica) handleAcceptReply(m AcceptReplyMessage, now time.Time) {
+	inst := r.get(m.Instance, now)
+	if !m.OK {
+		r.reject(inst, m.Ballot, now)
+		return
+	}
+	lead := inst.lead
+	if lead == nil || !lead.accepting || inst.status != Accepted || types.Compare(&m.Ballot, &inst.ballot) != 0 {
+		return
+	}
+	lead.replied[m.Src().ID()] = true
+	r.checkAccepted(inst, now)
+}
+
+func (r *Replica) checkAccepted(inst *instance, now time.Time) {
+	if len(inst.lead.replied) < r.majority() {
+		return
+	}
+	path := "slow"
+	if inst.lead.recovery {
+		path = "recovery"
+	}
+	r.lead(inst, inst.command, inst.attrs, path, now)
+}
+
+// lead - commit the instance led by this replica, and let every replica & client know
+func (r *Replica) lead(inst *instance, command types.Command, attrs Attributes, path string, now time.Time) {
+	r.metrics.commits.Inc(r.label, path)
+	r.broadcast(NewCommitMessage(r.GetAddr(), inst.id, command, attrs))
+	if r.notifyClients && !isNoOp(command) {
+		dm := messages.NewDecisionMessage(r.GetAddr(), r.slotOf(inst.id), command)
+		if err := r.exchange.SendAll(v1.Client, dm); err != nil {
+			log.Debugf("exchange.sendAll to clients failed %v", err)
+		}
+	}
+	r.commit(inst, command, attrs, now)
+}
+
+// commit - the instance is decided, execute every instance which can be
+func (r *Replica) commit(inst *instance, command types.Command, attrs Attributes, now time.Time) {
+	if inst.status >= Committed {
+		return
+	}
+	inst.command = command
+	inst.attrs = attrs
+	inst.status = Committed
+	inst.updatedAt = now
+	inst.lead = nil
+	r.recordConflicts(inst.id, command)
+	events.Emit(r.events, events.SlotDecided{Replica: r.GetAddr(), Slot: r.slotOf(inst.id), Command: command})
+	r.execute(now)
+}
+
+// slotOf - the position of the instance in the decision log of the replica. The instances of
+// all replicas are interleaved, so every instance maps to a unique slot
+func (r *Replica) slotOf(id InstanceID) types.Slot {
+	return types.Slot(id.Index*len(r.peers) + r.positions[id.Replica] + 1)
+}
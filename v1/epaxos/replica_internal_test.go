@@ -0,0 +1,204 @@
+package epaxos
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+type envelope struct {
+	dest v1.Addr
+	m    v1.Message
+}
+
+// testNetwork - delivers messages synchronously, in the order they were sent
+type testNetwork struct {
+	queue []envelope
+
+	replicas map[v1.ProcessID]*Replica
+
+	// messages from & to these replicas are dropped
+	crashed map[v1.ProcessID]bool
+
+	now time.Time
+
+	ids *v1.IDAllocator
+}
+
+func newTestNetwork() *testNetwork {
+	return &testNetwork{
+		replicas: make(map[v1.ProcessID]*Replica),
+		crashed:  make(map[v1.ProcessID]bool),
+		now:      time.Now(),
+		ids:      v1.NewIDAllocator(),
+	}
+}
+
+func (n *testNetwork) Send(dest v1.Addr, m v1.Message) error {
+	if !n.isCrashed(dest) && !n.isCrashed(m.Src()) {
+		n.queue = append(n.queue, envelope{dest: dest, m: m})
+	}
+	return nil
+}
+
+// isCrashed - true if the process is one of the crashed replicas; clients never crash
+func (n *testNetwork) isCrashed(addr v1.Addr) bool {
+	return addr.Type() == v1.Replica && n.crashed[addr.ID()]
+}
+
+func (n *testNetwork) SendAll(pt v1.ProcessType, m v1.Message) error {
+	return nil
+}
+
+func (n *testNetwork) IDs() *v1.IDAllocator {
+	return n.ids
+}
+
+func (n *testNetwork) Register(p v1.ProcessInbox) error {
+	return nil
+}
+
+func (n *testNetwork) UnRegister(p v1.ProcessInbox) error {
+	return nil
+}
+
+func (n *testNetwork) deliverAll() {
+	for len(n.queue) > 0 {
+		n.deliver()
+	}
+}
+
+// deliver - deliver the first message in the queue
+func (n *testNetwork) deliver() {
+	e := n.queue[0]
+	n.queue = n.queue[1:]
+	n.replicas[e.dest.ID()].handleMessage(e.m, n.now)
+}
+
+func (n *testNetwork) request(r *Replica, op string) {
+	operation, err := ops.Decode(op)
+	if err != nil {
+		panic(err)
+	}
+	command := ops.NewCommand("client:0", op, operation)
+	r.handleMessage(messages.NewRequestMessage(v1.NewAddress(0, v1.Client), command), n.now)
+}
+
+// tick - let the recovery timeout of every replica expire
+func (n *testNetwork) tick(r *Replica) {
+	n.now = n.now.Add(DefaultRecoveryTimeout * time.Duration(len(n.replicas)))
+	r.handleMessage(tickMessage{basicMessage{src: r.GetAddr()}}, n.now)
+}
+
+func newTestCluster(n int, opts ...Option) (*testNetwork, []*Replica) {
+	network := newTestNetwork()
+	replicas := NewReplicas(network, n, opts...)
+	for _, r := range replicas {
+		network.replicas[r.ID()] = r
+	}
+	return network, replicas
+}
+
+func opsOf(commands []types.Command) []string {
+	result := make([]string, len(commands))
+	for i, c := range commands {
+		result[i] = c.GetOp()
+	}
+	return result
+}
+
+func TestReplica_FastPath(t *testing.T) {
+	Convey("Given a cluster of three replicas", t, func() {
+		r := metrics.NewRegistry()
+		network, replicas := newTestCluster(3, WithMetrics(r))
+
+		Convey("commands which do not interfere commit on the fast path", func() {
+			network.request(replicas[0], "PUT a 1")
+			network.request(replicas[1], "PUT b 2")
+			network.deliverAll()
+
+			v, _ := r.Value("epaxos_commits_total", metrics.Label(replicas[0].GetAddr()), "fast")
+			So(v, ShouldEqual, 1)
+			v, _ = r.Value("epaxos_commits_total", metrics.Label(replicas[1].GetAddr()), "fast")
+			So(v, ShouldEqual, 1)
+
+			Convey("and are executed by every replica", func() {
+				for _, replica := range replicas {
+					So(len(replica.Executed()), ShouldEqual, 2)
+					So(len(replica.Decisions()), ShouldEqual, 2)
+				}
+			})
+		})
+	})
+}
+
+func TestReplica_SlowPath(t *testing.T) {
+	Convey("Given a cluster of three replicas applying commands to a KV store", t, func() {
+		stores := make([]*statemachine.KV, 0)
+		network, replicas := newTestCluster(3, WithStateMachines(func() statemachine.StateMachine {
+			kv := statemachine.NewKV()
+			stores = append(stores, kv)
+			return kv
+		}))
+
+		Convey("interfering commands led concurrently take the slow path", func() {
+			network.request(replicas[0], "PUT k 1")
+			network.request(replicas[2], "PUT k 2")
+			network.deliverAll()
+
+			Convey("and are executed in the same order by every replica", func() {
+				order := opsOf(replicas[0].Executed())
+				So(len(order), ShouldEqual, 2)
+				for i, replica := range replicas {
+					So(opsOf(replica.Executed()), ShouldResemble, order)
+					So(stores[i].String(), ShouldEqual, stores[0].String())
+				}
+			})
+		})
+	})
+}
+
+func TestReplica_Recovery(t *testing.T) {
+	Convey("Given a cluster of three replicas", t, func() {
+		r := metrics.NewRegistry()
+		network, replicas := newTestCluster(3, WithMetrics(r))
+
+		Convey("a command whose leader crashed after pre-accepting it", func() {
+			network.request(replicas[0], "PUT k 1")
+			// the pre-accept reaches replica 1 only, the leader crashes before the reply
+			network.deliver()
+			network.queue = nil
+			network.crashed[replicas[0].ID()] = true
+
+			Convey("is recovered & committed by another replica", func() {
+				network.tick(replicas[1])
+				network.deliverAll()
+
+				v, _ := r.Value("epaxos_recoveries_total", metrics.Label(replicas[1].GetAddr()))
+				So(v, ShouldEqual, 1)
+				So(opsOf(replicas[1].Executed()), ShouldResemble, []string{"PUT k 1"})
+				So(opsOf(replicas[2].Executed()), ShouldResemble, []string{"PUT k 1"})
+			})
+		})
+
+		Convey("a command which never left its crashed leader does not block other commands", func() {
+			network.request(replicas[0], "PUT k 1")
+			network.queue = nil
+			network.crashed[replicas[0].ID()] = true
+			network.request(replicas[1], "PUT k 2")
+			network.deliverAll()
+			network.tick(replicas[1])
+			network.deliverAll()
+
+			for _, replica := range replicas[1:] {
+				So(opsOf(replica.Executed()), ShouldResemble, []string{"PUT k 2"})
+			}
+		})
+	})
+}
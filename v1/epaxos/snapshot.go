@@ -0,0 +1,34 @@
+package epaxos
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/components"
+	"github.com/1xyz/paxossim/v1/types"
+)
+
+// Snapshot - the state of the replica in the shape of a classic replica's: the instances it
+// leads which are not committed yet are its proposals, every committed instance a decision.
+// Instances execute out of slot order, so SlotOut is one past the number of executed instances
+func (r *Replica) Snapshot() components.ReplicaSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	proposals := make(types.SlotCommandMap)
+	decisions := make(types.SlotCommandMap)
+	for id, inst := range r.instances {
+		switch {
+		case inst.status >= Committed:
+			decisions[r.slotOf(id)] = inst.command
+		case id.Replica == r.ID() && inst.command != nil:
+			proposals[r.slotOf(id)] = inst.command
+		}
+	}
+	return components.ReplicaSnapshot{
+		Addr:      r.GetAddr(),
+		SlotIn:    r.slotOf(InstanceID{Replica: r.ID(), Index: r.nextIndex}),
+		SlotOut:   types.Slot(len(r.executed) + 1),
+		Proposals: proposals,
+		Decisions: decisions,
+		Leaders:   append([]v1.Addr{}, r.peers...),
+		InboxLen:  r.InboxLen(),
+	}
+}
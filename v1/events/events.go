@@ -0,0 +1,147 @@
+package events
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of protocol events
+const (
+	KindBallotAdopted    = "ballot_adopted"
+	KindBallotPreempted  = "ballot_preempted"
+	KindPValueAccepted   = "pvalue_accepted"
+	KindSlotDecided      = "slot_decided"
+	KindCommandPerformed = "command_performed"
+	KindConfigChanged    = "config_changed"
+)
+
+// Event - a state transition of the protocol at a single process
+type Event interface {
+	// One of the Kind constants
+	Kind() string
+
+	// The process at which the transition happened
+	Process() v1.Addr
+
+	// The event's attributes, with ballots, commands & addresses formatted as strings
+	Fields() log.Fields
+}
+
+// BallotAdopted - a majority of acceptors adopted the leader's ballot, the leader is active
+type BallotAdopted struct {
+	Leader v1.Addr
+
+	Ballot types.BallotNumber
+
+	// Number of pvalues reported as accepted by the acceptors
+	PValues int
+}
+
+func (e BallotAdopted) Kind() string     { return KindBallotAdopted }
+func (e BallotAdopted) Process() v1.Addr { return e.Leader }
+func (e BallotAdopted) Fields() log.Fields {
+	return log.Fields{"ballot": e.Ballot.String(), "pvalues": e.PValues}
+}
+
+// BallotPreempted - the leader learned of a higher ballot and gave up its own
+type BallotPreempted struct {
+	Leader v1.Addr
+
+	// The leader's ballot which was preempted
+	Ballot types.BallotNumber
+
+	// The higher ballot
+	By types.BallotNumber
+}
+
+func (e BallotPreempted) Kind() string     { return KindBallotPreempted }
+func (e BallotPreempted) Process() v1.Addr { return e.Leader }
+func (e BallotPreempted) Fields() log.Fields {
+	return log.Fields{"ballot": e.Ballot.String(), "by": e.By.String()}
+}
+
+// PValueAccepted - the acceptor accepted a pvalue
+type PValueAccepted struct {
+	Acceptor v1.Addr
+
+	PValue types.PValue
+}
+
+func (e PValueAccepted) Kind() string     { return KindPValueAccepted }
+func (e PValueAccepted) Process() v1.Addr { return e.Acceptor }
+func (e PValueAccepted) Fields() log.Fields {
+	return log.Fields{
+		"ballot":  e.PValue.BN.String(),
+		"slot":    e.PValue.Slot,
+		"command": formatCommand(e.PValue.Command),
+	}
+}
+
+// SlotDecided - the replica learned the decision of a slot for the first time
+type SlotDecided struct {
+	Replica v1.Addr
+
+	Slot types.Slot
+
+	Command types.Command
+}
+
+func (e SlotDecided) Kind() string     { return KindSlotDecided }
+func (e SlotDecided) Process() v1.Addr { return e.Replica }
+func (e SlotDecided) Fields() log.Fields {
+	return log.Fields{"slot": e.Slot, "command": formatCommand(e.Command)}
+}
+
+// CommandPerformed - the replica applied a decided command to its state
+type CommandPerformed struct {
+	Replica v1.Addr
+
+	Slot types.Slot
+
+	Command types.Command
+
+	// result of applying the command to the replica's state machine, if any
+	Result string
+}
+
+func (e CommandPerformed) Kind() string     { return KindCommandPerformed }
+func (e CommandPerformed) Process() v1.Addr { return e.Replica }
+func (e CommandPerformed) Fields() log.Fields {
+	fields := log.Fields{"slot": e.Slot, "command": formatCommand(e.Command)}
+	if e.Result != "" {
+		fields["result"] = e.Result
+	}
+	return fields
+}
+
+// ConfigChanged - the replica switched to the configuration decided at Slot
+type ConfigChanged struct {
+	Replica v1.Addr
+
+	Slot types.Slot
+
+	// nil if the leaders are unchanged
+	Leaders []v1.Addr
+
+	// the main acceptors (Cheap Paxos), nil if unchanged
+	Acceptors []v1.Addr
+}
+
+func (e ConfigChanged) Kind() string     { return KindConfigChanged }
+func (e ConfigChanged) Process() v1.Addr { return e.Replica }
+func (e ConfigChanged) Fields() log.Fields {
+	fields := log.Fields{"slot": e.Slot, "leaders": fmt.Sprintf("%v", e.Leaders)}
+	if e.Acceptors != nil {
+		fields["acceptors"] = fmt.Sprintf("%v", e.Acceptors)
+	}
+	return fields
+}
+
+func formatCommand(c types.Command) string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s %s", c.GetClientID(), c.GetCommandID(), c.GetOp())
+}
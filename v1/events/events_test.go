@@ -0,0 +1,46 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSinks(t *testing.T) {
+	Convey("Given a memory and a JSON lines sink", t, func() {
+		replica := v1.NewAddress(0, v1.Replica)
+		leader := v1.NewAddress(1, v1.Leader)
+		command := types.BasicCommand{ClientID: "c", CommandID: "1", Op: "OP"}
+		mem := NewMemory()
+		buf := &bytes.Buffer{}
+		sink := Tee(mem, NewWriter(buf))
+
+		Emit(sink, SlotDecided{Replica: replica, Slot: 3, Command: command})
+		Emit(sink, BallotAdopted{Leader: leader, Ballot: types.BallotNumber{Round: 2, LeaderID: leader}})
+
+		Convey("the memory sink captures the events in order", func() {
+			So(len(mem.Events()), ShouldEqual, 2)
+			decided := mem.OfKind(KindSlotDecided)
+			So(len(decided), ShouldEqual, 1)
+			So(decided[0].(SlotDecided).Slot, ShouldEqual, types.Slot(3))
+		})
+
+		Convey("the writer writes a JSON record per event", func() {
+			dec := json.NewDecoder(buf)
+			var r Record
+			So(dec.Decode(&r), ShouldBeNil)
+			So(r.Kind, ShouldEqual, KindSlotDecided)
+			So(r.Process, ShouldEqual, "(Replica-0)")
+			So(r.Fields["command"], ShouldEqual, "c/1 OP")
+			So(dec.Decode(&r), ShouldBeNil)
+			So(r.Kind, ShouldEqual, KindBallotAdopted)
+		})
+	})
+
+	Convey("Emit ignores a nil sink", t, func() {
+		So(func() { Emit(nil, SlotDecided{}) }, ShouldNotPanic)
+	})
+}
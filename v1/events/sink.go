@@ -0,0 +1,133 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"sync"
+	"time"
+)
+
+// Sink - receives the protocol events emitted by components
+// Sinks are shared by all the components of an Env and must be go-routine safe
+type Sink interface {
+	Record(e Event) error
+}
+
+// Emit - record the event to the sink, if any. Failures are logged and otherwise
+// ignored, so that the protocol is not affected by its observers
+func Emit(sink Sink, e Event) {
+	if sink == nil {
+		return
+	}
+	if err := sink.Record(e); err != nil {
+		log.Debugf("events: record %s failed %v", e.Kind(), err)
+	}
+}
+
+// Tee - a Sink recording every event to all of the sinks, stopping at the first error
+func Tee(sinks ...Sink) Sink {
+	return tee(sinks)
+}
+
+type tee []Sink
+
+func (t tee) Record(e Event) error {
+	for _, s := range t {
+		if err := s.Record(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record - the JSON lines form of an event
+type Record struct {
+	Time time.Time `json:"time"`
+
+	Kind string `json:"kind"`
+
+	Process string `json:"process"`
+
+	Fields log.Fields `json:"fields"`
+}
+
+// Writer - a Sink writing events as JSON lines
+type Writer struct {
+	mu *sync.Mutex
+
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{mu: &sync.Mutex{}, enc: json.NewEncoder(w)}
+}
+
+func (w *Writer) Record(e Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(Record{
+		Time:    time.Now(),
+		Kind:    e.Kind(),
+		Process: fmt.Sprintf("%v", e.Process()),
+		Fields:  e.Fields(),
+	})
+}
+
+// Memory - a Sink capturing events in memory, e.g. for tests
+type Memory struct {
+	mu *sync.Mutex
+
+	events []Event
+}
+
+func NewMemory() *Memory {
+	return &Memory{mu: &sync.Mutex{}, events: make([]Event, 0)}
+}
+
+func (m *Memory) Record(e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+	return nil
+}
+
+// Events - a copy of the events recorded so far
+func (m *Memory) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]Event, len(m.events))
+	copy(result, m.events)
+	return result
+}
+
+// OfKind - the events of the specified kind recorded so far
+func (m *Memory) OfKind(kind string) []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]Event, 0)
+	for _, e := range m.events {
+		if e.Kind() == kind {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Logger - a Sink writing events to the logrus output at the specified level
+type Logger struct {
+	level log.Level
+}
+
+func NewLogger(level log.Level) *Logger {
+	return &Logger{level: level}
+}
+
+func (l *Logger) Record(e Event) error {
+	log.WithFields(e.Fields()).WithFields(log.Fields{
+		"Addr":  e.Process(),
+		"Event": e.Kind(),
+	}).Log(l.level, e.Kind())
+	return nil
+}
@@ -0,0 +1,364 @@
+package v1
+
+import (
+	"fmt"
+	"github.com/1xyz/paxossim/v1/clock"
+	log "github.com/sirupsen/logrus"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// FaultModel - describes how unreliable the network between processes is
+type FaultModel struct {
+	// Probability [0, 1) that a message is silently dropped
+	DropRate float64
+
+	// Probability [0, 1) that a message is delivered twice
+	DuplicateRate float64
+
+	// Every delivered message is delayed by a random duration in [MinDelay, MaxDelay]
+	MinDelay time.Duration
+	MaxDelay time.Duration
+}
+
+// Owned - implemented by processes which are spawned by (and fail along with) another process
+// e.g. a Scout or a Commander is owned by its Leader
+type Owned interface {
+	Owner() Addr
+}
+
+// FaultyMessageExchange - A MessageExchange which wraps another exchange and injects
+// network faults (drops, duplicates, delays), process crashes and network partitions
+type FaultyMessageExchange struct {
+	inner MessageExchange
+
+	mu *sync.Mutex
+
+	model FaultModel
+
+	rnd *rand.Rand
+
+	// processes registered via this exchange, used to expand SendAll
+	typeToProcessInbox typeToProcessMap
+
+	// owner of a spawned process (a Scout's or a Commander's leader)
+	owners map[Addr]Addr
+
+	// every process ever registered via this exchange; messages in-flight to a process which
+	// unregistered since are dropped by the inner exchange
+	registered AddrSet
+
+	// processes which are crashed; messages to & from them are dropped
+	crashed AddrSet
+
+	// partition group of a process; processes in different groups cannot communicate
+	partitions map[Addr]int
+
+	// links which are cut; both directions of a cut link are recorded
+	cut map[link]bool
+
+	// extra delay of the messages sent to & by a slow process
+	slow map[Addr]time.Duration
+
+	// delayed messages are delivered on this clock
+	clock clock.Clock
+}
+
+// link - the network link between two processes
+type link struct {
+	from Addr
+	to   Addr
+}
+
+func NewFaultyMessageExchange(inner MessageExchange, model FaultModel, seed int64) *FaultyMessageExchange {
+	return &FaultyMessageExchange{
+		inner:              inner,
+		mu:                 &sync.Mutex{},
+		model:              model,
+		rnd:                rand.New(rand.NewSource(seed)),
+		typeToProcessInbox: make(typeToProcessMap),
+		owners:             make(map[Addr]Addr),
+		registered:         make(AddrSet),
+		crashed:            make(AddrSet),
+		partitions:         make(map[Addr]int),
+		cut:                make(map[link]bool),
+		slow:               make(map[Addr]time.Duration),
+		clock:              clock.Real(),
+	}
+}
+
+// IDs - the allocator of the wrapped exchange
+func (fme *FaultyMessageExchange) IDs() *IDAllocator {
+	return fme.inner.IDs()
+}
+
+func (fme *FaultyMessageExchange) Send(dest Addr, m Message) error {
+	addr := NewAddress(dest.ID(), dest.Type())
+	fme.mu.Lock()
+	ok := fme.registered.Contains(addr)
+	fme.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("not-found: process with id %v not-found", dest)
+	}
+	fme.deliver(addr, m)
+	return nil
+}
+
+func (fme *FaultyMessageExchange) SendAll(pt ProcessType, m Message) error {
+	fme.mu.Lock()
+	entries, ok := fme.typeToProcessInbox.get(pt)
+	if !ok || entries.Len() == 0 {
+		fme.mu.Unlock()
+		return fmt.Errorf("not-found: No process(es) with type:%v found", pt)
+	}
+	dests := make([]Addr, 0, entries.Len())
+	for e := entries.Front(); e != nil; e = e.Next() {
+		p := e.Value.(ProcessInbox)
+		dests = append(dests, NewAddress(p.ID(), p.Type()))
+	}
+	fme.mu.Unlock()
+
+	for _, dest := range dests {
+		fme.deliver(dest, m)
+	}
+	return nil
+}
+
+func (fme *FaultyMessageExchange) Register(p ProcessInbox) error {
+	if err := fme.inner.Register(p); err != nil {
+		return err
+	}
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.typeToProcessInbox.put(p)
+	fme.registered.Add(NewAddress(p.ID(), p.Type()))
+	if o, ok := p.(Owned); ok && o.Owner() != nil {
+		fme.owners[NewAddress(p.ID(), p.Type())] = NewAddress(o.Owner().ID(), o.Owner().Type())
+	}
+	return nil
+}
+
+func (fme *FaultyMessageExchange) UnRegister(p ProcessInbox) error {
+	if err := fme.inner.UnRegister(p); err != nil {
+		return err
+	}
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.typeToProcessInbox.remove(p)
+	delete(fme.owners, NewAddress(p.ID(), p.Type()))
+	return nil
+}
+
+// SetFaultModel - replace the network fault model
+func (fme *FaultyMessageExchange) SetFaultModel(model FaultModel) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.model = model
+}
+
+// Pending - the number of messages waiting in the inboxes of the processes registered via this
+// exchange
+func (fme *FaultyMessageExchange) Pending() int {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	result := 0
+	for _, entries := range fme.typeToProcessInbox {
+		for e := entries.Front(); e != nil; e = e.Next() {
+			if p, ok := e.Value.(interface{ InboxLen() int }); ok {
+				result += p.InboxLen()
+			}
+		}
+	}
+	return result
+}
+
+// SetClock - deliver the delayed messages on the specified clock, instead of the host's
+func (fme *FaultyMessageExchange) SetClock(c clock.Clock) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.clock = clock.OrReal(c)
+}
+
+// Crash - isolate a process (and the processes it owns) from the network
+func (fme *FaultyMessageExchange) Crash(addr Addr) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.crashed.Add(NewAddress(addr.ID(), addr.Type()))
+}
+
+// Restart - re-connect a previously crashed process, with its state intact
+func (fme *FaultyMessageExchange) Restart(addr Addr) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.crashed.Remove(NewAddress(addr.ID(), addr.Type()))
+}
+
+// Partition - split the network into the specified groups. Processes which
+// are not part of any group remain reachable from every group
+func (fme *FaultyMessageExchange) Partition(groups ...[]Addr) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.partitions = make(map[Addr]int)
+	for i, group := range groups {
+		for _, addr := range group {
+			fme.partitions[NewAddress(addr.ID(), addr.Type())] = i + 1
+		}
+	}
+}
+
+// Heal - remove all network partitions and restore all cut links
+func (fme *FaultyMessageExchange) Heal() {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	fme.partitions = make(map[Addr]int)
+	fme.cut = make(map[link]bool)
+}
+
+// CutLink - drop all messages between two processes (and the processes they own), in both directions
+func (fme *FaultyMessageExchange) CutLink(a Addr, b Addr) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	a, b = NewAddress(a.ID(), a.Type()), NewAddress(b.ID(), b.Type())
+	fme.cut[link{from: a, to: b}] = true
+	fme.cut[link{from: b, to: a}] = true
+}
+
+// HealLink - restore a link previously cut by CutLink
+func (fme *FaultyMessageExchange) HealLink(a Addr, b Addr) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	a, b = NewAddress(a.ID(), a.Type()), NewAddress(b.ID(), b.Type())
+	delete(fme.cut, link{from: a, to: b})
+	delete(fme.cut, link{from: b, to: a})
+}
+
+// CutLinks - the links which are currently cut, each reported once
+func (fme *FaultyMessageExchange) CutLinks() [][2]Addr {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	result := make([][2]Addr, 0, len(fme.cut)/2)
+	seen := make(map[link]bool)
+	for l := range fme.cut {
+		if seen[l] {
+			continue
+		}
+		seen[link{from: l.to, to: l.from}] = true
+		result = append(result, [2]Addr{l.from, l.to})
+	}
+	return result
+}
+
+// Slow - delay every message sent to or by a process (and the processes it owns) by d more; zero
+// restores the process
+func (fme *FaultyMessageExchange) Slow(addr Addr, d time.Duration) {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	setDelay(fme.slow, NewAddress(addr.ID(), addr.Type()), d)
+}
+
+func setDelay(delays map[Addr]time.Duration, addr Addr, d time.Duration) {
+	if d <= 0 {
+		delete(delays, addr)
+		return
+	}
+	delays[addr] = d
+}
+
+// Crashed - the processes which are currently crashed
+func (fme *FaultyMessageExchange) Crashed() []Addr {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	result := make([]Addr, 0, len(fme.crashed))
+	for addr := range fme.crashed {
+		result = append(result, addr)
+	}
+	return result
+}
+
+// resolve - the process whose failures apply to addr
+func (fme *FaultyMessageExchange) resolve(addr Addr) Addr {
+	if owner, ok := fme.owners[addr]; ok {
+		return owner
+	}
+	return addr
+}
+
+// Reachable - true if messages sent by src get through to dest, unless the fault model drops them
+func (fme *FaultyMessageExchange) Reachable(src Addr, dest Addr) bool {
+	fme.mu.Lock()
+	defer fme.mu.Unlock()
+	return fme.reachable(NewAddress(src.ID(), src.Type()), NewAddress(dest.ID(), dest.Type()))
+}
+
+func (fme *FaultyMessageExchange) reachable(src Addr, dest Addr) bool {
+	src, dest = fme.resolve(src), fme.resolve(dest)
+	if fme.crashed.Contains(src) || fme.crashed.Contains(dest) {
+		return false
+	}
+	if fme.cut[link{from: src, to: dest}] {
+		return false
+	}
+	g1, ok1 := fme.partitions[src]
+	g2, ok2 := fme.partitions[dest]
+	return !ok1 || !ok2 || g1 == g2
+}
+
+// delay - a random delay of the fault model, plus the delays of slow processes
+func (fme *FaultyMessageExchange) delay(src Addr, dest Addr) time.Duration {
+	src, dest = fme.resolve(src), fme.resolve(dest)
+	d := fme.model.MinDelay + fme.slow[src] + fme.slow[dest]
+	if spread := fme.model.MaxDelay - fme.model.MinDelay; spread > 0 {
+		d += time.Duration(fme.rnd.Int63n(int64(spread) + 1))
+	}
+	return d
+}
+
+// deliver - forward the message, unless it is dropped, after the delays of the fault model. Messages
+// between a process and the processes it owns, e.g. a Leader and its Scouts, do not cross the network:
+// they are neither dropped, duplicated nor delayed
+func (fme *FaultyMessageExchange) deliver(dest Addr, m Message) {
+	fme.mu.Lock()
+	src := NewAddress(m.Src().ID(), m.Src().Type())
+	if fme.resolve(src) == fme.resolve(dest) {
+		fme.mu.Unlock()
+		fme.forward(dest, m)
+		return
+	}
+	if !fme.reachable(src, dest) || fme.rnd.Float64() < fme.model.DropRate {
+		fme.mu.Unlock()
+		log.WithFields(log.Fields{
+			"Method":      "faultyExchange.deliver",
+			"MessageType": fmt.Sprintf("%T", m),
+			"Dest":        dest,
+			"Source":      src}).Debugf("DropMessage")
+		return
+	}
+	delays := []time.Duration{fme.delay(src, dest)}
+	if fme.rnd.Float64() < fme.model.DuplicateRate {
+		delays = append(delays, fme.delay(src, dest))
+	}
+	c := fme.clock
+	fme.mu.Unlock()
+
+	for _, d := range delays {
+		if d <= 0 {
+			fme.forward(dest, m)
+			continue
+		}
+		c.AfterFunc(d, func() { fme.forward(dest, m) })
+	}
+}
+
+func (fme *FaultyMessageExchange) forward(dest Addr, m Message) {
+	// re-check reachability, the destination might have crashed while the message was in-flight
+	fme.mu.Lock()
+	ok := fme.reachable(NewAddress(m.Src().ID(), m.Src().Type()), dest)
+	fme.mu.Unlock()
+	if !ok {
+		return
+	}
+	if err := fme.inner.Send(dest, m); err != nil {
+		log.Debugf("faultyExchange.forward failed %v", err)
+	}
+}
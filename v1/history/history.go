@@ -0,0 +1,199 @@
+package history
+
+// Client histories, and their linearizability.
+//
+// A History records when every command was requested by its client (the invocation), when a
+// replica first performed it, i.e. when a response could have been sent (the completion), and
+// the order every replica performed the commands in. The replicated state machine is
+// linearizable if these orders respect real time: a command which completed before another was
+// invoked is performed first. Only commands which touch a common key are ordered (see
+// statemachine.Interfere), so the check holds for protocols which order interfering commands
+// only, e.g. EPaxos.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Op - a command requested by a client
+type Op struct {
+	Command types.Command
+
+	Invoked time.Time
+
+	// zero if no replica performed the command
+	Completed time.Time
+}
+
+// IsCompleted - true if a replica performed the command
+func (o Op) IsCompleted() bool {
+	return !o.Completed.IsZero()
+}
+
+// opKey - identifies the command of an op
+type opKey struct {
+	clientID string
+
+	commandID string
+}
+
+func keyOf(c types.Command) opKey {
+	return opKey{clientID: c.GetClientID(), commandID: c.GetCommandID()}
+}
+
+// Order - the commands a replica performed, in the order it performed them
+type Order struct {
+	Replica v1.Addr
+
+	Commands []types.Command
+}
+
+// History - the ops of the clients of a run. The clients record their invocations (see
+// components.WithHistory); a History is an events.Sink which records the completions, and the
+// order of the replicas
+type History struct {
+	mu *sync.Mutex
+
+	ops map[opKey]*Op
+
+	// the ops in the order they were invoked
+	order []opKey
+
+	// the commands performed by each replica
+	performed map[v1.Addr][]types.Command
+
+	// the time of the invocations & completions
+	clock clock.Clock
+}
+
+func New() *History {
+	return NewWithClock(clock.Real())
+}
+
+// NewWithClock - a History which reads the time of the invocations & completions on the clock,
+// which should be the clock of the processes
+func NewWithClock(c clock.Clock) *History {
+	return &History{
+		mu:        &sync.Mutex{},
+		ops:       make(map[opKey]*Op),
+		performed: make(map[v1.Addr][]types.Command),
+		clock:     c,
+	}
+}
+
+// Invoke - the client requested the command
+func (h *History) Invoke(command types.Command) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := keyOf(command)
+	if _, ok := h.ops[k]; ok {
+		return
+	}
+	h.ops[k] = &Op{Command: command, Invoked: h.clock.Now()}
+	h.order = append(h.order, k)
+}
+
+// Record - append a performed command to the order of its replica, and complete its op the first
+// time it is performed. Commands performed after their key moved to another shard take no effect,
+// and are not recorded
+func (h *History) Record(e events.Event) error {
+	p, ok := e.(events.CommandPerformed)
+	if !ok || p.Command == nil || p.Result == statemachine.ResultMoved {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	replica := v1.NewAddress(p.Replica.ID(), p.Replica.Type())
+	h.performed[replica] = append(h.performed[replica], p.Command)
+	if op, ok := h.ops[keyOf(p.Command)]; ok && !op.IsCompleted() {
+		op.Completed = h.clock.Now()
+	}
+	return nil
+}
+
+// Ops - the ops recorded so far, in the order they were invoked
+func (h *History) Ops() []Op {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]Op, 0, len(h.order))
+	for _, k := range h.order {
+		result = append(result, *h.ops[k])
+	}
+	return result
+}
+
+// Orders - the order of every replica which performed a command, by address
+func (h *History) Orders() []Order {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	result := make([]Order, 0, len(h.performed))
+	for replica, commands := range h.performed {
+		result = append(result, Order{Replica: replica, Commands: append([]types.Command{}, commands...)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Replica.ID() < result[j].Replica.ID() })
+	return result
+}
+
+// CheckLinearizable - L1: every replica performed a command which completed before an
+// interfering command was invoked first. Commands performed more than once count as performed
+// the first time, and commands a replica did not perform are not checked at that replica
+func CheckLinearizable(ops []Op, orders []Order) []invariant.Violation {
+	completed := make([]Op, 0, len(ops))
+	for _, op := range ops {
+		if op.IsCompleted() {
+			completed = append(completed, op)
+		}
+	}
+	sort.SliceStable(completed, func(i, j int) bool { return completed[i].Completed.Before(completed[j].Completed) })
+
+	result := make([]invariant.Violation, 0)
+	for _, o := range orders {
+		positions := firstPositions(o.Commands)
+		for _, b := range ops {
+			pb, ok := positions[keyOf(b.Command)]
+			if !ok {
+				continue
+			}
+			// the ops which completed before b was invoked
+			for _, a := range completed {
+				if !a.Completed.Before(b.Invoked) {
+					break
+				}
+				pa, ok := positions[keyOf(a.Command)]
+				if !ok || pa < pb || !statemachine.Interfere(a.Command, b.Command) {
+					continue
+				}
+				result = append(result, invariant.Violation{
+					Invariant: "L1",
+					Message: fmt.Sprintf("replica %v performed %s before %s, which completed %v before it was invoked",
+						o.Replica, format(b.Command), format(a.Command), b.Invoked.Sub(a.Completed)),
+				})
+				break
+			}
+		}
+	}
+	return result
+}
+
+// firstPositions - the position each command was first performed at
+func firstPositions(commands []types.Command) map[opKey]int {
+	result := make(map[opKey]int, len(commands))
+	for i, c := range commands {
+		if _, ok := result[keyOf(c)]; !ok {
+			result[keyOf(c)] = i
+		}
+	}
+	return result
+}
+
+func format(c types.Command) string {
+	return fmt.Sprintf("%s/%s", c.GetClientID(), c.GetCommandID())
+}
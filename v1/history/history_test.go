@@ -0,0 +1,76 @@
+package history
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func put(id string, key string) types.Command {
+	return ops.NewCommand("client:0", id, ops.Put{Key: key, Value: id})
+}
+
+func TestCheckLinearizable(t *testing.T) {
+	Convey("Given a command which completed before another was invoked", t, func() {
+		start := time.Now()
+		a := Op{Command: put("1", "k1"), Invoked: start, Completed: start.Add(time.Millisecond)}
+		b := Op{Command: put("2", "k1"), Invoked: start.Add(2 * time.Millisecond)}
+		replica := v1.NewAddress(0, v1.Replica)
+
+		Convey("a replica which performed them in order is linearizable", func() {
+			orders := []Order{{Replica: replica, Commands: []types.Command{a.Command, b.Command}}}
+			So(CheckLinearizable([]Op{a, b}, orders), ShouldBeEmpty)
+		})
+
+		Convey("a replica which performed them out of order is not", func() {
+			orders := []Order{{Replica: replica, Commands: []types.Command{b.Command, a.Command}}}
+			violations := CheckLinearizable([]Op{a, b}, orders)
+			So(violations, ShouldHaveLength, 1)
+			So(violations[0].Invariant, ShouldEqual, "L1")
+		})
+
+		Convey("unless the commands do not interfere", func() {
+			b.Command = put("2", "k2")
+			orders := []Order{{Replica: replica, Commands: []types.Command{b.Command, a.Command}}}
+			So(CheckLinearizable([]Op{a, b}, orders), ShouldBeEmpty)
+		})
+
+		Convey("concurrent commands may be performed in any order", func() {
+			b.Invoked = a.Invoked
+			orders := []Order{{Replica: replica, Commands: []types.Command{b.Command, a.Command}}}
+			So(CheckLinearizable([]Op{a, b}, orders), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestHistory(t *testing.T) {
+	Convey("Given a history of two requested commands", t, func() {
+		h := New()
+		c1, c2 := put("1", "k1"), put("2", "k1")
+		h.Invoke(c1)
+		h.Invoke(c2)
+		So(h.Ops(), ShouldHaveLength, 2)
+		So(h.Ops()[0].IsCompleted(), ShouldBeFalse)
+
+		Convey("a command is completed by the first replica to perform it", func() {
+			r0, r1 := v1.NewAddress(0, v1.Replica), v1.NewAddress(1, v1.Replica)
+			So(h.Record(events.CommandPerformed{Replica: r1, Slot: 1, Command: c1}), ShouldBeNil)
+			completed := h.Ops()[0].Completed
+			So(completed.IsZero(), ShouldBeFalse)
+			So(h.Record(events.CommandPerformed{Replica: r0, Slot: 1, Command: c1}), ShouldBeNil)
+			So(h.Ops()[0].Completed, ShouldEqual, completed)
+			So(h.Ops()[1].IsCompleted(), ShouldBeFalse)
+
+			Convey("and the order of every replica is recorded", func() {
+				orders := h.Orders()
+				So(orders, ShouldHaveLength, 2)
+				So(orders[0].Replica, ShouldResemble, r0)
+				So(orders[1].Commands, ShouldResemble, []types.Command{c1})
+			})
+		})
+	})
+}
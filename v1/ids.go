@@ -0,0 +1,31 @@
+package v1
+
+import (
+	"sync"
+)
+
+// IDAllocator - allocates the ids of the processes of one cluster, counting every process type
+// from zero. Clusters with allocators of their own can share a binary without their ids colliding
+type IDAllocator struct {
+	mu *sync.Mutex
+
+	next map[ProcessType]ProcessID
+}
+
+func NewIDAllocator() *IDAllocator {
+	return &IDAllocator{mu: &sync.Mutex{}, next: make(map[ProcessType]ProcessID)}
+}
+
+// Next - the next id of the process type
+func (a *IDAllocator) Next(pt ProcessType) ProcessID {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id := a.next[pt]
+	a.next[pt]++
+	return id
+}
+
+// AllocateID - the next id of the process type, in the cluster of the exchange
+func AllocateID(exchange MessageExchange, pt ProcessType) ProcessID {
+	return exchange.IDs().Next(pt)
+}
@@ -0,0 +1,130 @@
+package invariant
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+)
+
+// DecisionLog - The decisions observed at a single replica
+type DecisionLog struct {
+	Replica v1.Addr
+
+	// the Paxos group of the replica, in a sharded cluster
+	Group int
+
+	Decisions types.SlotCommandMap
+}
+
+// Violation - A description of a broken invariant
+type Violation struct {
+	// Invariant identifier as listed in the README (e.g. R1)
+	Invariant string
+
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Invariant, v.Message)
+}
+
+// CheckDecisions - verify that the decision logs across replicas are consistent
+// R1: There are no two commands decided for the same slot. The slots of every group are checked
+// separately
+func CheckDecisions(logs []DecisionLog) []Violation {
+	type groupSlot struct {
+		group int
+		slot  types.Slot
+	}
+
+	violations := make([]Violation, 0)
+	decided := make(map[groupSlot]DecisionLog)
+	for _, l := range logs {
+		for _, slot := range sortedSlots(l.Decisions) {
+			command := l.Decisions[slot]
+			gs := groupSlot{group: l.Group, slot: slot}
+			first, ok := decided[gs]
+			if !ok {
+				decided[gs] = l
+				continue
+			}
+			if other := first.Decisions[slot]; other != command {
+				violations = append(violations, Violation{
+					Invariant: "R1",
+					Message: fmt.Sprintf("slot %v decided as [%v] at %v and as [%v] at %v",
+						slot, other, first.Replica, command, l.Replica),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+func sortedSlots(decisions types.SlotCommandMap) []types.Slot {
+	slots := make([]types.Slot, 0, len(decisions))
+	for slot := range decisions {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	return slots
+}
+
+// AcceptedLog - The pvalues accepted by a single acceptor
+type AcceptedLog struct {
+	Acceptor v1.Addr
+
+	Accepted types.PValues
+}
+
+// CheckAccepted - verify that the acceptors accepted the same command for a ballot & slot
+// A4: For any two acceptors, if a accepted <b, s, c> and a' accepted <b, s, c'> then c = c'.
+func CheckAccepted(logs []AcceptedLog) []Violation {
+	type ballotSlot struct {
+		round  int
+		leader v1.ProcessID
+		slot   types.Slot
+	}
+	type accepted struct {
+		acceptor v1.Addr
+		command  types.Command
+	}
+
+	violations := make([]Violation, 0)
+	seen := make(map[ballotSlot]accepted)
+	for _, l := range logs {
+		for _, pv := range sortedPValues(l.Accepted) {
+			bs := ballotSlot{round: pv.BN.Round, leader: pv.BN.LeaderID.ID(), slot: pv.Slot}
+			first, ok := seen[bs]
+			if !ok {
+				seen[bs] = accepted{acceptor: l.Acceptor, command: pv.Command}
+				continue
+			}
+			if first.command != pv.Command {
+				violations = append(violations, Violation{
+					Invariant: "A4",
+					Message: fmt.Sprintf("ballot %v slot %v accepted as [%v] at %v and as [%v] at %v",
+						pv.BN, pv.Slot, first.command, first.acceptor, pv.Command, l.Acceptor),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+func sortedPValues(pvalues types.PValues) []types.PValue {
+	result := make([]types.PValue, 0, len(pvalues))
+	for pv := range pvalues {
+		result = append(result, pv)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if c := types.Compare(&result[i].BN, &result[j].BN); c != 0 {
+			return c < 0
+		}
+		if result[i].Slot != result[j].Slot {
+			return result[i].Slot < result[j].Slot
+		}
+		return fmt.Sprintf("%v", result[i].Command) < fmt.Sprintf("%v", result[j].Command)
+	})
+	return result
+}
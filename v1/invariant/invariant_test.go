@@ -0,0 +1,72 @@
+package invariant
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func newCommand(id string) types.Command {
+	return types.BasicCommand{ClientID: "client:0", CommandID: id, Op: "OP"}
+}
+
+func TestCheckDecisions(t *testing.T) {
+	Convey("Given two replicas", t, func() {
+		r1 := DecisionLog{Replica: v1.NewAddress(0, v1.Replica), Decisions: make(types.SlotCommandMap)}
+		r2 := DecisionLog{Replica: v1.NewAddress(1, v1.Replica), Decisions: make(types.SlotCommandMap)}
+		r1.Decisions.Assign(1, newCommand("1"))
+		r2.Decisions.Assign(1, newCommand("1"))
+
+		Convey("which decided the same command for a slot", func() {
+			r1.Decisions.Assign(2, newCommand("2"))
+
+			Convey("no violations are reported", func() {
+				So(CheckDecisions([]DecisionLog{r1, r2}), ShouldBeEmpty)
+			})
+		})
+
+		Convey("which decided different commands for a slot", func() {
+			r1.Decisions.Assign(2, newCommand("2"))
+			r2.Decisions.Assign(2, newCommand("3"))
+
+			Convey("an R1 violation is reported", func() {
+				violations := CheckDecisions([]DecisionLog{r1, r2})
+				So(len(violations), ShouldEqual, 1)
+				So(violations[0].Invariant, ShouldEqual, "R1")
+			})
+		})
+
+		Convey("of different groups, which decided different commands for a slot", func() {
+			r2.Group = 1
+			r1.Decisions.Assign(2, newCommand("2"))
+			r2.Decisions.Assign(2, newCommand("3"))
+
+			Convey("no violations are reported", func() {
+				So(CheckDecisions([]DecisionLog{r1, r2}), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestCheckAccepted(t *testing.T) {
+	Convey("Given two acceptors which accepted a pvalue", t, func() {
+		bn := types.BallotNumber{Round: 1, LeaderID: v1.NewAddress(0, v1.Leader)}
+		a1 := AcceptedLog{Acceptor: v1.NewAddress(0, v1.Acceptor), Accepted: make(types.PValues)}
+		a2 := AcceptedLog{Acceptor: v1.NewAddress(1, v1.Acceptor), Accepted: make(types.PValues)}
+		a1.Accepted.Set(types.PValue{BN: bn, Slot: 1, Command: newCommand("1")})
+		a2.Accepted.Set(types.PValue{BN: bn, Slot: 1, Command: newCommand("1")})
+
+		Convey("the same command for the ballot & slot is no violation", func() {
+			a2.Accepted.Set(types.PValue{BN: types.BallotNumber{Round: 2, LeaderID: bn.LeaderID}, Slot: 1, Command: newCommand("2")})
+			So(CheckAccepted([]AcceptedLog{a1, a2}), ShouldBeEmpty)
+		})
+
+		Convey("another command for the ballot & slot is an A4 violation", func() {
+			a2.Accepted.Set(types.PValue{BN: bn, Slot: 1, Command: newCommand("2")})
+			violations := CheckAccepted([]AcceptedLog{a1, a2})
+			So(len(violations), ShouldEqual, 1)
+			So(violations[0].Invariant, ShouldEqual, "A4")
+		})
+	})
+}
@@ -26,6 +26,10 @@ type MessageExchange interface {
 
 	// UnRegister a process with this exchange
 	UnRegister(p ProcessInbox) error
+
+	// IDs - the allocator of the ids of the processes of the cluster; exchanges which wrap
+	// another exchange return the allocator of the exchange they wrap
+	IDs() *IDAllocator
 }
 
 func NewMessageExchange() MessageExchange {
@@ -33,6 +37,7 @@ func NewMessageExchange() MessageExchange {
 		addrToProcessInbox: make(map[Addr]ProcessInbox),
 		typeToProcessInbox: make(typeToProcessMap),
 		mu:                 &sync.RWMutex{},
+		ids:                NewIDAllocator(),
 	}
 }
 
@@ -48,13 +53,21 @@ type basicMessageExchange struct {
 	typeToProcessInbox typeToProcessMap
 
 	mu *sync.RWMutex
+
+	// allocates the ids of the processes of the cluster
+	ids *IDAllocator
+}
+
+func (bme basicMessageExchange) IDs() *IDAllocator {
+	return bme.ids
 }
 
 func (bme basicMessageExchange) Send(dest Addr, m Message) error {
-	bme.mu.RLock()
-	defer bme.mu.RUnlock()
 	addr := NewAddress(dest.ID(), dest.Type())
+	// enqueue without holding the lock, a bounded inbox may block until its process catches up
+	bme.mu.RLock()
 	v, ok := bme.addrToProcessInbox[addr]
+	bme.mu.RUnlock()
 	if !ok {
 		return fmt.Errorf("not-found: process with id %v not-found", dest)
 	}
@@ -68,13 +81,18 @@ func (bme basicMessageExchange) Send(dest Addr, m Message) error {
 
 func (bme basicMessageExchange) SendAll(pt ProcessType, m Message) error {
 	bme.mu.RLock()
-	defer bme.mu.RUnlock()
 	entries, ok := bme.typeToProcessInbox.get(pt)
 	if !ok || entries.Len() == 0 {
+		bme.mu.RUnlock()
 		return fmt.Errorf("not-found: No process(es) with type:%v found", pt)
 	}
+	dests := make([]ProcessInbox, 0, entries.Len())
 	for e := entries.Front(); e != nil; e = e.Next() {
-		p := e.Value.(ProcessInbox)
+		dests = append(dests, e.Value.(ProcessInbox))
+	}
+	bme.mu.RUnlock()
+
+	for _, p := range dests {
 		ctxLog := log.WithFields(log.Fields{
 			"MessageType": fmt.Sprintf("%T", m),
 			"Dest":        fmt.Sprintf("(%v-%v)", p.ID(), p.Type()),
@@ -147,6 +147,10 @@ type AdoptedMessage struct {
 	basicMessage
 	BallotNumber types.BallotNumber
 	Accepted     types.PValues
+
+	// Number of acceptors of the adopting majority which reported each accepted pvalue
+	// Used by Fast Paxos to recover the value of a slot with colliding fast votes
+	Votes map[types.PValue]int
 }
 
 func NewAdoptedMessage(addr v1.Addr, number types.BallotNumber, values types.PValues) AdoptedMessage {
@@ -156,3 +160,80 @@ func NewAdoptedMessage(addr v1.Addr, number types.BallotNumber, values types.PVa
 		Accepted:     values,
 	}
 }
+
+// FastProposeMessage - Request from a Client sent directly to all the acceptors in a fast round (Fast Paxos)
+type FastProposeMessage struct {
+	basicMessage
+	Command types.Command
+}
+
+func NewFastProposeMessage(source v1.Addr, command types.Command) FastProposeMessage {
+	return FastProposeMessage{
+		basicMessage: basicMessage{src: source},
+		Command:      command,
+	}
+}
+
+// Phase2aAnyMessage - sent by the leader to the acceptors once its ballot is adopted, allowing them
+// to accept any client command in the ballot for the slots starting at FromSlot (Fast Paxos)
+type Phase2aAnyMessage struct {
+	basicMessage
+	BallotNumber types.BallotNumber
+	FromSlot     types.Slot
+}
+
+func NewPhase2aAnyMessage(source v1.Addr, number types.BallotNumber, from types.Slot) Phase2aAnyMessage {
+	return Phase2aAnyMessage{
+		basicMessage: basicMessage{src: source},
+		BallotNumber: number,
+		FromSlot:     from,
+	}
+}
+
+// FastVoteMessage - sent by an Acceptor to the leader of a fast ballot when it accepts a client's command
+// for a slot (Fast Paxos)
+type FastVoteMessage struct {
+	basicMessage
+	PValue types.PValue
+}
+
+func NewFastVoteMessage(source v1.Addr, value types.PValue) FastVoteMessage {
+	return FastVoteMessage{
+		basicMessage: basicMessage{src: source},
+		PValue:       value,
+	}
+}
+
+// AuxiliariesEngagedMessage - sent by a Scout or a Commander to its leader when the main acceptors did
+// not form a quorum in time, and the auxiliary acceptors were engaged (Cheap Paxos)
+type AuxiliariesEngagedMessage struct {
+	basicMessage
+	BallotNumber types.BallotNumber
+
+	// main acceptors which had not responded
+	Missing []v1.Addr
+}
+
+func NewAuxiliariesEngagedMessage(source v1.Addr, number types.BallotNumber, missing []v1.Addr) AuxiliariesEngagedMessage {
+	return AuxiliariesEngagedMessage{
+		basicMessage: basicMessage{src: source},
+		BallotNumber: number,
+		Missing:      missing,
+	}
+}
+
+// AcceptorConfigMessage - sent by a Replica to the leaders once it applies the reconfiguration of the
+// main acceptors decided at Slot (Cheap Paxos)
+type AcceptorConfigMessage struct {
+	basicMessage
+	Slot      types.Slot
+	Acceptors []v1.Addr
+}
+
+func NewAcceptorConfigMessage(source v1.Addr, slot types.Slot, acceptors []v1.Addr) AcceptorConfigMessage {
+	return AcceptorConfigMessage{
+		basicMessage: basicMessage{src: source},
+		Slot:         slot,
+		Acceptors:    acceptors,
+	}
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"strings"
+)
+
+// Label - the label value identifying a process, e.g. Acceptor-2
+func Label(addr v1.Addr) string {
+	return fmt.Sprintf("%v-%v", addr.Type(), addr.ID())
+}
+
+// MessageType - the label value identifying a message type, e.g. Phase1a
+func MessageType(m v1.Message) string {
+	name := fmt.Sprintf("%T", m)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "Message")
+}
+
+// Exchange - A MessageExchange which counts the messages passing through it, by
+// message type and by either the sending or the receiving process.
+type Exchange struct {
+	v1.MessageExchange
+
+	counter *CounterVec
+
+	// true if messages are counted by their destination
+	byDest bool
+}
+
+// NewSentExchange - counts the messages sent via inner by their source
+func NewSentExchange(inner v1.MessageExchange, r *Registry) *Exchange {
+	return &Exchange{
+		MessageExchange: inner,
+		counter: r.Counter("paxos_messages_sent_total",
+			"Messages sent, by message type and sending process", "type", "process"),
+	}
+}
+
+// NewReceivedExchange - counts the messages delivered via inner by their destination
+// Broadcasts are only counted once expanded to a Send per destination, so this exchange is
+// meant to be wrapped by one which does so (e.g. v1.FaultyMessageExchange)
+func NewReceivedExchange(inner v1.MessageExchange, r *Registry) *Exchange {
+	return &Exchange{
+		MessageExchange: inner,
+		counter: r.Counter("paxos_messages_received_total",
+			"Messages delivered to an inbox, by message type and receiving process", "type", "process"),
+		byDest: true,
+	}
+}
+
+func (me *Exchange) Send(dest v1.Addr, m v1.Message) error {
+	err := me.MessageExchange.Send(dest, m)
+	if err == nil {
+		addr := m.Src()
+		if me.byDest {
+			addr = dest
+		}
+		me.counter.Inc(MessageType(m), Label(addr))
+	}
+	return err
+}
+
+func (me *Exchange) SendAll(pt v1.ProcessType, m v1.Message) error {
+	err := me.MessageExchange.SendAll(pt, m)
+	if err == nil && !me.byDest {
+		me.counter.Inc(MessageType(m), Label(m.Src()))
+	}
+	return err
+}
@@ -0,0 +1,356 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefBuckets - default histogram buckets, in seconds
+var DefBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// Registry - A set of metric families which can be written in the Prometheus text
+// exposition format. A nil *Registry is valid, and hands out metrics which discard
+// every update, so components can be instrumented unconditionally.
+type Registry struct {
+	mu *sync.Mutex
+
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{mu: &sync.Mutex{}, families: make(map[string]*family)}
+}
+
+// family - a metric name and all its labelled children
+type family struct {
+	name string
+
+	help string
+
+	kind kind
+
+	labelNames []string
+
+	buckets []float64
+
+	mu *sync.Mutex
+
+	children map[string]*child
+}
+
+// child - a single labelled time series
+type child struct {
+	labelValues []string
+
+	value float64
+
+	// evaluated at scrape time, if set
+	fn func() float64
+
+	// per bucket (non-cumulative) counts of a histogram
+	counts []uint64
+
+	count uint64
+}
+
+func (r *Registry) family(name string, help string, k kind, labelNames []string, buckets []float64) *family {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if ok {
+		if f.kind != k || len(f.labelNames) != len(labelNames) {
+			panic(fmt.Sprintf("metric %s re-registered with a different kind or labels", name))
+		}
+		return f
+	}
+	f = &family{
+		name:       name,
+		help:       help,
+		kind:       k,
+		labelNames: labelNames,
+		buckets:    buckets,
+		mu:         &sync.Mutex{},
+		children:   make(map[string]*child),
+	}
+	r.families[name] = f
+	return f
+}
+
+func (f *family) child(labelValues []string) *child {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	c, ok := f.children[key]
+	if !ok {
+		c = &child{labelValues: append([]string{}, labelValues...)}
+		if f.kind == histogramKind {
+			c.counts = make([]uint64, len(f.buckets))
+		}
+		f.children[key] = c
+	}
+	return c
+}
+
+// CounterVec - a counter partitioned by labels
+type CounterVec struct {
+	f *family
+}
+
+// Counter - get or create the counter family with the specified name
+func (r *Registry) Counter(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{f: r.family(name, help, counterKind, labelNames, nil)}
+}
+
+func (cv *CounterVec) Inc(labelValues ...string) {
+	cv.Add(1, labelValues...)
+}
+
+func (cv *CounterVec) Add(v float64, labelValues ...string) {
+	if cv == nil || cv.f == nil {
+		return
+	}
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s cannot decrease", cv.f.name))
+	}
+	cv.f.mu.Lock()
+	defer cv.f.mu.Unlock()
+	cv.f.child(labelValues).value += v
+}
+
+// GaugeVec - a gauge partitioned by labels
+type GaugeVec struct {
+	f *family
+}
+
+// Gauge - get or create the gauge family with the specified name
+func (r *Registry) Gauge(name string, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{f: r.family(name, help, gaugeKind, labelNames, nil)}
+}
+
+func (gv *GaugeVec) Set(v float64, labelValues ...string) {
+	if gv == nil || gv.f == nil {
+		return
+	}
+	gv.f.mu.Lock()
+	defer gv.f.mu.Unlock()
+	gv.f.child(labelValues).value = v
+}
+
+func (gv *GaugeVec) Add(v float64, labelValues ...string) {
+	if gv == nil || gv.f == nil {
+		return
+	}
+	gv.f.mu.Lock()
+	defer gv.f.mu.Unlock()
+	gv.f.child(labelValues).value += v
+}
+
+// Func - the gauge with these label values is evaluated by calling fn at scrape time
+func (gv *GaugeVec) Func(fn func() float64, labelValues ...string) {
+	if gv == nil || gv.f == nil {
+		return
+	}
+	gv.f.mu.Lock()
+	defer gv.f.mu.Unlock()
+	gv.f.child(labelValues).fn = fn
+}
+
+// HistogramVec - a histogram partitioned by labels
+type HistogramVec struct {
+	f *family
+}
+
+// Histogram - get or create the histogram family with the specified name and upper bucket bounds
+func (r *Registry) Histogram(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{f: r.family(name, help, histogramKind, labelNames, sorted)}
+}
+
+func (hv *HistogramVec) Observe(v float64, labelValues ...string) {
+	if hv == nil || hv.f == nil {
+		return
+	}
+	hv.f.mu.Lock()
+	defer hv.f.mu.Unlock()
+	c := hv.f.child(labelValues)
+	c.value += v
+	c.count++
+	for i, upper := range hv.f.buckets {
+		if v <= upper {
+			c.counts[i]++
+			break
+		}
+	}
+}
+
+// Value - the current value of a counter or a gauge, or the sum of a histogram. For tests & reports
+func (r *Registry) Value(name string, labelValues ...string) (float64, bool) {
+	if r == nil {
+		return 0, false
+	}
+	r.mu.Lock()
+	f, ok := r.families[name]
+	r.mu.Unlock()
+	if !ok {
+		return 0, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.children[strings.Join(labelValues, "\xff")]
+	if !ok {
+		return 0, false
+	}
+	if c.fn != nil {
+		return c.fn(), true
+	}
+	return c.value, true
+}
+
+// Total - the sum of the values of all children of a family, and the number of observations
+// of a histogram (the number of children otherwise). For tests & reports
+func (r *Registry) Total(name string) (float64, uint64) {
+	if r == nil {
+		return 0, 0
+	}
+	r.mu.Lock()
+	f, ok := r.families[name]
+	r.mu.Unlock()
+	if !ok {
+		return 0, 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sum, count := float64(0), uint64(0)
+	for _, c := range f.children {
+		if c.fn != nil {
+			sum += c.fn()
+		} else {
+			sum += c.value
+		}
+		if f.kind == histogramKind {
+			count += c.count
+		} else {
+			count++
+		}
+	}
+	return sum, count
+}
+
+// WriteText - write all metrics in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.mu.Lock()
+		f := r.families[name]
+		r.mu.Unlock()
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *family) write(w io.Writer) error {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.children))
+	for key := range f.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	children := make([]*child, 0, len(keys))
+	for _, key := range keys {
+		children = append(children, f.children[key])
+	}
+	f.mu.Unlock()
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.kind)
+	for _, c := range children {
+		if f.kind != histogramKind {
+			v := c.value
+			if c.fn != nil {
+				v = c.fn()
+			}
+			fmt.Fprintf(b, "%s%s %s\n", f.name, f.labels(c.labelValues, ""), formatFloat(v))
+			continue
+		}
+		f.mu.Lock()
+		cumulative := uint64(0)
+		for i, upper := range f.buckets {
+			cumulative += c.counts[i]
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, f.labels(c.labelValues, formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, f.labels(c.labelValues, "+Inf"), c.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.name, f.labels(c.labelValues, ""), formatFloat(c.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.name, f.labels(c.labelValues, ""), c.count)
+		f.mu.Unlock()
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (f *family) labels(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", f.labelNames[i], escapeLabel(v)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, +1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
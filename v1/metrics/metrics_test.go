@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bytes"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Given a registry", t, func() {
+		r := NewRegistry()
+
+		Convey("counters accumulate per label values", func() {
+			c := r.Counter("test_total", "help", "process")
+			c.Inc("a")
+			c.Add(2, "a")
+			c.Inc("b")
+			v, ok := r.Value("test_total", "a")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, 3)
+			v, _ = r.Value("test_total", "b")
+			So(v, ShouldEqual, 1)
+		})
+
+		Convey("gauge funcs are evaluated when read", func() {
+			n := 1.0
+			r.Gauge("test_depth", "help", "process").Func(func() float64 { return n }, "a")
+			n = 5
+			v, ok := r.Value("test_depth", "a")
+			So(ok, ShouldBeTrue)
+			So(v, ShouldEqual, 5)
+		})
+
+		Convey("histograms are written with cumulative buckets", func() {
+			h := r.Histogram("test_seconds", "help", []float64{1, 0.1}, "process")
+			h.Observe(0.05, "a")
+			h.Observe(0.5, "a")
+			h.Observe(2, "a")
+			buf := &bytes.Buffer{}
+			So(r.WriteText(buf), ShouldBeNil)
+			text := buf.String()
+			So(text, ShouldContainSubstring, "# TYPE test_seconds histogram")
+			So(text, ShouldContainSubstring, `test_seconds_bucket{process="a",le="0.1"} 1`)
+			So(text, ShouldContainSubstring, `test_seconds_bucket{process="a",le="1"} 2`)
+			So(text, ShouldContainSubstring, `test_seconds_bucket{process="a",le="+Inf"} 3`)
+			So(text, ShouldContainSubstring, `test_seconds_count{process="a"} 3`)
+		})
+
+		Convey("the handler serves the text exposition format", func() {
+			r.Counter("test_total", "help").Inc()
+			rec := httptest.NewRecorder()
+			r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+			So(rec.Body.String(), ShouldContainSubstring, "test_total 1")
+		})
+	})
+
+	Convey("Given a nil registry", t, func() {
+		var r *Registry
+
+		Convey("updates are discarded", func() {
+			So(func() { r.Counter("test_total", "help").Inc() }, ShouldNotPanic)
+			So(func() { r.Histogram("test_seconds", "help", DefBuckets).Observe(1) }, ShouldNotPanic)
+			_, ok := r.Value("test_total")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestExchange(t *testing.T) {
+	Convey("Given a sent and a received exchange", t, func() {
+		r := NewRegistry()
+		inner := v1.NewMessageExchange()
+		received := NewReceivedExchange(inner, r)
+		sent := NewSentExchange(received, r)
+		p := v1.NewProcess(0, v1.Acceptor)
+		So(sent.Register(p), ShouldBeNil)
+		src := v1.NewAddress(1, v1.Scout)
+
+		Convey("a message is counted by its type, source and destination", func() {
+			m := messages.NewPhase1aMessage(src, types.BallotNumber{Round: 1, LeaderID: src})
+			So(sent.Send(p.GetAddr(), m), ShouldBeNil)
+			v, _ := r.Value("paxos_messages_sent_total", "Phase1a", "Scout-1")
+			So(v, ShouldEqual, 1)
+			v, _ = r.Value("paxos_messages_received_total", "Phase1a", "Acceptor-0")
+			So(v, ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,319 @@
+package modelcheck
+
+// Exhaustive model checking of small clusters.
+//
+// The checker drives fresh Acceptors, Leaders and Replicas, and the Scouts & Commanders the
+// leaders spawn (see components.WithSpawnHook), one message at a time, and explores every order
+// in which the messages in flight can be delivered, lost or delivered twice. The components
+// cannot be copied, so every path is re-executed from the initial state; they are
+// deterministic, so a path always leads to the same state.
+//
+// States are hashed, and a state reached along several paths is explored only once. Deliveries
+// to different processes commute, and sleep sets (Godefroid, 1996) prune all but one of their
+// orders. Addresses are canonical, i.e. independent of the ids the components allocate, so that
+// states, and counterexamples, are the same across re-executions.
+
+import (
+	"crypto/sha256"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/trace"
+	"sort"
+)
+
+// Config - the cluster to check, and the bounds of the exploration
+type Config struct {
+	// Acceptor failures tolerated; the cluster has 2f+1 acceptors
+	Failures int
+
+	Leaders int
+
+	Replicas int
+
+	// Commands requested by a client, each sent to every replica
+	Commands int
+
+	// Messages which may be lost, and messages which may be delivered twice, along a path
+	Drops int
+
+	Duplicates int
+
+	// Acceptors, leaders & replicas which may crash along a path. The scouts & commanders of a
+	// crashed leader crash with it
+	Crashes int
+
+	// Paths are cut off after this many transitions; zero for no bound. Leaders preempt each
+	// other forever, so a bound is required with more than one leader
+	MaxDepth int
+
+	// The exploration stops once this many states were visited; zero for no bound
+	MaxStates int
+
+	// Behaviors of Byzantine processes, by canonical address (e.g. leader:0). The state kept
+	// by a behavior is not part of the hashed state
+	Byzantine map[v1.Addr]string
+}
+
+// DefaultConfig - f=1 with a single leader & replica and two commands, on a reliable network. Each
+// additional process or command multiplies the states, e.g. a second replica by more than ten
+func DefaultConfig() Config {
+	return Config{Failures: 1, Leaders: 1, Replicas: 1, Commands: 2}
+}
+
+func (cfg Config) validate() error {
+	if cfg.Failures < 0 || cfg.Leaders < 1 || cfg.Replicas < 1 || cfg.Commands < 0 {
+		return fmt.Errorf("expected at least one leader & replica, got %d leaders, %d replicas, %d failures & %d commands",
+			cfg.Leaders, cfg.Replicas, cfg.Failures, cfg.Commands)
+	}
+	if cfg.Drops < 0 || cfg.Duplicates < 0 || cfg.Crashes < 0 || cfg.MaxDepth < 0 || cfg.MaxStates < 0 {
+		return fmt.Errorf("bounds cannot be negative")
+	}
+	counts := map[v1.ProcessType]int{v1.Acceptor: 2*cfg.Failures + 1, v1.Leader: cfg.Leaders}
+	for addr, name := range cfg.Byzantine {
+		b, err := byzantine.New(name)
+		if err != nil {
+			return err
+		}
+		if addr.Type() != b.ProcessType() || int(addr.ID()) < 0 || int(addr.ID()) >= counts[addr.Type()] {
+			return fmt.Errorf("behavior %s cannot be assigned to %v", name, addr)
+		}
+	}
+	return nil
+}
+
+// Result - the outcome of a check
+type Result struct {
+	// Distinct states visited
+	States int
+
+	// Transitions executed, not counting re-executions
+	Transitions int
+
+	// false if a path was cut off by MaxDepth, or MaxStates was reached
+	Complete bool
+
+	// Invariants broken in the first violating state found, if any
+	Violations []invariant.Violation
+
+	// The registrations & deliveries leading to the violating state, in the format of a recorded
+	// run, so it can be replayed (package replay) or drawn (trace.Mermaid)
+	Counterexample []trace.Entry
+}
+
+// Check - explore the states of the cluster, until an invariant is violated or all of the
+// states within the bounds were visited
+func Check(cfg Config) (Result, error) {
+	if err := cfg.validate(); err != nil {
+		return Result{}, err
+	}
+	if cfg.Leaders > 1 && cfg.MaxDepth == 0 {
+		return Result{}, fmt.Errorf("%d leaders require a max depth", cfg.Leaders)
+	}
+	c := &checker{
+		cfg:      cfg,
+		visited:  make(map[[sha256.Size]byte]*visit),
+		childIDs: make(map[string]v1.ProcessID),
+		result:   Result{Complete: true},
+	}
+	ex, err := c.execute(nil)
+	if err != nil {
+		return Result{}, err
+	}
+	c.explore(nil, ex, make(map[Transition]bool))
+	return c.result, c.err
+}
+
+type action int
+
+const (
+	deliver action = iota
+	drop
+	duplicate
+	crash
+)
+
+var actionStrings = map[action]string{deliver: "deliver", drop: "drop", duplicate: "duplicate", crash: "crash"}
+
+func (a action) String() string {
+	return actionStrings[a]
+}
+
+// Transition - an action on a message in flight, or the crash of a process. Copies of a message
+// are indistinguishable
+type Transition struct {
+	action action
+
+	// canonical destination of the message, or the crashed process
+	dest v1.Addr
+
+	// key of the message, see envelope
+	message string
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%v %s", t.action, t.message)
+}
+
+// independent - true if the transitions commute, and neither disables the other. A delivery
+// changes the state of its destination only, and every message is delivered or lost once
+func independent(a Transition, b Transition) bool {
+	if a.action == crash || b.action == crash {
+		// a crash discards messages to the process & its children, and crashes share a bound
+		return false
+	}
+	if a.message == b.message {
+		return false
+	}
+	if a.action == drop || b.action == drop {
+		// drops share a bound, and change no process
+		return a.action != b.action
+	}
+	if a.action == duplicate && b.action == duplicate {
+		return false
+	}
+	return a.dest != b.dest
+}
+
+// visit - a visited state
+type visit struct {
+	// transitions not explored from the state, as they were explored along another order
+	sleep map[Transition]bool
+
+	// length of the shortest path the state was reached by
+	depth int
+}
+
+type checker struct {
+	cfg Config
+
+	visited map[[sha256.Size]byte]*visit
+
+	// canonical ids of the scouts & commanders by name, shared by all executions
+	childIDs map[string]v1.ProcessID
+
+	result Result
+
+	err error
+}
+
+// childAddr - the canonical address of the named scout or commander
+func (c *checker) childAddr(name string, pt v1.ProcessType) v1.Addr {
+	id, ok := c.childIDs[name]
+	if !ok {
+		id = v1.ProcessID(len(c.childIDs))
+		c.childIDs[name] = id
+	}
+	return v1.NewAddress(id, pt)
+}
+
+// execute - a fresh execution of the path
+func (c *checker) execute(path []Transition) (*execution, error) {
+	ex, err := newExecution(c)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range path {
+		if !ex.apply(t) {
+			return nil, fmt.Errorf("path is not reproducible, %v is not enabled", t)
+		}
+	}
+	return ex, nil
+}
+
+// explore - visit the states reachable from ex (the state at the end of path), and return
+// false once the exploration stops
+func (c *checker) explore(path []Transition, ex *execution, sleep map[Transition]bool) bool {
+	if len(ex.violations) > 0 {
+		c.result.Violations = ex.violations
+		c.result.Counterexample = ex.trace()
+		return false
+	}
+
+	enabled := ex.enabled()
+	h := ex.hash()
+	if v, ok := c.visited[h]; ok && v.depth <= len(path) {
+		// explore the transitions slept on at an earlier visit, which are not slept on now
+		todo := make([]Transition, 0)
+		for _, t := range enabled {
+			if v.sleep[t] && !sleep[t] {
+				todo = append(todo, t)
+			}
+		}
+		if len(todo) == 0 {
+			return true
+		}
+		for t := range v.sleep {
+			if !sleep[t] {
+				delete(v.sleep, t)
+			}
+		}
+		enabled = todo
+	} else {
+		if !ok {
+			if c.cfg.MaxStates > 0 && c.result.States >= c.cfg.MaxStates {
+				c.result.Complete = false
+				return false
+			}
+			c.result.States++
+		}
+		c.visited[h] = &visit{sleep: copyTransitions(sleep), depth: len(path)}
+	}
+
+	if c.cfg.MaxDepth > 0 && len(path) >= c.cfg.MaxDepth {
+		if len(enabled) > 0 {
+			c.result.Complete = false
+		}
+		return true
+	}
+
+	sleep = copyTransitions(sleep)
+	first := true
+	for _, t := range enabled {
+		if sleep[t] {
+			continue
+		}
+		next := ex
+		if !first {
+			// ex was advanced along the first transition
+			var err error
+			if next, err = c.execute(path); err != nil {
+				c.err = err
+				return false
+			}
+		}
+		first = false
+
+		next.apply(t)
+		c.result.Transitions++
+		childSleep := make(map[Transition]bool)
+		for s := range sleep {
+			if independent(s, t) {
+				childSleep[s] = true
+			}
+		}
+		if !c.explore(append(path[:len(path):len(path)], t), next, childSleep) {
+			return false
+		}
+		sleep[t] = true
+	}
+	return true
+}
+
+func copyTransitions(set map[Transition]bool) map[Transition]bool {
+	result := make(map[Transition]bool, len(set))
+	for t := range set {
+		result[t] = true
+	}
+	return result
+}
+
+func sortTransitions(ts []Transition) {
+	sort.Slice(ts, func(i, j int) bool {
+		if ts[i].message != ts[j].message {
+			return ts[i].message < ts[j].message
+		}
+		return ts[i].action < ts[j].action
+	})
+}
@@ -0,0 +1,134 @@
+package modelcheck
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/replay"
+	"github.com/1xyz/paxossim/v1/trace"
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func init() {
+	// replicas log every command they perform
+	log.SetLevel(log.WarnLevel)
+}
+
+func TestCheck(t *testing.T) {
+	Convey("Given a cluster tolerating one failure, with a leader, a replica and a command", t, func() {
+		cfg := Config{Failures: 1, Leaders: 1, Replicas: 1, Commands: 1}
+
+		Convey("every state is explored and no invariant is violated", func() {
+			result, err := Check(cfg)
+			So(err, ShouldBeNil)
+			So(result.Complete, ShouldBeTrue)
+			So(result.Violations, ShouldBeEmpty)
+			So(result.States, ShouldBeGreaterThan, 1)
+			So(result.Transitions, ShouldBeGreaterThanOrEqualTo, result.States-1)
+
+			Convey("and a lossy network reaches more states", func() {
+				cfg.Drops = 1
+				lossy, err := Check(cfg)
+				So(err, ShouldBeNil)
+				So(lossy.Complete, ShouldBeTrue)
+				So(lossy.Violations, ShouldBeEmpty)
+				So(lossy.States, ShouldBeGreaterThan, result.States)
+			})
+
+			Convey("and so does a crash of any process", func() {
+				cfg.Crashes = 1
+				crashing, err := Check(cfg)
+				So(err, ShouldBeNil)
+				So(crashing.Complete, ShouldBeTrue)
+				So(crashing.Violations, ShouldBeEmpty)
+				So(crashing.States, ShouldBeGreaterThan, result.States)
+			})
+		})
+
+		Convey("the exploration stops at the bound on states", func() {
+			cfg.MaxStates = 10
+			result, err := Check(cfg)
+			So(err, ShouldBeNil)
+			So(result.Complete, ShouldBeFalse)
+			So(result.States, ShouldEqual, 10)
+		})
+
+		Convey("leaders preempting each other are explored up to the max depth", func() {
+			cfg.Leaders = 2
+			_, err := Check(cfg)
+			So(err, ShouldNotBeNil)
+
+			cfg.MaxDepth = 8
+			result, err := Check(cfg)
+			So(err, ShouldBeNil)
+			So(result.Complete, ShouldBeFalse)
+			So(result.Violations, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestCheck_Counterexample(t *testing.T) {
+	Convey("Given a leader proposing conflicting commands", t, func() {
+		leader := v1.NewAddress(0, v1.Leader)
+		cfg := Config{Failures: 1, Leaders: 1, Replicas: 2, Commands: 1,
+			Byzantine: map[v1.Addr]string{leader: byzantine.ConflictingProposals}}
+
+		result, err := Check(cfg)
+		So(err, ShouldBeNil)
+
+		Convey("a violation is found", func() {
+			So(result.Violations, ShouldNotBeEmpty)
+		})
+
+		Convey("with the deliveries leading to it, as a trace of canonical addresses", func() {
+			So(result.Counterexample[0].Kind, ShouldEqual, trace.KindRegister)
+			So(result.Counterexample[0].Dest, ShouldResemble, trace.NewAddr(v1.NewAddress(0, v1.Acceptor)))
+			last := result.Counterexample[len(result.Counterexample)-1]
+			So(last.Kind, ShouldEqual, trace.KindDeliver)
+			So(last.Step, ShouldEqual, uint64(len(result.Counterexample)))
+		})
+
+		Convey("which can be replayed", func() {
+			r, err := replay.New(result.Counterexample)
+			So(err, ShouldBeNil)
+			defer r.Close()
+			So(r.Run(), ShouldBeNil)
+		})
+
+		Convey("the same counterexample is found every time", func() {
+			again, err := Check(cfg)
+			So(err, ShouldBeNil)
+			So(again.Counterexample, ShouldResemble, result.Counterexample)
+		})
+	})
+
+	Convey("A behavior must apply to the type of its process", t, func() {
+		cfg := DefaultConfig()
+		cfg.Byzantine = map[v1.Addr]string{v1.NewAddress(0, v1.Leader): byzantine.Equivocate}
+		_, err := Check(cfg)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestIndependent(t *testing.T) {
+	Convey("Given messages to two processes", t, func() {
+		a0, a1 := v1.NewAddress(0, v1.Acceptor), v1.NewAddress(1, v1.Acceptor)
+		m0 := Transition{action: deliver, dest: a0, message: "m0"}
+		m1 := Transition{action: deliver, dest: a1, message: "m1"}
+		m2 := Transition{action: deliver, dest: a0, message: "m2"}
+
+		Convey("deliveries to different processes commute", func() {
+			So(independent(m0, m1), ShouldBeTrue)
+			So(independent(m0, m2), ShouldBeFalse)
+		})
+
+		Convey("dropping a message conflicts with delivering it, and with other drops", func() {
+			d0 := Transition{action: drop, dest: a0, message: "m0"}
+			d2 := Transition{action: drop, dest: a0, message: "m2"}
+			So(independent(m0, d0), ShouldBeFalse)
+			So(independent(m0, d2), ShouldBeTrue)
+			So(independent(d0, d2), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,589 @@
+package modelcheck
+
+import (
+	"crypto/sha256"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/components"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/trace"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+	"strings"
+)
+
+// client - the canonical address of the client whose requests are in flight initially
+var client = v1.NewAddress(0, v1.Client)
+
+// envelope - a message in flight
+type envelope struct {
+	dest v1.Addr
+
+	m v1.Message
+
+	// the delivery, with canonical addresses
+	entry trace.Entry
+
+	// identifies the message: its canonical source, destination, type & payload
+	key string
+}
+
+// process - a process of the cluster, by canonical address
+type process struct {
+	handle func(m v1.Message) bool
+
+	// a scout or a commander; its state is the set of messages it handled, until it is done
+	child bool
+
+	handled []string
+
+	done bool
+}
+
+// execution - a cluster driven along a single path
+type execution struct {
+	checker *checker
+
+	acceptors []*components.Acceptor
+
+	leaders []*components.Leader
+
+	replicas []*components.Replica
+
+	// canonical address of every process, by its allocated address, and the other way around
+	canonical map[v1.Addr]v1.Addr
+
+	allocated map[v1.Addr]v1.Addr
+
+	processes map[v1.Addr]*process
+
+	// translate the addresses in a message to canonical ones, and back
+	toCanonical *trace.Decoder
+
+	toAllocated *trace.Decoder
+
+	// behaviors of the Byzantine processes, and the leader of every scout & commander
+	behaviors map[v1.Addr]byzantine.Behavior
+
+	owners map[v1.Addr]v1.Addr
+
+	inflight []envelope
+
+	drops int
+
+	duplicates int
+
+	crashes int
+
+	// the deliveries & crashes so far
+	delivered []trace.Entry
+
+	// C1: the command of the commander spawned for every ballot & slot
+	commanders map[string]types.Command
+
+	violations []invariant.Violation
+
+	// every execution allocates the ids of its processes afresh
+	ids *v1.IDAllocator
+}
+
+func newExecution(c *checker) (*execution, error) {
+	ex := &execution{
+		checker:    c,
+		canonical:  make(map[v1.Addr]v1.Addr),
+		allocated:  make(map[v1.Addr]v1.Addr),
+		processes:  make(map[v1.Addr]*process),
+		behaviors:  make(map[v1.Addr]byzantine.Behavior),
+		owners:     make(map[v1.Addr]v1.Addr),
+		commanders: make(map[string]types.Command),
+		ids:        v1.NewIDAllocator(),
+	}
+	ex.toCanonical = trace.NewDecoder(ex.canonicalOf)
+	ex.toAllocated = trace.NewDecoder(ex.allocatedOf)
+	exchange := newBroadcaster(ex)
+
+	acceptors := make([]v1.Addr, 0)
+	for i := 0; i < 2*c.cfg.Failures+1; i++ {
+		a := components.NewAcceptor(exchange)
+		ex.acceptors = append(ex.acceptors, a)
+		ex.bind(a, i, func(m v1.Message) bool {
+			a.Handle(m)
+			return true
+		})
+		acceptors = append(acceptors, a.GetAddr())
+	}
+	leaders := make([]v1.Addr, 0)
+	for i := 0; i < c.cfg.Leaders; i++ {
+		l := components.NewLeader(exchange, acceptors, components.WithSpawnHook(ex.spawn))
+		ex.leaders = append(ex.leaders, l)
+		ex.bind(l, i, func(m v1.Message) bool {
+			l.Handle(m)
+			return true
+		})
+		leaders = append(leaders, l.GetAddr())
+	}
+	for i := 0; i < c.cfg.Replicas; i++ {
+		r := components.NewReplica(exchange, leaders)
+		ex.replicas = append(ex.replicas, r)
+		ex.bind(r, i, func(m v1.Message) bool {
+			r.Handle(m)
+			return true
+		})
+	}
+
+	for addr, name := range c.cfg.Byzantine {
+		b, err := byzantine.New(name)
+		if err != nil {
+			return nil, err
+		}
+		ex.behaviors[key(addr)] = b
+	}
+
+	for i := 1; i <= c.cfg.Commands; i++ {
+		command := types.BasicCommand{ClientID: fmt.Sprintf("%v", client), CommandID: fmt.Sprintf("%d", i), Op: "OP"}
+		for _, r := range ex.replicas {
+			if err := ex.Send(r.GetAddr(), messages.NewRequestMessage(client, command)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, l := range ex.leaders {
+		l.Start()
+	}
+	return ex, nil
+}
+
+// bind - the process is the i-th of its type
+func (ex *execution) bind(p v1.Addr, i int, handle func(m v1.Message) bool) {
+	addr := v1.NewAddress(v1.ProcessID(i), p.Type())
+	ex.canonical[key(p)] = addr
+	ex.allocated[addr] = key(p)
+	ex.processes[addr] = &process{handle: handle}
+}
+
+// spawn - start a scout or a commander spawned by a leader. Its canonical address is named
+// after its leader and ballot, and its slot
+func (ex *execution) spawn(c components.Child) {
+	owner := ex.canonicalOf(c.Owner())
+	var name string
+	switch v := c.(type) {
+	case *components.Scout:
+		name = fmt.Sprintf("scout of %v in round %d", owner, v.Snapshot().BallotNumber.Round)
+	case *components.Commander:
+		pv := v.Snapshot().PValue
+		name = fmt.Sprintf("commander of %v in round %d for slot %d", owner, pv.BN.Round, pv.Slot)
+		if command, ok := ex.commanders[name]; ok && command != pv.Command {
+			ex.violations = append(ex.violations, invariant.Violation{
+				Invariant: "C1",
+				Message: fmt.Sprintf("ballot %s slot %v has commanders for [%v] and [%v]",
+					ex.ballot(pv.BN), pv.Slot, command, pv.Command),
+			})
+		}
+		ex.commanders[name] = pv.Command
+	}
+	addr := ex.checker.childAddr(name, c.Type())
+	for n := 2; ex.processes[addr] != nil; n++ {
+		// spawned again, e.g. by a duplicated message
+		addr = ex.checker.childAddr(fmt.Sprintf("%s (%d)", name, n), c.Type())
+	}
+	ex.canonical[key(c)] = addr
+	ex.allocated[addr] = key(c)
+	ex.owners[addr] = owner
+	ex.processes[addr] = &process{handle: c.Handle, child: true}
+	c.Start()
+}
+
+func (ex *execution) canonicalOf(addr v1.Addr) v1.Addr {
+	if c, ok := ex.canonical[key(addr)]; ok {
+		return c
+	}
+	return key(addr)
+}
+
+func (ex *execution) allocatedOf(addr v1.Addr) v1.Addr {
+	if a, ok := ex.allocated[key(addr)]; ok {
+		return a
+	}
+	return key(addr)
+}
+
+// translate - the message with its addresses translated by the decoder
+func translate(decoder *trace.Decoder, m v1.Message) (v1.Message, error) {
+	name, data, err := trace.Encode(m)
+	if err != nil {
+		return nil, err
+	}
+	src := trace.NewAddr(m.Src())
+	return decoder.Decode(trace.Entry{Kind: trace.KindDeliver, Src: &src, Type: name, Payload: data})
+}
+
+// tamper - the message delivered in place of m (with canonical addresses), which is tampered with
+// if sent by a Byzantine process or one of its scouts & commanders. The behaviors see canonical
+// addresses only, so they deviate the same way in every execution
+func (ex *execution) tamper(dest v1.Addr, m v1.Message) v1.Message {
+	if b, ok := ex.behaviors[ex.ownerOf(m.Src())]; ok {
+		m = b.Tamper(dest, m)
+	}
+	if b, ok := ex.behaviors[ex.ownerOf(dest)]; ok {
+		b.Observe(m)
+	}
+	return m
+}
+
+// ownerOf - the leader of a scout or a commander, or the (canonical) address itself
+func (ex *execution) ownerOf(addr v1.Addr) v1.Addr {
+	if owner, ok := ex.owners[key(addr)]; ok {
+		return owner
+	}
+	return key(addr)
+}
+
+// Send - the message is in flight, unless it is addressed to a client or a finished process
+func (ex *execution) Send(dest v1.Addr, m v1.Message) error {
+	addr := ex.canonicalOf(dest)
+	if p, ok := ex.processes[addr]; !ok || p.done {
+		return nil
+	}
+	canonical, err := translate(ex.toCanonical, m)
+	if err != nil {
+		return err
+	}
+	if len(ex.behaviors) > 0 {
+		canonical = ex.tamper(addr, canonical)
+		if m, err = translate(ex.toAllocated, canonical); err != nil {
+			return err
+		}
+	}
+	name, data, err := trace.Encode(canonical)
+	if err != nil {
+		return err
+	}
+	src := trace.NewAddr(canonical.Src())
+	e := trace.Entry{Kind: trace.KindDeliver, Src: &src, Dest: trace.NewAddr(addr), Type: name, Payload: data}
+	ex.inflight = append(ex.inflight, envelope{
+		dest:  addr,
+		m:     m,
+		entry: e,
+		key:   fmt.Sprintf("%v -> %v %s %s", e.Src, e.Dest, e.Type, e.Payload),
+	})
+	return nil
+}
+
+// SendAll - not used, broadcasts are expanded by the broadcaster
+func (ex *execution) SendAll(pt v1.ProcessType, m v1.Message) error {
+	return fmt.Errorf("unexpected broadcast of %T", m)
+}
+
+func (ex *execution) IDs() *v1.IDAllocator {
+	return ex.ids
+}
+
+func (ex *execution) Register(p v1.ProcessInbox) error {
+	return nil
+}
+
+func (ex *execution) UnRegister(p v1.ProcessInbox) error {
+	return nil
+}
+
+// enabled - the transitions of the messages in flight and the crashes, within the bounds on
+// drops, duplicates & crashes
+func (ex *execution) enabled() []Transition {
+	result := make([]Transition, 0, len(ex.inflight))
+	seen := make(map[string]bool)
+	for _, e := range ex.inflight {
+		if seen[e.key] {
+			continue
+		}
+		seen[e.key] = true
+		result = append(result, Transition{action: deliver, dest: e.dest, message: e.key})
+		if ex.drops < ex.checker.cfg.Drops {
+			result = append(result, Transition{action: drop, dest: e.dest, message: e.key})
+		}
+		if ex.duplicates < ex.checker.cfg.Duplicates {
+			result = append(result, Transition{action: duplicate, dest: e.dest, message: e.key})
+		}
+	}
+	if ex.crashes < ex.checker.cfg.Crashes {
+		for addr, p := range ex.processes {
+			if !p.child && !p.done {
+				result = append(result, Transition{action: crash, dest: addr, message: fmt.Sprintf("crash %v", addr)})
+			}
+		}
+	}
+	sortTransitions(result)
+	return result
+}
+
+// apply - take the transition, returns false if it is not enabled
+func (ex *execution) apply(t Transition) bool {
+	if t.action == crash {
+		return ex.crash(t.dest)
+	}
+	i := 0
+	for i < len(ex.inflight) && ex.inflight[i].key != t.message {
+		i++
+	}
+	if i == len(ex.inflight) {
+		return false
+	}
+	e := ex.inflight[i]
+	switch t.action {
+	case drop:
+		ex.drops++
+		ex.inflight = append(ex.inflight[:i:i], ex.inflight[i+1:]...)
+		return true
+	case duplicate:
+		// a copy stays in flight
+		ex.duplicates++
+	default:
+		ex.inflight = append(ex.inflight[:i:i], ex.inflight[i+1:]...)
+	}
+
+	ex.delivered = append(ex.delivered, e.entry)
+	before := ex.observe()
+	p := ex.processes[e.dest]
+	if p.child {
+		p.handled = append(p.handled, e.key)
+	}
+	if !p.handle(e.m) {
+		p.done = true
+		ex.discard()
+	}
+	ex.check(before)
+	return true
+}
+
+// crash - the process, and its scouts & commanders if it is a leader, handle no more messages
+func (ex *execution) crash(addr v1.Addr) bool {
+	p, ok := ex.processes[addr]
+	if !ok || p.child || p.done || ex.crashes >= ex.checker.cfg.Crashes {
+		return false
+	}
+	ex.crashes++
+	p.done = true
+	for child, owner := range ex.owners {
+		if owner == addr {
+			ex.processes[child].done = true
+		}
+	}
+	ex.discard()
+	ex.delivered = append(ex.delivered, trace.Entry{Kind: trace.KindUnRegister, Dest: trace.NewAddr(addr)})
+	return true
+}
+
+// discard - the messages in flight to finished processes
+func (ex *execution) discard() {
+	inflight := ex.inflight[:0]
+	for _, e := range ex.inflight {
+		if !ex.processes[e.dest].done {
+			inflight = append(inflight, e)
+		}
+	}
+	ex.inflight = inflight
+}
+
+// observation - the state which may only grow, see check
+type observation struct {
+	ballots []*types.BallotNumber
+
+	slotOuts []types.Slot
+}
+
+func (ex *execution) observe() observation {
+	o := observation{}
+	for _, a := range ex.acceptors {
+		o.ballots = append(o.ballots, a.Snapshot().BallotNumber)
+	}
+	for _, r := range ex.replicas {
+		o.slotOuts = append(o.slotOuts, r.Snapshot().SlotOut)
+	}
+	return o
+}
+
+// check - record the invariants broken by the last transition, or in the state it led to
+func (ex *execution) check(before observation) {
+	after := ex.observe()
+	for i, bn := range after.ballots {
+		if prev := before.ballots[i]; prev != nil && (bn == nil || types.Compare(bn, prev) < 0) {
+			ex.violations = append(ex.violations, invariant.Violation{
+				Invariant: "A1",
+				Message:   fmt.Sprintf("acceptor:%d went from ballot %s to %v", i, ex.ballot(*prev), after.ballots[i]),
+			})
+		}
+	}
+	for i, slot := range after.slotOuts {
+		if slot < before.slotOuts[i] {
+			ex.violations = append(ex.violations, invariant.Violation{
+				Invariant: "R4",
+				Message:   fmt.Sprintf("replica:%d slot_out went from %v to %v", i, before.slotOuts[i], slot),
+			})
+		}
+	}
+
+	decisions := make([]invariant.DecisionLog, 0, len(ex.replicas))
+	for i, r := range ex.replicas {
+		decisions = append(decisions, invariant.DecisionLog{
+			Replica:   v1.NewAddress(v1.ProcessID(i), v1.Replica),
+			Decisions: r.Decisions(),
+		})
+	}
+	ex.violations = append(ex.violations, invariant.CheckDecisions(decisions)...)
+
+	accepted := make([]invariant.AcceptedLog, 0, len(ex.acceptors))
+	for i, a := range ex.acceptors {
+		pvalues := make(types.PValues)
+		for pv := range a.Accepted {
+			pv.BN.LeaderID = ex.canonicalOf(pv.BN.LeaderID)
+			pvalues.Set(pv)
+		}
+		accepted = append(accepted, invariant.AcceptedLog{
+			Acceptor: v1.NewAddress(v1.ProcessID(i), v1.Acceptor),
+			Accepted: pvalues,
+		})
+	}
+	ex.violations = append(ex.violations, invariant.CheckAccepted(accepted)...)
+}
+
+// hash - the state of every process, and the messages in flight. Copies of a message are
+// counted, but the order of the messages is not part of the state
+func (ex *execution) hash() [sha256.Size]byte {
+	lines := make([]string, 0)
+	for i, a := range ex.acceptors {
+		snap := a.Snapshot()
+		if snap.BallotNumber == nil {
+			lines = append(lines, fmt.Sprintf("acceptor:%d", i))
+			continue
+		}
+		pvalues := make([]string, 0, len(a.Accepted))
+		for pv := range a.Accepted {
+			pvalues = append(pvalues, ex.pvalue(pv))
+		}
+		sort.Strings(pvalues)
+		lines = append(lines, fmt.Sprintf("acceptor:%d %s %v", i, ex.ballot(*snap.BallotNumber), pvalues))
+	}
+	for i, l := range ex.leaders {
+		snap := l.Snapshot()
+		lines = append(lines, fmt.Sprintf("leader:%d %s %v %s",
+			i, ex.ballot(snap.BallotNumber), snap.Active, slotCommands(snap.Commands)))
+	}
+	for i, r := range ex.replicas {
+		snap := r.Snapshot()
+		lines = append(lines, fmt.Sprintf("replica:%d %v %v %v %s %s", i, snap.SlotIn, snap.SlotOut,
+			snap.Pending, slotCommands(snap.Proposals), slotCommands(snap.Decisions)))
+	}
+	children := make([]string, 0)
+	for addr, p := range ex.processes {
+		if !p.child {
+			if p.done {
+				children = append(children, fmt.Sprintf("%v crashed", addr))
+			}
+			continue
+		}
+		if p.done {
+			children = append(children, fmt.Sprintf("%v done", addr))
+			continue
+		}
+		handled := append([]string{}, p.handled...)
+		sort.Strings(handled)
+		children = append(children, fmt.Sprintf("%v %v", addr, handled))
+	}
+	sort.Strings(children)
+	inflight := make([]string, 0, len(ex.inflight))
+	for _, e := range ex.inflight {
+		inflight = append(inflight, e.key)
+	}
+	sort.Strings(inflight)
+
+	lines = append(lines, children...)
+	lines = append(lines, inflight...)
+	lines = append(lines, fmt.Sprintf("drops %d duplicates %d crashes %d", ex.drops, ex.duplicates, ex.crashes))
+	return sha256.Sum256([]byte(strings.Join(lines, "\n")))
+}
+
+func (ex *execution) ballot(bn types.BallotNumber) string {
+	return fmt.Sprintf("<%d, %v>", bn.Round, ex.canonicalOf(bn.LeaderID))
+}
+
+func (ex *execution) pvalue(pv types.PValue) string {
+	return fmt.Sprintf("<%s, %v, %v>", ex.ballot(pv.BN), pv.Slot, pv.Command)
+}
+
+// trace - the registrations of the acceptors, leaders & replicas and the configuration of the
+// cluster, followed by the deliveries and the crashes (as unregistrations)
+func (ex *execution) trace() []trace.Entry {
+	result := make([]trace.Entry, 0)
+	counts := map[v1.ProcessType]int{v1.Acceptor: len(ex.acceptors), v1.Leader: len(ex.leaders), v1.Replica: len(ex.replicas)}
+	addrs := make(map[v1.ProcessType][]trace.Addr)
+	for _, pt := range []v1.ProcessType{v1.Acceptor, v1.Leader, v1.Replica} {
+		for i := 0; i < counts[pt]; i++ {
+			addr := trace.NewAddr(v1.NewAddress(v1.ProcessID(i), pt))
+			addrs[pt] = append(addrs[pt], addr)
+			result = append(result, trace.Entry{Kind: trace.KindRegister, Dest: addr})
+		}
+	}
+	// a single group of classic Paxos with majority quorums
+	cluster, err := trace.Cluster{Groups: []trace.Group{{
+		Acceptors: addrs[v1.Acceptor],
+		Leaders:   addrs[v1.Leader],
+		Replicas:  addrs[v1.Replica],
+	}}}.Entry()
+	if err != nil {
+		panic(fmt.Sprintf("trace.Cluster: %v", err))
+	}
+	result = append(result, cluster)
+	result = append(result, ex.delivered...)
+	for i := range result {
+		result[i].Step = uint64(i + 1)
+	}
+	return result
+}
+
+func slotCommands(m types.SlotCommandMap) string {
+	slots := make([]types.Slot, 0, len(m))
+	for slot := range m {
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i] < slots[j] })
+	var sb strings.Builder
+	for _, slot := range slots {
+		fmt.Fprintf(&sb, "%v:%v ", slot, m[slot])
+	}
+	return sb.String()
+}
+
+// key - addresses are compared by value
+func key(addr v1.Addr) v1.Addr {
+	return v1.NewAddress(addr.ID(), addr.Type())
+}
+
+// broadcaster - expands a broadcast to a Send to every registered process of the type, so that
+// each copy can be tampered with and delivered on its own
+type broadcaster struct {
+	v1.MessageExchange
+
+	inboxes map[v1.ProcessType][]v1.Addr
+}
+
+func newBroadcaster(inner v1.MessageExchange) *broadcaster {
+	return &broadcaster{MessageExchange: inner, inboxes: make(map[v1.ProcessType][]v1.Addr)}
+}
+
+func (b *broadcaster) SendAll(pt v1.ProcessType, m v1.Message) error {
+	for _, addr := range b.inboxes[pt] {
+		if err := b.MessageExchange.Send(addr, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *broadcaster) Register(p v1.ProcessInbox) error {
+	if err := b.MessageExchange.Register(p); err != nil {
+		return err
+	}
+	b.inboxes[p.Type()] = append(b.inboxes[p.Type()], p)
+	return nil
+}
@@ -0,0 +1,69 @@
+package modelcheck
+
+import (
+	"crypto/sha256"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/trace"
+)
+
+// Simulation - a single path through the states of a cluster, driven one transition at a time,
+// e.g. by a random walk. Like the paths of Check, a simulation is deterministic: the same
+// transitions, applied to a simulation of the same config, lead to the same state
+type Simulation struct {
+	ex *execution
+}
+
+// NewSimulation - the cluster of the config in its initial state. MaxDepth & MaxStates are not
+// enforced; the caller decides how far to go
+func NewSimulation(cfg Config) (*Simulation, error) {
+	return newSimulation(cfg, make(map[string]v1.ProcessID))
+}
+
+// Rerun - a fresh simulation of the config, which names the scouts & commanders like s does.
+// The canonical address of a child depends on the order children are first spawned in, so the
+// transitions of s, e.g. a schedule shrunk by deleting some of them, are replayed on a rerun
+func (s *Simulation) Rerun(cfg Config) (*Simulation, error) {
+	return newSimulation(cfg, s.ex.checker.childIDs)
+}
+
+func newSimulation(cfg Config, childIDs map[string]v1.ProcessID) (*Simulation, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	c := &checker{
+		cfg:      cfg,
+		visited:  make(map[[sha256.Size]byte]*visit),
+		childIDs: childIDs,
+	}
+	ex, err := newExecution(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Simulation{ex: ex}, nil
+}
+
+// Enabled - the transitions which can be taken next, in a stable order
+func (s *Simulation) Enabled() []Transition {
+	return s.ex.enabled()
+}
+
+// Apply - take the transition, returns false if it is not enabled
+func (s *Simulation) Apply(t Transition) bool {
+	return s.ex.apply(t)
+}
+
+// Violations - the invariants broken along the path so far
+func (s *Simulation) Violations() []invariant.Violation {
+	return s.ex.violations
+}
+
+// Trace - the path so far, in the format of a recorded run (see Result.Counterexample)
+func (s *Simulation) Trace() []trace.Entry {
+	return s.ex.trace()
+}
+
+// Action - deliver, drop, duplicate or crash
+func (t Transition) Action() string {
+	return t.action.String()
+}
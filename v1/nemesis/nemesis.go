@@ -0,0 +1,334 @@
+package nemesis
+
+// Nemeses inject faults into a running Env, Jepsen style.
+//
+// A Nemesis is started and later stopped by a schedule of Faults (see Run); stopping heals what
+// starting broke. Nemeses compose: the nemesis of Compose starts, and stops, all of its parts.
+// The run is judged by a Report, which combines the nemesis timeline with the linearizability
+// of the client history and the safety invariants of the decisions.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Names of the nemeses
+const (
+	// crash an active leader (a random leader if none is active, a random node in protocols
+	// without leaders), and restart it
+	KillLeader = "kill_leader"
+
+	// split the cluster into a majority and a minority, and heal the partition
+	Partition = "partition"
+
+	// jump the clock of a random leader or replica (or node) ahead and run it fast, and set it back
+	ClockSkew = "clock_skew"
+
+	// slow down a random acceptor (a random node in protocols without acceptors), and restore it
+	SlowAcceptor = "slow_acceptor"
+
+	// flood a random replica with requests
+	Flood = "flood"
+)
+
+// Defaults of the nemeses constructed by New
+const (
+	DefaultSkew = 200 * time.Millisecond
+
+	DefaultSkewRate = 2.0
+
+	DefaultSlowdown = 100 * time.Millisecond
+
+	DefaultFloodSize = 200
+)
+
+// Nemesis - a fault injected into a running Env, and healed
+type Nemesis interface {
+	// One of the names above, or the names of the parts of a composed nemesis
+	Name() string
+
+	// Start - inject the fault, returns what was done
+	Start(e *env.Env, rnd *rand.Rand) (string, error)
+
+	// Stop - heal the fault injected by the last Start, returns what was done
+	Stop(e *env.Env) (string, error)
+}
+
+// New - the named nemesis, with the defaults above
+func New(name string) (Nemesis, error) {
+	switch name {
+	case KillLeader:
+		return &killLeader{}, nil
+	case Partition:
+		return &partition{}, nil
+	case ClockSkew:
+		return &clockSkew{skew: DefaultSkew, rate: DefaultSkewRate}, nil
+	case SlowAcceptor:
+		return &slowAcceptor{slowdown: DefaultSlowdown}, nil
+	case Flood:
+		return &flood{size: DefaultFloodSize}, nil
+	}
+	return nil, fmt.Errorf("unknown nemesis %q, expected one of %v", name, Names())
+}
+
+// Names - the names of all nemeses, sorted
+func Names() []string {
+	result := []string{KillLeader, Partition, ClockSkew, SlowAcceptor, Flood}
+	sort.Strings(result)
+	return result
+}
+
+// Parse - the composition of the comma separated nemeses
+func Parse(s string) (Nemesis, error) {
+	parts := make([]Nemesis, 0)
+	for _, name := range strings.Split(s, ",") {
+		n, err := New(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, n)
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return Compose(parts...), nil
+}
+
+// Compose - a nemesis which starts all of the parts, in order, and stops them in reverse order
+func Compose(parts ...Nemesis) Nemesis {
+	return composed(parts)
+}
+
+type composed []Nemesis
+
+func (c composed) Name() string {
+	names := make([]string, len(c))
+	for i, n := range c {
+		names[i] = n.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (c composed) Start(e *env.Env, rnd *rand.Rand) (string, error) {
+	done := make([]string, 0, len(c))
+	for _, n := range c {
+		s, err := n.Start(e, rnd)
+		if err != nil {
+			return strings.Join(done, "; "), err
+		}
+		if s != "" {
+			done = append(done, s)
+		}
+	}
+	return strings.Join(done, "; "), nil
+}
+
+func (c composed) Stop(e *env.Env) (string, error) {
+	done := make([]string, 0, len(c))
+	for i := len(c) - 1; i >= 0; i-- {
+		s, err := c[i].Stop(e)
+		if err != nil {
+			return strings.Join(done, "; "), err
+		}
+		if s != "" {
+			done = append(done, s)
+		}
+	}
+	return strings.Join(done, "; "), nil
+}
+
+// pick - a random one of the addresses, nil if there are none
+func pick(rnd *rand.Rand, addrs []v1.Addr) v1.Addr {
+	if len(addrs) == 0 {
+		return nil
+	}
+	return addrs[rnd.Intn(len(addrs))]
+}
+
+// orNodes - the addresses, or the nodes of a protocol without leaders & acceptors
+func orNodes(e *env.Env, addrs []v1.Addr) []v1.Addr {
+	if len(addrs) == 0 {
+		return e.Addrs(v1.Replica)
+	}
+	return addrs
+}
+
+type killLeader struct {
+	killed v1.Addr
+}
+
+func (k *killLeader) Name() string {
+	return KillLeader
+}
+
+func (k *killLeader) Start(e *env.Env, rnd *rand.Rand) (string, error) {
+	status := e.Status()
+	leaders := orNodes(e, e.Addrs(v1.Leader))
+	active := make([]v1.Addr, 0)
+	for i, l := range status.Leaders {
+		if l.Active && !status.IsCrashed(leaders[i]) {
+			active = append(active, leaders[i])
+		}
+	}
+	if len(active) == 0 {
+		active = leaders
+	}
+	k.killed = pick(rnd, active)
+	if k.killed == nil {
+		return "", fmt.Errorf("not-found: no leader to kill")
+	}
+	e.Network().Crash(k.killed)
+	return fmt.Sprintf("crashed %v", k.killed), nil
+}
+
+func (k *killLeader) Stop(e *env.Env) (string, error) {
+	if k.killed == nil {
+		return "", nil
+	}
+	e.Network().Restart(k.killed)
+	defer func() { k.killed = nil }()
+	return fmt.Sprintf("restarted %v", k.killed), nil
+}
+
+type partition struct{}
+
+func (p *partition) Name() string {
+	return Partition
+}
+
+// Start - a random majority of the acceptors (or nodes) on one side, the rest on the other; the
+// leaders & replicas are spread randomly. Clients reach both sides
+func (p *partition) Start(e *env.Env, rnd *rand.Rand) (string, error) {
+	voters := append([]v1.Addr{}, orNodes(e, e.Addrs(v1.Acceptor))...)
+	rnd.Shuffle(len(voters), func(i, j int) { voters[i], voters[j] = voters[j], voters[i] })
+	majority := len(voters)/2 + 1
+	groups := [][]v1.Addr{append([]v1.Addr{}, voters[:majority]...), append([]v1.Addr{}, voters[majority:]...)}
+	if len(e.Addrs(v1.Acceptor)) > 0 {
+		for _, pt := range []v1.ProcessType{v1.Leader, v1.Replica} {
+			for _, addr := range e.Addrs(pt) {
+				i := rnd.Intn(2)
+				groups[i] = append(groups[i], addr)
+			}
+		}
+	}
+	e.Network().Partition(groups...)
+	return fmt.Sprintf("partitioned %v | %v", groups[0], groups[1]), nil
+}
+
+func (p *partition) Stop(e *env.Env) (string, error) {
+	e.Network().Heal()
+	return "healed", nil
+}
+
+// clockSkew - the clock of a process reads skew ahead of its peers' and runs rate times as fast, so
+// that e.g. its timeouts fire early. The acceptors do not read the time, and are left alone
+type clockSkew struct {
+	skew time.Duration
+
+	rate float64
+
+	skewed v1.Addr
+}
+
+func (c *clockSkew) Name() string {
+	return ClockSkew
+}
+
+func (c *clockSkew) Start(e *env.Env, rnd *rand.Rand) (string, error) {
+	processes := make([]v1.Addr, 0)
+	for _, pt := range []v1.ProcessType{v1.Leader, v1.Replica} {
+		processes = append(processes, e.Addrs(pt)...)
+	}
+	skewed := pick(rnd, processes)
+	if skewed == nil {
+		return "", fmt.Errorf("not-found: no process to skew")
+	}
+	if err := e.SkewClock(skewed, c.skew, c.rate); err != nil {
+		return "", err
+	}
+	c.skewed = skewed
+	return fmt.Sprintf("clock of %v jumped %v ahead, running %vx", c.skewed, c.skew, c.rate), nil
+}
+
+func (c *clockSkew) Stop(e *env.Env) (string, error) {
+	if c.skewed == nil {
+		return "", nil
+	}
+	defer func() { c.skewed = nil }()
+	if err := e.SkewClock(c.skewed, 0, 1); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("clock of %v set back", c.skewed), nil
+}
+
+type slowAcceptor struct {
+	slowdown time.Duration
+
+	slowed v1.Addr
+}
+
+func (s *slowAcceptor) Name() string {
+	return SlowAcceptor
+}
+
+func (s *slowAcceptor) Start(e *env.Env, rnd *rand.Rand) (string, error) {
+	s.slowed = pick(rnd, orNodes(e, e.Addrs(v1.Acceptor)))
+	if s.slowed == nil {
+		return "", fmt.Errorf("not-found: no acceptor to slow down")
+	}
+	e.Network().Slow(s.slowed, s.slowdown)
+	return fmt.Sprintf("slowed %v by %v", s.slowed, s.slowdown), nil
+}
+
+func (s *slowAcceptor) Stop(e *env.Env) (string, error) {
+	if s.slowed == nil {
+		return "", nil
+	}
+	e.Network().Slow(s.slowed, 0)
+	defer func() { s.slowed = nil }()
+	return fmt.Sprintf("restored %v", s.slowed), nil
+}
+
+// floodClient - the source of the flooded requests, which no client of an Env uses
+var floodClient = v1.NewAddress(v1.ProcessID(-2), v1.Client)
+
+type flood struct {
+	size int
+
+	// requests sent so far, numbering the commands
+	sent int
+}
+
+func (f *flood) Name() string {
+	return Flood
+}
+
+func (f *flood) Start(e *env.Env, rnd *rand.Rand) (string, error) {
+	dest := pick(rnd, e.Addrs(v1.Replica))
+	if dest == nil {
+		return "", fmt.Errorf("not-found: no replica to flood")
+	}
+	for i := 0; i < f.size; i++ {
+		f.sent++
+		command := types.BasicCommand{
+			ClientID:  fmt.Sprintf("%v", floodClient),
+			CommandID: fmt.Sprintf("flood-%d", f.sent),
+			Op:        "OP",
+		}
+		if err := e.Network().Send(dest, messages.NewRequestMessage(floodClient, command)); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("flooded %v with %d requests", dest, f.size), nil
+}
+
+func (f *flood) Stop(e *env.Env) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,127 @@
+package nemesis
+
+import (
+	"bytes"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/env"
+	log "github.com/sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func init() {
+	// replicas log every command they perform
+	log.SetLevel(log.WarnLevel)
+}
+
+func TestParse(t *testing.T) {
+	Convey("Given comma separated nemeses", t, func() {
+		Convey("a single one is not composed", func() {
+			n, err := Parse(KillLeader)
+			So(err, ShouldBeNil)
+			So(n.Name(), ShouldEqual, KillLeader)
+		})
+
+		Convey("several are composed in order", func() {
+			n, err := Parse("partition, clock_skew")
+			So(err, ShouldBeNil)
+			So(n.Name(), ShouldEqual, "partition+clock_skew")
+		})
+
+		Convey("an unknown one is an error", func() {
+			_, err := Parse("partition,meteor")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A nemesis alternates between started and stopped", t, func() {
+		n, _ := New(Flood)
+		faults := Alternate(n, time.Second, 5*time.Second)
+		So(faults, ShouldHaveLength, 2)
+		So(faults[1].At, ShouldEqual, 3*time.Second)
+		So(faults[1].For, ShouldEqual, time.Second)
+	})
+}
+
+func TestNemeses(t *testing.T) {
+	Convey("Given a running cluster", t, func() {
+		e := env.NewEnvWithConfig(env.Config{NFailures: 1, NClients: 1, ClientReqInterval: 5 * time.Millisecond})
+		e.Run()
+		defer e.Stop()
+		rnd := rand.New(rand.NewSource(1))
+
+		Convey("a partition splits the acceptors into a majority and a minority, until it is healed", func() {
+			n, _ := New(Partition)
+			_, err := n.Start(e, rnd)
+			So(err, ShouldBeNil)
+			reachable := 0
+			acceptors := e.Addrs(v1.Acceptor)
+			for _, a := range acceptors[1:] {
+				if e.Network().Reachable(acceptors[0], a) {
+					reachable++
+				}
+			}
+			So(reachable, ShouldBeLessThan, 2)
+			_, err = n.Stop(e)
+			So(err, ShouldBeNil)
+			So(e.Network().Reachable(acceptors[0], acceptors[1]), ShouldBeTrue)
+		})
+
+		Convey("a skewed clock runs ahead of the Env's clock, until it is set back", func() {
+			n, _ := New(ClockSkew)
+			detail, err := n.Start(e, rnd)
+			So(err, ShouldBeNil)
+			skewed := n.(*clockSkew).skewed
+			So(skewed.Type(), ShouldBeIn, []v1.ProcessType{v1.Leader, v1.Replica})
+			So(detail, ShouldContainSubstring, "ahead")
+			offset, err := e.ClockOffset(skewed)
+			So(err, ShouldBeNil)
+			So(offset, ShouldBeGreaterThanOrEqualTo, DefaultSkew)
+			_, err = n.Stop(e)
+			So(err, ShouldBeNil)
+			offset, _ = e.ClockOffset(skewed)
+			So(offset, ShouldEqual, 0)
+		})
+
+		Convey("a killed leader is crashed, until it is restarted", func() {
+			n, _ := New(KillLeader)
+			detail, err := n.Start(e, rnd)
+			So(err, ShouldBeNil)
+			So(detail, ShouldStartWith, "crashed")
+			So(e.Status().Crashed, ShouldHaveLength, 1)
+			So(e.Status().Crashed[0].Type(), ShouldEqual, v1.Leader)
+			_, err = n.Stop(e)
+			So(err, ShouldBeNil)
+			So(e.Status().Crashed, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestTest(t *testing.T) {
+	Convey("Given a cluster run under composed nemeses", t, func() {
+		n, err := Parse("kill_leader,partition,clock_skew,slow_acceptor,flood")
+		So(err, ShouldBeNil)
+		cfg := env.Config{NFailures: 1, NClients: 2, ClientReqInterval: 5 * time.Millisecond, Keys: 4}
+		report := Test(cfg, []Fault{{At: 100 * time.Millisecond, For: 200 * time.Millisecond, Nemesis: n}}, 600*time.Millisecond, 1)
+
+		Convey("the nemesis is started and stopped on time", func() {
+			So(report.Timeline, ShouldHaveLength, 2)
+			So(report.Timeline[0].Action, ShouldEqual, ActionStart)
+			So(report.Timeline[0].At, ShouldEqual, 100*time.Millisecond)
+			So(report.Timeline[0].Error, ShouldBeEmpty)
+			So(report.Timeline[1].Action, ShouldEqual, ActionStop)
+		})
+
+		Convey("the history is linearizable and the decisions are safe", func() {
+			So(report.Ops, ShouldBeGreaterThan, 0)
+			So(report.Completed, ShouldBeGreaterThan, 0)
+			So(report.Passed(), ShouldBeTrue)
+
+			buf := &bytes.Buffer{}
+			report.Write(buf)
+			So(buf.String(), ShouldContainSubstring, "linearizability: ok")
+		})
+	})
+}
@@ -0,0 +1,219 @@
+package nemesis
+
+import (
+	"fmt"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/history"
+	"github.com/1xyz/paxossim/v1/invariant"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Fault - a nemesis started At a time into the run, and stopped For a duration later. A fault
+// with no duration lasts until the end of the run
+type Fault struct {
+	At time.Duration
+
+	For time.Duration
+
+	Nemesis Nemesis
+}
+
+// Alternate - the nemesis started and stopped in turn, every interval, until the end of the run
+func Alternate(n Nemesis, interval time.Duration, duration time.Duration) []Fault {
+	result := make([]Fault, 0)
+	for at := interval; at+interval <= duration; at += 2 * interval {
+		result = append(result, Fault{At: at, For: interval, Nemesis: n})
+	}
+	return result
+}
+
+// Actions recorded in the timeline
+const (
+	ActionStart = "start"
+	ActionStop  = "stop"
+)
+
+// Event - an entry of the nemesis timeline
+type Event struct {
+	// time into the run
+	At time.Duration `json:"at"`
+
+	Nemesis string `json:"nemesis"`
+
+	// ActionStart or ActionStop
+	Action string `json:"action"`
+
+	// what the nemesis did
+	Detail string `json:"detail,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%8v %-5s %s", e.At.Round(time.Millisecond), e.Action, e.Nemesis)
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	if e.Error != "" {
+		s += " (error: " + e.Error + ")"
+	}
+	return s
+}
+
+// step - the start or the stop of a fault
+type step struct {
+	at time.Duration
+
+	start bool
+
+	fault int
+}
+
+// Run - run the Env for the duration, starting & stopping the faults on time. The faults which
+// are active at the end are stopped before the Env is, so that the cluster is healed. Returns
+// the timeline; a nemesis which fails is recorded as such, and does not end the run. The duration
+// elapses on the clock of the Env, see clock.Sleep
+func Run(e *env.Env, faults []Fault, duration time.Duration, seed int64) []Event {
+	rnd := rand.New(rand.NewSource(seed))
+	steps := make([]step, 0, 2*len(faults))
+	for i, f := range faults {
+		steps = append(steps, step{at: f.At, start: true, fault: i})
+		if f.For > 0 {
+			steps = append(steps, step{at: f.At + f.For, fault: i})
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].at < steps[j].at })
+
+	timeline := make([]Event, 0, len(steps))
+	active := make(map[int]bool)
+	apply := func(s step) {
+		n := faults[s.fault].Nemesis
+		ev := Event{Nemesis: n.Name(), Action: ActionStop}
+		var err error
+		if s.start {
+			ev.Action = ActionStart
+			ev.Detail, err = n.Start(e, rnd)
+			active[s.fault] = err == nil
+		} else if active[s.fault] {
+			ev.Detail, err = n.Stop(e)
+			delete(active, s.fault)
+		} else {
+			return
+		}
+		if err != nil {
+			ev.Error = err.Error()
+		}
+		ev.At = s.at
+		log.WithFields(log.Fields{"Nemesis": ev.Nemesis, "Action": ev.Action}).Debugf("%s", ev.Detail)
+		timeline = append(timeline, ev)
+	}
+
+	c := e.Clock()
+	start := c.Now()
+	e.Run()
+	for _, s := range steps {
+		if s.at > duration {
+			break
+		}
+		clock.Sleep(c, s.at-clock.Since(c, start))
+		apply(s)
+	}
+	clock.Sleep(c, duration-clock.Since(c, start))
+	for i := len(faults) - 1; i >= 0; i-- {
+		if active[i] {
+			apply(step{at: duration, fault: i})
+		}
+	}
+	e.Stop()
+	return timeline
+}
+
+// Report - the outcome of a run under nemeses
+type Report struct {
+	Timeline []Event `json:"timeline"`
+
+	// commands requested by the clients, and performed by a replica
+	Ops int `json:"ops"`
+
+	Completed int `json:"completed"`
+
+	// Number of decided slots at each replica
+	Decisions map[string]int `json:"decisions"`
+
+	// L1: the replicas perform the commands in the real time order of the client history, see
+	// history.CheckLinearizable
+	Linearizability []invariant.Violation `json:"linearizability"`
+
+	// R1: conflicting decisions
+	Invariants []invariant.Violation `json:"invariants"`
+}
+
+// Passed - true if the history is linearizable and no invariant is violated
+func (r Report) Passed() bool {
+	return len(r.Linearizability) == 0 && len(r.Invariants) == 0
+}
+
+// Test - construct the Env of the config, run it under the faults for the duration, and judge
+// its history & decisions
+func Test(cfg env.Config, faults []Fault, duration time.Duration, seed int64) Report {
+	h := history.NewWithClock(clock.OrReal(cfg.Clock))
+	cfg.History = h
+	e := env.NewEnvWithConfig(cfg)
+	timeline := Run(e, faults, duration, seed)
+
+	ops := h.Ops()
+	logs := e.DecisionLogs()
+	report := Report{
+		Timeline:        timeline,
+		Ops:             len(ops),
+		Decisions:       make(map[string]int),
+		Linearizability: history.CheckLinearizable(ops, h.Orders()),
+		Invariants:      invariant.CheckDecisions(logs),
+	}
+	for _, op := range ops {
+		if op.IsCompleted() {
+			report.Completed++
+		}
+	}
+	for _, l := range logs {
+		report.Decisions[fmt.Sprintf("%v", l.Replica)] = len(l.Decisions)
+	}
+	return report
+}
+
+// Write - the report in text: the timeline, the history and the violations
+func (r Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "nemesis timeline:\n")
+	for _, ev := range r.Timeline {
+		fmt.Fprintf(w, "  %v\n", ev)
+	}
+	fmt.Fprintf(w, "history: %d ops, %d completed\n", r.Ops, r.Completed)
+	replicas := make([]string, 0, len(r.Decisions))
+	for replica := range r.Decisions {
+		replicas = append(replicas, replica)
+	}
+	sort.Strings(replicas)
+	for _, replica := range replicas {
+		fmt.Fprintf(w, "  replica %s decided %d slots\n", replica, r.Decisions[replica])
+	}
+	fmt.Fprintf(w, "linearizability: %s\n", verdict(r.Linearizability))
+	for _, v := range r.Linearizability {
+		fmt.Fprintf(w, "  %v\n", v)
+	}
+	fmt.Fprintf(w, "invariants: %s\n", verdict(r.Invariants))
+	for _, v := range r.Invariants {
+		fmt.Fprintf(w, "  %v\n", v)
+	}
+}
+
+func verdict(violations []invariant.Violation) string {
+	if len(violations) == 0 {
+		return "ok"
+	}
+	return fmt.Sprintf("%d violations", len(violations))
+}
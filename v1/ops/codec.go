@@ -0,0 +1,156 @@
+package ops
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Decoder - the operation of the arguments encoded after its name
+type Decoder func(args []string) (Operation, error)
+
+// registration - an operation type, and the decoder of its operations
+type registration struct {
+	t reflect.Type
+
+	decoder Decoder
+}
+
+var (
+	mu = &sync.RWMutex{}
+
+	// the operation types, by name
+	registrations = map[string]registration{
+		NameGet:    {reflect.TypeOf(Get{}), decodeGet},
+		NamePut:    {reflect.TypeOf(Put{}), decodePut},
+		NameDelete: {reflect.TypeOf(Delete{}), decodeDelete},
+		NameCAS:    {reflect.TypeOf(CAS{}), decodeCAS},
+		NameAppend: {reflect.TypeOf(Append{}), decodeAppend},
+		NameNoOp:   {reflect.TypeOf(NoOp{}), decodeNoOp},
+	}
+)
+
+// Register - decode the operations of the type of the prototype, under its name, with the decoder.
+// The type is a comparable value type, not a pointer, so that commands carrying its operations
+// compare by value. Names are case insensitive, and a name is registered once
+func Register(prototype Operation, decoder Decoder) error {
+	if prototype == nil {
+		return fmt.Errorf("invalid operation: nil")
+	}
+	name := strings.ToUpper(prototype.Name())
+	if name == "" || strings.IndexFunc(name, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("invalid operation name %q", name)
+	}
+	t := reflect.TypeOf(prototype)
+	if t.Kind() == reflect.Ptr || !t.Comparable() {
+		return fmt.Errorf("invalid operation %s: %v is not a comparable value type", name, t)
+	}
+	if decoder == nil {
+		return fmt.Errorf("invalid operation %s: nil decoder", name)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registrations[name]; ok {
+		return fmt.Errorf("already-exists: operation %s", name)
+	}
+	registrations[name] = registration{t: t, decoder: decoder}
+	return nil
+}
+
+// Names - the names of all operation types, sorted
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := make([]string, 0, len(registrations))
+	for name := range registrations {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Encode - the name of the operation followed by its arguments, separated by spaces. An argument
+// which is empty, or contains a space or a quote, is quoted
+func Encode(op Operation) string {
+	fields := []string{strings.ToUpper(op.Name())}
+	for _, arg := range op.Args() {
+		if arg == "" || strings.IndexFunc(arg, unicode.IsSpace) >= 0 || strings.ContainsRune(arg, '"') {
+			arg = strconv.Quote(arg)
+		}
+		fields = append(fields, arg)
+	}
+	return strings.Join(fields, " ")
+}
+
+// Decode - the operation encoded by Encode, of a registered type
+func Decode(s string) (Operation, error) {
+	fields, err := split(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid operation: empty")
+	}
+	name := strings.ToUpper(fields[0])
+	mu.RLock()
+	r, ok := registrations[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("not-found: unknown operation %q", fields[0])
+	}
+	op, err := r.decoder(fields[1:])
+	if err != nil {
+		return nil, err
+	}
+	if reflect.TypeOf(op) != r.t {
+		return nil, fmt.Errorf("invalid %s: decoded %T, expected %v", name, op, r.t)
+	}
+	return op, nil
+}
+
+// split - the fields of the string separated by spaces, unquoting the quoted ones
+func split(s string) ([]string, error) {
+	result := make([]string, 0)
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return result, nil
+		}
+		if s[0] != '"' {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			result = append(result, s[:end])
+			s = s[end:]
+			continue
+		}
+		end := closingQuote(s)
+		if end < 0 {
+			return nil, fmt.Errorf("invalid operation %q: unterminated quote", s)
+		}
+		field, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid operation %q: %v", s, err)
+		}
+		result = append(result, field)
+		s = s[end+1:]
+	}
+}
+
+// closingQuote - the index of the quote closing the one s starts with, -1 if there is none
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
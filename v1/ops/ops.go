@@ -0,0 +1,263 @@
+package ops
+
+// Typed operations of the commands of the clients.
+//
+// A Command carries its operation typed, and every replica decides & compares it by value. The
+// operations below are encoded as a string by Encode, as their name followed by their arguments,
+// e.g. "PUT k1 v1" or "CAS k1 v1 v2", and decoded back by Decode; the string is what GetOp returns,
+// and what traces & scenarios record. Operation types other than the ones below are added with
+// Register.
+
+import (
+	"fmt"
+	"github.com/1xyz/paxossim/v1/types"
+	"strings"
+)
+
+// Names of the operations
+const (
+	NamePut    = "PUT"
+	NameGet    = "GET"
+	NameDelete = "DEL"
+	NameCAS    = "CAS"
+	NameAppend = "APPEND"
+	NameNoOp   = "NOOP"
+)
+
+// Results of the operations which do not read a value
+const (
+	ResultOK = "OK"
+
+	// the result of a CAS which found another value than the expected one
+	ResultMismatch = "MISMATCH"
+)
+
+// Operation - a typed operation on the keys of a Store
+type Operation interface {
+	// Name - the name of the type of the operation, the first word of its encoding
+	Name() string
+
+	// Args - the arguments of the operation, encoded after its name
+	Args() []string
+
+	// Keys - the keys the operation reads or writes, none if it leaves the store unchanged
+	Keys() []string
+
+	// Apply - apply the operation to the store, and return its result
+	Apply(s Store) string
+}
+
+// Store - the keys & values an Operation is applied to
+type Store interface {
+	Get(key string) (string, bool)
+
+	Put(key string, value string)
+
+	Delete(key string)
+}
+
+// Get - read the value of a key, empty if it has none
+type Get struct {
+	Key string
+}
+
+func (o Get) Name() string   { return NameGet }
+func (o Get) Args() []string { return []string{o.Key} }
+func (o Get) Keys() []string { return []string{o.Key} }
+
+func (o Get) Apply(s Store) string {
+	v, _ := s.Get(o.Key)
+	return v
+}
+
+// Put - set the value of a key
+type Put struct {
+	Key string
+
+	Value string
+}
+
+func (o Put) Name() string   { return NamePut }
+func (o Put) Args() []string { return []string{o.Key, o.Value} }
+func (o Put) Keys() []string { return []string{o.Key} }
+
+func (o Put) Apply(s Store) string {
+	s.Put(o.Key, o.Value)
+	return ResultOK
+}
+
+// Delete - remove a key
+type Delete struct {
+	Key string
+}
+
+func (o Delete) Name() string   { return NameDelete }
+func (o Delete) Args() []string { return []string{o.Key} }
+func (o Delete) Keys() []string { return []string{o.Key} }
+
+func (o Delete) Apply(s Store) string {
+	s.Delete(o.Key)
+	return ResultOK
+}
+
+// CAS - set the value of a key if it is the expected one, an empty expected value matching a key
+// without a value. Returns ResultOK if it did, ResultMismatch otherwise
+type CAS struct {
+	Key string
+
+	Expected string
+
+	Value string
+}
+
+func (o CAS) Name() string   { return NameCAS }
+func (o CAS) Args() []string { return []string{o.Key, o.Expected, o.Value} }
+func (o CAS) Keys() []string { return []string{o.Key} }
+
+func (o CAS) Apply(s Store) string {
+	if v, _ := s.Get(o.Key); v != o.Expected {
+		return ResultMismatch
+	}
+	s.Put(o.Key, o.Value)
+	return ResultOK
+}
+
+// Append - add the value at the end of the value of a key
+type Append struct {
+	Key string
+
+	Value string
+}
+
+func (o Append) Name() string   { return NameAppend }
+func (o Append) Args() []string { return []string{o.Key, o.Value} }
+func (o Append) Keys() []string { return []string{o.Key} }
+
+func (o Append) Apply(s Store) string {
+	v, _ := s.Get(o.Key)
+	s.Put(o.Key, v+o.Value)
+	return ResultOK
+}
+
+// NoOp - an operation which leaves the store unchanged, e.g. decided in place of a lost command
+type NoOp struct{}
+
+func (o NoOp) Name() string         { return NameNoOp }
+func (o NoOp) Args() []string       { return nil }
+func (o NoOp) Keys() []string       { return nil }
+func (o NoOp) Apply(s Store) string { return "" }
+
+// atLeast - check an operation of the name has n arguments or more
+func atLeast(name string, args []string, n int) error {
+	if len(args) < n {
+		return fmt.Errorf("invalid %s: expected %d arguments or more, got %d", name, n, len(args))
+	}
+	return nil
+}
+
+// exactly - check an operation of the name has n arguments
+func exactly(name string, args []string, n int) error {
+	if len(args) != n {
+		return fmt.Errorf("invalid %s: expected %d arguments, got %d", name, n, len(args))
+	}
+	return nil
+}
+
+func decodeGet(args []string) (Operation, error) {
+	if err := exactly(NameGet, args, 1); err != nil {
+		return nil, err
+	}
+	return Get{Key: args[0]}, nil
+}
+
+// decodePut - the value is every argument after the key, e.g. "PUT k1 a b" sets k1 to "a b"
+func decodePut(args []string) (Operation, error) {
+	if err := atLeast(NamePut, args, 1); err != nil {
+		return nil, err
+	}
+	return Put{Key: args[0], Value: strings.Join(args[1:], " ")}, nil
+}
+
+func decodeDelete(args []string) (Operation, error) {
+	if err := exactly(NameDelete, args, 1); err != nil {
+		return nil, err
+	}
+	return Delete{Key: args[0]}, nil
+}
+
+func decodeCAS(args []string) (Operation, error) {
+	if err := exactly(NameCAS, args, 3); err != nil {
+		return nil, err
+	}
+	return CAS{Key: args[0], Expected: args[1], Value: args[2]}, nil
+}
+
+// decodeAppend - the value is every argument after the key, as for a PUT
+func decodeAppend(args []string) (Operation, error) {
+	if err := atLeast(NameAppend, args, 1); err != nil {
+		return nil, err
+	}
+	return Append{Key: args[0], Value: strings.Join(args[1:], " ")}, nil
+}
+
+func decodeNoOp(args []string) (Operation, error) {
+	if err := exactly(NameNoOp, args, 0); err != nil {
+		return nil, err
+	}
+	return NoOp{}, nil
+}
+
+// Command - a command of a client carrying a typed operation. Operations are comparable values,
+// see Register, so that commands compare, and key maps, by value
+type Command struct {
+	ClientID string
+
+	CommandID string
+
+	Operation Operation
+}
+
+// NewCommand - a command of the client carrying the operation
+func NewCommand(clientID string, commandID string, op Operation) Command {
+	return Command{ClientID: clientID, CommandID: commandID, Operation: op}
+}
+
+func (c Command) GetClientID() string {
+	return c.ClientID
+}
+
+func (c Command) GetCommandID() string {
+	return c.CommandID
+}
+
+// GetOp - the encoding of the operation
+func (c Command) GetOp() string {
+	return Encode(c.Operation)
+}
+
+// GetOperation - the operation carried by the command
+func (c Command) GetOperation() Operation {
+	return c.Operation
+}
+
+func (c Command) String() string {
+	return fmt.Sprintf("Command{ClientID: %s, CommandID: %s, Op: %s}",
+		c.ClientID, c.CommandID, c.GetOp())
+}
+
+// Typed - a command carrying a typed operation
+type Typed interface {
+	types.Command
+
+	GetOperation() Operation
+}
+
+// OperationOf - the typed operation carried by the command, false if it carries none, e.g. the
+// commands of the protocols moving ranges or running transactions
+func OperationOf(command types.Command) (Operation, bool) {
+	typed, ok := command.(Typed)
+	if !ok || typed.GetOperation() == nil {
+		return nil, false
+	}
+	return typed.GetOperation(), true
+}
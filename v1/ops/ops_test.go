@@ -0,0 +1,178 @@
+package ops
+
+import (
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// swap - exchange the values of two keys, a custom operation type
+type swap struct {
+	a, b string
+}
+
+func (o swap) Name() string   { return "SWAP" }
+func (o swap) Args() []string { return []string{o.a, o.b} }
+func (o swap) Keys() []string { return []string{o.a, o.b} }
+
+func (o swap) Apply(s Store) string {
+	va, _ := s.Get(o.a)
+	vb, _ := s.Get(o.b)
+	s.Put(o.a, vb)
+	s.Put(o.b, va)
+	return ResultOK
+}
+
+func init() {
+	if err := Register(swap{}, func(args []string) (Operation, error) {
+		if err := exactly("SWAP", args, 2); err != nil {
+			return nil, err
+		}
+		return swap{a: args[0], b: args[1]}, nil
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// named - an operation of any name, which leaves the store unchanged
+type named struct {
+	NoOp
+
+	name string
+}
+
+func (o named) Name() string { return o.name }
+
+// batch - an operation which is not comparable
+type batch struct {
+	NoOp
+
+	ops []Operation
+}
+
+func (o batch) Name() string { return "BATCH" }
+
+// store - a Store of a map
+type store map[string]string
+
+func (s store) Get(key string) (string, bool) {
+	v, ok := s[key]
+	return v, ok
+}
+
+func (s store) Put(key string, value string) { s[key] = value }
+func (s store) Delete(key string)            { delete(s, key) }
+
+func TestCodec(t *testing.T) {
+	Convey("Operations are decoded from their encoding", t, func() {
+		for _, op := range []Operation{
+			Get{Key: "k1"},
+			Put{Key: "k1", Value: "v1"},
+			Put{Key: "k1", Value: `a "quoted" value`},
+			Put{Key: "k1"},
+			Delete{Key: "k1"},
+			CAS{Key: "k1", Value: "v1"},
+			CAS{Key: "k1", Expected: "v1", Value: "v 2"},
+			Append{Key: "k1", Value: "\tv\n"},
+			NoOp{},
+			swap{a: "k1", b: "k2"},
+		} {
+			decoded, err := Decode(Encode(op))
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, op)
+		}
+	})
+
+	Convey("Operations are encoded as their name followed by their arguments", t, func() {
+		So(Encode(Put{Key: "k1", Value: "v1"}), ShouldEqual, "PUT k1 v1")
+		So(Encode(CAS{Key: "k1", Value: "v 2"}), ShouldEqual, `CAS k1 "" "v 2"`)
+		So(Encode(NoOp{}), ShouldEqual, NameNoOp)
+
+		Convey("and decoded whatever the case of the name, the value of a PUT spanning the remaining fields", func() {
+			op, err := Decode("put k1 a  b")
+			So(err, ShouldBeNil)
+			So(op, ShouldResemble, Put{Key: "k1", Value: "a b"})
+			op, err = Decode("Get k1")
+			So(err, ShouldBeNil)
+			So(op, ShouldResemble, Get{Key: "k1"})
+		})
+	})
+
+	Convey("Decoding fails for", t, func() {
+		Convey("unknown or missing operations", func() {
+			for _, s := range []string{"", "  ", "OP", "MOVE k1 k2"} {
+				_, err := Decode(s)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("the wrong number of arguments", func() {
+			for _, s := range []string{"GET", "GET k1 k2", "PUT", "CAS k1 v1", "NOOP k1", "SWAP k1"} {
+				_, err := Decode(s)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("an unterminated quote", func() {
+			_, err := Decode(`PUT k1 "v1`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A name is registered once", t, func() {
+		So(Register(swap{}, decodeNoOp), ShouldNotBeNil)
+		So(Register(Put{}, decodePut), ShouldNotBeNil)
+		So(Register(named{name: "two words"}, decodeNoOp), ShouldNotBeNil)
+		So(Names(), ShouldContain, "SWAP")
+	})
+
+	Convey("Only comparable value types are registered", t, func() {
+		So(Register(&named{name: "POINTER"}, decodeNoOp), ShouldNotBeNil)
+		So(Register(batch{}, decodeNoOp), ShouldNotBeNil)
+		So(Names(), ShouldNotContain, "POINTER")
+		So(Names(), ShouldNotContain, "BATCH")
+	})
+
+	Convey("Commands carry typed operations", t, func() {
+		command := NewCommand("client:0", "1", Append{Key: "k1", Value: "v"})
+		So(command.GetOp(), ShouldEqual, "APPEND k1 v")
+		op, ok := OperationOf(command)
+		So(ok, ShouldBeTrue)
+		So(op, ShouldResemble, Append{Key: "k1", Value: "v"})
+		So(command == NewCommand("client:0", "1", Append{Key: "k1", Value: "v"}), ShouldBeTrue)
+
+		_, ok = OperationOf(types.BasicCommand{ClientID: "client:0", CommandID: "2", Op: "APPEND k1 v"})
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestApply(t *testing.T) {
+	Convey("Given a store", t, func() {
+		s := store{"k1": "v1"}
+
+		Convey("operations read & write its keys", func() {
+			So(Get{Key: "k1"}.Apply(s), ShouldEqual, "v1")
+			So(Get{Key: "k2"}.Apply(s), ShouldEqual, "")
+			So(Put{Key: "k2", Value: "v2"}.Apply(s), ShouldEqual, ResultOK)
+			So(Append{Key: "k2", Value: "+"}.Apply(s), ShouldEqual, ResultOK)
+			So(Delete{Key: "k1"}.Apply(s), ShouldEqual, ResultOK)
+			So(NoOp{}.Apply(s), ShouldEqual, "")
+			So(s, ShouldResemble, store{"k2": "v2+"})
+		})
+
+		Convey("a CAS writes the key only if it has the expected value", func() {
+			So(CAS{Key: "k1", Expected: "v0", Value: "v2"}.Apply(s), ShouldEqual, ResultMismatch)
+			So(CAS{Key: "k1", Expected: "v1", Value: "v2"}.Apply(s), ShouldEqual, ResultOK)
+			So(CAS{Key: "k3", Value: "v3"}.Apply(s), ShouldEqual, ResultOK)
+			So(s, ShouldResemble, store{"k1": "v2", "k3": "v3"})
+		})
+
+		Convey("a custom operation applies to every key it names", func() {
+			op, err := Decode("SWAP k1 k2")
+			So(err, ShouldBeNil)
+			So(op.Keys(), ShouldResemble, []string{"k1", "k2"})
+			So(op.Apply(s), ShouldEqual, ResultOK)
+			So(s, ShouldResemble, store{"k1": "", "k2": "v1"})
+		})
+	})
+}
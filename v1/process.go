@@ -1,10 +1,15 @@
 package v1
 
 import (
+	"errors"
 	"fmt"
 	"github.com/1xyz/paxossim/queue"
+	"strings"
 )
 
+// ErrProcessClosed - returned by Recv once a process has been closed
+var ErrProcessClosed = errors.New("process closed")
+
 // ProcessType - The different paxos process types
 type ProcessType int
 
@@ -36,6 +41,16 @@ func (pt ProcessType) String() string {
 	}
 }
 
+// ParseProcessType - the ProcessType named s (case-insensitive)
+func ParseProcessType(s string) (ProcessType, error) {
+	for pt, name := range ptStrings {
+		if strings.EqualFold(name, s) {
+			return pt, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown process type %q", s)
+}
+
 // ProcessInbox Identifier in this Paxos system
 type ProcessID int
 
@@ -65,7 +80,7 @@ type ProcessInbox interface {
 
 // ProcessOutbox - interface allowing a process to recv messages
 type ProcessOutbox interface {
-	// Recv for the next message
+	// Recv for the next message, returns ErrProcessClosed once the process is closed
 	Recv() (Message, error)
 }
 
@@ -74,6 +89,13 @@ type Process interface {
 	ProcessInbox
 	ProcessOutbox
 	GetAddr() Addr
+
+	// Close the process, messages sent to a closed process are discarded
+	// and a pending Recv returns ErrProcessClosed
+	Close()
+
+	// Number of messages waiting in the inbox
+	InboxLen() int
 }
 
 func NewProcess(id ProcessID, pt ProcessType) Process {
@@ -107,6 +129,13 @@ type basicProcess struct {
 	inbox queue.Queue
 }
 
+// NewProcessWithInbox - a process whose inbox is the specified queue, e.g. a bounded queue
+func NewProcessWithInbox(id ProcessID, pt ProcessType, inbox queue.Queue) Process {
+	p := newBasicProcess(id, pt)
+	p.inbox = inbox
+	return p
+}
+
 func newBasicProcess(id ProcessID, pt ProcessType) *basicProcess {
 	return &basicProcess{
 		basicAddr: basicAddr{
@@ -133,14 +162,29 @@ func (b basicProcess) GetAddr() Addr {
 }
 
 func (b basicProcess) Send(m Message) error {
-	b.inbox.Enqueue(m)
+	// like a crashed process, a closed process silently discards its messages
+	if err := b.inbox.Enqueue(m); err != nil && err != queue.ErrClosed {
+		return fmt.Errorf("send to %v failed: %v", b.basicAddr, err)
+	}
 	return nil
 }
 
 func (b basicProcess) Recv() (Message, error) {
-	entry, ok := b.inbox.WaitForItem().(Message)
+	item, err := b.inbox.WaitForItem()
+	if err == queue.ErrClosed {
+		return nil, ErrProcessClosed
+	}
+	entry, ok := item.(Message)
 	if !ok {
 		return nil, fmt.Errorf("cast-error message entry not found %T", entry)
 	}
 	return entry, nil
 }
+
+func (b basicProcess) Close() {
+	b.inbox.Close()
+}
+
+func (b basicProcess) InboxLen() int {
+	return b.inbox.Len()
+}
@@ -0,0 +1,221 @@
+package property
+
+// Property-based testing of the protocol's safety.
+//
+// A Generator draws random cases: a cluster (acceptors, leaders & replicas), a workload (the
+// commands a client requests), a fault budget (messages lost or delivered twice, processes
+// crashed, and optionally a Byzantine process) and a seed. A case runs in the deterministic mode
+// of the model checker (modelcheck.Simulation): the seed drives a random walk through the
+// transitions enabled at every step, and the invariants are checked after each of them.
+//
+// A failing case is shrunk to a minimal reproducible one: the cluster, the workload and the
+// fault budget are reduced, and transitions are deleted from the schedule (delta debugging,
+// Zeller 1999), as long as an invariant is still violated. A shrunk schedule is replayed
+// tolerantly, i.e. the transitions which are no longer enabled are skipped.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/modelcheck"
+	"github.com/1xyz/paxossim/v1/trace"
+	"math/rand"
+	"sort"
+)
+
+// Case - a generated test case
+type Case struct {
+	Config modelcheck.Config
+
+	// seed of the random walk
+	Seed int64
+
+	// the walk is cut off after this many transitions
+	Steps int
+}
+
+func (c Case) String() string {
+	return fmt.Sprintf("seed %d steps %d %s", c.Seed, c.Steps, describe(c.Config))
+}
+
+// describe - the cluster, workload & faults of the config
+func describe(cfg modelcheck.Config) string {
+	s := fmt.Sprintf("failures %d leaders %d replicas %d commands %d drops %d duplicates %d crashes %d",
+		cfg.Failures, cfg.Leaders, cfg.Replicas, cfg.Commands, cfg.Drops, cfg.Duplicates, cfg.Crashes)
+	for _, addr := range byzantineAddrs(cfg) {
+		s += fmt.Sprintf(" %v=%s", addr, cfg.Byzantine[addr])
+	}
+	return s
+}
+
+// byzantineAddrs - the Byzantine processes of the config, sorted
+func byzantineAddrs(cfg modelcheck.Config) []v1.Addr {
+	addrs := make([]v1.Addr, 0, len(cfg.Byzantine))
+	for addr := range cfg.Byzantine {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return fmt.Sprintf("%v", addrs[i]) < fmt.Sprintf("%v", addrs[j]) })
+	return addrs
+}
+
+// Generator - the bounds of the generated cases. Every bound is inclusive
+type Generator struct {
+	MaxFailures int
+
+	MaxLeaders int
+
+	MaxReplicas int
+
+	MaxCommands int
+
+	MaxDrops int
+
+	MaxDuplicates int
+
+	MaxCrashes int
+
+	MaxSteps int
+
+	// Byzantine behaviors, one of which is assigned to a process of half of the cases. Without
+	// behaviors, every process is honest
+	Behaviors []string
+}
+
+// DefaultGenerator - clusters of up to 5 acceptors, 2 leaders & 3 replicas, on a network which
+// loses and duplicates a few messages, and a crash
+func DefaultGenerator() Generator {
+	return Generator{
+		MaxFailures:   2,
+		MaxLeaders:    2,
+		MaxReplicas:   3,
+		MaxCommands:   3,
+		MaxDrops:      2,
+		MaxDuplicates: 2,
+		MaxCrashes:    1,
+		MaxSteps:      200,
+	}
+}
+
+// Generate - a random case within the bounds
+func (g Generator) Generate(rnd *rand.Rand) (Case, error) {
+	cfg := modelcheck.Config{
+		Failures:   rnd.Intn(g.MaxFailures + 1),
+		Leaders:    1 + rnd.Intn(g.MaxLeaders),
+		Replicas:   1 + rnd.Intn(g.MaxReplicas),
+		Commands:   1 + rnd.Intn(g.MaxCommands),
+		Drops:      rnd.Intn(g.MaxDrops + 1),
+		Duplicates: rnd.Intn(g.MaxDuplicates + 1),
+		Crashes:    rnd.Intn(g.MaxCrashes + 1),
+		Byzantine:  make(map[v1.Addr]string),
+	}
+	if len(g.Behaviors) > 0 && rnd.Intn(2) == 0 {
+		name := g.Behaviors[rnd.Intn(len(g.Behaviors))]
+		b, err := byzantine.New(name)
+		if err != nil {
+			return Case{}, err
+		}
+		counts := map[v1.ProcessType]int{v1.Acceptor: 2*cfg.Failures + 1, v1.Leader: cfg.Leaders}
+		pt := b.ProcessType()
+		cfg.Byzantine[v1.NewAddress(v1.ProcessID(rnd.Intn(counts[pt])), pt)] = name
+	}
+	return Case{Config: cfg, Seed: rnd.Int63(), Steps: 1 + rnd.Intn(g.MaxSteps)}, nil
+}
+
+// Outcome - a run of a case, up to the first violation
+type Outcome struct {
+	// the transitions taken
+	Schedule []modelcheck.Transition
+
+	Violations []invariant.Violation
+
+	// the registrations & deliveries, in the format of a recorded run
+	Trace []trace.Entry
+
+	sim *modelcheck.Simulation
+}
+
+// Failed - true if an invariant was violated
+func (o Outcome) Failed() bool {
+	return len(o.Violations) > 0
+}
+
+// Run - the random walk of the case
+func Run(c Case) (Outcome, error) {
+	sim, err := modelcheck.NewSimulation(c.Config)
+	if err != nil {
+		return Outcome{}, err
+	}
+	rnd := rand.New(rand.NewSource(c.Seed))
+	schedule := make([]modelcheck.Transition, 0, c.Steps)
+	for len(schedule) < c.Steps && len(sim.Violations()) == 0 {
+		enabled := sim.Enabled()
+		if len(enabled) == 0 {
+			break
+		}
+		t := enabled[rnd.Intn(len(enabled))]
+		sim.Apply(t)
+		schedule = append(schedule, t)
+	}
+	return outcome(sim, schedule), nil
+}
+
+// replay - take the transitions of the schedule which are enabled, in order, until an invariant
+// is violated, on a rerun of the outcome's simulation. The schedule of the result holds the
+// transitions taken
+func (o Outcome) replay(cfg modelcheck.Config, schedule []modelcheck.Transition) (Outcome, error) {
+	sim, err := o.sim.Rerun(cfg)
+	if err != nil {
+		return Outcome{}, err
+	}
+	taken := make([]modelcheck.Transition, 0, len(schedule))
+	for _, t := range schedule {
+		if len(sim.Violations()) > 0 {
+			break
+		}
+		if sim.Apply(t) {
+			taken = append(taken, t)
+		}
+	}
+	return outcome(sim, taken), nil
+}
+
+func outcome(sim *modelcheck.Simulation, schedule []modelcheck.Transition) Outcome {
+	return Outcome{Schedule: schedule, Violations: sim.Violations(), Trace: sim.Trace(), sim: sim}
+}
+
+// Report - the outcome of a property check
+type Report struct {
+	// cases run, including the failing one
+	Cases int
+
+	// transitions taken by the cases
+	Transitions int
+
+	// the first failing case, shrunk; nil if every case passed
+	Failure *Failure
+}
+
+// Check - run n cases drawn by the generator from the seed, until one fails. The failing case is
+// shrunk
+func Check(g Generator, seed int64, n int) (Report, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	report := Report{}
+	for report.Cases < n {
+		c, err := g.Generate(rnd)
+		if err != nil {
+			return report, err
+		}
+		o, err := Run(c)
+		if err != nil {
+			return report, fmt.Errorf("case %v: %v", c, err)
+		}
+		report.Cases++
+		report.Transitions += len(o.Schedule)
+		if o.Failed() {
+			report.Failure = Shrink(c, o)
+			break
+		}
+	}
+	return report, nil
+}
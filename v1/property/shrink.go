@@ -0,0 +1,134 @@
+package property
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/modelcheck"
+)
+
+// Failure - a failing case, and the minimal case it was shrunk to
+type Failure struct {
+	// the generated case
+	Case Case
+
+	// the shrunk cluster, workload & fault budget
+	Config modelcheck.Config
+
+	// the run of the shrunk case: its schedule, the invariants it violates and its trace
+	Outcome
+
+	// reductions of the config or the schedule which preserved the violation
+	Shrinks int
+
+	// the invariant violated by the generated case
+	invariant string
+}
+
+func (f *Failure) String() string {
+	return fmt.Sprintf("%s violates %s; shrunk to %d transitions of %s",
+		f.Case, f.invariant, len(f.Schedule), describe(f.Config))
+}
+
+// Reproduce - replay the shrunk schedule on the shrunk config
+func (f *Failure) Reproduce() (Outcome, error) {
+	return f.replay(f.Config, f.Schedule)
+}
+
+// Shrink - reduce the failing case, alternately its config and its schedule, until neither can
+// be reduced without losing the violation of the invariant which failed first
+func Shrink(c Case, failed Outcome) *Failure {
+	f := &Failure{Case: c, Config: c.Config, Outcome: failed, invariant: failed.Violations[0].Invariant}
+	for changed := true; changed; {
+		changed = f.shrinkConfig()
+		if f.shrinkSchedule() {
+			changed = true
+		}
+	}
+	return f
+}
+
+// fails - true if the outcome violates the same invariant as the generated case
+func (f *Failure) fails(o Outcome, err error) bool {
+	// a reduced config may be invalid, e.g. without the acceptor assigned a behavior
+	return err == nil && o.Failed() && o.Violations[0].Invariant == f.invariant
+}
+
+// shrinkConfig - take the first smaller config which still fails, returns false if there is none
+func (f *Failure) shrinkConfig() bool {
+	for _, cfg := range smaller(f.Config, f.Schedule) {
+		if o, err := f.replay(cfg, f.Schedule); f.fails(o, err) {
+			f.Config, f.Outcome = cfg, o
+			f.Shrinks++
+			return true
+		}
+	}
+	return false
+}
+
+// shrinkSchedule - delete chunks of transitions, halving the chunks down to single transitions.
+// Returns false if no transition could be deleted
+func (f *Failure) shrinkSchedule() bool {
+	shrunk := false
+	for n := len(f.Schedule) / 2; n >= 1; n /= 2 {
+		for i := 0; i < len(f.Schedule); {
+			end := i + n
+			if end > len(f.Schedule) {
+				end = len(f.Schedule)
+			}
+			candidate := append(append(make([]modelcheck.Transition, 0, len(f.Schedule)), f.Schedule[:i]...), f.Schedule[end:]...)
+			if o, err := f.replay(f.Config, candidate); f.fails(o, err) && len(o.Schedule) < len(f.Schedule) {
+				f.Outcome = o
+				f.Shrinks++
+				shrunk = true
+				continue
+			}
+			i += n
+		}
+	}
+	return shrunk
+}
+
+// smaller - the configs with a process, a command or a Byzantine behavior less, or with a fault
+// budget cut down to the faults of the schedule
+func smaller(cfg modelcheck.Config, schedule []modelcheck.Transition) []modelcheck.Config {
+	used := make(map[string]int)
+	for _, t := range schedule {
+		used[t.Action()]++
+	}
+	result := make([]modelcheck.Config, 0)
+	add := func(change func(c *modelcheck.Config)) {
+		c := cfg
+		c.Byzantine = make(map[v1.Addr]string, len(cfg.Byzantine))
+		for addr, name := range cfg.Byzantine {
+			c.Byzantine[addr] = name
+		}
+		change(&c)
+		result = append(result, c)
+	}
+	for _, addr := range byzantineAddrs(cfg) {
+		addr := addr
+		add(func(c *modelcheck.Config) { delete(c.Byzantine, addr) })
+	}
+	if cfg.Failures > 0 {
+		add(func(c *modelcheck.Config) { c.Failures-- })
+	}
+	if cfg.Leaders > 1 {
+		add(func(c *modelcheck.Config) { c.Leaders-- })
+	}
+	if cfg.Replicas > 1 {
+		add(func(c *modelcheck.Config) { c.Replicas-- })
+	}
+	if cfg.Commands > 0 {
+		add(func(c *modelcheck.Config) { c.Commands-- })
+	}
+	if used["drop"] < cfg.Drops {
+		add(func(c *modelcheck.Config) { c.Drops = used["drop"] })
+	}
+	if used["duplicate"] < cfg.Duplicates {
+		add(func(c *modelcheck.Config) { c.Duplicates = used["duplicate"] })
+	}
+	if used["crash"] < cfg.Crashes {
+		add(func(c *modelcheck.Config) { c.Crashes = used["crash"] })
+	}
+	return result
+}
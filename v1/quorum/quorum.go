@@ -0,0 +1,239 @@
+package quorum
+
+// Quorum systems for the two phases of Paxos.
+//
+// Classic Paxos uses a majority of the acceptors in both phases. Flexible Paxos
+// (Howard et al, 2016) observed that only the phase 1 (scout) quorums need to intersect
+// the phase 2 (commander) quorums, so phase 2 can be made cheaper at the cost of a
+// larger phase 1, e.g. any 4 of 6 acceptors in phase 1 and any 3 in phase 2.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"sort"
+	"strings"
+)
+
+// MaxValidatedAcceptors - Validate enumerates every subset of the acceptors, and refuses larger sets
+const MaxValidatedAcceptors = 20
+
+// System - decides which sets of acceptors form a quorum in phase 1 (scouts) and phase 2 (commanders)
+type System interface {
+	// Phase1 - whether the acceptors which responded form a phase 1 quorum
+	Phase1(acks v1.AddrSet) bool
+
+	// Phase2 - whether the acceptors which responded form a phase 2 quorum
+	Phase2(acks v1.AddrSet) bool
+
+	String() string
+}
+
+// members - the index of every acceptor of a system. Addresses are compared by ID and type,
+// so any Addr implementation of an acceptor is matched
+type members map[v1.Addr]int
+
+func newMembers(acceptors []v1.Addr) members {
+	m := make(members)
+	for i, a := range acceptors {
+		m[key(a)] = i
+	}
+	return m
+}
+
+func key(a v1.Addr) v1.Addr {
+	return v1.NewAddress(a.ID(), a.Type())
+}
+
+// indexes - the indexes of the member acceptors in acks
+func (m members) indexes(acks v1.AddrSet) []int {
+	result := make([]int, 0, len(acks))
+	for a := range acks {
+		if i, ok := m[key(a)]; ok {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Sizes - any Q1 acceptors form a phase 1 quorum and any Q2 acceptors a phase 2 quorum.
+// The quorums intersect if Q1 + Q2 > n
+type Sizes struct {
+	members members
+
+	Q1 int
+
+	Q2 int
+}
+
+// NewSizes - a quorum system of Q1 acceptors in phase 1 and Q2 acceptors in phase 2
+func NewSizes(acceptors []v1.Addr, q1 int, q2 int) *Sizes {
+	return &Sizes{members: newMembers(acceptors), Q1: q1, Q2: q2}
+}
+
+// NewMajority - the classic quorum system, a majority of the acceptors in both phases
+func NewMajority(acceptors []v1.Addr) *Sizes {
+	majority := len(acceptors)/2 + 1
+	return NewSizes(acceptors, majority, majority)
+}
+
+func (s *Sizes) Phase1(acks v1.AddrSet) bool {
+	return len(s.members.indexes(acks)) >= s.Q1
+}
+
+func (s *Sizes) Phase2(acks v1.AddrSet) bool {
+	return len(s.members.indexes(acks)) >= s.Q2
+}
+
+func (s *Sizes) String() string {
+	return fmt.Sprintf("sizes(n=%d, q1=%d, q2=%d)", len(s.members), s.Q1, s.Q2)
+}
+
+// Grid - the acceptors are laid out row by row in a grid of Rows rows. A phase 1 quorum is
+// a complete row, a phase 2 quorum is an acceptor of every row (e.g. a column). Every row
+// intersects every set with an acceptor of every row, so phase 2 quorums are as small as the
+// number of rows
+type Grid struct {
+	members members
+
+	Rows int
+
+	Columns int
+}
+
+// NewGrid - a grid quorum system; the number of acceptors has to be a multiple of rows
+func NewGrid(acceptors []v1.Addr, rows int) (*Grid, error) {
+	if rows <= 0 || len(acceptors)%rows != 0 {
+		return nil, fmt.Errorf("%d acceptors cannot be laid out in %d rows", len(acceptors), rows)
+	}
+	return &Grid{members: newMembers(acceptors), Rows: rows, Columns: len(acceptors) / rows}, nil
+}
+
+// rowCounts - the number of acceptors in acks of every row
+func (g *Grid) rowCounts(acks v1.AddrSet) []int {
+	counts := make([]int, g.Rows)
+	for _, i := range g.members.indexes(acks) {
+		counts[i/g.Columns]++
+	}
+	return counts
+}
+
+func (g *Grid) Phase1(acks v1.AddrSet) bool {
+	for _, n := range g.rowCounts(acks) {
+		if n == g.Columns {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Grid) Phase2(acks v1.AddrSet) bool {
+	for _, n := range g.rowCounts(acks) {
+		if n == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Grid) String() string {
+	return fmt.Sprintf("grid(%dx%d)", g.Rows, g.Columns)
+}
+
+// Weighted - every acceptor has a weight, and acceptors form a quorum in both phases once
+// their weights add up to more than half of the total
+type Weighted struct {
+	members members
+
+	Weights []float64
+
+	total float64
+}
+
+// NewWeighted - a weighted majority quorum system, with a weight for every acceptor in order
+func NewWeighted(acceptors []v1.Addr, weights []float64) (*Weighted, error) {
+	if len(weights) != len(acceptors) {
+		return nil, fmt.Errorf("expected %d weights, got %d", len(acceptors), len(weights))
+	}
+	total := float64(0)
+	for i, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("weights[%d]: must not be negative", i)
+		}
+		total += w
+	}
+	return &Weighted{members: newMembers(acceptors), Weights: weights, total: total}, nil
+}
+
+func (w *Weighted) weight(acks v1.AddrSet) float64 {
+	sum := float64(0)
+	for _, i := range w.members.indexes(acks) {
+		sum += w.Weights[i]
+	}
+	return sum
+}
+
+func (w *Weighted) Phase1(acks v1.AddrSet) bool {
+	return w.weight(acks) > w.total/2
+}
+
+func (w *Weighted) Phase2(acks v1.AddrSet) bool {
+	return w.weight(acks) > w.total/2
+}
+
+func (w *Weighted) String() string {
+	weights := make([]string, len(w.Weights))
+	for i, weight := range w.Weights {
+		weights[i] = fmt.Sprintf("%g", weight)
+	}
+	return fmt.Sprintf("weighted(%s)", strings.Join(weights, ","))
+}
+
+// Validate - every phase 1 quorum of the acceptors intersects every phase 2 quorum, and all
+// acceptors together form a quorum in both phases. Quorum systems are monotone, so it
+// suffices to check that no phase 1 quorum leaves a phase 2 quorum in its complement
+func Validate(s System, acceptors []v1.Addr) error {
+	n := len(acceptors)
+	if n == 0 {
+		return fmt.Errorf("no acceptors")
+	}
+	if n > MaxValidatedAcceptors {
+		return fmt.Errorf("cannot validate %s over %d acceptors, at most %d are supported",
+			s, n, MaxValidatedAcceptors)
+	}
+
+	all := subset(acceptors, 1<<uint(n)-1)
+	if !s.Phase1(all) || !s.Phase2(all) {
+		return fmt.Errorf("%s: all %d acceptors do not form a quorum", s, n)
+	}
+	for mask := 0; mask < 1<<uint(n); mask++ {
+		q1 := subset(acceptors, mask)
+		if !s.Phase1(q1) {
+			continue
+		}
+		q2 := subset(acceptors, ^mask&(1<<uint(n)-1))
+		if s.Phase2(q2) {
+			return fmt.Errorf("%s: phase 1 quorum %v does not intersect phase 2 quorum %v",
+				s, sortedIDs(q1), sortedIDs(q2))
+		}
+	}
+	return nil
+}
+
+func subset(acceptors []v1.Addr, mask int) v1.AddrSet {
+	result := make(v1.AddrSet)
+	for i, a := range acceptors {
+		if mask&(1<<uint(i)) != 0 {
+			result.Add(a)
+		}
+	}
+	return result
+}
+
+func sortedIDs(acks v1.AddrSet) []v1.ProcessID {
+	ids := make([]v1.ProcessID, 0, len(acks))
+	for a := range acks {
+		ids = append(ids, a.ID())
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,135 @@
+package quorum
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func newAcceptors(n int) []v1.Addr {
+	result := make([]v1.Addr, n)
+	for i := range result {
+		result[i] = v1.NewAddress(v1.ProcessID(i), v1.Acceptor)
+	}
+	return result
+}
+
+func acks(acceptors []v1.Addr, indexes ...int) v1.AddrSet {
+	result := make(v1.AddrSet)
+	for _, i := range indexes {
+		result.Add(acceptors[i])
+	}
+	return result
+}
+
+func TestMajority(t *testing.T) {
+	Convey("Given a majority quorum system of 5 acceptors", t, func() {
+		acceptors := newAcceptors(5)
+		q := NewMajority(acceptors)
+
+		Convey("3 acceptors form a quorum in both phases, 2 do not", func() {
+			So(q.Phase1(acks(acceptors, 0, 1, 2)), ShouldBeTrue)
+			So(q.Phase2(acks(acceptors, 2, 3, 4)), ShouldBeTrue)
+			So(q.Phase1(acks(acceptors, 0, 1)), ShouldBeFalse)
+			So(q.Phase2(acks(acceptors, 3, 4)), ShouldBeFalse)
+		})
+
+		Convey("acceptors which are not members are ignored", func() {
+			other := v1.NewAddress(9, v1.Acceptor)
+			So(q.Phase1(acks(append(acceptors, other), 0, 1, 5)), ShouldBeFalse)
+		})
+
+		Convey("its quorums intersect", func() {
+			So(Validate(q, acceptors), ShouldBeNil)
+		})
+	})
+}
+
+func TestSizes(t *testing.T) {
+	Convey("Given 6 acceptors", t, func() {
+		acceptors := newAcceptors(6)
+
+		Convey("phase 1 quorums of 4 intersect phase 2 quorums of 3", func() {
+			q := NewSizes(acceptors, 4, 3)
+			So(Validate(q, acceptors), ShouldBeNil)
+			So(q.Phase2(acks(acceptors, 0, 1, 2)), ShouldBeTrue)
+			So(q.Phase1(acks(acceptors, 0, 1, 2)), ShouldBeFalse)
+		})
+
+		Convey("phase 1 and phase 2 quorums of 3 do not intersect", func() {
+			So(Validate(NewSizes(acceptors, 3, 3), acceptors), ShouldNotBeNil)
+		})
+
+		Convey("quorums larger than the acceptors are never formed", func() {
+			So(Validate(NewSizes(acceptors, 7, 1), acceptors), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGrid(t *testing.T) {
+	Convey("Given a grid of 2 rows of 3 acceptors", t, func() {
+		acceptors := newAcceptors(6)
+		q, err := NewGrid(acceptors, 2)
+		So(err, ShouldBeNil)
+
+		Convey("a complete row is a phase 1 quorum", func() {
+			So(q.Phase1(acks(acceptors, 3, 4, 5)), ShouldBeTrue)
+			So(q.Phase1(acks(acceptors, 0, 1, 3, 4)), ShouldBeFalse)
+		})
+
+		Convey("an acceptor of every row is a phase 2 quorum", func() {
+			So(q.Phase2(acks(acceptors, 0, 5)), ShouldBeTrue)
+			So(q.Phase2(acks(acceptors, 0, 1, 2)), ShouldBeFalse)
+		})
+
+		Convey("its quorums intersect", func() {
+			So(Validate(q, acceptors), ShouldBeNil)
+		})
+	})
+
+	Convey("Acceptors which do not fill the rows are rejected", t, func() {
+		_, err := NewGrid(newAcceptors(5), 2)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestWeighted(t *testing.T) {
+	Convey("Given 4 weighted acceptors", t, func() {
+		acceptors := newAcceptors(4)
+		q, err := NewWeighted(acceptors, []float64{3, 1, 1, 1})
+		So(err, ShouldBeNil)
+
+		Convey("more than half of the total weight forms a quorum", func() {
+			So(q.Phase1(acks(acceptors, 0, 1)), ShouldBeTrue)
+			So(q.Phase2(acks(acceptors, 1, 2, 3)), ShouldBeFalse)
+			So(q.Phase2(acks(acceptors, 0)), ShouldBeFalse)
+		})
+
+		Convey("its quorums intersect", func() {
+			So(Validate(q, acceptors), ShouldBeNil)
+		})
+	})
+}
+
+func TestParseSpec(t *testing.T) {
+	Convey("Specs are parsed from their string form", t, func() {
+		for _, s := range []string{"majority", "sizes:4,3", "grid:2", "weighted:3,1,1,1"} {
+			spec, err := ParseSpec(s)
+			So(err, ShouldBeNil)
+			So(spec.String(), ShouldEqual, s)
+		}
+
+		Convey("malformed specs are rejected", func() {
+			for _, s := range []string{"sizes:4", "grid:x", "weighted:1,a", "paxos"} {
+				_, err := ParseSpec(s)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("a spec is checked against the number of acceptors", func() {
+			spec, _ := ParseSpec("sizes:4,3")
+			So(spec.Check(6), ShouldBeNil)
+			So(spec.Check(7), ShouldNotBeNil)
+		})
+	})
+}
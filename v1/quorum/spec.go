@@ -0,0 +1,134 @@
+package quorum
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"strconv"
+	"strings"
+)
+
+// Kinds of quorum systems
+const (
+	KindMajority = "majority"
+	KindSizes    = "sizes"
+	KindGrid     = "grid"
+	KindWeighted = "weighted"
+)
+
+// Spec - a serializable description of a quorum system, built once the acceptors are known
+type Spec struct {
+	// majority (default), sizes, grid or weighted
+	Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+
+	// sizes: number of acceptors in a phase 1 and a phase 2 quorum
+	Phase1 int `json:"phase1,omitempty" yaml:"phase1,omitempty"`
+
+	Phase2 int `json:"phase2,omitempty" yaml:"phase2,omitempty"`
+
+	// grid: number of rows the acceptors are laid out in
+	Rows int `json:"rows,omitempty" yaml:"rows,omitempty"`
+
+	// weighted: weight of every acceptor, in construction order
+	Weights []float64 `json:"weights,omitempty" yaml:"weights,omitempty"`
+}
+
+// IsMajority - whether the spec describes the classic majority quorums
+func (s Spec) IsMajority() bool {
+	return s.Kind == "" || s.Kind == KindMajority
+}
+
+// Build - the quorum system over the acceptors; fails unless its quorums intersect
+func (s Spec) Build(acceptors []v1.Addr) (System, error) {
+	var system System
+	var err error
+	switch s.Kind {
+	case "", KindMajority:
+		system = NewMajority(acceptors)
+	case KindSizes:
+		system = NewSizes(acceptors, s.Phase1, s.Phase2)
+	case KindGrid:
+		system, err = NewGrid(acceptors, s.Rows)
+	case KindWeighted:
+		system, err = NewWeighted(acceptors, s.Weights)
+	default:
+		err = fmt.Errorf("unknown quorum kind %q, expected majority, sizes, grid or weighted", s.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return system, Validate(system, acceptors)
+}
+
+// Check - build the quorum system over n acceptors, to validate a spec before a cluster is constructed
+func (s Spec) Check(n int) error {
+	acceptors := make([]v1.Addr, n)
+	for i := range acceptors {
+		acceptors[i] = v1.NewAddress(v1.ProcessID(i), v1.Acceptor)
+	}
+	_, err := s.Build(acceptors)
+	return err
+}
+
+func (s Spec) String() string {
+	switch s.Kind {
+	case KindSizes:
+		return fmt.Sprintf("%s:%d,%d", s.Kind, s.Phase1, s.Phase2)
+	case KindGrid:
+		return fmt.Sprintf("%s:%d", s.Kind, s.Rows)
+	case KindWeighted:
+		weights := make([]string, len(s.Weights))
+		for i, w := range s.Weights {
+			weights[i] = strconv.FormatFloat(w, 'g', -1, 64)
+		}
+		return fmt.Sprintf("%s:%s", s.Kind, strings.Join(weights, ","))
+	}
+	return KindMajority
+}
+
+// ParseSpec - parse the String form of a spec: majority, sizes:Q1,Q2, grid:ROWS or weighted:W1,W2,...
+func ParseSpec(str string) (Spec, error) {
+	kind, args := str, ""
+	if i := strings.Index(str, ":"); i >= 0 {
+		kind, args = str[:i], str[i+1:]
+	}
+	spec := Spec{Kind: kind}
+	switch kind {
+	case "", KindMajority:
+		return Spec{}, nil
+	case KindSizes:
+		sizes, err := parseInts(args)
+		if err != nil || len(sizes) != 2 {
+			return spec, fmt.Errorf("%q: expected sizes:Q1,Q2", str)
+		}
+		spec.Phase1, spec.Phase2 = sizes[0], sizes[1]
+	case KindGrid:
+		rows, err := strconv.Atoi(args)
+		if err != nil {
+			return spec, fmt.Errorf("%q: expected grid:ROWS", str)
+		}
+		spec.Rows = rows
+	case KindWeighted:
+		for _, w := range strings.Split(args, ",") {
+			weight, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+			if err != nil {
+				return spec, fmt.Errorf("%q: expected weighted:W1,W2,...", str)
+			}
+			spec.Weights = append(spec.Weights, weight)
+		}
+	default:
+		return spec, fmt.Errorf("unknown quorum kind %q, expected majority, sizes, grid or weighted", kind)
+	}
+	return spec, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	result := make([]int, 0)
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package raft
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/types"
+)
+
+// Entry - a command in the log, with the term in which the leader appended it
+type Entry struct {
+	Term int
+
+	Command types.Command
+}
+
+type basicMessage struct {
+	src v1.Addr
+}
+
+func (bm basicMessage) Src() v1.Addr {
+	return bm.src
+}
+
+// RequestVoteMessage - sent by a candidate to every other node to be elected leader of the term
+type RequestVoteMessage struct {
+	basicMessage
+	Term         int
+	LastLogIndex int
+	LastLogTerm  int
+}
+
+func NewRequestVoteMessage(source v1.Addr, term int, lastLogIndex int, lastLogTerm int) RequestVoteMessage {
+	return RequestVoteMessage{
+		basicMessage: basicMessage{src: source},
+		Term:         term,
+		LastLogIndex: lastLogIndex,
+		LastLogTerm:  lastLogTerm,
+	}
+}
+
+func (m RequestVoteMessage) MessageName() string { return "RequestVoteMessage" }
+
+// RequestVoteReplyMessage - whether the node voted for the candidate in the term
+type RequestVoteReplyMessage struct {
+	basicMessage
+	Term    int
+	Granted bool
+}
+
+func NewRequestVoteReplyMessage(source v1.Addr, term int, granted bool) RequestVoteReplyMessage {
+	return RequestVoteReplyMessage{
+		basicMessage: basicMessage{src: source},
+		Term:         term,
+		Granted:      granted,
+	}
+}
+
+func (m RequestVoteReplyMessage) MessageName() string { return "RequestVoteReplyMessage" }
+
+// AppendEntriesMessage - sent by the leader to replicate its log, and as a heartbeat if there
+// are no entries to send
+type AppendEntriesMessage struct {
+	basicMessage
+	Term int
+
+	// index & term of the entry preceding Entries
+	PrevLogIndex int
+	PrevLogTerm  int
+
+	Entries []Entry
+
+	// commit index of the leader
+	LeaderCommit int
+}
+
+func NewAppendEntriesMessage(source v1.Addr, term int, prevLogIndex int, prevLogTerm int, entries []Entry, leaderCommit int) AppendEntriesMessage {
+	return AppendEntriesMessage{
+		basicMessage: basicMessage{src: source},
+		Term:         term,
+		PrevLogIndex: prevLogIndex,
+		PrevLogTerm:  prevLogTerm,
+		Entries:      entries,
+		LeaderCommit: leaderCommit,
+	}
+}
+
+func (m AppendEntriesMessage) MessageName() string { return "AppendEntriesMessage" }
+
+// AppendEntriesReplyMessage - whether the follower's log matched the leader's at PrevLogIndex
+type AppendEntriesReplyMessage struct {
+	basicMessage
+	Term    int
+	Success bool
+
+	// on success, the index of the last entry known to match the leader's log
+	MatchIndex int
+
+	// on failure, the index the leader should retry from
+	ConflictIndex int
+}
+
+func NewAppendEntriesReplyMessage(source v1.Addr, term int, success bool, matchIndex int, conflictIndex int) AppendEntriesReplyMessage {
+	return AppendEntriesReplyMessage{
+		basicMessage:  basicMessage{src: source},
+		Term:          term,
+		Success:       success,
+		MatchIndex:    matchIndex,
+		ConflictIndex: conflictIndex,
+	}
+}
+
+func (m AppendEntriesReplyMessage) MessageName() string { return "AppendEntriesReplyMessage" }
+
+// tickMessage - sent by a node to itself, to time out elections & send heartbeats
+type tickMessage struct {
+	basicMessage
+}
@@ -0,0 +1,573 @@
+package raft
+
+// Raft (Ongaro & Ousterhout, 2014).
+//
+// Nodes are followers, candidates or the leader of a term. A follower which does not hear
+// from a leader within its randomized election timeout becomes a candidate, and the
+// candidate collecting the votes of a majority in its term becomes the leader. Only a
+// node whose log is at least as up to date as a voter's can win its vote, so a leader
+// holds every committed entry. The leader appends the requests of the clients to its log
+// and replicates them with AppendEntries; an entry of the leader's term is committed once
+// a majority stored it, together with every entry before it. Committed entries are applied
+// in log order, so the log index of an entry is the slot it is decided for.
+//
+// Nodes are addressed as replicas, so that clients & the invariant checker treat them like
+// the replicas of the other protocols. Followers forward requests to the leader they know of.
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// NoOp - the op of the entry a leader appends when it is elected, to commit the entries of earlier
+// terms, an ops.NoOp
+const NoOp = ops.NameNoOp
+
+// noVote - votedFor of a node which did not vote in its current term
+const noVote v1.ProcessID = -1
+
+// Role - the role of a node in its current term
+type Role int
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	return [...]string{"follower", "candidate", "leader"}[r]
+}
+
+// Node - a Raft node; it is addressed as a v1.Replica
+type Node struct {
+	v1.Process
+
+	exchange v1.MessageExchange
+
+	// every node of the cluster, including this one
+	peers []v1.Addr
+
+	role Role
+
+	currentTerm int
+
+	// candidate voted for in the current term
+	votedFor v1.ProcessID
+
+	// entries by index; log[0] is a sentinel of term 0, so the first entry has index 1
+	log []Entry
+
+	// index of the latest entry known to be committed
+	commitIndex int
+
+	// index of the latest entry applied
+	lastApplied int
+
+	// leader of the current term, nil if unknown
+	leader v1.Addr
+
+	// candidate: the nodes which voted for it, including itself
+	votes map[v1.ProcessID]bool
+
+	// leader: index of the next entry to send to every follower
+	nextIndex map[v1.ProcessID]int
+
+	// leader: index of the latest entry known to be stored by every follower
+	matchIndex map[v1.ProcessID]int
+
+	// leader: commands in its log, so a duplicated request is appended once
+	proposed map[string]bool
+
+	// requests received while no leader is known
+	pending []types.Command
+
+	// commands applied, so a command appended twice is applied once
+	performed map[string]bool
+
+	// committed commands, indexed by their log index
+	decisions types.SlotCommandMap
+
+	// a follower or candidate starts an election at this time, the zero time until the first tick
+	electionDeadline time.Time
+
+	// a leader sends AppendEntries to every follower at this time
+	heartbeatAt time.Time
+
+	electionTimeout time.Duration
+
+	heartbeatInterval time.Duration
+
+	random *rand.Rand
+
+	stateMachine statemachine.StateMachine
+
+	notifyClients bool
+
+	metrics nodeMetrics
+
+	// label identifying this node in its metrics
+	label string
+
+	events events.Sink
+
+	// the time of the elections & heartbeats
+	clock clock.Clock
+
+	// guards the node's state against concurrent readers
+	mu *sync.Mutex
+}
+
+// NewNodes - a cluster of n nodes, each registered with the exchange
+func NewNodes(exchange v1.MessageExchange, n int, opts ...Option) []*Node {
+	o := newOptions(opts)
+	nodes := make([]*Node, n)
+	peers := make([]v1.Addr, n)
+	for i := 0; i < n; i++ {
+		p := o.newProcess(v1.AllocateID(exchange, v1.Replica), v1.Replica)
+		nodes[i] = &Node{
+			Process:           p,
+			exchange:          exchange,
+			peers:             peers,
+			role:              Follower,
+			votedFor:          noVote,
+			log:               []Entry{{Term: 0}},
+			nextIndex:         make(map[v1.ProcessID]int),
+			matchIndex:        make(map[v1.ProcessID]int),
+			proposed:          make(map[string]bool),
+			pending:           make([]types.Command, 0),
+			performed:         make(map[string]bool),
+			decisions:         make(types.SlotCommandMap),
+			electionTimeout:   o.electionTimeout,
+			heartbeatInterval: o.heartbeatInterval,
+			random:            rand.New(rand.NewSource(o.seed + int64(i))),
+			stateMachine:      o.stateMachine(),
+			notifyClients:     o.notifyClients,
+			metrics:           newNodeMetrics(o.metrics),
+			label:             metrics.Label(p.GetAddr()),
+			events:            o.events,
+			clock:             o.clockOf(p.GetAddr()),
+			mu:                &sync.Mutex{},
+		}
+		peers[i] = p.GetAddr()
+		if err := exchange.Register(nodes[i]); err != nil {
+			log.Panicf("exchange.Register error %v", err)
+		}
+	}
+	return nodes
+}
+
+// Run - handle messages until the node is closed, timing out elections & sending heartbeats periodically
+func (n *Node) Run() {
+	ctxLog := log.WithFields(log.Fields{"Addr": n.GetAddr()})
+	done := make(chan struct{})
+	defer close(done)
+	go n.tick(done)
+
+	for {
+		msg, err := n.Process.Recv()
+		if err == v1.ErrProcessClosed {
+			ctxLog.Debugf("process closed")
+			return
+		}
+		if err != nil {
+			ctxLog.Panicf("error in inbox recv %v", err)
+		}
+
+		n.Handle(msg)
+	}
+}
+
+func (n *Node) tick(done chan struct{}) {
+	ticker := n.clock.NewTicker(n.heartbeatInterval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C():
+			// bypasses the exchange; the messages of a crashed node are dropped by the network
+			n.Process.Send(tickMessage{basicMessage{src: n.GetAddr()}})
+		}
+	}
+}
+
+// Handle - synchronously process a single message, as Run does for every message in the inbox
+func (n *Node) Handle(message v1.Message) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handleMessage(message, n.clock.Now())
+}
+
+func (n *Node) handleMessage(message v1.Message, now time.Time) {
+	switch m := message.(type) {
+	case messages.RequestMessage:
+		n.handleRequest(m)
+	case RequestVoteMessage:
+		n.handleRequestVote(m, now)
+	case RequestVoteReplyMessage:
+		n.handleRequestVoteReply(m, now)
+	case AppendEntriesMessage:
+		n.handleAppendEntries(m, now)
+	case AppendEntriesReplyMessage:
+		n.handleAppendEntriesReply(m, now)
+	case tickMessage:
+		n.handleTick(now)
+	default:
+		log.Panicf("Unknown message type %T", m)
+	}
+}
+
+func (n *Node) majority() int {
+	return len(n.peers)/2 + 1
+}
+
+func (n *Node) lastIndex() int {
+	return len(n.log) - 1
+}
+
+func (n *Node) lastTerm() int {
+	return n.log[n.lastIndex()].Term
+}
+
+func commandKey(command types.Command) string {
+	return command.GetClientID() + "/" + command.GetCommandID()
+}
+
+func isNoOp(command types.Command) bool {
+	operation, _ := ops.OperationOf(command)
+	_, ok := operation.(ops.NoOp)
+	return ok
+}
+
+// broadcast - send the message to every other node
+func (n *Node) broadcast(m v1.Message) {
+	for _, peer := range n.peers {
+		if peer.ID() != n.ID() {
+			n.send(peer, m)
+		}
+	}
+}
+
+func (n *Node) send(dest v1.Addr, m v1.Message) {
+	if err := n.exchange.Send(dest, m); err != nil {
+		log.WithFields(log.Fields{"Addr": n.GetAddr()}).Debugf("exchange.Send failed %v", err)
+	}
+}
+
+// resetElectionTimer - start an election after a random duration in [timeout, 2 * timeout)
+func (n *Node) resetElectionTimer(now time.Time) {
+	jitter := time.Duration(n.random.Int63n(int64(n.electionTimeout)))
+	n.electionDeadline = now.Add(n.electionTimeout + jitter)
+}
+
+func (n *Node) handleTick(now time.Time) {
+	switch {
+	case n.role == Leader:
+		if !now.Before(n.heartbeatAt) {
+			n.replicate(now)
+		}
+	case n.electionDeadline.IsZero():
+		n.resetElectionTimer(now)
+	case !now.Before(n.electionDeadline):
+		n.startElection(now)
+	}
+}
+
+// observeTerm - a node of a later term exists; step down to be a follower in that term
+func (n *Node) observeTerm(term int, src v1.Addr) {
+	if term <= n.currentTerm {
+		return
+	}
+	if n.role == Leader {
+		events.Emit(n.events, events.BallotPreempted{
+			Leader: n.GetAddr(),
+			Ballot: types.BallotNumber{Round: n.currentTerm, LeaderID: n.GetAddr()},
+			By:     types.BallotNumber{Round: term, LeaderID: src},
+		})
+	}
+	n.currentTerm = term
+	n.votedFor = noVote
+	n.role = Follower
+	n.leader = nil
+	n.metrics.term.Set(float64(term), n.label)
+}
+
+func (n *Node) startElection(now time.Time) {
+	n.currentTerm++
+	n.role = Candidate
+	n.votedFor = n.ID()
+	n.votes = map[v1.ProcessID]bool{n.ID(): true}
+	n.leader = nil
+	n.resetElectionTimer(now)
+	n.metrics.elections.Inc(n.label)
+	n.metrics.term.Set(float64(n.currentTerm), n.label)
+	log.WithFields(log.Fields{"Addr": n.GetAddr(), "term": n.currentTerm}).Debug("election started")
+	if len(n.votes) >= n.majority() {
+		n.becomeLeader(now)
+		return
+	}
+	n.broadcast(NewRequestVoteMessage(n.GetAddr(), n.currentTerm, n.lastIndex(), n.lastTerm()))
+}
+
+func (n *Node) handleRequestVote(m RequestVoteMessage, now time.Time) {
+	n.observeTerm(m.Term, m.Src())
+	// the candidate's log has to hold every entry this node holds
+	upToDate := m.LastLogTerm > n.lastTerm() ||
+		(m.LastLogTerm == n.lastTerm() && m.LastLogIndex >= n.lastIndex())
+	granted := m.Term == n.currentTerm && upToDate &&
+		(n.votedFor == noVote || n.votedFor == m.Src().ID())
+	if granted {
+		n.votedFor = m.Src().ID()
+		n.resetElectionTimer(now)
+	}
+	n.send(m.Src(), NewRequestVoteReplyMessage(n.GetAddr(), n.currentTerm, granted))
+}
+
+func (n *Node) handleRequestVoteReply(m RequestVoteReplyMessage, now time.Time) {
+	n.observeTerm(m.Term, m.Src())
+	if n.role != Candidate || m.Term != n.currentTerm || !m.Granted {
+		return
+	}
+	n.votes[m.Src().ID()] = true
+	if len(n.votes) >= n.majority() {
+		n.becomeLeader(now)
+	}
+}
+
+// becomeLeader - start replicating the log to the followers, with a no-op of the new term so
+// that the entries of earlier terms commit without waiting for a request
+func (n *Node) becomeLeader(now time.Time) {
+	n.role = Leader
+	n.leader = n.GetAddr()
+	n.nextIndex = make(map[v1.ProcessID]int)
+	n.matchIndex = make(map[v1.ProcessID]int)
+	for _, peer := range n.peers {
+		n.nextIndex[peer.ID()] = n.lastIndex() + 1
+		n.matchIndex[peer.ID()] = 0
+	}
+	n.proposed = make(map[string]bool)
+	for _, e := range n.log[1:] {
+		n.proposed[commandKey(e.Command)] = true
+	}
+	events.Emit(n.events, events.BallotAdopted{
+		Leader:  n.GetAddr(),
+		Ballot:  types.BallotNumber{Round: n.currentTerm, LeaderID: n.GetAddr()},
+		PValues: n.lastIndex() - n.commitIndex,
+	})
+	log.WithFields(log.Fields{"Addr": n.GetAddr(), "term": n.currentTerm}).Debug("elected leader")
+
+	n.append(ops.NewCommand(fmt.Sprintf("%v", n.GetAddr()), fmt.Sprintf("noop-%d", n.currentTerm), ops.NoOp{}))
+	for _, command := range n.pending {
+		n.append(command)
+	}
+	n.pending = n.pending[:0]
+	n.replicate(now)
+}
+
+// handleRequest - the leader appends the command to its log, others forward it to the leader
+func (n *Node) handleRequest(m messages.RequestMessage) {
+	switch {
+	case n.role == Leader:
+		if n.append(m.Command) {
+			for _, peer := range n.peers {
+				if peer.ID() != n.ID() {
+					n.sendAppendEntries(peer)
+				}
+			}
+		}
+	case n.leader != nil:
+		n.send(n.leader, m)
+	default:
+		n.pending = append(n.pending, m.Command)
+	}
+}
+
+// append - append the command to the leader's log, unless it is in the log already
+func (n *Node) append(command types.Command) bool {
+	key := commandKey(command)
+	if n.proposed[key] {
+		return false
+	}
+	n.proposed[key] = true
+	n.log = append(n.log, Entry{Term: n.currentTerm, Command: command})
+	n.matchIndex[n.ID()] = n.lastIndex()
+	n.advanceCommitIndex()
+	return true
+}
+
+// replicate - send AppendEntries to every follower, as a heartbeat if the follower is up to date
+func (n *Node) replicate(now time.Time) {
+	for _, peer := range n.peers {
+		if peer.ID() != n.ID() {
+			n.sendAppendEntries(peer)
+		}
+	}
+	n.heartbeatAt = now.Add(n.heartbeatInterval)
+}
+
+// sendAppendEntries - send the follower the entries from its next index on. The next index is
+// advanced optimistically; a follower missing entries rejects the next AppendEntries
+func (n *Node) sendAppendEntries(peer v1.Addr) {
+	next := n.nextIndex[peer.ID()]
+	last := n.lastIndex()
+	if last > next+MaxEntries-1 {
+		last = next + MaxEntries - 1
+	}
+	entries := make([]Entry, 0, last-next+1)
+	entries = append(entries, n.log[next:last+1]...)
+	n.send(peer, NewAppendEntriesMessage(n.GetAddr(), n.currentTerm, next-1, n.log[next-1].Term, entries, n.commitIndex))
+	n.nextIndex[peer.ID()] = last + 1
+}
+
+func (n *Node) handleAppendEntries(m AppendEntriesMessage, now time.Time) {
+	n.observeTerm(m.Term, m.Src())
+	if m.Term < n.currentTerm {
+		n.send(m.Src(), NewAppendEntriesReplyMessage(n.GetAddr(), n.currentTerm, false, 0, 0))
+		return
+	}
+	// m.Src() is the leader of the current term
+	n.role = Follower
+	n.resetElectionTimer(now)
+	if n.leader == nil {
+		n.leader = m.Src()
+		for _, command := range n.pending {
+			n.send(n.leader, messages.NewRequestMessage(n.GetAddr(), command))
+		}
+		n.pending = n.pending[:0]
+	}
+
+	if m.PrevLogIndex > n.lastIndex() {
+		n.send(m.Src(), NewAppendEntriesReplyMessage(n.GetAddr(), n.currentTerm, false, 0, n.lastIndex()+1))
+		return
+	}
+	if term := n.log[m.PrevLogIndex].Term; term != m.PrevLogTerm {
+		// skip every entry of the conflicting term
+		conflict := m.PrevLogIndex
+		for conflict > n.commitIndex+1 && n.log[conflict-1].Term == term {
+			conflict--
+		}
+		n.send(m.Src(), NewAppendEntriesReplyMessage(n.GetAddr(), n.currentTerm, false, 0, conflict))
+		return
+	}
+
+	for i, e := range m.Entries {
+		index := m.PrevLogIndex + 1 + i
+		if index <= n.lastIndex() {
+			if n.log[index].Term == e.Term {
+				continue
+			}
+			if index <= n.commitIndex {
+				log.Panicf("%v: truncating committed entry %d", n.GetAddr(), index)
+			}
+			n.log = n.log[:index]
+		}
+		n.log = append(n.log, e)
+	}
+	match := m.PrevLogIndex + len(m.Entries)
+	if m.LeaderCommit > n.commitIndex {
+		commit := m.LeaderCommit
+		if commit > match {
+			commit = match
+		}
+		n.commit(commit)
+	}
+	n.send(m.Src(), NewAppendEntriesReplyMessage(n.GetAddr(), n.currentTerm, true, match, 0))
+}
+
+func (n *Node) handleAppendEntriesReply(m AppendEntriesReplyMessage, now time.Time) {
+	n.observeTerm(m.Term, m.Src())
+	if n.role != Leader || m.Term != n.currentTerm {
+		return
+	}
+	id := m.Src().ID()
+	if m.Success {
+		if m.MatchIndex > n.matchIndex[id] {
+			n.matchIndex[id] = m.MatchIndex
+			n.advanceCommitIndex()
+		}
+		if n.nextIndex[id] <= m.MatchIndex {
+			n.nextIndex[id] = m.MatchIndex + 1
+		}
+		return
+	}
+	if m.ConflictIndex > n.matchIndex[id] && m.ConflictIndex < n.nextIndex[id] {
+		n.nextIndex[id] = m.ConflictIndex
+		n.sendAppendEntries(m.Src())
+	}
+}
+
+// advanceCommitIndex - commit the latest entry of the current term stored by a majority
+func (n *Node) advanceCommitIndex() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.log[index].Term != n.currentTerm {
+			return
+		}
+		stored := 0
+		for _, peer := range n.peers {
+			if n.matchIndex[peer.ID()] >= index {
+				stored++
+			}
+		}
+		if stored >= n.majority() {
+			n.commit(index)
+			return
+		}
+	}
+}
+
+// commit - every entry up to the index is committed; apply them in log order
+func (n *Node) commit(index int) {
+	if index <= n.commitIndex {
+		return
+	}
+	n.commitIndex = index
+	n.metrics.commitIndex.Set(float64(index), n.label)
+	for n.lastApplied < n.commitIndex {
+		n.lastApplied++
+		n.apply(types.Slot(n.lastApplied), n.log[n.lastApplied].Command)
+	}
+}
+
+func (n *Node) apply(slot types.Slot, command types.Command) {
+	n.decisions[slot] = command
+	events.Emit(n.events, events.SlotDecided{Replica: n.GetAddr(), Slot: slot, Command: command})
+	key := commandKey(command)
+	if isNoOp(command) || n.performed[key] {
+		return
+	}
+	n.performed[key] = true
+	result := ""
+	if n.stateMachine != nil {
+		result = n.stateMachine.Apply(command)
+	}
+	events.Emit(n.events, events.CommandPerformed{Replica: n.GetAddr(), Slot: slot, Command: command, Result: result})
+	if n.notifyClients && n.role == Leader {
+		dm := messages.NewDecisionMessage(n.GetAddr(), slot, command)
+		if err := n.exchange.SendAll(v1.Client, dm); err != nil {
+			log.Debugf("exchange.sendAll to clients failed %v", err)
+		}
+	}
+}
+
+// Decisions - a copy of the commands committed so far, indexed by their log index
+func (n *Node) Decisions() types.SlotCommandMap {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	result := make(types.SlotCommandMap, len(n.decisions))
+	for slot, command := range n.decisions {
+		result[slot] = command
+	}
+	return result
+}
@@ -0,0 +1,218 @@
+package raft
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+type envelope struct {
+	dest v1.Addr
+	m    v1.Message
+}
+
+// testNetwork - delivers messages synchronously, in the order they were sent
+type testNetwork struct {
+	queue []envelope
+
+	nodes map[v1.ProcessID]*Node
+
+	// messages from & to these nodes are dropped
+	crashed map[v1.ProcessID]bool
+
+	now time.Time
+
+	ids *v1.IDAllocator
+}
+
+func (n *testNetwork) Send(dest v1.Addr, m v1.Message) error {
+	if !n.isCrashed(dest) && !n.isCrashed(m.Src()) {
+		n.queue = append(n.queue, envelope{dest: dest, m: m})
+	}
+	return nil
+}
+
+// isCrashed - true if the process is one of the crashed nodes; clients never crash
+func (n *testNetwork) isCrashed(addr v1.Addr) bool {
+	return addr.Type() == v1.Replica && n.crashed[addr.ID()]
+}
+
+func (n *testNetwork) SendAll(pt v1.ProcessType, m v1.Message) error {
+	return nil
+}
+
+func (n *testNetwork) IDs() *v1.IDAllocator {
+	return n.ids
+}
+
+func (n *testNetwork) Register(p v1.ProcessInbox) error {
+	return nil
+}
+
+func (n *testNetwork) UnRegister(p v1.ProcessInbox) error {
+	return nil
+}
+
+func (n *testNetwork) deliverAll() {
+	for len(n.queue) > 0 {
+		e := n.queue[0]
+		n.queue = n.queue[1:]
+		n.nodes[e.dest.ID()].handleMessage(e.m, n.now)
+	}
+}
+
+func (n *testNetwork) request(node *Node, op string) {
+	operation, err := ops.Decode(op)
+	if err != nil {
+		panic(err)
+	}
+	command := ops.NewCommand("client:0", op, operation)
+	node.handleMessage(messages.NewRequestMessage(v1.NewAddress(0, v1.Client), command), n.now)
+	n.deliverAll()
+}
+
+// elect - let the election timeout of the node expire
+func (n *testNetwork) elect(node *Node) {
+	node.handleMessage(tickMessage{basicMessage{src: node.GetAddr()}}, n.now)
+	n.now = n.now.Add(2 * DefaultElectionTimeout)
+	node.handleMessage(tickMessage{basicMessage{src: node.GetAddr()}}, n.now)
+	n.deliverAll()
+}
+
+// heartbeat - let the leader send AppendEntries, so the followers learn its commit index
+func (n *testNetwork) heartbeat(leader *Node) {
+	n.now = n.now.Add(DefaultHeartbeatInterval)
+	leader.handleMessage(tickMessage{basicMessage{src: leader.GetAddr()}}, n.now)
+	n.deliverAll()
+}
+
+func newTestCluster(n int, opts ...Option) (*testNetwork, []*Node) {
+	network := &testNetwork{
+		nodes:   make(map[v1.ProcessID]*Node),
+		crashed: make(map[v1.ProcessID]bool),
+		now:     time.Now(),
+		ids:     v1.NewIDAllocator(),
+	}
+	nodes := NewNodes(network, n, opts...)
+	for _, node := range nodes {
+		network.nodes[node.ID()] = node
+	}
+	return network, nodes
+}
+
+func decisionLogs(nodes []*Node) []invariant.DecisionLog {
+	logs := make([]invariant.DecisionLog, 0, len(nodes))
+	for _, node := range nodes {
+		logs = append(logs, invariant.DecisionLog{Replica: node.GetAddr(), Decisions: node.Decisions()})
+	}
+	return logs
+}
+
+func TestNode_Election(t *testing.T) {
+	Convey("Given a cluster of three nodes", t, func() {
+		network, nodes := newTestCluster(3)
+
+		Convey("the node whose election timeout expires first is elected leader", func() {
+			network.elect(nodes[1])
+
+			So(nodes[1].Role(), ShouldEqual, Leader)
+			So(nodes[1].Term(), ShouldEqual, 1)
+			for _, node := range []*Node{nodes[0], nodes[2]} {
+				So(node.Role(), ShouldEqual, Follower)
+				So(node.Term(), ShouldEqual, 1)
+				So(node.leader, ShouldResemble, nodes[1].GetAddr())
+			}
+
+			Convey("and commits a no-op of its term", func() {
+				network.heartbeat(nodes[1])
+				for _, node := range nodes {
+					So(node.Decisions()[1].GetOp(), ShouldEqual, NoOp)
+				}
+			})
+		})
+
+		Convey("a candidate missing committed entries is not elected", func() {
+			network.elect(nodes[0])
+			network.crashed[nodes[2].ID()] = true
+			network.request(nodes[0], "PUT a 1")
+			network.crashed[nodes[2].ID()] = false
+			network.crashed[nodes[0].ID()] = true
+
+			network.elect(nodes[2])
+			So(nodes[2].Role(), ShouldEqual, Candidate)
+
+			network.elect(nodes[1])
+			So(nodes[1].Role(), ShouldEqual, Leader)
+		})
+	})
+}
+
+func TestNode_Replication(t *testing.T) {
+	Convey("Given a cluster of three nodes applying commands to a KV store", t, func() {
+		stores := make([]*statemachine.KV, 0)
+		network, nodes := newTestCluster(3, WithStateMachines(func() statemachine.StateMachine {
+			kv := statemachine.NewKV()
+			stores = append(stores, kv)
+			return kv
+		}))
+		network.elect(nodes[0])
+
+		Convey("requests sent to any node are committed in the same slots by every node", func() {
+			network.request(nodes[0], "PUT a 1")
+			network.request(nodes[1], "PUT b 2")
+			network.request(nodes[2], "PUT a 3")
+			network.heartbeat(nodes[0])
+
+			So(invariant.CheckDecisions(decisionLogs(nodes)), ShouldBeEmpty)
+			for i, node := range nodes {
+				So(len(node.Decisions()), ShouldEqual, 4)
+				So(stores[i].Applied(), ShouldEqual, 3)
+				v, _ := stores[i].Get("a")
+				So(v, ShouldEqual, "3")
+			}
+		})
+
+		Convey("a duplicated request is committed once", func() {
+			network.request(nodes[0], "PUT a 1")
+			network.request(nodes[0], "PUT a 1")
+			So(len(nodes[0].Decisions()), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestNode_LeaderCrash(t *testing.T) {
+	Convey("Given a cluster of three nodes whose leader crashes", t, func() {
+		network, nodes := newTestCluster(3)
+		network.elect(nodes[0])
+		network.request(nodes[0], "PUT a 1")
+		network.crashed[nodes[0].ID()] = true
+
+		// the crashed leader appends entries it cannot replicate
+		network.request(nodes[0], "PUT a 2")
+
+		Convey("another node is elected in a later term and keeps the committed entries", func() {
+			network.elect(nodes[1])
+			So(nodes[1].Role(), ShouldEqual, Leader)
+			So(nodes[1].Term(), ShouldEqual, 2)
+			network.request(nodes[2], "PUT b 3")
+			network.heartbeat(nodes[1])
+			So(nodes[2].Decisions()[2].GetOp(), ShouldEqual, "PUT a 1")
+			So(len(nodes[2].Decisions()), ShouldEqual, 4)
+
+			Convey("and the old leader's uncommitted entries are replaced once it recovers", func() {
+				network.crashed[nodes[0].ID()] = false
+				network.heartbeat(nodes[1])
+				network.heartbeat(nodes[1])
+
+				So(nodes[0].Role(), ShouldEqual, Follower)
+				So(nodes[0].Decisions(), ShouldResemble, nodes[1].Decisions())
+				So(invariant.CheckDecisions(decisionLogs(nodes)), ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,181 @@
+package raft
+
+import (
+	"github.com/1xyz/paxossim/queue"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"time"
+)
+
+const (
+	// DefaultElectionTimeout - a follower which does not hear from a leader for a random
+	// duration between this and twice this starts an election
+	DefaultElectionTimeout = 150 * time.Millisecond
+
+	// DefaultHeartbeatInterval - interval between consecutive AppendEntries of a leader
+	DefaultHeartbeatInterval = 30 * time.Millisecond
+
+	// MaxEntries - the maximum number of entries sent in one AppendEntries
+	MaxEntries = 64
+)
+
+// Option - configures optional behaviour of a node
+type Option func(*options)
+
+type options struct {
+	metrics *metrics.Registry
+
+	events events.Sink
+
+	// the leader sends every committed command to the clients as well
+	notifyClients bool
+
+	// creates the state machine every node applies its committed commands to, if set
+	newStateMachine func() statemachine.StateMachine
+
+	electionTimeout time.Duration
+
+	heartbeatInterval time.Duration
+
+	// seeds the randomized election timeouts
+	seed int64
+
+	// timeouts & ticks are measured on this clock, the real clock if nil
+	clock clock.Clock
+
+	// creates the clock of every node, instead of sharing clock, if set
+	newClock func(addr v1.Addr) clock.Clock
+
+	// capacity & overflow policy of the nodes' inboxes, unbounded if nil
+	inbox *queue.Options
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		electionTimeout:   DefaultElectionTimeout,
+		heartbeatInterval: DefaultHeartbeatInterval,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.clock = clock.OrReal(o.clock)
+	return o
+}
+
+// stateMachine - a new state machine for a node, nil if none is configured
+func (o options) stateMachine() statemachine.StateMachine {
+	if o.newStateMachine == nil {
+		return nil
+	}
+	return o.newStateMachine()
+}
+
+// WithMetrics - record the node's metrics to the specified registry
+func WithMetrics(r *metrics.Registry) Option {
+	return func(o *options) {
+		o.metrics = r
+	}
+}
+
+// WithEventSink - emit the node's protocol events to the specified sink
+func WithEventSink(sink events.Sink) Option {
+	return func(o *options) {
+		o.events = sink
+	}
+}
+
+// WithClientNotifications - the leader sends every command it commits to the clients
+func WithClientNotifications() Option {
+	return func(o *options) {
+		o.notifyClients = true
+	}
+}
+
+// WithStateMachines - every node applies the committed commands to a state machine of its
+// own, created by the specified function
+func WithStateMachines(newStateMachine func() statemachine.StateMachine) Option {
+	return func(o *options) {
+		o.newStateMachine = newStateMachine
+	}
+}
+
+// WithElectionTimeout - followers start an election after a random duration between d and 2d
+// without hearing from a leader
+func WithElectionTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.electionTimeout = d
+	}
+}
+
+// WithHeartbeatInterval - the leader sends AppendEntries to every follower at this interval
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.heartbeatInterval = d
+	}
+}
+
+// WithSeed - seed for the randomized election timeouts of the nodes
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = seed
+	}
+}
+
+// WithClock - the nodes read the time, and tick, on the specified clock instead of the host's
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithClocks - every node reads the time, and measures its timeouts & ticks, on a clock of its
+// own created by the specified function, e.g. to skew the clock of a single node
+func WithClocks(newClock func(addr v1.Addr) clock.Clock) Option {
+	return func(o *options) {
+		o.newClock = newClock
+	}
+}
+
+// clockOf - the clock of the node, the shared clock unless every node has its own
+func (o options) clockOf(addr v1.Addr) clock.Clock {
+	if o.newClock == nil {
+		return o.clock
+	}
+	return clock.OrReal(o.newClock(addr))
+}
+
+// WithInbox - the inbox of every node is a queue bounded by the specified options
+func WithInbox(inbox queue.Options) Option {
+	return func(o *options) {
+		o.inbox = &inbox
+	}
+}
+
+// newProcess - a process whose inbox is bounded by the configured options, if any
+func (o options) newProcess(id v1.ProcessID, pt v1.ProcessType) v1.Process {
+	if o.inbox == nil {
+		return v1.NewProcess(id, pt)
+	}
+	return v1.NewProcessWithInbox(id, pt, queue.NewBoundedQueue(*o.inbox))
+}
+
+// nodeMetrics - metrics recorded by a node, labelled by the node
+type nodeMetrics struct {
+	elections   *metrics.CounterVec
+	term        *metrics.GaugeVec
+	commitIndex *metrics.GaugeVec
+}
+
+func newNodeMetrics(r *metrics.Registry) nodeMetrics {
+	return nodeMetrics{
+		elections: r.Counter("raft_elections_total",
+			"Elections started by a node", "node"),
+		term: r.Gauge("raft_term",
+			"Current term of a node", "node"),
+		commitIndex: r.Gauge("raft_commit_index",
+			"Index of the latest log entry the node knows to be committed", "node"),
+	}
+}
@@ -0,0 +1,50 @@
+package raft
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/components"
+	"github.com/1xyz/paxossim/v1/types"
+)
+
+// Snapshot - the state of the node in the shape of a classic replica's: the entries which are
+// not committed yet are its proposals, and the leader it knows of its leader configuration
+func (n *Node) Snapshot() components.ReplicaSnapshot {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	proposals := make(types.SlotCommandMap)
+	for index := n.commitIndex + 1; index <= n.lastIndex(); index++ {
+		proposals[types.Slot(index)] = n.log[index].Command
+	}
+	decisions := make(types.SlotCommandMap, len(n.decisions))
+	for slot, command := range n.decisions {
+		decisions[slot] = command
+	}
+	leaders := make([]v1.Addr, 0, 1)
+	if n.leader != nil {
+		leaders = append(leaders, n.leader)
+	}
+	return components.ReplicaSnapshot{
+		Addr:      n.GetAddr(),
+		SlotIn:    types.Slot(n.lastIndex() + 1),
+		SlotOut:   types.Slot(n.commitIndex + 1),
+		Requests:  len(n.pending),
+		Proposals: proposals,
+		Decisions: decisions,
+		Leaders:   leaders,
+		InboxLen:  n.InboxLen(),
+	}
+}
+
+// Role - the role of the node in its current term
+func (n *Node) Role() Role {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role
+}
+
+// Term - the current term of the node
+func (n *Node) Term() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.currentTerm
+}
@@ -0,0 +1,231 @@
+package replay
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/components"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/trace"
+)
+
+// Replayer - re-feeds the deliveries recorded in a trace, in step order, into fresh
+// Acceptors, Leaders and Replicas. Every message is handled synchronously, so a replay
+// is deterministic and can be stepped through.
+//
+// Deliveries to Scouts and Commanders are skipped; their outputs to the leaders are part
+// of the trace. Messages sent by the fresh processes are discarded for the same reason.
+type Replayer struct {
+	entries []trace.Entry
+
+	// index of the next entry
+	pos int
+
+	decoder *trace.Decoder
+
+	// recorded address of a process to its fresh counterpart
+	addrs map[v1.Addr]v1.Addr
+
+	handlers map[v1.Addr]func(m v1.Message)
+
+	acceptors []*components.Acceptor
+
+	leaders []*components.Leader
+
+	replicas []*components.Replica
+
+	// recorded addresses of the replicas
+	replicaAddrs []v1.Addr
+}
+
+// New - a replayer for the cluster recorded in the trace: its Paxos groups, quorums and
+// auxiliary acceptors. Fails for a trace which does not record its cluster, e.g. of the EPaxos
+// or Raft protocols
+func New(entries []trace.Entry) (*Replayer, error) {
+	cluster, err := trace.ClusterOf(entries)
+	if err != nil {
+		return nil, err
+	}
+	if len(cluster.Groups) == 0 {
+		return nil, fmt.Errorf("trace does not record any Paxos group")
+	}
+	r := &Replayer{
+		entries:  entries,
+		addrs:    make(map[v1.Addr]v1.Addr),
+		handlers: make(map[v1.Addr]func(m v1.Message)),
+	}
+	r.decoder = trace.NewDecoder(r.resolve)
+
+	exchange := newDiscardExchange()
+	for g, group := range cluster.Groups {
+		if err := r.addGroup(exchange, cluster, group); err != nil {
+			return nil, fmt.Errorf("group %d: %v", g, err)
+		}
+	}
+	return r, nil
+}
+
+// addGroup - fresh acceptors, leaders & replicas in place of the recorded ones of a group
+func (r *Replayer) addGroup(exchange v1.MessageExchange, cluster trace.Cluster, group trace.Group) error {
+	if len(group.Acceptors) == 0 || len(group.Leaders) == 0 || len(group.Replicas) == 0 {
+		return fmt.Errorf("trace does not record acceptors, leaders and replicas")
+	}
+	acceptorAddrs, err := r.addAcceptors(exchange, group.Acceptors)
+	if err != nil {
+		return err
+	}
+	auxAddrs, err := r.addAcceptors(exchange, group.Auxiliaries)
+	if err != nil {
+		return err
+	}
+	// quorums are counted over the main & auxiliary acceptors alike
+	system, err := cluster.Quorum.Build(append(append([]v1.Addr{}, acceptorAddrs...), auxAddrs...))
+	if err != nil {
+		return fmt.Errorf("quorum: %v", err)
+	}
+	leaderOpts := []components.Option{components.WithQuorum(system)}
+	if cluster.Fast {
+		leaderOpts = append(leaderOpts, components.WithFastPaxos())
+	}
+	if len(auxAddrs) > 0 {
+		leaderOpts = append(leaderOpts, components.WithAuxiliaryAcceptors(auxAddrs))
+	}
+
+	leaderAddrs := make([]v1.Addr, 0)
+	for _, a := range group.Leaders {
+		recorded, err := a.Addr()
+		if err != nil {
+			return err
+		}
+		l := components.NewLeader(exchange, acceptorAddrs, leaderOpts...)
+		r.leaders = append(r.leaders, l)
+		r.bind(recorded, l.GetAddr(), l.Handle)
+		leaderAddrs = append(leaderAddrs, l.GetAddr())
+	}
+	for _, a := range group.Replicas {
+		recorded, err := a.Addr()
+		if err != nil {
+			return err
+		}
+		rp := components.NewReplica(exchange, leaderAddrs)
+		r.replicas = append(r.replicas, rp)
+		r.replicaAddrs = append(r.replicaAddrs, recorded)
+		r.bind(recorded, rp.GetAddr(), rp.Handle)
+	}
+	return nil
+}
+
+// addAcceptors - fresh acceptors in place of the recorded ones, returns their addresses
+func (r *Replayer) addAcceptors(exchange v1.MessageExchange, recorded []trace.Addr) ([]v1.Addr, error) {
+	result := make([]v1.Addr, 0, len(recorded))
+	for _, a := range recorded {
+		addr, err := a.Addr()
+		if err != nil {
+			return nil, err
+		}
+		acceptor := components.NewAcceptor(exchange)
+		r.acceptors = append(r.acceptors, acceptor)
+		r.bind(addr, acceptor.GetAddr(), acceptor.Handle)
+		result = append(result, acceptor.GetAddr())
+	}
+	return result, nil
+}
+
+func (r *Replayer) bind(recorded v1.Addr, fresh v1.Addr, handle func(m v1.Message)) {
+	r.addrs[recorded] = fresh
+	r.handlers[recorded] = handle
+}
+
+func (r *Replayer) resolve(addr v1.Addr) v1.Addr {
+	if fresh, ok := r.addrs[v1.NewAddress(addr.ID(), addr.Type())]; ok {
+		return fresh
+	}
+	return addr
+}
+
+// Step - deliver the next recorded message addressed to an Acceptor, a Leader or a Replica.
+// Returns false once the trace is exhausted
+func (r *Replayer) Step() (trace.Entry, bool, error) {
+	for r.pos < len(r.entries) {
+		e := r.entries[r.pos]
+		r.pos++
+		if e.Kind != trace.KindDeliver {
+			continue
+		}
+		dest, err := e.Dest.Addr()
+		if err != nil {
+			return e, false, fmt.Errorf("entry %d: %v", e.Step, err)
+		}
+		handle, ok := r.handlers[dest]
+		if !ok {
+			continue
+		}
+		m, err := r.decoder.Decode(e)
+		if err != nil {
+			return e, false, err
+		}
+		handle(m)
+		return e, true, nil
+	}
+	return trace.Entry{}, false, nil
+}
+
+// Run - deliver all the remaining messages
+func (r *Replayer) Run() error {
+	for {
+		_, ok, err := r.Step()
+		if err != nil || !ok {
+			return err
+		}
+	}
+}
+
+// DecisionLogs - the decisions made so far at every replica, keyed by the recorded replica address
+func (r *Replayer) DecisionLogs() []invariant.DecisionLog {
+	result := make([]invariant.DecisionLog, 0, len(r.replicas))
+	for i, rp := range r.replicas {
+		result = append(result, invariant.DecisionLog{Replica: r.replicaAddrs[i], Decisions: rp.Decisions()})
+	}
+	return result
+}
+
+// Close - stop the scouts & commanders spawned by the replayed leaders
+func (r *Replayer) Close() {
+	for _, l := range r.leaders {
+		l.Close()
+	}
+	for _, a := range r.acceptors {
+		a.Close()
+	}
+	for _, rp := range r.replicas {
+		rp.Close()
+	}
+}
+
+// discardExchange - registers processes but discards every message sent
+type discardExchange struct {
+	ids *v1.IDAllocator
+}
+
+func newDiscardExchange() v1.MessageExchange {
+	return discardExchange{ids: v1.NewIDAllocator()}
+}
+
+func (d discardExchange) IDs() *v1.IDAllocator {
+	return d.ids
+}
+
+func (discardExchange) Send(dest v1.Addr, m v1.Message) error {
+	return nil
+}
+
+func (discardExchange) SendAll(pt v1.ProcessType, m v1.Message) error {
+	return nil
+}
+
+func (discardExchange) Register(p v1.ProcessInbox) error {
+	return nil
+}
+
+func (discardExchange) UnRegister(p v1.ProcessInbox) error {
+	return nil
+}
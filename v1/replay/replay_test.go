@@ -0,0 +1,135 @@
+package replay
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/quorum"
+	"github.com/1xyz/paxossim/v1/trace"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestReplayer(t *testing.T) {
+	Convey("Given a trace of a run on a delaying network", t, func() {
+		sink := trace.NewMemory()
+		e := env.NewEnvWithConfig(env.Config{
+			NFailures:         1,
+			NClients:          2,
+			ClientReqInterval: 5 * time.Millisecond,
+			Faults:            v1.FaultModel{MinDelay: 0, MaxDelay: 2 * time.Millisecond},
+			Seed:              7,
+			Trace:             sink,
+		})
+		e.Run()
+		time.Sleep(200 * time.Millisecond)
+		e.Stop()
+		live := e.DecisionLogs()
+
+		Convey("replaying the trace", func() {
+			r, err := New(sink.Entries())
+			So(err, ShouldBeNil)
+			defer r.Close()
+			So(r.Run(), ShouldBeNil)
+			replayed := r.DecisionLogs()
+
+			Convey("reproduces every decision of the run", func() {
+				So(len(replayed), ShouldEqual, len(live))
+				for i, l := range live {
+					So(len(l.Decisions), ShouldBeGreaterThan, 0)
+					So(replayed[i].Replica, ShouldResemble, l.Replica)
+					for slot, command := range l.Decisions {
+						So(replayed[i].Decisions[slot], ShouldResemble, command)
+					}
+				}
+				So(invariant.CheckDecisions(replayed), ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReplayer_Cluster(t *testing.T) {
+	record := func(cfg env.Config) ([]trace.Entry, []invariant.DecisionLog) {
+		sink := trace.NewMemory()
+		cfg.NFailures = 1
+		cfg.NClients = 2
+		cfg.ClientReqInterval = 5 * time.Millisecond
+		cfg.Trace = sink
+		e := env.NewEnvWithConfig(cfg)
+		e.Run()
+		time.Sleep(200 * time.Millisecond)
+		e.Stop()
+		return sink.Entries(), e.DecisionLogs()
+	}
+	reproduces := func(r *Replayer, live []invariant.DecisionLog) {
+		So(r.Run(), ShouldBeNil)
+		replayed := r.DecisionLogs()
+		So(len(replayed), ShouldEqual, len(live))
+		for i, l := range live {
+			So(replayed[i].Replica, ShouldResemble, l.Replica)
+			for slot, command := range l.Decisions {
+				So(replayed[i].Decisions[slot], ShouldResemble, command)
+			}
+		}
+	}
+
+	Convey("Given a trace of a sharded cluster with sized quorums", t, func() {
+		entries, live := record(env.Config{
+			NAcceptors: 4,
+			Quorum:     quorum.Spec{Kind: quorum.KindSizes, Phase1: 3, Phase2: 2},
+			Keys:       8,
+			Groups:     2,
+		})
+		cluster, err := trace.ClusterOf(entries)
+		So(err, ShouldBeNil)
+		So(cluster.Groups, ShouldHaveLength, 2)
+
+		Convey("the replayed leaders of a group contact the acceptors of their group only", func() {
+			r, err := New(entries)
+			So(err, ShouldBeNil)
+			defer r.Close()
+			So(r.leaders, ShouldHaveLength, 4)
+			for i, l := range r.leaders {
+				group := cluster.Groups[i/2]
+				acceptors := make([]v1.Addr, 0)
+				for _, a := range group.Acceptors {
+					recorded, _ := a.Addr()
+					acceptors = append(acceptors, r.resolve(recorded))
+				}
+				So(l.Snapshot().Acceptors, ShouldResemble, acceptors)
+			}
+			reproduces(r, live)
+		})
+	})
+
+	Convey("Given a trace of a Cheap Paxos cluster", t, func() {
+		entries, live := record(env.Config{Protocol: env.Cheap})
+
+		Convey("the replayed leaders contact the main acceptors only", func() {
+			r, err := New(entries)
+			So(err, ShouldBeNil)
+			defer r.Close()
+			So(r.acceptors, ShouldHaveLength, 3)
+			for _, l := range r.leaders {
+				So(l.Snapshot().Acceptors, ShouldResemble, []v1.Addr{r.acceptors[0].GetAddr(), r.acceptors[1].GetAddr()})
+			}
+			reproduces(r, live)
+		})
+	})
+
+	Convey("Given a trace which does not record its cluster", t, func() {
+		entries, _ := record(env.Config{})
+		unrecorded := make([]trace.Entry, 0, len(entries))
+		for _, e := range entries {
+			if e.Kind != trace.KindCluster {
+				unrecorded = append(unrecorded, e)
+			}
+		}
+
+		Convey("it cannot be replayed", func() {
+			_, err := New(unrecorded)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,250 @@
+package scenario
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/metrics"
+	"github.com/1xyz/paxossim/v1/trace"
+	log "github.com/sirupsen/logrus"
+	"sort"
+)
+
+// Result - The outcome of a scenario run
+type Result struct {
+	Scenario string `json:"scenario"`
+
+	// Number of decided slots at each replica
+	Decisions map[string]int `json:"decisions"`
+
+	// Invariant violations detected at the end of the run
+	Violations []invariant.Violation `json:"violations"`
+
+	// Assertions which did not hold
+	Failures []string `json:"failures"`
+
+	// true if the scenario expects invariant violations, see Assertions.ExpectConflictingDecisions
+	ExpectViolations bool `json:"expect_violations,omitempty"`
+}
+
+// Passed - true if all the assertions of the scenario held, and no invariant was violated unless
+// the scenario expects violations
+func (r *Result) Passed() bool {
+	if len(r.Violations) > 0 && !r.ExpectViolations {
+		return false
+	}
+	return len(r.Failures) == 0
+}
+
+// Option - customizes the Env configuration derived from a scenario, e.g. to enable tracing
+type Option func(cfg *env.Config)
+
+// WithTrace - record every message delivery of the run to the sink
+func WithTrace(sink trace.Sink) Option {
+	return func(cfg *env.Config) {
+		cfg.Trace = sink
+	}
+}
+
+// WithMetrics - record the metrics of every process of the run to the registry
+func WithMetrics(r *metrics.Registry) Option {
+	return func(cfg *env.Config) {
+		cfg.Metrics = r
+	}
+}
+
+// WithEvents - record the protocol events of every process of the run to the sink
+func WithEvents(sink events.Sink) Option {
+	return func(cfg *env.Config) {
+		cfg.Events = sink
+	}
+}
+
+// WithClock - run the processes on the clock; a run on a clock.Fake takes no time, see RunEnv
+func WithClock(c clock.Clock) Option {
+	return func(cfg *env.Config) {
+		cfg.Clock = c
+	}
+}
+
+// Config - the Env configuration described by this scenario
+func (s *Scenario) Config(opts ...Option) env.Config {
+	cfg := env.Config{
+		NFailures:         s.Cluster.Failures,
+		NClients:          s.Workload.Clients,
+		ClientReqInterval: s.Workload.RequestInterval.Duration,
+		Faults:            s.Network.FaultModel(),
+		Seed:              s.Seed,
+		NAcceptors:        s.Cluster.Acceptors,
+		Quorum:            s.Cluster.Quorum,
+		Keys:              s.Workload.Keys,
+		Groups:            s.Cluster.Groups,
+		Partition:         s.Cluster.Partition,
+		Inbox:             s.Cluster.Inbox.Options(),
+	}
+	// validated by Validate
+	cfg.Protocol, _ = env.ParseProtocol(s.Cluster.Protocol)
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// NewEnv - construct (but do not run) the Env described by this scenario
+func (s *Scenario) NewEnv(opts ...Option) *env.Env {
+	return env.NewEnvWithConfig(s.Config(opts...))
+}
+
+// Run - build the Env described by the scenario, run it for the
+// scenario's duration while applying the timeline, and check the assertions
+func Run(s *Scenario, opts ...Option) (*Result, error) {
+	return RunEnv(s, s.NewEnv(opts...))
+}
+
+// RunEnv - run an Env constructed by NewEnv for the scenario's duration while
+// applying the timeline, and check the assertions. The duration elapses on the clock of the Env,
+// which RunEnv advances if it is a clock.Fake
+func RunEnv(s *Scenario, e *env.Env) (*Result, error) {
+	timeline := make([]Event, len(s.Timeline))
+	copy(timeline, s.Timeline)
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].At.Duration < timeline[j].At.Duration
+	})
+
+	ctxLog := log.WithFields(log.Fields{"Scenario": s.Name})
+	ctxLog.Debugf("Running scenario")
+	c := e.Clock()
+	start := c.Now()
+	e.Run()
+	for _, event := range timeline {
+		clock.Sleep(c, event.At.Duration-clock.Since(c, start))
+		ctxLog.Debugf("Applying %s at %v", event.Action, clock.Since(c, start))
+		if err := Apply(e, event); err != nil {
+			e.Stop()
+			return nil, err
+		}
+	}
+	clock.Sleep(c, s.Duration.Duration-clock.Since(c, start))
+	e.Stop()
+
+	return Check(s, e), nil
+}
+
+// Apply - apply a single timeline event to the Env
+func Apply(e *env.Env, event Event) error {
+	network := e.Network()
+	switch event.Action {
+	case ActionCrash, ActionRestart:
+		if event.Target.IsCoordinator() {
+			if event.Action == ActionCrash {
+				e.Coordinator().Crash()
+				return nil
+			}
+			return e.Coordinator().Restart()
+		}
+		addr, err := e.Addr(event.Target.ProcessType(), event.Target.Index)
+		if err != nil {
+			return err
+		}
+		if event.Action == ActionCrash {
+			network.Crash(addr)
+		} else {
+			network.Restart(addr)
+		}
+
+	case ActionPartition:
+		groups := make([][]v1.Addr, len(event.Groups))
+		for i, group := range event.Groups {
+			for _, target := range group {
+				addr, err := e.Addr(target.ProcessType(), target.Index)
+				if err != nil {
+					return err
+				}
+				groups[i] = append(groups[i], addr)
+			}
+		}
+		network.Partition(groups...)
+
+	case ActionHeal:
+		network.Heal()
+
+	case ActionReconfigure:
+		leaders := make([]v1.Addr, 0, len(event.Leaders))
+		for _, index := range event.Leaders {
+			addr, err := e.Addr(v1.Leader, index)
+			if err != nil {
+				return err
+			}
+			leaders = append(leaders, addr)
+		}
+		return e.Reconfigure(leaders)
+
+	case ActionMove:
+		return e.MoveRange(event.Range, event.Group)
+
+	case ActionTransact:
+		// decoded by Validate
+		operations, _ := event.Operations()
+		if _, err := e.Coordinator().Submit(operations...); err != nil {
+			// e.g. while a range is moving, as a client's request would be refused
+			log.WithFields(log.Fields{"ops": event.Ops}).Warnf("transaction refused: %v", err)
+		}
+
+	case ActionByzantine:
+		addr, err := e.Addr(event.Target.ProcessType(), event.Target.Index)
+		if err != nil {
+			return err
+		}
+		b, err := byzantine.New(event.Behavior)
+		if err != nil {
+			return err
+		}
+		e.Byzantine().SetBehavior(addr, b)
+
+	default:
+		return fmt.Errorf("unknown action %q", event.Action)
+	}
+	return nil
+}
+
+// Check - evaluate the scenario's assertions against the current state of the Env
+func Check(s *Scenario, e *env.Env) *Result {
+	logs := e.DecisionLogs()
+	result := &Result{
+		Scenario:   s.Name,
+		Decisions:  make(map[string]int),
+		Violations: invariant.CheckDecisions(logs),
+		Failures:   make([]string, 0),
+
+		ExpectViolations: s.Assertions.ExpectConflictingDecisions,
+	}
+	for _, l := range logs {
+		result.Decisions[fmt.Sprintf("%v", l.Replica)] = len(l.Decisions)
+		if len(l.Decisions) < s.Assertions.MinDecisions {
+			result.Failures = append(result.Failures, fmt.Sprintf("min_decisions: replica %v decided %d slots, expected at least %d",
+				l.Replica, len(l.Decisions), s.Assertions.MinDecisions))
+		}
+	}
+	if s.Assertions.NoConflictingDecisions {
+		for _, v := range result.Violations {
+			result.Failures = append(result.Failures, fmt.Sprintf("no_conflicting_decisions: %v", v))
+		}
+	}
+	if s.Assertions.ExpectConflictingDecisions && len(result.Violations) == 0 {
+		result.Failures = append(result.Failures, "expect_conflicting_decisions: no conflicting decisions detected")
+	}
+	if c := e.Coordinator(); c != nil {
+		violations := c.Violations()
+		result.Violations = append(result.Violations, violations...)
+		if s.Assertions.AtomicTransactions {
+			for _, v := range violations {
+				result.Failures = append(result.Failures, fmt.Sprintf("atomic_transactions: %v", v))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,461 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/1xyz/paxossim/queue"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/byzantine"
+	"github.com/1xyz/paxossim/v1/env"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/quorum"
+	"github.com/1xyz/paxossim/v1/shard"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions supported in a scenario timeline
+const (
+	ActionCrash       = "crash"
+	ActionRestart     = "restart"
+	ActionPartition   = "partition"
+	ActionHeal        = "heal"
+	ActionReconfigure = "reconfigure"
+	ActionByzantine   = "byzantine"
+	ActionMove        = "move"
+	ActionTransact    = "transact"
+)
+
+// Scenario - A description of a simulation run, and the expected outcome
+type Scenario struct {
+	Name string `json:"name" yaml:"name"`
+
+	Description string `json:"description" yaml:"description"`
+
+	// Seed for the random decisions made by the network
+	Seed int64 `json:"seed" yaml:"seed"`
+
+	// How long the simulation is run for
+	Duration Duration `json:"duration" yaml:"duration"`
+
+	Cluster Cluster `json:"cluster" yaml:"cluster"`
+
+	Workload Workload `json:"workload" yaml:"workload"`
+
+	Network Network `json:"network" yaml:"network"`
+
+	// Faults & reconfigurations applied during the run
+	Timeline []Event `json:"timeline" yaml:"timeline"`
+
+	Assertions Assertions `json:"assertions" yaml:"assertions"`
+}
+
+// Cluster - size of the cluster
+type Cluster struct {
+	// Number of failures tolerated. The cluster is made of f+1 replicas,
+	// f+1 leaders and 2f+1 acceptors
+	Failures int `json:"failures" yaml:"failures"`
+
+	// classic (default), fast, epaxos, raft or cheap, see env.Protocol
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+
+	// Number of acceptors, overrides 2f+1 if set
+	Acceptors int `json:"acceptors,omitempty" yaml:"acceptors,omitempty"`
+
+	// Phase 1 & phase 2 quorums of the acceptors, a majority if empty
+	Quorum quorum.Spec `json:"quorum,omitempty" yaml:"quorum,omitempty"`
+
+	// Number of Paxos groups the keys are partitioned across, each of the size above; one if zero
+	Groups int `json:"groups,omitempty" yaml:"groups,omitempty"`
+
+	// Partitioning of the keys across the groups, by hash if empty
+	Partition shard.Spec `json:"partition,omitempty" yaml:"partition,omitempty"`
+
+	// Bounded inbox of every process, unbounded if omitted
+	Inbox Inbox `json:"inbox,omitempty" yaml:"inbox,omitempty"`
+}
+
+// Inbox - the capacity of the inbox of every process, and what happens once it is full
+type Inbox struct {
+	// Maximum number of messages waiting in an inbox, unbounded if zero
+	Capacity int `json:"capacity" yaml:"capacity"`
+
+	// block (default), drop_oldest or reject, see queue.Policy
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty"`
+}
+
+// Options - the queue options of the inbox of every process
+func (i Inbox) Options() queue.Options {
+	// validated by Validate
+	policy, _ := queue.ParsePolicy(i.Policy)
+	return queue.Options{Capacity: i.Capacity, Policy: policy}
+}
+
+// Workload - the requests issued by clients
+type Workload struct {
+	Clients int `json:"clients" yaml:"clients"`
+
+	// Interval between consecutive requests of a client
+	RequestInterval Duration `json:"request_interval" yaml:"request_interval"`
+
+	// Number of keys the clients write to, opaque commands if zero. Commands
+	// writing the same key interfere with each other in EPaxos
+	Keys int `json:"keys,omitempty" yaml:"keys,omitempty"`
+}
+
+// Network - fault model applied to every message
+type Network struct {
+	DropRate float64 `json:"drop_rate" yaml:"drop_rate"`
+
+	DuplicateRate float64 `json:"duplicate_rate" yaml:"duplicate_rate"`
+
+	MinDelay Duration `json:"min_delay" yaml:"min_delay"`
+
+	MaxDelay Duration `json:"max_delay" yaml:"max_delay"`
+}
+
+func (n Network) FaultModel() v1.FaultModel {
+	return v1.FaultModel{
+		DropRate:      n.DropRate,
+		DuplicateRate: n.DuplicateRate,
+		MinDelay:      n.MinDelay.Duration,
+		MaxDelay:      n.MaxDelay.Duration,
+	}
+}
+
+// Event - an action applied at a point in time relative to the start of the run
+type Event struct {
+	At Duration `json:"at" yaml:"at"`
+
+	// One of crash, restart, partition, heal, reconfigure, byzantine, move or transact
+	Action string `json:"action" yaml:"action"`
+
+	// Process crashed, restarted or made Byzantine, e.g. leader:0. The coordinator of the
+	// transactions of a sharded cluster is crashed & restarted as coordinator:0
+	Target Target `json:"target,omitempty" yaml:"target,omitempty"`
+
+	// Partition groups, e.g. [[leader:0, acceptor:0], [leader:1, acceptor:1, acceptor:2]]
+	Groups [][]Target `json:"groups,omitempty" yaml:"groups,omitempty"`
+
+	// New leader configuration, by leader index
+	Leaders []int `json:"leaders,omitempty" yaml:"leaders,omitempty"`
+
+	// How the target deviates from the protocol, see byzantine.Names
+	Behavior string `json:"behavior,omitempty" yaml:"behavior,omitempty"`
+
+	// Range of keys moved, and the index of the Paxos group it is moved to
+	Range statemachine.KeyRange `json:"range,omitempty" yaml:"range,omitempty"`
+
+	Group int `json:"group,omitempty" yaml:"group,omitempty"`
+
+	// Operations of a transaction on keys, see package ops, e.g. [PUT k1 v1, CAS k5 v5 v6]
+	Ops []string `json:"ops,omitempty" yaml:"ops,omitempty"`
+}
+
+// Operations - the operations of the transaction, decoded from Ops
+func (e Event) Operations() ([]ops.Operation, error) {
+	result := make([]ops.Operation, 0, len(e.Ops))
+	for _, o := range e.Ops {
+		operation, err := ops.Decode(o)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, operation)
+	}
+	return result, nil
+}
+
+// Assertions - checked at the end of the run
+type Assertions struct {
+	// R1: no two commands decided for the same slot across replicas
+	NoConflictingDecisions bool `json:"no_conflicting_decisions" yaml:"no_conflicting_decisions"`
+
+	// Every replica has decided at least these many slots
+	MinDecisions int `json:"min_decisions" yaml:"min_decisions"`
+
+	// R1 is expected to be violated, e.g. by Byzantine processes; fails if the invariant
+	// checker detects no conflicting decisions
+	ExpectConflictingDecisions bool `json:"expect_conflicting_decisions,omitempty" yaml:"expect_conflicting_decisions,omitempty"`
+
+	// T1: no transaction committed by one Paxos group and aborted by another
+	AtomicTransactions bool `json:"atomic_transactions,omitempty" yaml:"atomic_transactions,omitempty"`
+}
+
+// Load - read a scenario from a .json, .yaml or .yml file
+func Load(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	s, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Parse - decode a scenario in the specified format (json, yaml or yml)
+func Parse(data []byte, format string) (*Scenario, error) {
+	s := &Scenario{}
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(s); err != nil {
+			return nil, err
+		}
+	case "yaml", "yml":
+		if err := yaml.UnmarshalStrict(data, s); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scenario format %q", format)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Validate - check the scenario for inconsistent values
+func (s *Scenario) Validate() error {
+	if s.Cluster.Failures < 0 {
+		return fmt.Errorf("cluster.failures must be >= 0")
+	}
+	if _, err := env.ParseProtocol(s.Cluster.Protocol); err != nil {
+		return fmt.Errorf("cluster.protocol: %v", err)
+	}
+	if s.Cluster.Acceptors < 0 {
+		return fmt.Errorf("cluster.acceptors must be >= 0")
+	}
+	if _, err := queue.ParsePolicy(s.Cluster.Inbox.Policy); err != nil {
+		return fmt.Errorf("cluster.inbox.policy: %v", err)
+	}
+	if s.Workload.Keys < 0 {
+		return fmt.Errorf("workload.keys must be >= 0")
+	}
+	if err := s.Config().Validate(); err != nil {
+		return fmt.Errorf("cluster.%v", err)
+	}
+	if s.Workload.Clients < 0 {
+		return fmt.Errorf("workload.clients must be >= 0")
+	}
+	if s.Duration.Duration <= 0 {
+		return fmt.Errorf("duration must be > 0")
+	}
+	if s.Network.DropRate < 0 || s.Network.DropRate >= 1 ||
+		s.Network.DuplicateRate < 0 || s.Network.DuplicateRate >= 1 {
+		return fmt.Errorf("network rates must be in [0, 1)")
+	}
+	if s.Network.MaxDelay.Duration < s.Network.MinDelay.Duration {
+		return fmt.Errorf("network.max_delay must be >= network.min_delay")
+	}
+	if s.Assertions.NoConflictingDecisions && s.Assertions.ExpectConflictingDecisions {
+		return fmt.Errorf("assertions: no_conflicting_decisions contradicts expect_conflicting_decisions")
+	}
+	if s.Assertions.AtomicTransactions && s.Cluster.Groups < 2 {
+		return fmt.Errorf("assertions: atomic_transactions requires a cluster of two groups or more")
+	}
+	for i, e := range s.Timeline {
+		if e.At.Duration < 0 || e.At.Duration > s.Duration.Duration {
+			return fmt.Errorf("timeline[%d]: at %v is outside the run duration", i, e.At)
+		}
+		switch e.Action {
+		case ActionCrash, ActionRestart:
+			if e.Target.Type == "" {
+				return fmt.Errorf("timeline[%d]: %s requires a target", i, e.Action)
+			}
+			if e.Target.IsCoordinator() && s.Cluster.Groups < 2 {
+				return fmt.Errorf("timeline[%d]: %s of the coordinator requires a cluster of two groups or more", i, e.Action)
+			}
+		case ActionPartition:
+			if len(e.Groups) < 2 {
+				return fmt.Errorf("timeline[%d]: partition requires at least two groups", i)
+			}
+			for _, group := range e.Groups {
+				for _, target := range group {
+					if target.IsCoordinator() {
+						return fmt.Errorf("timeline[%d]: the coordinator cannot be partitioned", i)
+					}
+				}
+			}
+		case ActionReconfigure:
+			if len(e.Leaders) == 0 {
+				return fmt.Errorf("timeline[%d]: reconfigure requires leaders", i)
+			}
+			if p, _ := env.ParseProtocol(s.Cluster.Protocol); !p.SupportsReconfiguration() {
+				return fmt.Errorf("timeline[%d]: reconfigure is not supported by the %s protocol", i, p)
+			}
+		case ActionByzantine:
+			b, err := byzantine.New(e.Behavior)
+			if err != nil {
+				return fmt.Errorf("timeline[%d]: %v", i, err)
+			}
+			if e.Target.Type == "" || e.Target.IsCoordinator() || e.Target.ProcessType() != b.ProcessType() {
+				return fmt.Errorf("timeline[%d]: the %s behavior requires a %v target", i, e.Behavior, b.ProcessType())
+			}
+		case ActionMove:
+			if s.Cluster.Groups < 2 {
+				return fmt.Errorf("timeline[%d]: move requires a cluster of two groups or more", i)
+			}
+			if e.Group < 0 || e.Group >= s.Cluster.Groups {
+				return fmt.Errorf("timeline[%d]: move to group %d of %d", i, e.Group, s.Cluster.Groups)
+			}
+			if e.Range.IsEmpty() {
+				return fmt.Errorf("timeline[%d]: move of the empty range %v", i, e.Range)
+			}
+		case ActionTransact:
+			if s.Cluster.Groups < 2 {
+				return fmt.Errorf("timeline[%d]: transact requires a cluster of two groups or more", i)
+			}
+			if len(e.Ops) == 0 {
+				return fmt.Errorf("timeline[%d]: transact requires ops", i)
+			}
+			operations, err := e.Operations()
+			if err != nil {
+				return fmt.Errorf("timeline[%d]: %v", i, err)
+			}
+			for j, operation := range operations {
+				if len(operation.Keys()) == 0 {
+					return fmt.Errorf("timeline[%d]: %q is not an operation on a key", i, e.Ops[j])
+				}
+			}
+		case ActionHeal:
+		default:
+			return fmt.Errorf("timeline[%d]: unknown action %q", i, e.Action)
+		}
+	}
+	return nil
+}
+
+// Target - identifies a process by its type and index, e.g. acceptor:2
+type Target struct {
+	Type string
+
+	Index int
+}
+
+var targetTypes = map[string]v1.ProcessType{
+	"acceptor": v1.Acceptor,
+	"leader":   v1.Leader,
+	"replica":  v1.Replica,
+	"client":   v1.Client,
+}
+
+// coordinatorTarget - the type of the target naming the coordinator of transactions, which is
+// not a process of the cluster
+const coordinatorTarget = "coordinator"
+
+func ParseTarget(s string) (Target, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return Target{}, fmt.Errorf("invalid target %q, expected <type>:<index>", s)
+	}
+	t := strings.ToLower(strings.TrimSpace(parts[0]))
+	if _, ok := targetTypes[t]; !ok && t != coordinatorTarget {
+		return Target{}, fmt.Errorf("invalid target %q, unknown process type", s)
+	}
+	index, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || index < 0 {
+		return Target{}, fmt.Errorf("invalid target %q, bad index", s)
+	}
+	return Target{Type: t, Index: index}, nil
+}
+
+func (t Target) ProcessType() v1.ProcessType {
+	return targetTypes[t.Type]
+}
+
+// IsCoordinator - whether the target is the coordinator of transactions
+func (t Target) IsCoordinator() bool {
+	return t.Type == coordinatorTarget
+}
+
+func (t Target) String() string {
+	if t.Type == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", t.Type, t.Index)
+}
+
+func (t *Target) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return t.set(s)
+}
+
+func (t *Target) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return t.set(s)
+}
+
+func (t *Target) set(s string) error {
+	if s == "" {
+		*t = Target{}
+		return nil
+	}
+	v, err := ParseTarget(s)
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
+
+func (t Target) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t Target) MarshalYAML() (interface{}, error) {
+	return t.String(), nil
+}
+
+// Duration - a time.Duration represented as a string (e.g. 250ms) in scenario files
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.set(s)
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.set(s)
+}
+
+func (d *Duration) set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
@@ -0,0 +1,231 @@
+package scenario
+
+import (
+	"github.com/1xyz/paxossim/queue"
+	"github.com/1xyz/paxossim/v1/clock"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/trace"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Given a yaml scenario", t, func() {
+		data := []byte(`
+name: example
+duration: 2s
+cluster:
+  failures: 2
+workload:
+  clients: 3
+  request_interval: 50ms
+timeline:
+  - at: 1s
+    action: crash
+    target: acceptor:4
+assertions:
+  min_decisions: 5
+`)
+		Convey("it is parsed", func() {
+			s, err := Parse(data, "yaml")
+			So(err, ShouldBeNil)
+			So(s.Cluster.Failures, ShouldEqual, 2)
+			So(s.Workload.RequestInterval.Milliseconds(), ShouldEqual, 50)
+			So(s.Timeline[0].Target, ShouldResemble, Target{Type: "acceptor", Index: 4})
+			So(s.Assertions.MinDecisions, ShouldEqual, 5)
+		})
+	})
+
+	Convey("Given a scenario with an unknown action", t, func() {
+		data := []byte(`{"name": "bad", "duration": "1s", "timeline": [{"at": "0s", "action": "explode"}]}`)
+
+		Convey("parsing fails", func() {
+			_, err := Parse(data, "json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a scenario with a misspelled field", t, func() {
+		data := []byte(`{"name": "bad", "duration": "1s", "asertions": {"min_decisions": 5}}`)
+
+		Convey("parsing fails", func() {
+			_, err := Parse(data, "json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given scenarios with bounded inboxes", t, func() {
+		Convey("the capacity & policy are passed on to the Env", func() {
+			data := []byte(`{"name": "inbox", "duration": "1s", "cluster": {"failures": 1, "inbox": {"capacity": 8, "policy": "drop_oldest"}}}`)
+			s, err := Parse(data, "json")
+			So(err, ShouldBeNil)
+			So(s.Config().Inbox, ShouldResemble, queue.Options{Capacity: 8, Policy: queue.DropOldest})
+		})
+
+		Convey("parsing fails for an unknown policy", func() {
+			data := []byte(`{"name": "bad", "duration": "1s", "cluster": {"failures": 1, "inbox": {"capacity": 8, "policy": "drop_newest"}}}`)
+			_, err := Parse(data, "json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a scenario with an invalid target", t, func() {
+		data := []byte(`{"name": "bad", "duration": "1s", "timeline": [{"at": "0s", "action": "crash", "target": "router:1"}]}`)
+
+		Convey("parsing fails", func() {
+			_, err := Parse(data, "json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a scenario with a Byzantine behavior applied to the wrong type of process", t, func() {
+		data := []byte(`{"name": "bad", "duration": "1s", "timeline": [{"at": "0s", "action": "byzantine", "target": "leader:0", "behavior": "equivocate"}]}`)
+
+		Convey("parsing fails", func() {
+			_, err := Parse(data, "json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a scenario moving keys in a cluster of one group", t, func() {
+		data := []byte(`{"name": "bad", "duration": "1s", "timeline": [{"at": "0s", "action": "move", "range": {"start": "k2"}, "group": 1}]}`)
+
+		Convey("parsing fails", func() {
+			_, err := Parse(data, "json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given scenarios of transactions", t, func() {
+		sharded := `"cluster": {"failures": 1, "groups": 2}`
+
+		Convey("a transaction of PUTs & GETs across two groups is parsed", func() {
+			data := []byte(`{"name": "txn", "duration": "1s", ` + sharded + `, "timeline": [{"at": "0s", "action": "transact", "ops": ["PUT k1 a", "GET k5"]}, {"at": "0s", "action": "crash", "target": "coordinator:0"}]}`)
+			s, err := Parse(data, "json")
+			So(err, ShouldBeNil)
+			So(s.Timeline[0].Ops, ShouldResemble, []string{"PUT k1 a", "GET k5"})
+			operations, err := s.Timeline[0].Operations()
+			So(err, ShouldBeNil)
+			So(operations, ShouldResemble, []ops.Operation{ops.Put{Key: "k1", Value: "a"}, ops.Get{Key: "k5"}})
+			So(s.Timeline[1].Target.IsCoordinator(), ShouldBeTrue)
+		})
+
+		Convey("parsing fails for operations other than those on keys", func() {
+			for _, op := range []string{"MOVE k1 k2", "NOOP", "GET"} {
+				data := []byte(`{"name": "bad", "duration": "1s", ` + sharded + `, "timeline": [{"at": "0s", "action": "transact", "ops": ["` + op + `"]}]}`)
+				_, err := Parse(data, "json")
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("parsing fails in a cluster of one group", func() {
+			for _, event := range []string{`{"at": "0s", "action": "transact", "ops": ["PUT k1 a"]}`, `{"at": "0s", "action": "restart", "target": "coordinator:0"}`} {
+				_, err := Parse([]byte(`{"name": "bad", "duration": "1s", "timeline": [`+event+`]}`), "json")
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+// TestScenarios - run every scenario checked into the repository as a regression test
+func TestScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping scenario runs in short mode")
+	}
+
+	paths, err := filepath.Glob("../../scenarios/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			s, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := Run(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, failure := range result.Failures {
+				t.Error(failure)
+			}
+			if len(result.Failures) == 0 && !result.Passed() {
+				t.Errorf("unexpected violations %v", result.Violations)
+			}
+		})
+	}
+}
+
+func TestResult_Passed(t *testing.T) {
+	Convey("Given the result of a scenario without assertions", t, func() {
+		result := &Result{Failures: make([]string, 0)}
+
+		Convey("it passes without violations", func() {
+			So(result.Passed(), ShouldBeTrue)
+		})
+
+		Convey("it fails once an invariant is violated", func() {
+			result.Violations = []invariant.Violation{{Invariant: "R1", Message: "conflicting decisions"}}
+			So(result.Passed(), ShouldBeFalse)
+
+			Convey("unless the scenario expects violations", func() {
+				result.ExpectViolations = true
+				So(result.Passed(), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestRun_FakeClock(t *testing.T) {
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"steady_state.yaml", "leader_crash.yaml", "epaxos.yaml", "raft.yaml"} {
+		Convey("Given the scenario "+name+" run on a fake clock", t, func() {
+			s, err := Load(filepath.Join("../../scenarios", name))
+			So(err, ShouldBeNil)
+			c := clock.NewFake(epoch)
+			result, err := Run(s, WithClock(c))
+
+			Convey("it passes once the clock is advanced by its duration", func() {
+				So(err, ShouldBeNil)
+				So(result.Failures, ShouldBeEmpty)
+				So(clock.Since(c, epoch), ShouldEqual, s.Duration.Duration)
+			})
+		})
+	}
+}
+
+func TestRun_TracedBlockingInboxes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping scenario runs in short mode")
+	}
+	Convey("Given a traced scenario whose senders block on full inboxes", t, func() {
+		data := []byte(`{"name": "traced", "duration": "1s", ` +
+			`"cluster": {"failures": 1, "inbox": {"capacity": 2, "policy": "block"}}, ` +
+			`"workload": {"clients": 3, "request_interval": "1ms"}, ` +
+			`"assertions": {"no_conflicting_decisions": true, "min_decisions": 5}}`)
+		s, err := Parse(data, "json")
+		So(err, ShouldBeNil)
+		sink := trace.NewMemory()
+
+		Convey("it decides commands, and stops", func() {
+			done := make(chan *Result, 1)
+			go func() {
+				result, _ := Run(s, WithTrace(sink))
+				done <- result
+			}()
+			select {
+			case result := <-done:
+				So(result, ShouldNotBeNil)
+				So(result.Failures, ShouldBeEmpty)
+				So(len(sink.Entries()), ShouldBeGreaterThan, 0)
+			case <-time.After(30 * time.Second):
+				t.Fatal("the run did not stop")
+			}
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package shard
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"sync"
+)
+
+// Group - the exchange of the processes of one Paxos group. It records the processes registered
+// through it, and broadcasts to the members of the group only; broadcasts to the clients, which
+// are shared by every group, reach all of them
+type Group struct {
+	v1.MessageExchange
+
+	index int
+
+	mu *sync.RWMutex
+
+	members map[v1.ProcessType][]v1.Addr
+}
+
+func NewGroup(inner v1.MessageExchange, index int) *Group {
+	return &Group{
+		MessageExchange: inner,
+		index:           index,
+		mu:              &sync.RWMutex{},
+		members:         make(map[v1.ProcessType][]v1.Addr),
+	}
+}
+
+// Index - the index of the group, as returned by a Partitioner
+func (g *Group) Index() int {
+	return g.index
+}
+
+func (g *Group) Register(p v1.ProcessInbox) error {
+	if err := g.MessageExchange.Register(p); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.members[p.Type()] = append(g.members[p.Type()], v1.NewAddress(p.ID(), p.Type()))
+	return nil
+}
+
+func (g *Group) UnRegister(p v1.ProcessInbox) error {
+	if err := g.MessageExchange.UnRegister(p); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	members := g.members[p.Type()]
+	for i, addr := range members {
+		if addr.ID() == p.ID() {
+			g.members[p.Type()] = append(members[:i:i], members[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// SendAll - send the message to every member of the specified type, or to every client
+func (g *Group) SendAll(pt v1.ProcessType, m v1.Message) error {
+	if pt == v1.Client {
+		return g.MessageExchange.SendAll(pt, m)
+	}
+	members := g.Members(pt)
+	if len(members) == 0 {
+		return fmt.Errorf("not-found: No process(es) with type:%v found in group %d", pt, g.index)
+	}
+	for _, addr := range members {
+		if err := g.MessageExchange.Send(addr, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Members - the addresses of the members of the specified type, in registration order
+func (g *Group) Members(pt v1.ProcessType) []v1.Addr {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]v1.Addr{}, g.members[pt]...)
+}
+
+// Contains - whether the process is a member of the group
+func (g *Group) Contains(addr v1.Addr) bool {
+	for _, m := range g.Members(addr.Type()) {
+		if m.ID() == addr.ID() {
+			return true
+		}
+	}
+	return false
+}
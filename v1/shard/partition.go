@@ -0,0 +1,84 @@
+// Package shard splits the keys of the KV state machine across independent Paxos groups. A Router
+// in front of the clients sends every request to the group owning its key, and moves ranges of
+// keys between the groups. A Coordinator runs transactions across the groups with two-phase commit
+package shard
+
+import (
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Partitioner - maps a key to the index of the group owning it
+type Partitioner interface {
+	Group(key string) int
+}
+
+// Hash - partitions the keys by their FNV-1a hash
+type Hash struct {
+	Groups int
+}
+
+func (h Hash) Group(key string) int {
+	if h.Groups <= 1 {
+		return 0
+	}
+	f := fnv.New32a()
+	f.Write([]byte(key))
+	return int(f.Sum32() % uint32(h.Groups))
+}
+
+// Range - partitions the keys by ranges: group 0 owns the keys below Bounds[0], group i the keys
+// from Bounds[i-1] to Bounds[i], and the last group the keys from the last bound on
+type Range struct {
+	Bounds []string
+}
+
+func (r Range) Group(key string) int {
+	return sort.Search(len(r.Bounds), func(i int) bool { return key < r.Bounds[i] })
+}
+
+// assignment - a range of keys moved to a group
+type assignment struct {
+	keys statemachine.KeyRange
+
+	group int
+}
+
+// Table - the routing table of a Router: the partitioner the groups start with, overridden by the
+// ranges moved since. Safe for concurrent use
+type Table struct {
+	mu *sync.RWMutex
+
+	base Partitioner
+
+	// latest first
+	moves []assignment
+}
+
+func NewTable(base Partitioner) *Table {
+	return &Table{mu: &sync.RWMutex{}, base: base}
+}
+
+// Group - the group owning the key; the global key is owned by group 0
+func (t *Table) Group(key string) int {
+	if key == statemachine.GlobalKey {
+		return 0
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, m := range t.moves {
+		if m.keys.Contains(key) {
+			return m.group
+		}
+	}
+	return t.base.Group(key)
+}
+
+// Assign - route the keys of the range to the group from now on
+func (t *Table) Assign(keys statemachine.KeyRange, group int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.moves = append([]assignment{{keys: keys, group: group}}, t.moves...)
+}
@@ -0,0 +1,305 @@
+package shard
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+)
+
+// RouterID - the client id of the commands moving ranges of keys
+const RouterID = "router"
+
+// routerAddr - the source of the commands moving ranges of keys
+var routerAddr = v1.NewAddress(v1.ProcessID(-2), v1.Client)
+
+// Router - the exchange of the clients of a sharded cluster. It sends every request to the
+// replicas (or, in fast rounds, the acceptors) of the group owning the key of its command, and
+// moves ranges of keys between the groups. The Router has to be registered as an events.Sink of
+// the replicas, it learns of the progress of a move, and of the requests performed after their
+// range moved away, from their CommandPerformed events
+type Router struct {
+	v1.MessageExchange
+
+	groups []*Group
+
+	table *Table
+
+	mu *sync.Mutex
+
+	// the move in flight, nil if none
+	move *move
+
+	moveCount int
+
+	// requests for the keys of the range in flight, sent once it is installed
+	buffered []request
+
+	// address of every client, by its id
+	clients map[string]v1.Addr
+
+	// requests already sent again after they were performed as moved, by group
+	retried map[string]bool
+
+	// the transactions in flight, by id; no range is moved while there are any
+	held map[string]bool
+}
+
+// request - a request held back by the router
+type request struct {
+	pt v1.ProcessType
+
+	m v1.Message
+}
+
+// move - a range of keys on its way to a group. Every other group removes the range with a MOVE
+// command, the group then installs the keys & values removed with an INSTALL command
+type move struct {
+	keys statemachine.KeyRange
+
+	group int
+
+	// command id of the MOVE & INSTALL commands
+	id string
+
+	// the groups which have yet to perform the MOVE
+	pending map[int]bool
+
+	// the keys & values removed by the groups which performed the MOVE
+	data map[string]string
+
+	installing bool
+}
+
+// NewRouter - route the requests sent through the network to the groups, which share the network
+func NewRouter(network v1.MessageExchange, groups []*Group, partitioner Partitioner) *Router {
+	return &Router{
+		MessageExchange: network,
+		groups:          groups,
+		table:           NewTable(partitioner),
+		mu:              &sync.Mutex{},
+		clients:         make(map[string]v1.Addr),
+		retried:         make(map[string]bool),
+		held:            make(map[string]bool),
+	}
+}
+
+// Group - the index of the group owning the key
+func (r *Router) Group(key string) int {
+	return r.table.Group(key)
+}
+
+// Moving - whether a range of keys is on its way to a group
+func (r *Router) Moving() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.move != nil
+}
+
+// SendAll - send requests to the replicas, and fast proposals to the acceptors, of the group owning
+// the key of their command; other messages are broadcast to every process of the type
+func (r *Router) SendAll(pt v1.ProcessType, m v1.Message) error {
+	command, ok := commandOf(pt, m)
+	if !ok {
+		return r.MessageExchange.SendAll(pt, m)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[command.GetClientID()] = m.Src()
+	return r.route(pt, m)
+}
+
+// commandOf - the command of a message the router routes
+func commandOf(pt v1.ProcessType, m v1.Message) (types.Command, bool) {
+	switch msg := m.(type) {
+	case messages.RequestMessage:
+		return msg.Command, pt == v1.Replica
+	case messages.FastProposeMessage:
+		return msg.Command, pt == v1.Acceptor
+	}
+	return nil, false
+}
+
+// route - send the message to the group owning its key, or hold it back while its key is moved
+func (r *Router) route(pt v1.ProcessType, m v1.Message) error {
+	command, _ := commandOf(pt, m)
+	key := statemachine.Keys(command)[0]
+	if r.move != nil && r.move.keys.Contains(key) {
+		r.buffered = append(r.buffered, request{pt: pt, m: m})
+		return nil
+	}
+	return r.groups[r.table.Group(key)].SendAll(pt, m)
+}
+
+// Move - move the range of keys to the group. Requests for the keys of the range are held back
+// until the group installed them; one range is moved at a time
+func (r *Router) Move(keys statemachine.KeyRange, group int) error {
+	if group < 0 || group >= len(r.groups) {
+		return fmt.Errorf("not-found: no group with index %d", group)
+	}
+	if keys.IsEmpty() {
+		return fmt.Errorf("range %v is empty", keys)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.move != nil {
+		return fmt.Errorf("busy: range %v is on its way to group %d", r.move.keys, r.move.group)
+	}
+	if len(r.held) > 0 {
+		return fmt.Errorf("busy: %d transactions in flight", len(r.held))
+	}
+	r.moveCount++
+	r.move = &move{
+		keys:    keys,
+		group:   group,
+		id:      fmt.Sprintf("move-%d", r.moveCount),
+		pending: make(map[int]bool),
+		data:    make(map[string]string),
+	}
+	log.WithFields(log.Fields{"range": keys, "group": group}).Info("Moving range")
+	for _, g := range r.groups {
+		if g.Index() != group {
+			r.move.pending[g.Index()] = true
+		}
+	}
+	for _, g := range r.groups {
+		if !r.move.pending[g.Index()] {
+			continue
+		}
+		if err := r.send(g, statemachine.MoveOp(keys)); err != nil {
+			return err
+		}
+	}
+	return r.installIfMoved()
+}
+
+// hold - keep the ranges in place while the transaction is in flight
+func (r *Router) hold(txid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.move != nil {
+		return fmt.Errorf("busy: range %v is on its way to group %d", r.move.keys, r.move.group)
+	}
+	r.held[txid] = true
+	return nil
+}
+
+// release - let the ranges move once the transaction is done
+func (r *Router) release(txid string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.held, txid)
+}
+
+// releaseExcept - release every transaction but the ones in flight
+func (r *Router) releaseExcept(inFlight map[string]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for txid := range r.held {
+		if !inFlight[txid] {
+			delete(r.held, txid)
+		}
+	}
+	for txid := range inFlight {
+		r.held[txid] = true
+	}
+}
+
+// send - request the group to perform the operation of the move in flight
+func (r *Router) send(g *Group, op string) error {
+	command := types.BasicCommand{ClientID: RouterID, CommandID: r.move.id, Op: op}
+	return g.SendAll(v1.Replica, messages.NewRequestMessage(routerAddr, command))
+}
+
+// installIfMoved - install the range at its group, once every other group performed the MOVE
+func (r *Router) installIfMoved() error {
+	if len(r.move.pending) > 0 || r.move.installing {
+		return nil
+	}
+	r.move.installing = true
+	data, err := json.Marshal(r.move.data)
+	if err != nil {
+		return err
+	}
+	return r.send(r.groups[r.move.group], statemachine.InstallOp(r.move.keys, string(data)))
+}
+
+// Record - follow the MOVE & INSTALL commands of the move in flight, and send the requests which
+// were performed after their range moved away to the group owning it
+func (r *Router) Record(e events.Event) error {
+	p, ok := e.(events.CommandPerformed)
+	if !ok || p.Command == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	group := r.groupOf(p.Replica)
+	if group < 0 {
+		return nil
+	}
+	if p.Command.GetClientID() == RouterID {
+		return r.progress(group, p)
+	}
+	if p.Result != statemachine.ResultMoved {
+		return nil
+	}
+	retry := fmt.Sprintf("%s/%s/%d", p.Command.GetClientID(), p.Command.GetCommandID(), group)
+	src, ok := r.clients[p.Command.GetClientID()]
+	if r.retried[retry] || !ok {
+		return nil
+	}
+	r.retried[retry] = true
+	return r.route(v1.Replica, messages.NewRequestMessage(src, p.Command))
+}
+
+// progress - account for a MOVE or INSTALL of the move in flight performed by a replica of the group
+func (r *Router) progress(group int, p events.CommandPerformed) error {
+	m := r.move
+	if m == nil || p.Command.GetCommandID() != m.id {
+		return nil
+	}
+	if strings.HasPrefix(p.Command.GetOp(), statemachine.OpInstall) {
+		if group != m.group || !m.installing {
+			return nil
+		}
+		r.table.Assign(m.keys, m.group)
+		r.move = nil
+		log.WithFields(log.Fields{"range": m.keys, "group": m.group}).Info("Range moved")
+		buffered := r.buffered
+		r.buffered = nil
+		for _, b := range buffered {
+			if err := r.route(b.pt, b.m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !m.pending[group] {
+		return nil
+	}
+	delete(m.pending, group)
+	data := make(map[string]string)
+	if err := json.Unmarshal([]byte(p.Result), &data); err != nil {
+		return fmt.Errorf("group %d moved range %v as %q: %v", group, m.keys, p.Result, err)
+	}
+	for k, v := range data {
+		m.data[k] = v
+	}
+	return r.installIfMoved()
+}
+
+// groupOf - the index of the group of the replica, -1 if it is in none
+func (r *Router) groupOf(replica v1.Addr) int {
+	for _, g := range r.groups {
+		if g.Contains(replica) {
+			return g.Index()
+		}
+	}
+	return -1
+}
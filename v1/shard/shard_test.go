@@ -0,0 +1,298 @@
+package shard
+
+import (
+	"encoding/json"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSpec(t *testing.T) {
+	Convey("Specs are parsed from their String form", t, func() {
+		for _, str := range []string{"hash", "range:k3,k6"} {
+			spec, err := ParseSpec(str)
+			So(err, ShouldBeNil)
+			So(spec.String(), ShouldEqual, str)
+		}
+		spec, err := ParseSpec("")
+		So(err, ShouldBeNil)
+		So(spec.Kind, ShouldBeEmpty)
+		_, err = ParseSpec("consistent")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A range spec requires ascending bounds between every two groups", t, func() {
+		spec := Spec{Kind: KindRange, Bounds: []string{"k3", "k6"}}
+		So(spec.Check(3), ShouldBeNil)
+		So(spec.Check(2), ShouldNotBeNil)
+		So(Spec{Kind: KindRange, Bounds: []string{"k6", "k3"}}.Check(3), ShouldNotBeNil)
+		So(Spec{}.Check(0), ShouldNotBeNil)
+	})
+}
+
+func TestTable(t *testing.T) {
+	Convey("Given a table of 3 groups partitioned by range", t, func() {
+		table := NewTable(Range{Bounds: []string{"k3", "k6"}})
+
+		Convey("every key is owned by the group of its range", func() {
+			So(table.Group("k1"), ShouldEqual, 0)
+			So(table.Group("k3"), ShouldEqual, 1)
+			So(table.Group("k9"), ShouldEqual, 2)
+			So(table.Group(statemachine.GlobalKey), ShouldEqual, 0)
+		})
+
+		Convey("the latest assignment of a key overrides the others", func() {
+			table.Assign(statemachine.KeyRange{Start: "k0", End: "k4"}, 2)
+			table.Assign(statemachine.KeyRange{Start: "k1", End: "k2"}, 1)
+			So(table.Group("k0"), ShouldEqual, 2)
+			So(table.Group("k1"), ShouldEqual, 1)
+			So(table.Group("k3"), ShouldEqual, 2)
+			So(table.Group("k4"), ShouldEqual, 1)
+		})
+	})
+
+	Convey("A hash spreads the keys across the groups", t, func() {
+		h := Hash{Groups: 4}
+		seen := make(map[int]bool)
+		for _, key := range []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7"} {
+			So(h.Group(key), ShouldEqual, h.Group(key))
+			seen[h.Group(key)] = true
+		}
+		So(len(seen), ShouldBeGreaterThan, 1)
+	})
+}
+
+// cluster - two groups of one replica & one acceptor each, and the router of a client
+type cluster struct {
+	groups   []*Group
+	router   *Router
+	replicas []v1.Process
+	acceptor []v1.Process
+	client   v1.Process
+}
+
+func newCluster() *cluster {
+	network := v1.NewMessageExchange()
+	c := &cluster{}
+	for i := 0; i < 2; i++ {
+		g := NewGroup(network, i)
+		replica := v1.NewProcess(v1.AllocateID(g, v1.Replica), v1.Replica)
+		acceptor := v1.NewProcess(v1.AllocateID(g, v1.Acceptor), v1.Acceptor)
+		So(g.Register(replica), ShouldBeNil)
+		So(g.Register(acceptor), ShouldBeNil)
+		c.groups = append(c.groups, g)
+		c.replicas = append(c.replicas, replica)
+		c.acceptor = append(c.acceptor, acceptor)
+	}
+	c.router = NewRouter(network, c.groups, Range{Bounds: []string{"k3"}})
+	c.client = v1.NewProcess(v1.AllocateID(c.router, v1.Client), v1.Client)
+	So(c.router.Register(c.client), ShouldBeNil)
+	return c
+}
+
+// request - send a PUT of the key from the client through the router
+func (c *cluster) request(key string) types.Command {
+	command := ops.NewCommand("client:0", key, ops.Put{Key: key, Value: "v"})
+	So(c.router.SendAll(v1.Replica, messages.NewRequestMessage(c.client.GetAddr(), command)), ShouldBeNil)
+	return command
+}
+
+// recv - the command of the next request in the inbox of the process
+func recv(p v1.Process) types.Command {
+	msg, err := p.Recv()
+	So(err, ShouldBeNil)
+	return msg.(messages.RequestMessage).Command
+}
+
+// perform - record the command as performed by the replica of the group, with the result
+func (c *cluster) perform(group int, command types.Command, result string) {
+	So(c.router.Record(events.CommandPerformed{
+		Replica: c.replicas[group].GetAddr(), Command: command, Result: result}), ShouldBeNil)
+}
+
+func TestGroup(t *testing.T) {
+	Convey("Given two groups sharing a network", t, func() {
+		c := newCluster()
+
+		Convey("their processes have distinct ids", func() {
+			So(c.replicas[0].GetAddr().ID(), ShouldNotEqual, c.replicas[1].GetAddr().ID())
+			So(c.groups[1].Contains(c.replicas[1].GetAddr()), ShouldBeTrue)
+			So(c.groups[1].Contains(c.replicas[0].GetAddr()), ShouldBeFalse)
+		})
+
+		Convey("a broadcast reaches the members of the group only", func() {
+			m := messages.NewRequestMessage(c.client.GetAddr(), types.BasicCommand{Op: "OP"})
+			So(c.groups[1].SendAll(v1.Replica, m), ShouldBeNil)
+			So(c.replicas[0].InboxLen(), ShouldEqual, 0)
+			So(c.replicas[1].InboxLen(), ShouldEqual, 1)
+		})
+
+		Convey("a broadcast to the clients reaches every client", func() {
+			m := messages.NewRequestMessage(c.replicas[0].GetAddr(), types.BasicCommand{Op: "OP"})
+			So(c.groups[0].SendAll(v1.Client, m), ShouldBeNil)
+			So(c.client.InboxLen(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestRouter(t *testing.T) {
+	Convey("Given a router in front of two groups split at k3", t, func() {
+		c := newCluster()
+
+		Convey("requests reach the group owning their key", func() {
+			c.request("k1")
+			c.request("k5")
+			So(recv(c.replicas[0]).GetOp(), ShouldEqual, "PUT k1 v")
+			So(recv(c.replicas[1]).GetOp(), ShouldEqual, "PUT k5 v")
+			So(c.replicas[0].InboxLen(), ShouldEqual, 0)
+		})
+
+		Convey("fast proposals reach the acceptors of the group owning their key", func() {
+			command := ops.NewCommand("client:0", "1", ops.Put{Key: "k5", Value: "v"})
+			So(c.router.SendAll(v1.Acceptor, messages.NewFastProposeMessage(c.client.GetAddr(), command)), ShouldBeNil)
+			So(c.acceptor[0].InboxLen(), ShouldEqual, 0)
+			So(c.acceptor[1].InboxLen(), ShouldEqual, 1)
+		})
+
+		Convey("a range moves to the other group", func() {
+			keys := statemachine.KeyRange{Start: "k1", End: "k2"}
+			So(c.router.Move(keys, 1), ShouldBeNil)
+			So(c.router.Moving(), ShouldBeTrue)
+			So(c.router.Move(keys, 0), ShouldNotBeNil)
+			moveCmd := recv(c.replicas[0])
+			So(moveCmd.GetOp(), ShouldEqual, statemachine.MoveOp(keys))
+			So(c.replicas[1].InboxLen(), ShouldEqual, 0)
+
+			Convey("holding back the requests for its keys until it is installed", func() {
+				c.request("k1")
+				c.request("k0")
+				So(recv(c.replicas[0]).GetOp(), ShouldEqual, "PUT k0 v")
+				So(c.replicas[0].InboxLen(), ShouldEqual, 0)
+
+				c.perform(0, moveCmd, `{"k1":"v"}`)
+				install := recv(c.replicas[1])
+				So(install.GetOp(), ShouldEqual, statemachine.InstallOp(keys, `{"k1":"v"}`))
+				So(c.router.Moving(), ShouldBeTrue)
+
+				c.perform(1, install, "OK")
+				So(c.router.Moving(), ShouldBeFalse)
+				So(c.router.Group("k1"), ShouldEqual, 1)
+				So(recv(c.replicas[1]).GetOp(), ShouldEqual, "PUT k1 v")
+			})
+
+			Convey("sending the requests performed after it moved away to the other group", func() {
+				c.perform(0, moveCmd, "{}")
+				c.perform(1, recv(c.replicas[1]), "OK")
+				stale := ops.NewCommand("client:0", "9", ops.Put{Key: "k1", Value: "v"})
+				c.request("k0")
+				recv(c.replicas[0])
+				c.perform(0, stale, statemachine.ResultMoved)
+				c.perform(0, stale, statemachine.ResultMoved)
+				So(recv(c.replicas[1]), ShouldResemble, types.Command(stale))
+				So(c.replicas[1].InboxLen(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestCoordinator(t *testing.T) {
+	Convey("Given a coordinator of transactions over two groups split at k3", t, func() {
+		c := newCluster()
+		coordinator := NewCoordinator(c.router)
+		perform := func(group int, command types.Command, result string) {
+			So(coordinator.Record(events.CommandPerformed{
+				Replica: c.replicas[group].GetAddr(), Command: command, Result: result}), ShouldBeNil)
+		}
+		// the next request in the inbox of the replica of the group, performed with the result
+		performNext := func(group int, result string) types.Command {
+			command := recv(c.replicas[group])
+			perform(group, command, result)
+			return command
+		}
+		status := func(txid string) string {
+			txn, _ := coordinator.Transaction(txid)
+			return txn.Status
+		}
+
+		Convey("a transaction is prepared by the groups owning its keys", func() {
+			txid, err := coordinator.Submit(ops.Put{Key: "k1", Value: "a"}, ops.Get{Key: "k5"})
+			So(err, ShouldBeNil)
+			So(c.router.Move(statemachine.KeyRange{Start: "k1"}, 1), ShouldNotBeNil)
+			So(performNext(0, statemachine.ResultPrepared).GetOp(), ShouldStartWith, statemachine.OpPrepare+" "+txid)
+
+			Convey("and committed once every group prepared it", func() {
+				performNext(1, statemachine.ResultPrepared)
+				So(performNext(0, statemachine.OpCommit).GetOp(), ShouldEqual, statemachine.DecideOp(txid, statemachine.OpCommit))
+				So(performNext(0, "{}").GetOp(), ShouldEqual, statemachine.CommitOp(txid))
+				So(status(txid), ShouldEqual, TxnPending)
+				performNext(1, `{"k5":"b"}`)
+
+				txn, _ := coordinator.Transaction(txid)
+				So(txn.Status, ShouldEqual, TxnCommitted)
+				So(txn.Reads, ShouldResemble, map[string]string{"k5": "b"})
+				So(coordinator.Violations(), ShouldBeEmpty)
+				So(c.router.Move(statemachine.KeyRange{Start: "k1"}, 1), ShouldBeNil)
+			})
+
+			Convey("and aborted as soon as a group did not", func() {
+				performNext(1, statemachine.ResultAborted)
+				So(performNext(0, statemachine.OpAbort).GetOp(), ShouldEqual, statemachine.DecideOp(txid, statemachine.OpAbort))
+				So(performNext(0, statemachine.ResultAborted).GetOp(), ShouldEqual, statemachine.AbortOp(txid))
+				performNext(1, statemachine.ResultAborted)
+				So(status(txid), ShouldEqual, TxnAborted)
+			})
+
+			Convey("and recovered after the coordinator crashed", func() {
+				performNext(1, statemachine.ResultPrepared)
+				// the DECIDE sent before the crash
+				decide := recv(c.replicas[0])
+				coordinator.Crash()
+				So(coordinator.Transactions(), ShouldBeEmpty)
+				_, err := coordinator.Submit(ops.Put{Key: "k1", Value: "a"})
+				So(err, ShouldNotBeNil)
+
+				So(coordinator.Restart(), ShouldBeNil)
+				inDoubt := func(operations ...ops.Operation) string {
+					encoded, _ := json.Marshal(map[string]statemachine.Txn{
+						txid: {Ops: operations, Participants: []int{0, 1}, Coordinator: 0}})
+					return string(encoded)
+				}
+				performNext(0, inDoubt(ops.Put{Key: "k1", Value: "a"}))
+				performNext(1, inDoubt(ops.Get{Key: "k5"}))
+				recovery := recv(c.replicas[0])
+				So(recovery.GetOp(), ShouldEqual, statemachine.DecideOp(txid, statemachine.OpAbort))
+				So(c.replicas[0].InboxLen(), ShouldEqual, 0)
+
+				Convey("committing it if the commit was decided before the crash", func() {
+					perform(0, decide, statemachine.OpCommit)
+					perform(0, recovery, statemachine.OpCommit)
+					performNext(0, "{}")
+					performNext(1, `{"k5":"b"}`)
+					So(status(txid), ShouldEqual, TxnCommitted)
+					So(coordinator.Violations(), ShouldBeEmpty)
+					So(c.router.Move(statemachine.KeyRange{Start: "k1"}, 1), ShouldBeNil)
+				})
+
+				Convey("aborting it otherwise", func() {
+					perform(0, recovery, statemachine.OpAbort)
+					performNext(0, statemachine.ResultAborted)
+					performNext(1, statemachine.ResultAborted)
+					So(status(txid), ShouldEqual, TxnAborted)
+				})
+			})
+		})
+
+		Convey("groups which disagree on the outcome are reported", func() {
+			perform(0, types.BasicCommand{ClientID: CoordinatorID, CommandID: "t/commit", Op: statemachine.CommitOp("t")}, "{}")
+			perform(1, types.BasicCommand{ClientID: CoordinatorID, CommandID: "t/abort", Op: statemachine.AbortOp("t")}, statemachine.ResultAborted)
+			violations := coordinator.Violations()
+			So(len(violations), ShouldEqual, 1)
+			So(violations[0].Invariant, ShouldEqual, "T1")
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package shard
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of partitioners
+const (
+	KindHash  = "hash"
+	KindRange = "range"
+)
+
+// Spec - a serializable description of a partitioner, built once the number of groups is known
+type Spec struct {
+	// hash (default) or range
+	Kind string `json:"kind,omitempty" yaml:"kind,omitempty"`
+
+	// range: the first key of every group but the first, in ascending order
+	Bounds []string `json:"bounds,omitempty" yaml:"bounds,omitempty"`
+}
+
+// Build - the partitioner of the keys across the groups
+func (s Spec) Build(groups int) (Partitioner, error) {
+	if groups < 1 {
+		return nil, fmt.Errorf("number of groups must be positive")
+	}
+	switch s.Kind {
+	case "", KindHash:
+		return Hash{Groups: groups}, nil
+	case KindRange:
+		if len(s.Bounds) != groups-1 {
+			return nil, fmt.Errorf("%d groups require %d bounds, got %d", groups, groups-1, len(s.Bounds))
+		}
+		if !sort.SliceIsSorted(s.Bounds, func(i, j int) bool { return s.Bounds[i] <= s.Bounds[j] }) {
+			return nil, fmt.Errorf("bounds %v are not in ascending order", s.Bounds)
+		}
+		for i := 1; i < len(s.Bounds); i++ {
+			if s.Bounds[i] == s.Bounds[i-1] {
+				return nil, fmt.Errorf("bound %q is repeated", s.Bounds[i])
+			}
+		}
+		return Range{Bounds: s.Bounds}, nil
+	}
+	return nil, fmt.Errorf("unknown partition kind %q, expected hash or range", s.Kind)
+}
+
+// Check - build the partitioner, to validate a spec before a cluster is constructed
+func (s Spec) Check(groups int) error {
+	_, err := s.Build(groups)
+	return err
+}
+
+func (s Spec) String() string {
+	if s.Kind == KindRange {
+		return fmt.Sprintf("%s:%s", s.Kind, strings.Join(s.Bounds, ","))
+	}
+	return KindHash
+}
+
+// ParseSpec - parse the String form of a spec: hash or range:B1,B2,...
+func ParseSpec(str string) (Spec, error) {
+	kind, args := str, ""
+	if i := strings.Index(str, ":"); i >= 0 {
+		kind, args = str[:i], str[i+1:]
+	}
+	switch kind {
+	case "", KindHash:
+		return Spec{}, nil
+	case KindRange:
+		spec := Spec{Kind: kind}
+		for _, b := range strings.Split(args, ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				spec.Bounds = append(spec.Bounds, b)
+			}
+		}
+		return spec, nil
+	}
+	return Spec{Kind: kind}, fmt.Errorf("unknown partition kind %q, expected hash or range", kind)
+}
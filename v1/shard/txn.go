@@ -0,0 +1,440 @@
+package shard
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/events"
+	"github.com/1xyz/paxossim/v1/invariant"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/statemachine"
+	"github.com/1xyz/paxossim/v1/types"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CoordinatorID - the client id of the commands of the transaction coordinator
+const CoordinatorID = "coordinator"
+
+// coordinatorAddr - the source of the commands of the transaction coordinator
+var coordinatorAddr = v1.NewAddress(v1.ProcessID(-3), v1.Client)
+
+// Status of a transaction
+const (
+	TxnPending   = "pending"
+	TxnCommitted = "committed"
+	TxnAborted   = "aborted"
+)
+
+// Transaction - a transaction as known to its coordinator
+type Transaction struct {
+	ID string
+
+	// pending, committed or aborted
+	Status string
+
+	// the part of the transaction of every participating group, by group
+	Parts map[int]statemachine.Txn
+
+	// values read by the GETs of a committed transaction, by key
+	Reads map[string]string
+}
+
+// transaction - the progress of a transaction through two-phase commit
+type transaction struct {
+	Transaction
+
+	// the group which decides the outcome
+	coordinator int
+
+	// PREPARE results, by group
+	votes map[int]string
+
+	// DECIDE sent to the coordinating group
+	deciding bool
+
+	// outcome decided by the coordinating group, OpCommit or OpAbort; empty until then
+	outcome string
+
+	// the groups which committed or aborted
+	finished map[int]bool
+}
+
+// Coordinator - runs transactions over the groups of a Router with two-phase commit, in which
+// every step is a command decided by the Paxos groups: each participating group decides a PREPARE,
+// which locks the keys of its part of the transaction, the group of the first participant decides
+// the outcome, and each participating group then decides a COMMIT or an ABORT. The coordinator
+// only keeps its progress in memory; after a crash, Restart recovers every transaction a group
+// has prepared from the groups, and completes it with the outcome the coordinating group decided,
+// or aborts it if none was decided. The Coordinator has to be registered as an events.Sink of the
+// replicas, it learns of the progress of a transaction from their CommandPerformed events
+type Coordinator struct {
+	router *Router
+
+	mu *sync.Mutex
+
+	// the boot count of the coordinator, keeps the ids of the transactions of every incarnation
+	// unique
+	epoch int
+
+	count int
+
+	// the transactions of this incarnation, and the ones it recovered, by id; lost on a crash
+	txns map[string]*transaction
+
+	crashed bool
+
+	// the groups which have yet to list their in-doubt transactions to a recovery
+	recovering map[int]bool
+
+	// COMMIT or ABORT performed by each group, by transaction, as seen by an observer who
+	// outlives the crashes of the coordinator
+	observed map[string]map[int]string
+}
+
+func NewCoordinator(router *Router) *Coordinator {
+	return &Coordinator{
+		router:   router,
+		mu:       &sync.Mutex{},
+		txns:     make(map[string]*transaction),
+		observed: make(map[string]map[int]string),
+	}
+}
+
+// Submit - start a transaction of the operations on keys, applied atomically across the groups
+// owning their keys. Returns the id of the transaction, see Transaction
+func (c *Coordinator) Submit(operations ...ops.Operation) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.crashed {
+		return "", fmt.Errorf("unavailable: the coordinator is crashed")
+	}
+	if len(operations) == 0 {
+		return "", fmt.Errorf("a transaction requires an operation")
+	}
+	c.count++
+	txn := &transaction{
+		Transaction: Transaction{
+			ID:     fmt.Sprintf("txn-%d.%d", c.epoch, c.count),
+			Status: TxnPending,
+			Parts:  make(map[int]statemachine.Txn),
+		},
+		votes:    make(map[int]string),
+		finished: make(map[int]bool),
+	}
+	for _, o := range operations {
+		keys := o.Keys()
+		if len(keys) == 0 {
+			return "", fmt.Errorf("%q: expected an operation on a key", ops.Encode(o))
+		}
+		group := c.router.Group(keys[0])
+		part := txn.Parts[group]
+		part.Ops = append(part.Ops, o)
+		txn.Parts[group] = part
+	}
+	participants := make([]int, 0, len(txn.Parts))
+	for group := range txn.Parts {
+		participants = append(participants, group)
+	}
+	sort.Ints(participants)
+	txn.coordinator = participants[0]
+	if err := c.router.hold(txn.ID); err != nil {
+		return "", err
+	}
+	c.txns[txn.ID] = txn
+	log.WithFields(log.Fields{"txn": txn.ID, "participants": participants}).Debug("Preparing transaction")
+	for _, group := range participants {
+		part := txn.Parts[group]
+		part.Participants = participants
+		part.Coordinator = txn.coordinator
+		txn.Parts[group] = part
+		if err := c.send(group, txn.ID, statemachine.PrepareOp(txn.ID, part)); err != nil {
+			return "", err
+		}
+	}
+	return txn.ID, nil
+}
+
+// send - request the group to decide the operation of the transaction
+func (c *Coordinator) send(group int, txid string, op string) error {
+	kind := strings.ToLower(strings.Fields(op)[0])
+	command := types.BasicCommand{ClientID: CoordinatorID, CommandID: txid + "/" + kind, Op: op}
+	return c.router.groups[group].SendAll(v1.Replica, messages.NewRequestMessage(coordinatorAddr, command))
+}
+
+// Record - advance the transactions on the commands of the coordinator performed by the replicas
+func (c *Coordinator) Record(e events.Event) error {
+	p, ok := e.(events.CommandPerformed)
+	if !ok || p.Command == nil || p.Command.GetClientID() != CoordinatorID {
+		return nil
+	}
+	group := c.router.groupOf(p.Replica)
+	fields := strings.Fields(p.Command.GetOp())
+	if group < 0 || len(fields) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	kind := strings.ToUpper(fields[0])
+	if kind == statemachine.OpInDoubt {
+		return c.recover(group, p.Result)
+	}
+	if len(fields) < 2 {
+		return nil
+	}
+	txid := fields[1]
+	if kind == statemachine.OpCommit || kind == statemachine.OpAbort {
+		c.observe(txid, group, p.Result)
+	}
+	txn, ok := c.txns[txid]
+	if c.crashed || !ok {
+		return nil
+	}
+	switch kind {
+	case statemachine.OpPrepare:
+		return c.vote(txn, group, p.Result)
+	case statemachine.OpDecide:
+		return c.decided(txn, p.Result)
+	case statemachine.OpCommit, statemachine.OpAbort:
+		return c.finish(txn, group, p.Result)
+	}
+	return nil
+}
+
+// observe - record the outcome of the transaction at the group, the first time it is performed
+func (c *Coordinator) observe(txid string, group int, result string) {
+	if c.observed[txid] == nil {
+		c.observed[txid] = make(map[int]string)
+	}
+	if _, ok := c.observed[txid][group]; ok {
+		return
+	}
+	outcome := statemachine.OpCommit
+	if result == statemachine.ResultAborted {
+		outcome = statemachine.OpAbort
+	}
+	c.observed[txid][group] = outcome
+}
+
+// vote - count the PREPARE of the group; the transaction commits once every participant prepared
+// it, and aborts as soon as one did not
+func (c *Coordinator) vote(txn *transaction, group int, result string) error {
+	if _, ok := txn.votes[group]; ok || txn.deciding {
+		return nil
+	}
+	txn.votes[group] = result
+	if result != statemachine.ResultPrepared {
+		return c.decide(txn, statemachine.OpAbort)
+	}
+	if len(txn.votes) == len(txn.Parts) {
+		return c.decide(txn, statemachine.OpCommit)
+	}
+	return nil
+}
+
+// decide - propose the outcome to the coordinating group, which decides the first one proposed
+func (c *Coordinator) decide(txn *transaction, outcome string) error {
+	txn.deciding = true
+	return c.send(txn.coordinator, txn.ID, statemachine.DecideOp(txn.ID, outcome))
+}
+
+// decided - send the outcome decided by the coordinating group to every participant
+func (c *Coordinator) decided(txn *transaction, outcome string) error {
+	if txn.outcome != "" || (outcome != statemachine.OpCommit && outcome != statemachine.OpAbort) {
+		return nil
+	}
+	txn.outcome = outcome
+	log.WithFields(log.Fields{"txn": txn.ID, "outcome": outcome}).Debug("Transaction decided")
+	for _, group := range sortedGroups(txn.Parts) {
+		op := statemachine.AbortOp(txn.ID)
+		if outcome == statemachine.OpCommit {
+			op = statemachine.CommitOp(txn.ID)
+		}
+		if err := c.send(group, txn.ID, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish - count the COMMIT or ABORT of the group; the transaction is done once every participant
+// performed it
+func (c *Coordinator) finish(txn *transaction, group int, result string) error {
+	if txn.finished[group] || txn.outcome == "" {
+		return nil
+	}
+	txn.finished[group] = true
+	if txn.outcome == statemachine.OpCommit {
+		reads, err := statemachine.ParseReads(result)
+		if err != nil {
+			return err
+		}
+		if txn.Reads == nil {
+			txn.Reads = make(map[string]string)
+		}
+		for k, v := range reads {
+			txn.Reads[k] = v
+		}
+	}
+	if len(txn.finished) < len(txn.Parts) {
+		return nil
+	}
+	txn.Status = TxnAborted
+	if txn.outcome == statemachine.OpCommit {
+		txn.Status = TxnCommitted
+	}
+	c.router.release(txn.ID)
+	log.WithFields(log.Fields{"txn": txn.ID, "status": txn.Status}).Info("Transaction finished")
+	return nil
+}
+
+// Crash - lose the progress of every transaction, and stop taking part in them until Restart
+func (c *Coordinator) Crash() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.crashed = true
+	c.txns = make(map[string]*transaction)
+	c.recovering = nil
+}
+
+// Restart - take part in transactions again, and recover the transactions prepared by a group but
+// neither committed nor aborted: each group lists them with an INDOUBT, the coordinating group of
+// each decides its outcome, aborting it unless it was decided before, and every participant then
+// commits or aborts it
+func (c *Coordinator) Restart() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.crashed = false
+	c.epoch++
+	c.count = 0
+	c.recovering = make(map[int]bool)
+	recovery := fmt.Sprintf("recover-%d", c.epoch)
+	log.WithFields(log.Fields{"epoch": c.epoch}).Info("Recovering transactions")
+	for _, g := range c.router.groups {
+		c.recovering[g.Index()] = true
+		if err := c.send(g.Index(), recovery, statemachine.OpInDoubt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recover - complete the in-doubt transactions listed by the group
+func (c *Coordinator) recover(group int, result string) error {
+	if c.crashed || !c.recovering[group] {
+		return nil
+	}
+	delete(c.recovering, group)
+	inDoubt, err := statemachine.ParseInDoubt(result)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(inDoubt))
+	for txid := range inDoubt {
+		ids = append(ids, txid)
+	}
+	sort.Strings(ids)
+	for _, txid := range ids {
+		part := inDoubt[txid]
+		txn, ok := c.txns[txid]
+		if !ok {
+			txn = &transaction{
+				Transaction: Transaction{ID: txid, Status: TxnPending, Parts: make(map[int]statemachine.Txn)},
+				coordinator: part.Coordinator,
+				votes:       make(map[int]string),
+				finished:    make(map[int]bool),
+			}
+			for _, g := range part.Participants {
+				txn.Parts[g] = statemachine.Txn{Participants: part.Participants, Coordinator: part.Coordinator}
+			}
+			c.txns[txid] = txn
+			log.WithFields(log.Fields{"txn": txid, "group": group}).Info("Recovering in-doubt transaction")
+		}
+		txn.Parts[group] = part
+		if !txn.deciding {
+			// the outcome decided before the crash, if any, wins
+			if err := c.decide(txn, statemachine.OpAbort); err != nil {
+				return err
+			}
+		}
+	}
+	if len(c.recovering) == 0 {
+		// transactions no group prepared are not in doubt
+		c.router.releaseExcept(c.pending())
+	}
+	return nil
+}
+
+// pending - the ids of the transactions which are not done
+func (c *Coordinator) pending() map[string]bool {
+	result := make(map[string]bool)
+	for txid, txn := range c.txns {
+		if txn.Status == TxnPending {
+			result[txid] = true
+		}
+	}
+	return result
+}
+
+// Transaction - the state of the transaction, false if the coordinator does not know it
+func (c *Coordinator) Transaction(txid string) (Transaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	txn, ok := c.txns[txid]
+	if !ok {
+		return Transaction{}, false
+	}
+	return txn.Transaction, true
+}
+
+// Transactions - the transactions known to the coordinator, in order of their ids
+func (c *Coordinator) Transactions() []Transaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make([]Transaction, 0, len(c.txns))
+	for _, txn := range c.txns {
+		result = append(result, txn.Transaction)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Violations - T1: no transaction was committed by one group and aborted by another
+func (c *Coordinator) Violations() []invariant.Violation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make([]string, 0, len(c.observed))
+	for txid := range c.observed {
+		ids = append(ids, txid)
+	}
+	sort.Strings(ids)
+	violations := make([]invariant.Violation, 0)
+	for _, txid := range ids {
+		outcomes := c.observed[txid]
+		groups := make(map[string][]int)
+		for group, outcome := range outcomes {
+			groups[outcome] = append(groups[outcome], group)
+		}
+		if len(groups) > 1 {
+			sort.Ints(groups[statemachine.OpCommit])
+			sort.Ints(groups[statemachine.OpAbort])
+			violations = append(violations, invariant.Violation{
+				Invariant: "T1",
+				Message: fmt.Sprintf("transaction %s committed by groups %v and aborted by groups %v",
+					txid, groups[statemachine.OpCommit], groups[statemachine.OpAbort]),
+			})
+		}
+	}
+	return violations
+}
+
+func sortedGroups(parts map[int]statemachine.Txn) []int {
+	result := make([]int, 0, len(parts))
+	for group := range parts {
+		result = append(result, group)
+	}
+	sort.Ints(result)
+	return result
+}
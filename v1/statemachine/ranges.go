@@ -0,0 +1,93 @@
+package statemachine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// openBound - a missing start or end of a range, in an operation
+const openBound = "-"
+
+// KeyRange - the keys from Start (inclusive) to End (exclusive), in lexicographic order. An empty
+// Start or End leaves the range open on that side
+type KeyRange struct {
+	Start string `json:"start,omitempty" yaml:"start,omitempty"`
+
+	End string `json:"end,omitempty" yaml:"end,omitempty"`
+}
+
+// Contains - whether the key is in the range
+func (r KeyRange) Contains(key string) bool {
+	return key >= r.Start && (r.End == "" || key < r.End)
+}
+
+// IsEmpty - whether the range contains no key
+func (r KeyRange) IsEmpty() bool {
+	return r.End != "" && r.End <= r.Start
+}
+
+// Subtract - the parts of the range which are not in the other range
+func (r KeyRange) Subtract(other KeyRange) []KeyRange {
+	result := make([]KeyRange, 0, 2)
+	if other.Start > r.Start {
+		below := KeyRange{Start: r.Start, End: other.Start}
+		if r.End != "" && r.End < other.Start {
+			below.End = r.End
+		}
+		if !below.IsEmpty() {
+			result = append(result, below)
+		}
+	}
+	if other.End != "" && (r.End == "" || other.End < r.End) {
+		above := KeyRange{Start: other.End, End: r.End}
+		if r.Start > other.End {
+			above.Start = r.Start
+		}
+		if !above.IsEmpty() {
+			result = append(result, above)
+		}
+	}
+	return result
+}
+
+func (r KeyRange) String() string {
+	return fmt.Sprintf("[%s, %s)", bound(r.Start), bound(r.End))
+}
+
+func bound(s string) string {
+	if s == "" {
+		return openBound
+	}
+	return s
+}
+
+func unbound(s string) string {
+	if s == openBound {
+		return ""
+	}
+	return s
+}
+
+// MoveOp - the operation which removes the range from a store, and returns its keys & values
+func MoveOp(r KeyRange) string {
+	return fmt.Sprintf("%s %s %s", OpMove, bound(r.Start), bound(r.End))
+}
+
+// InstallOp - the operation which adds the range to a store, with the keys & values returned by
+// the MoveOp of another store
+func InstallOp(r KeyRange, data string) string {
+	return fmt.Sprintf("%s %s %s %s", OpInstall, bound(r.Start), bound(r.End), data)
+}
+
+// parseRangeOp - the range of a MOVE or an INSTALL, and the rest of the operation
+func parseRangeOp(op string) (KeyRange, string, error) {
+	parts := strings.SplitN(op, " ", 4)
+	if len(parts) < 3 {
+		return KeyRange{}, "", fmt.Errorf("invalid range operation %q", op)
+	}
+	r := KeyRange{Start: unbound(parts[1]), End: unbound(parts[2])}
+	if len(parts) == 3 {
+		return r, "", nil
+	}
+	return r, parts[3], nil
+}
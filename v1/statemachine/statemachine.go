@@ -0,0 +1,211 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Operations understood by the KV state machine: the operations of package ops carried by an
+// ops.Command, e.g. "PUT k1 v1", "GET k1", "DEL k1" or "CAS k1 v1 v2". A shard hands a range of keys over with
+// "MOVE <start> <end>", and takes one over with "INSTALL <start> <end> <data>", see MoveOp &
+// InstallOp. The operations of transactions are listed in txn.go
+const (
+	OpPut     = ops.NamePut
+	OpGet     = ops.NameGet
+	OpDel     = ops.NameDelete
+	OpMove    = "MOVE"
+	OpInstall = "INSTALL"
+)
+
+// ResultMoved - the result of an operation on a key which was moved to another shard
+const ResultMoved = "MOVED"
+
+// GlobalKey - the key of operations which do not name one; they interfere with every operation
+const GlobalKey = "*"
+
+// StateMachine - the replicated state, which every replica applies decided commands to in order
+type StateMachine interface {
+	// Apply the command and return its result
+	Apply(command types.Command) string
+}
+
+// KV - a key value store
+type KV struct {
+	mu *sync.Mutex
+
+	data map[string]string
+
+	// number of commands applied
+	applied int
+
+	// the ranges of keys moved to other shards
+	moved []KeyRange
+
+	// the transactions prepared, but neither committed nor aborted
+	txns txnState
+}
+
+func NewKV() *KV {
+	return &KV{mu: &sync.Mutex{}, data: make(map[string]string), txns: newTxnState()}
+}
+
+// Apply - apply the operation of package ops the command carries, a MOVE, an INSTALL or an
+// operation of a transaction; other operations are counted, but leave the store unchanged.
+// Operations on the keys of a range moved away return ResultMoved
+func (kv *KV) Apply(command types.Command) string {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.applied++
+	if operation, ok := ops.OperationOf(command); ok {
+		return kv.apply(operation)
+	}
+	op := command.GetOp()
+	fields := strings.Fields(op)
+	if len(fields) == 0 {
+		return ""
+	}
+	switch strings.ToUpper(fields[0]) {
+	case OpMove:
+		return kv.move(op)
+	case OpInstall:
+		return kv.install(op)
+	case OpPrepare:
+		return kv.prepare(op)
+	case OpCommit:
+		return kv.commit(fields)
+	case OpAbort:
+		return kv.abort(fields)
+	case OpDecide:
+		return kv.decide(fields)
+	case OpInDoubt:
+		return kv.inDoubt()
+	}
+	return ""
+}
+
+// apply - apply the operation to the keys of the store
+func (kv *KV) apply(operation ops.Operation) string {
+	for _, key := range operation.Keys() {
+		if kv.isMoved(key) {
+			return ResultMoved
+		}
+	}
+	return operation.Apply(store(kv.data))
+}
+
+// store - the keys & values of a KV, as an ops.Store
+type store map[string]string
+
+func (s store) Get(key string) (string, bool) {
+	v, ok := s[key]
+	return v, ok
+}
+
+func (s store) Put(key string, value string) {
+	s[key] = value
+}
+
+func (s store) Delete(key string) {
+	delete(s, key)
+}
+
+// move - remove the keys of the range, which other operations find moved from now on. Returns the
+// removed keys & values, in the format of InstallOp
+func (kv *KV) move(op string) string {
+	r, _, err := parseRangeOp(op)
+	if err != nil {
+		return ""
+	}
+	data := make(map[string]string)
+	for k, v := range kv.data {
+		if r.Contains(k) {
+			data[k] = v
+			delete(kv.data, k)
+		}
+	}
+	kv.moved = append(kv.moved, r)
+	encoded, _ := json.Marshal(data)
+	return string(encoded)
+}
+
+// install - take the range over, with the keys & values moved from another shard
+func (kv *KV) install(op string) string {
+	r, rest, err := parseRangeOp(op)
+	if err != nil {
+		return ""
+	}
+	data := make(map[string]string)
+	if err := json.Unmarshal([]byte(rest), &data); err != nil {
+		return ""
+	}
+	moved := make([]KeyRange, 0, len(kv.moved))
+	for _, m := range kv.moved {
+		moved = append(moved, m.Subtract(r)...)
+	}
+	kv.moved = moved
+	for k, v := range data {
+		if r.Contains(k) {
+			kv.data[k] = v
+		}
+	}
+	return "OK"
+}
+
+// Get - the value of a key
+func (kv *KV) Get(key string) (string, bool) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	v, ok := kv.data[key]
+	return v, ok
+}
+
+// Applied - the number of commands applied so far
+func (kv *KV) Applied() int {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.applied
+}
+
+// String - the contents of the store, ordered by key
+func (kv *KV) String() string {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	keys := make([]string, 0, len(kv.data))
+	for k := range kv.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = fmt.Sprintf("%s=%s", k, kv.data[k])
+	}
+	return "{" + strings.Join(pairs, " ") + "}"
+}
+
+// Keys - the keys a command reads or writes. Commands which do not carry an operation naming a key
+// touch GlobalKey, including MOVE & INSTALL, which touch a range of keys, and the operations of
+// transactions
+func Keys(command types.Command) []string {
+	operation, ok := ops.OperationOf(command)
+	if !ok || len(operation.Keys()) == 0 {
+		return []string{GlobalKey}
+	}
+	return operation.Keys()
+}
+
+// Interfere - whether the order in which two commands are applied matters, i.e. they touch a common key
+func Interfere(a types.Command, b types.Command) bool {
+	for _, ka := range Keys(a) {
+		for _, kb := range Keys(b) {
+			if ka == kb || ka == GlobalKey || kb == GlobalKey {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package statemachine
+
+import (
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func newCommand(op string) types.Command {
+	return types.BasicCommand{ClientID: "client:0", CommandID: op, Op: op}
+}
+
+// newOpCommand - a command carrying the operation encoded by the string, e.g. "PUT k1 v1"
+func newOpCommand(op string) types.Command {
+	operation, err := ops.Decode(op)
+	if err != nil {
+		panic(err)
+	}
+	return ops.NewCommand("client:0", op, operation)
+}
+
+func TestKV(t *testing.T) {
+	Convey("Given a KV store", t, func() {
+		kv := NewKV()
+
+		Convey("a PUT is read back by a GET", func() {
+			So(kv.Apply(newOpCommand("PUT k1 v1")), ShouldEqual, "OK")
+			So(kv.Apply(newOpCommand("GET k1")), ShouldEqual, "v1")
+			So(kv.String(), ShouldEqual, "{k1=v1}")
+
+			Convey("and removed by a DEL", func() {
+				kv.Apply(newOpCommand("DEL k1"))
+				_, ok := kv.Get("k1")
+				So(ok, ShouldBeFalse)
+				So(kv.Applied(), ShouldEqual, 3)
+			})
+		})
+
+		Convey("typed operations are applied to the keys they name", func() {
+			So(kv.Apply(ops.NewCommand("client:0", "1", ops.Put{Key: "k1", Value: "a b"})), ShouldEqual, ops.ResultOK)
+			So(kv.Apply(ops.NewCommand("client:0", "2", ops.Append{Key: "k1", Value: " c"})), ShouldEqual, ops.ResultOK)
+			So(kv.Apply(newOpCommand("CAS k1 v1 v2")), ShouldEqual, ops.ResultMismatch)
+			So(kv.Apply(ops.NewCommand("client:0", "3", ops.CAS{Key: "k1", Expected: "a b c", Value: "v2"})), ShouldEqual, ops.ResultOK)
+			So(kv.Apply(ops.NewCommand("client:0", "4", ops.NoOp{})), ShouldEqual, "")
+			So(kv.String(), ShouldEqual, "{k1=v2}")
+			So(kv.Apply(newCommand("PUT k1 v3")), ShouldEqual, "")
+			So(kv.String(), ShouldEqual, "{k1=v2}")
+			So(Keys(newCommand("PUT k1 v3")), ShouldResemble, []string{GlobalKey})
+			So(Keys(newOpCommand("CAS k1 v1 v2")), ShouldResemble, []string{"k1"})
+			So(Keys(newCommand(ops.NameNoOp)), ShouldResemble, []string{GlobalKey})
+		})
+
+		Convey("a MOVE hands a range over, which an INSTALL takes over", func() {
+			kv.Apply(newOpCommand("PUT k1 v1"))
+			kv.Apply(newOpCommand("PUT k5 v5"))
+			keys := KeyRange{Start: "k3"}
+			data := kv.Apply(newCommand(MoveOp(keys)))
+			So(data, ShouldEqual, `{"k5":"v5"}`)
+			So(kv.String(), ShouldEqual, "{k1=v1}")
+			So(kv.Apply(newOpCommand("PUT k6 v6")), ShouldEqual, ResultMoved)
+			So(kv.Apply(newOpCommand("APPEND k5 v")), ShouldEqual, ResultMoved)
+			So(kv.Apply(newOpCommand("GET k1")), ShouldEqual, "v1")
+
+			other := NewKV()
+			So(other.Apply(newCommand(InstallOp(keys, data))), ShouldEqual, "OK")
+			So(other.String(), ShouldEqual, "{k5=v5}")
+
+			Convey("and back again", func() {
+				So(kv.Apply(newCommand(InstallOp(KeyRange{Start: "k3", End: "k6"}, "{}"))), ShouldEqual, "OK")
+				So(kv.Apply(newOpCommand("PUT k4 v4")), ShouldEqual, "OK")
+				So(kv.Apply(newOpCommand("PUT k6 v6")), ShouldEqual, ResultMoved)
+			})
+		})
+
+		Convey("other operations leave the store unchanged", func() {
+			So(kv.Apply(newCommand("OP")), ShouldEqual, "")
+			So(kv.String(), ShouldEqual, "{}")
+			So(kv.Applied(), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestInterfere(t *testing.T) {
+	Convey("Commands interfere if they touch a common key", t, func() {
+		So(Interfere(newOpCommand("PUT k1 a"), newOpCommand("GET k1")), ShouldBeTrue)
+		So(Interfere(newOpCommand("PUT k1 a"), newOpCommand("PUT k2 b")), ShouldBeFalse)
+
+		Convey("commands without a key interfere with every command", func() {
+			So(Keys(newCommand("OP")), ShouldResemble, []string{GlobalKey})
+			So(Interfere(newCommand("OP"), newOpCommand("PUT k2 b")), ShouldBeTrue)
+		})
+	})
+}
+
+func TestKeyRange(t *testing.T) {
+	Convey("Given the range of keys from k3 to k6", t, func() {
+		r := KeyRange{Start: "k3", End: "k6"}
+
+		Convey("it contains its start, but not its end", func() {
+			So(r.Contains("k3"), ShouldBeTrue)
+			So(r.Contains("k5"), ShouldBeTrue)
+			So(r.Contains("k6"), ShouldBeFalse)
+			So(KeyRange{Start: "k3"}.Contains("k9"), ShouldBeTrue)
+			So(r.String(), ShouldEqual, "[k3, k6)")
+		})
+
+		Convey("subtracting a range leaves the keys below & above it", func() {
+			So(r.Subtract(KeyRange{Start: "k4", End: "k5"}), ShouldResemble,
+				[]KeyRange{{Start: "k3", End: "k4"}, {Start: "k5", End: "k6"}})
+			So(r.Subtract(KeyRange{Start: "k4"}), ShouldResemble, []KeyRange{{Start: "k3", End: "k4"}})
+			So(r.Subtract(KeyRange{}), ShouldBeEmpty)
+			So(r.Subtract(KeyRange{Start: "k7", End: "k8"}), ShouldResemble, []KeyRange{r})
+		})
+	})
+}
+
+func TestTransactions(t *testing.T) {
+	Convey("Given a KV store", t, func() {
+		kv := NewKV()
+		kv.Apply(newOpCommand("PUT k1 v1"))
+		txn := Txn{Ops: []ops.Operation{ops.Put{Key: "k1", Value: "a"}, ops.Get{Key: "k2"}}, Participants: []int{0, 1}}
+
+		Convey("a prepared transaction locks its keys", func() {
+			So(kv.Apply(newCommand(PrepareOp("t1", txn))), ShouldEqual, ResultPrepared)
+			So(kv.Apply(newCommand(PrepareOp("t1", txn))), ShouldEqual, ResultPrepared)
+			So(kv.Locked(), ShouldResemble, []string{"k1", "k2"})
+			So(kv.Apply(newCommand(PrepareOp("t2", Txn{Ops: []ops.Operation{ops.Delete{Key: "k2"}}}))), ShouldEqual, ResultAborted)
+
+			inDoubt, err := ParseInDoubt(kv.Apply(newCommand(OpInDoubt)))
+			So(err, ShouldBeNil)
+			So(inDoubt, ShouldResemble, map[string]Txn{"t1": txn})
+
+			Convey("which applies its operations on commit", func() {
+				reads, err := ParseReads(kv.Apply(newCommand(CommitOp("t1"))))
+				So(err, ShouldBeNil)
+				So(reads, ShouldResemble, map[string]string{"k2": ""})
+				So(kv.String(), ShouldEqual, "{k1=a}")
+				So(kv.Locked(), ShouldBeEmpty)
+				So(kv.Apply(newCommand(AbortOp("t1"))), ShouldEqual, `{"k2":""}`)
+				So(kv.String(), ShouldEqual, "{k1=a}")
+			})
+
+			Convey("and drops them on abort", func() {
+				So(kv.Apply(newCommand(AbortOp("t1"))), ShouldEqual, ResultAborted)
+				So(kv.Apply(newCommand(CommitOp("t1"))), ShouldEqual, ResultAborted)
+				So(kv.String(), ShouldEqual, "{k1=v1}")
+				So(kv.Locked(), ShouldBeEmpty)
+				So(kv.Apply(newCommand(OpInDoubt)), ShouldEqual, "{}")
+			})
+		})
+
+		Convey("a transaction aborted before it was prepared stays aborted", func() {
+			So(kv.Apply(newCommand(AbortOp("t1"))), ShouldEqual, ResultAborted)
+			So(kv.Apply(newCommand(PrepareOp("t1", txn))), ShouldEqual, ResultAborted)
+			So(kv.Locked(), ShouldBeEmpty)
+		})
+
+		Convey("a transaction on keys moved away is aborted", func() {
+			kv.Apply(newCommand(MoveOp(KeyRange{Start: "k2"})))
+			So(kv.Apply(newCommand(PrepareOp("t1", txn))), ShouldEqual, ResultAborted)
+			So(kv.Apply(newCommand(OpPrepare+` t2 {"ops":["MOVE k1 k2"]}`)), ShouldEqual, ResultAborted)
+		})
+
+		Convey("a transaction applies typed operations", func() {
+			cas := Txn{Ops: []ops.Operation{ops.CAS{Key: "k1", Expected: "v1", Value: "v2"}, ops.Append{Key: "k2", Value: "+"}}}
+			So(kv.Apply(newCommand(PrepareOp("t1", cas))), ShouldEqual, ResultPrepared)
+			So(kv.Locked(), ShouldResemble, []string{"k1", "k2"})
+			So(kv.Apply(newCommand(CommitOp("t1"))), ShouldEqual, "{}")
+			So(kv.String(), ShouldEqual, "{k1=v2 k2=+}")
+			So(kv.Apply(newCommand(PrepareOp("t2", Txn{Ops: []ops.Operation{ops.NoOp{}}}))), ShouldEqual, ResultAborted)
+		})
+
+		Convey("the first outcome decided wins", func() {
+			So(kv.Apply(newCommand(DecideOp("t1", OpCommit))), ShouldEqual, OpCommit)
+			So(kv.Apply(newCommand(DecideOp("t1", OpAbort))), ShouldEqual, OpCommit)
+			So(kv.Apply(newCommand(DecideOp("t2", OpAbort))), ShouldEqual, OpAbort)
+		})
+	})
+}
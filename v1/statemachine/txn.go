@@ -0,0 +1,271 @@
+package statemachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/1xyz/paxossim/v1/ops"
+	"sort"
+	"strings"
+)
+
+// Operations of the transactions of the KV state machine, which every shard taking part in a
+// transaction decides in turn: "PREPARE <txid> <txn>" locks the keys of its part of the transaction,
+// "COMMIT <txid>" applies it and "ABORT <txid>" drops it. The shard coordinating the transaction
+// decides its outcome with "DECIDE <txid> COMMIT|ABORT", and "INDOUBT" lists the transactions a
+// shard prepared but did not commit or abort yet
+const (
+	OpPrepare = "PREPARE"
+	OpCommit  = "COMMIT"
+	OpAbort   = "ABORT"
+	OpDecide  = "DECIDE"
+	OpInDoubt = "INDOUBT"
+)
+
+// Results of the operations of transactions
+const (
+	ResultPrepared = "PREPARED"
+	ResultAborted  = "ABORTED"
+)
+
+// Txn - the part of a transaction a shard takes part in, as prepared by the shard
+type Txn struct {
+	// operations of package ops on the keys of the shard, applied in order on commit
+	Ops []ops.Operation
+
+	// the shards taking part in the transaction
+	Participants []int
+
+	// the shard which decides the outcome of the transaction
+	Coordinator int
+}
+
+// txnJSON - a Txn as encoded in the operations & results of transactions, its operations encoded
+// by ops.Encode
+type txnJSON struct {
+	Ops []string `json:"ops"`
+
+	Participants []int `json:"participants"`
+
+	Coordinator int `json:"coordinator"`
+}
+
+func (t Txn) MarshalJSON() ([]byte, error) {
+	encoded := txnJSON{Ops: make([]string, len(t.Ops)), Participants: t.Participants, Coordinator: t.Coordinator}
+	for i, op := range t.Ops {
+		encoded.Ops[i] = ops.Encode(op)
+	}
+	return json.Marshal(encoded)
+}
+
+func (t *Txn) UnmarshalJSON(data []byte) error {
+	encoded := txnJSON{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	t.Ops = make([]ops.Operation, len(encoded.Ops))
+	for i, o := range encoded.Ops {
+		op, err := ops.Decode(o)
+		if err != nil {
+			return err
+		}
+		t.Ops[i] = op
+	}
+	t.Participants, t.Coordinator = encoded.Participants, encoded.Coordinator
+	return nil
+}
+
+// txnState - the transactions of a KV store
+type txnState struct {
+	// the transactions prepared, by id
+	prepared map[string]Txn
+
+	// the transaction which locked a key, by key
+	locks map[string]string
+
+	// the result of the transactions committed or aborted, by id
+	finished map[string]string
+
+	// the outcome of the transactions this shard coordinates, by id
+	decided map[string]string
+}
+
+func newTxnState() txnState {
+	return txnState{
+		prepared: make(map[string]Txn),
+		locks:    make(map[string]string),
+		finished: make(map[string]string),
+		decided:  make(map[string]string),
+	}
+}
+
+// PrepareOp - the operation which prepares the part of the transaction of a shard
+func PrepareOp(txid string, txn Txn) string {
+	encoded, _ := json.Marshal(txn)
+	return fmt.Sprintf("%s %s %s", OpPrepare, txid, encoded)
+}
+
+// CommitOp - the operation which applies a prepared transaction
+func CommitOp(txid string) string {
+	return fmt.Sprintf("%s %s", OpCommit, txid)
+}
+
+// AbortOp - the operation which drops a prepared transaction
+func AbortOp(txid string) string {
+	return fmt.Sprintf("%s %s", OpAbort, txid)
+}
+
+// DecideOp - the operation which decides the outcome of a transaction, OpCommit or OpAbort. The
+// first outcome decided wins, and is the result of every DECIDE of the transaction
+func DecideOp(txid string, outcome string) string {
+	return fmt.Sprintf("%s %s %s", OpDecide, txid, outcome)
+}
+
+// ParseInDoubt - the transactions listed by the result of an INDOUBT, by id
+func ParseInDoubt(result string) (map[string]Txn, error) {
+	txns := make(map[string]Txn)
+	if err := json.Unmarshal([]byte(result), &txns); err != nil {
+		return nil, fmt.Errorf("invalid in-doubt transactions %q: %v", result, err)
+	}
+	return txns, nil
+}
+
+// ParseReads - the values read by the GETs of a transaction, by key, from the result of its COMMIT
+func ParseReads(result string) (map[string]string, error) {
+	reads := make(map[string]string)
+	if err := json.Unmarshal([]byte(result), &reads); err != nil {
+		return nil, fmt.Errorf("invalid reads %q: %v", result, err)
+	}
+	return reads, nil
+}
+
+// prepare - lock the keys of the transaction, unless a key is locked by another transaction or was
+// moved to another shard, in which case the transaction is aborted
+func (kv *KV) prepare(op string) string {
+	parts := strings.SplitN(op, " ", 3)
+	if len(parts) < 3 {
+		return ResultAborted
+	}
+	txid := parts[1]
+	if result, ok := kv.txns.finished[txid]; ok {
+		// e.g. a PREPARE decided after the transaction was aborted
+		return result
+	}
+	if _, ok := kv.txns.prepared[txid]; ok {
+		return ResultPrepared
+	}
+	txn := Txn{}
+	if err := json.Unmarshal([]byte(parts[2]), &txn); err != nil {
+		return ResultAborted
+	}
+	keys := make([]string, 0, len(txn.Ops))
+	for _, operation := range txn.Ops {
+		if len(operation.Keys()) == 0 {
+			kv.txns.finished[txid] = ResultAborted
+			return ResultAborted
+		}
+		for _, key := range operation.Keys() {
+			if other, ok := kv.txns.locks[key]; (ok && other != txid) || kv.isMoved(key) {
+				kv.txns.finished[txid] = ResultAborted
+				return ResultAborted
+			}
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		kv.txns.locks[key] = txid
+	}
+	kv.txns.prepared[txid] = txn
+	return ResultPrepared
+}
+
+// commit - apply the operations of the prepared transaction, and release its locks. Returns the
+// values read by its GETs, by key
+func (kv *KV) commit(fields []string) string {
+	if len(fields) < 2 {
+		return ""
+	}
+	txid := fields[1]
+	txn, ok := kv.txns.prepared[txid]
+	if !ok {
+		return kv.txns.finished[txid]
+	}
+	reads := make(map[string]string)
+	for _, operation := range txn.Ops {
+		result := kv.apply(operation)
+		if get, ok := operation.(ops.Get); ok {
+			reads[get.Key] = result
+		}
+	}
+	kv.release(txid)
+	encoded, _ := json.Marshal(reads)
+	kv.txns.finished[txid] = string(encoded)
+	return string(encoded)
+}
+
+// abort - drop the prepared transaction, and release its locks
+func (kv *KV) abort(fields []string) string {
+	if len(fields) < 2 {
+		return ""
+	}
+	txid := fields[1]
+	if _, ok := kv.txns.prepared[txid]; ok {
+		kv.release(txid)
+	}
+	if _, ok := kv.txns.finished[txid]; !ok {
+		kv.txns.finished[txid] = ResultAborted
+	}
+	return kv.txns.finished[txid]
+}
+
+func (kv *KV) release(txid string) {
+	for key, locker := range kv.txns.locks {
+		if locker == txid {
+			delete(kv.txns.locks, key)
+		}
+	}
+	delete(kv.txns.prepared, txid)
+}
+
+// decide - record the outcome of the transaction, unless one was recorded before. Returns the
+// outcome recorded
+func (kv *KV) decide(fields []string) string {
+	if len(fields) < 3 {
+		return ""
+	}
+	txid, outcome := fields[1], strings.ToUpper(fields[2])
+	if outcome != OpCommit && outcome != OpAbort {
+		return ""
+	}
+	if _, ok := kv.txns.decided[txid]; !ok {
+		kv.txns.decided[txid] = outcome
+	}
+	return kv.txns.decided[txid]
+}
+
+// inDoubt - the transactions prepared, but neither committed nor aborted, by id
+func (kv *KV) inDoubt() string {
+	encoded, _ := json.Marshal(kv.txns.prepared)
+	return string(encoded)
+}
+
+// isMoved - whether the key is in a range moved to another shard
+func (kv *KV) isMoved(key string) bool {
+	for _, r := range kv.moved {
+		if r.Contains(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Locked - the keys locked by prepared transactions, in order
+func (kv *KV) Locked() []string {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	result := make([]string, 0, len(kv.txns.locks))
+	for key := range kv.txns.locks {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,68 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/quorum"
+)
+
+// Cluster - the configuration of a traced cluster which its registrations do not capture, recorded
+// once its processes are registered so that replay can rebuild the same cluster
+type Cluster struct {
+	// the leaders run Fast Paxos
+	Fast bool `json:"fast,omitempty"`
+
+	// Phase 1 & phase 2 quorums of the acceptors of every group, a majority if empty
+	Quorum quorum.Spec `json:"quorum,omitempty"`
+
+	// Paxos groups the keys are partitioned across, a single group unless the cluster is sharded
+	Groups []Group `json:"groups"`
+}
+
+// Group - the processes of a Paxos group, in construction order
+type Group struct {
+	// acceptors contacted by the leaders
+	Acceptors []Addr `json:"acceptors"`
+
+	// acceptors engaged when the main ones do not form a quorum (Cheap Paxos). Quorums are
+	// counted over the acceptors followed by the auxiliaries
+	Auxiliaries []Addr `json:"auxiliaries,omitempty"`
+
+	Leaders []Addr `json:"leaders"`
+
+	Replicas []Addr `json:"replicas"`
+}
+
+// NewAddrs - the encoded forms of the addresses
+func NewAddrs(addrs []v1.Addr) []Addr {
+	result := make([]Addr, len(addrs))
+	for i, addr := range addrs {
+		result[i] = NewAddr(addr)
+	}
+	return result
+}
+
+// Entry - an entry recording the cluster
+func (c Cluster) Entry() (Entry, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Kind: KindCluster, Payload: data}, nil
+}
+
+// ClusterOf - the cluster recorded in the entries of a trace
+func ClusterOf(entries []Entry) (Cluster, error) {
+	for _, e := range entries {
+		if e.Kind != KindCluster {
+			continue
+		}
+		var c Cluster
+		if err := json.Unmarshal(e.Payload, &c); err != nil {
+			return c, fmt.Errorf("entry %d: %v", e.Step, err)
+		}
+		return c, nil
+	}
+	return Cluster{}, fmt.Errorf("trace does not record the configuration of its cluster")
+}
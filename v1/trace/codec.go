@@ -0,0 +1,425 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/types"
+	"sort"
+)
+
+// Addr - the encoded form of a v1.Addr
+type Addr struct {
+	ID v1.ProcessID `json:"id"`
+
+	Type string `json:"type"`
+}
+
+func NewAddr(addr v1.Addr) Addr {
+	return Addr{ID: addr.ID(), Type: addr.Type().String()}
+}
+
+func (a Addr) Addr() (v1.Addr, error) {
+	pt, err := v1.ParseProcessType(a.Type)
+	if err != nil {
+		return nil, err
+	}
+	return v1.NewAddress(a.ID, pt), nil
+}
+
+func (a Addr) String() string {
+	return fmt.Sprintf("(%s-%d)", a.Type, a.ID)
+}
+
+type ballot struct {
+	Round int `json:"round"`
+
+	Leader Addr `json:"leader"`
+}
+
+type command struct {
+	ClientID string `json:"client_id"`
+
+	CommandID string `json:"command_id"`
+
+	Op string `json:"op"`
+
+	// Set for commands carrying a typed operation, see ops.Command, which Op encodes
+	Typed bool `json:"typed,omitempty"`
+
+	// Set for reconfiguration commands only
+	NewLeaders []Addr `json:"new_leaders,omitempty"`
+
+	NewAcceptors []Addr `json:"new_acceptors,omitempty"`
+}
+
+type pvalue struct {
+	Ballot ballot `json:"ballot"`
+
+	Slot types.Slot `json:"slot"`
+
+	Command command `json:"command"`
+}
+
+// payload - the union of the fields of all messages
+type payload struct {
+	Slot *types.Slot `json:"slot,omitempty"`
+
+	Command *command `json:"command,omitempty"`
+
+	Ballot *ballot `json:"ballot,omitempty"`
+
+	PValue *pvalue `json:"pvalue,omitempty"`
+
+	PValues []pvalue `json:"pvalues,omitempty"`
+
+	Votes []vote `json:"votes,omitempty"`
+
+	// the missing or the main acceptors (Cheap Paxos)
+	Acceptors []Addr `json:"acceptors,omitempty"`
+}
+
+// vote - the number of acceptors which reported a pvalue
+type vote struct {
+	PValue pvalue `json:"pvalue"`
+
+	Count int `json:"count"`
+}
+
+// Named - implemented by the messages of protocols other than Multi-Paxos (e.g. EPaxos),
+// which are recorded with their JSON encoding
+type Named interface {
+	v1.Message
+
+	MessageName() string
+}
+
+// Encode - the message type and the JSON encoded fields of a message
+func Encode(m v1.Message) (string, json.RawMessage, error) {
+	p := payload{}
+	var name string
+	switch v := m.(type) {
+	case messages.RequestMessage:
+		name, p.Command = "RequestMessage", encodeCommand(v.Command)
+	case messages.ProposeMessage:
+		name, p.Slot, p.Command = "ProposeMessage", &v.Slot, encodeCommand(v.Command)
+	case messages.DecisionMessage:
+		name, p.Slot, p.Command = "DecisionMessage", &v.Slot, encodeCommand(v.Command)
+	case messages.Phase1aMessage:
+		name, p.Ballot = "Phase1aMessage", encodeBallot(v.BallotNumber)
+	case messages.Phase1bMessage:
+		name, p.Ballot, p.PValues = "Phase1bMessage", encodeBallot(v.BallotNumber), encodePValues(v.PValues)
+	case messages.Phase2aMessage:
+		pv := encodePValue(v.PValue)
+		name, p.PValue = "Phase2aMessage", &pv
+	case messages.Phase2bMessage:
+		name, p.Ballot = "Phase2bMessage", encodeBallot(v.BallotNumber)
+	case messages.PreemptMessage:
+		name, p.Ballot = "PreemptMessage", encodeBallot(v.BallotNumber)
+	case messages.AdoptedMessage:
+		name, p.Ballot, p.PValues = "AdoptedMessage", encodeBallot(v.BallotNumber), encodePValues(v.Accepted)
+		p.Votes = encodeVotes(v.Votes)
+	case messages.FastProposeMessage:
+		name, p.Command = "FastProposeMessage", encodeCommand(v.Command)
+	case messages.Phase2aAnyMessage:
+		name, p.Ballot, p.Slot = "Phase2aAnyMessage", encodeBallot(v.BallotNumber), &v.FromSlot
+	case messages.FastVoteMessage:
+		pv := encodePValue(v.PValue)
+		name, p.PValue = "FastVoteMessage", &pv
+	case messages.AuxiliariesEngagedMessage:
+		name, p.Ballot, p.Acceptors = "AuxiliariesEngagedMessage", encodeBallot(v.BallotNumber), encodeAddrs(v.Missing)
+	case messages.AcceptorConfigMessage:
+		name, p.Slot, p.Acceptors = "AcceptorConfigMessage", &v.Slot, encodeAddrs(v.Acceptors)
+	case Named:
+		// messages of other protocols are recorded as is, and cannot be decoded
+		data, err := json.Marshal(v)
+		return v.MessageName(), data, err
+	default:
+		return "", nil, fmt.Errorf("unsupported message type %T", m)
+	}
+	data, err := json.Marshal(p)
+	return name, data, err
+}
+
+func encodeBallot(bn types.BallotNumber) *ballot {
+	return &ballot{Round: bn.Round, Leader: NewAddr(bn.LeaderID)}
+}
+
+func encodeCommand(c types.Command) *command {
+	result := &command{ClientID: c.GetClientID(), CommandID: c.GetCommandID(), Op: c.GetOp()}
+	if _, ok := ops.OperationOf(c); ok {
+		result.Typed = true
+	}
+	if rc, ok := c.(*types.ReConfigCommand); ok {
+		result.NewLeaders = encodeAddrs(rc.NewLeaders)
+		result.NewAcceptors = encodeAddrs(rc.NewAcceptors)
+	}
+	return result
+}
+
+func encodeAddrs(addrs []v1.Addr) []Addr {
+	if addrs == nil {
+		return nil
+	}
+	result := make([]Addr, 0, len(addrs))
+	for _, a := range addrs {
+		result = append(result, NewAddr(a))
+	}
+	return result
+}
+
+func encodePValue(pv types.PValue) pvalue {
+	return pvalue{Ballot: *encodeBallot(pv.BN), Slot: pv.Slot, Command: *encodeCommand(pv.Command)}
+}
+
+func encodePValues(pvs types.PValues) []pvalue {
+	result := make([]pvalue, 0, len(pvs))
+	for pv := range pvs {
+		result = append(result, encodePValue(pv))
+	}
+	// map iteration order is random, keep the encoding stable
+	sort.Slice(result, func(i, j int) bool {
+		return lessPValue(result[i], result[j])
+	})
+	return result
+}
+
+func encodeVotes(votes map[types.PValue]int) []vote {
+	result := make([]vote, 0, len(votes))
+	for pv, count := range votes {
+		result = append(result, vote{PValue: encodePValue(pv), Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return lessPValue(result[i].PValue, result[j].PValue)
+	})
+	return result
+}
+
+func lessPValue(a pvalue, b pvalue) bool {
+	if a.Slot != b.Slot {
+		return a.Slot < b.Slot
+	}
+	if a.Ballot.Round != b.Ballot.Round {
+		return a.Ballot.Round < b.Ballot.Round
+	}
+	if a.Ballot.Leader.ID != b.Ballot.Leader.ID {
+		return a.Ballot.Leader.ID < b.Ballot.Leader.ID
+	}
+	return a.Command.ClientID+"/"+a.Command.CommandID < b.Command.ClientID+"/"+b.Command.CommandID
+}
+
+// Decoder - decodes recorded messages. Addresses are translated by the
+// Resolve func (if set), which allows a trace to be fed into processes
+// with different identifiers than the recorded ones.
+type Decoder struct {
+	Resolve func(addr v1.Addr) v1.Addr
+
+	// reconfiguration commands are compared by reference, so the same
+	// recorded command must always decode to the same value
+	reconfigs map[string]*types.ReConfigCommand
+}
+
+func NewDecoder(resolve func(addr v1.Addr) v1.Addr) *Decoder {
+	return &Decoder{Resolve: resolve, reconfigs: make(map[string]*types.ReConfigCommand)}
+}
+
+// Decode - the message recorded in a deliver entry
+func (d *Decoder) Decode(e Entry) (v1.Message, error) {
+	if e.Src == nil {
+		return nil, fmt.Errorf("entry %d has no source", e.Step)
+	}
+	src, err := d.addr(*e.Src)
+	if err != nil {
+		return nil, err
+	}
+	p := payload{}
+	if err := json.Unmarshal(e.Payload, &p); err != nil {
+		return nil, err
+	}
+
+	switch e.Type {
+	case "RequestMessage":
+		c, err := d.command(p.Command)
+		return messages.NewRequestMessage(src, c), err
+	case "ProposeMessage", "DecisionMessage":
+		if p.Slot == nil {
+			return nil, fmt.Errorf("entry %d: %s without a slot", e.Step, e.Type)
+		}
+		c, err := d.command(p.Command)
+		if e.Type == "ProposeMessage" {
+			return messages.NewProposedMessage(src, *p.Slot, c), err
+		}
+		return messages.NewDecisionMessage(src, *p.Slot, c), err
+	case "Phase1aMessage":
+		bn, err := d.ballot(p.Ballot)
+		return messages.NewPhase1aMessage(src, bn), err
+	case "Phase1bMessage", "AdoptedMessage":
+		bn, err := d.ballot(p.Ballot)
+		if err != nil {
+			return nil, err
+		}
+		pvs, err := d.pvalues(p.PValues)
+		if err != nil {
+			return nil, err
+		}
+		if e.Type == "Phase1bMessage" {
+			return messages.NewPhase1bMessage(src, bn, pvs), nil
+		}
+		am := messages.NewAdoptedMessage(src, bn, pvs)
+		am.Votes, err = d.votes(p.Votes)
+		return am, err
+	case "Phase2aMessage":
+		if p.PValue == nil {
+			return nil, fmt.Errorf("entry %d: %s without a pvalue", e.Step, e.Type)
+		}
+		pv, err := d.pvalue(*p.PValue)
+		return messages.NewPhase2aMessage(src, pv), err
+	case "Phase2bMessage":
+		bn, err := d.ballot(p.Ballot)
+		return messages.NewPhase2bMessage(src, bn), err
+	case "PreemptMessage":
+		bn, err := d.ballot(p.Ballot)
+		return messages.NewPremptedMessage(src, bn), err
+	case "FastProposeMessage":
+		c, err := d.command(p.Command)
+		return messages.NewFastProposeMessage(src, c), err
+	case "Phase2aAnyMessage":
+		if p.Slot == nil {
+			return nil, fmt.Errorf("entry %d: %s without a slot", e.Step, e.Type)
+		}
+		bn, err := d.ballot(p.Ballot)
+		return messages.NewPhase2aAnyMessage(src, bn, *p.Slot), err
+	case "FastVoteMessage":
+		if p.PValue == nil {
+			return nil, fmt.Errorf("entry %d: %s without a pvalue", e.Step, e.Type)
+		}
+		pv, err := d.pvalue(*p.PValue)
+		return messages.NewFastVoteMessage(src, pv), err
+	case "AuxiliariesEngagedMessage":
+		bn, err := d.ballot(p.Ballot)
+		if err != nil {
+			return nil, err
+		}
+		missing, err := d.addrs(p.Acceptors)
+		return messages.NewAuxiliariesEngagedMessage(src, bn, missing), err
+	case "AcceptorConfigMessage":
+		if p.Slot == nil {
+			return nil, fmt.Errorf("entry %d: %s without a slot", e.Step, e.Type)
+		}
+		acceptors, err := d.addrs(p.Acceptors)
+		return messages.NewAcceptorConfigMessage(src, *p.Slot, acceptors), err
+	default:
+		return nil, fmt.Errorf("entry %d: unsupported message type %q", e.Step, e.Type)
+	}
+}
+
+func (d *Decoder) addr(a Addr) (v1.Addr, error) {
+	addr, err := a.Addr()
+	if err != nil {
+		return nil, err
+	}
+	if d.Resolve != nil {
+		return d.Resolve(addr), nil
+	}
+	return addr, nil
+}
+
+func (d *Decoder) addrs(addrs []Addr) ([]v1.Addr, error) {
+	if addrs == nil {
+		return nil, nil
+	}
+	result := make([]v1.Addr, 0, len(addrs))
+	for _, a := range addrs {
+		addr, err := d.addr(a)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, addr)
+	}
+	return result, nil
+}
+
+func (d *Decoder) ballot(b *ballot) (types.BallotNumber, error) {
+	if b == nil {
+		return types.BallotNumber{}, fmt.Errorf("missing ballot")
+	}
+	leader, err := d.addr(b.Leader)
+	if err != nil {
+		return types.BallotNumber{}, err
+	}
+	return types.BallotNumber{Round: b.Round, LeaderID: leader}, nil
+}
+
+func (d *Decoder) command(c *command) (types.Command, error) {
+	if c == nil {
+		return nil, fmt.Errorf("missing command")
+	}
+	if c.Typed {
+		operation, err := ops.Decode(c.Op)
+		if err != nil {
+			return nil, err
+		}
+		return ops.NewCommand(c.ClientID, c.CommandID, operation), nil
+	}
+	basic := types.BasicCommand{ClientID: c.ClientID, CommandID: c.CommandID, Op: c.Op}
+	if c.NewLeaders == nil && c.NewAcceptors == nil {
+		return basic, nil
+	}
+
+	key := c.ClientID + "/" + c.CommandID
+	if rc, ok := d.reconfigs[key]; ok {
+		return rc, nil
+	}
+	leaders, err := d.addrs(c.NewLeaders)
+	if err != nil {
+		return nil, err
+	}
+	acceptors, err := d.addrs(c.NewAcceptors)
+	if err != nil {
+		return nil, err
+	}
+	rc := &types.ReConfigCommand{BasicCommand: basic, NewLeaders: leaders, NewAcceptors: acceptors}
+	d.reconfigs[key] = rc
+	return rc, nil
+}
+
+func (d *Decoder) pvalue(pv pvalue) (types.PValue, error) {
+	bn, err := d.ballot(&pv.Ballot)
+	if err != nil {
+		return types.PValue{}, err
+	}
+	c, err := d.command(&pv.Command)
+	if err != nil {
+		return types.PValue{}, err
+	}
+	return types.PValue{BN: bn, Slot: pv.Slot, Command: c}, nil
+}
+
+func (d *Decoder) pvalues(pvs []pvalue) (types.PValues, error) {
+	result := make(types.PValues)
+	for _, pv := range pvs {
+		v, err := d.pvalue(pv)
+		if err != nil {
+			return nil, err
+		}
+		result.Set(v)
+	}
+	return result, nil
+}
+
+func (d *Decoder) votes(votes []vote) (map[types.PValue]int, error) {
+	if len(votes) == 0 {
+		return nil, nil
+	}
+	result := make(map[types.PValue]int, len(votes))
+	for _, v := range votes {
+		pv, err := d.pvalue(v.PValue)
+		if err != nil {
+			return nil, err
+		}
+		result[pv] = v.Count
+	}
+	return result, nil
+}
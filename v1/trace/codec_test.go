@@ -0,0 +1,69 @@
+package trace
+
+import (
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/ops"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	leader := v1.NewAddress(1, v1.Leader)
+	scout := v1.NewAddress(7, v1.Scout)
+	bn := types.BallotNumber{Round: 3, LeaderID: leader}
+	command := types.BasicCommand{ClientID: "(Client-0)", CommandID: "1", Op: "OP"}
+	typed := ops.NewCommand("(Client-0)", "2", ops.CAS{Key: "k1", Value: "v 1"})
+	pvalues := make(types.PValues)
+	pvalues.Set(types.PValue{BN: bn, Slot: 2, Command: command})
+
+	roundTrip := func(m v1.Message) v1.Message {
+		name, data, err := Encode(m)
+		So(err, ShouldBeNil)
+		src := NewAddr(m.Src())
+		decoded, err := NewDecoder(nil).Decode(Entry{Kind: KindDeliver, Src: &src, Type: name, Payload: data})
+		So(err, ShouldBeNil)
+		return decoded
+	}
+
+	Convey("Given the messages exchanged between processes", t, func() {
+		msgs := []v1.Message{
+			messages.NewRequestMessage(v1.NewAddress(0, v1.Client), command),
+			messages.NewProposedMessage(v1.NewAddress(0, v1.Replica), 2, command),
+			messages.NewDecisionMessage(v1.NewAddress(4, v1.Commander), 2, command),
+			messages.NewRequestMessage(v1.NewAddress(0, v1.Client), typed),
+			messages.NewDecisionMessage(v1.NewAddress(4, v1.Commander), 3, typed),
+			messages.NewPhase1aMessage(scout, bn),
+			messages.NewPhase1bMessage(v1.NewAddress(0, v1.Acceptor), bn, pvalues),
+			messages.NewPhase2aMessage(v1.NewAddress(4, v1.Commander), types.PValue{BN: bn, Slot: 2, Command: command}),
+			messages.NewPhase2bMessage(v1.NewAddress(0, v1.Acceptor), bn),
+			messages.NewPremptedMessage(scout, bn),
+			messages.NewAdoptedMessage(scout, bn, pvalues),
+		}
+
+		Convey("each message survives an encode & decode round trip", func() {
+			for _, m := range msgs {
+				So(roundTrip(m), ShouldResemble, m)
+			}
+		})
+	})
+
+	Convey("Given a reconfiguration command", t, func() {
+		rc := &types.ReConfigCommand{BasicCommand: command, NewLeaders: []v1.Addr{leader}}
+		name, data, err := Encode(messages.NewRequestMessage(v1.NewAddress(0, v1.Client), rc))
+		So(err, ShouldBeNil)
+		src := NewAddr(v1.NewAddress(0, v1.Client))
+		e := Entry{Kind: KindDeliver, Src: &src, Type: name, Payload: data}
+
+		Convey("the same recorded command always decodes to the same reference", func() {
+			d := NewDecoder(nil)
+			m1, err := d.Decode(e)
+			So(err, ShouldBeNil)
+			m2, _ := d.Decode(e)
+			c1 := m1.(messages.RequestMessage).Command
+			So(c1, ShouldEqual, m2.(messages.RequestMessage).Command)
+			So(c1.(*types.ReConfigCommand).NewLeaders, ShouldResemble, []v1.Addr{leader})
+		})
+	})
+}
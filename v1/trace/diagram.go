@@ -0,0 +1,193 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// lane order of the participants in a sequence diagram, left to right
+var laneOrder = map[v1.ProcessType]int{
+	v1.Client:    0,
+	v1.Replica:   1,
+	v1.Leader:    2,
+	v1.Scout:     3,
+	v1.Commander: 4,
+	v1.Acceptor:  5,
+}
+
+// Window - the deliveries with a step in [from, to]; zero to means until the end
+func Window(entries []Entry, from uint64, to uint64) []Entry {
+	result := make([]Entry, 0)
+	for _, e := range entries {
+		if e.Kind != KindDeliver || e.Step < from || (to != 0 && e.Step > to) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// arrow - a single message of a sequence diagram
+type arrow struct {
+	src Addr
+
+	dest Addr
+
+	label string
+}
+
+func arrows(entries []Entry) ([]Addr, []arrow) {
+	seen := make(map[Addr]bool)
+	participants := make([]Addr, 0)
+	result := make([]arrow, 0)
+	for _, e := range entries {
+		if e.Kind != KindDeliver || e.Src == nil {
+			continue
+		}
+		for _, a := range []Addr{*e.Src, e.Dest} {
+			if !seen[a] {
+				seen[a] = true
+				participants = append(participants, a)
+			}
+		}
+		result = append(result, arrow{src: *e.Src, dest: e.Dest, label: Label(e)})
+	}
+	sort.SliceStable(participants, func(i, j int) bool {
+		li, lj := lane(participants[i]), lane(participants[j])
+		if li != lj {
+			return li < lj
+		}
+		return participants[i].ID < participants[j].ID
+	})
+	return participants, result
+}
+
+func lane(a Addr) int {
+	pt, err := v1.ParseProcessType(a.Type)
+	if err != nil {
+		return len(laneOrder)
+	}
+	return laneOrder[pt]
+}
+
+// Label - a short description of a delivery, annotated with its ballot, slot and command
+func Label(e Entry) string {
+	p := payload{}
+	_ = json.Unmarshal(e.Payload, &p)
+	parts := []string{strings.TrimSuffix(e.Type, "Message")}
+	if p.Ballot != nil {
+		parts = append(parts, fmt.Sprintf("b=(%d,%d)", p.Ballot.Round, p.Ballot.Leader.ID))
+	}
+	if p.PValue != nil {
+		parts = append(parts, fmt.Sprintf("b=(%d,%d)", p.PValue.Ballot.Round, p.PValue.Ballot.Leader.ID),
+			fmt.Sprintf("s=%d", p.PValue.Slot), fmt.Sprintf("c=%s", commandLabel(&p.PValue.Command)))
+	}
+	if p.Slot != nil {
+		parts = append(parts, fmt.Sprintf("s=%d", *p.Slot))
+	}
+	if p.Command != nil {
+		parts = append(parts, fmt.Sprintf("c=%s", commandLabel(p.Command)))
+	}
+	if e.Type == "Phase1bMessage" || e.Type == "AdoptedMessage" {
+		slots := make([]string, 0, len(p.PValues))
+		for _, pv := range p.PValues {
+			slots = append(slots, fmt.Sprintf("%d", pv.Slot))
+		}
+		parts = append(parts, fmt.Sprintf("accepted={%s}", strings.Join(slots, ",")))
+	}
+	return strings.Join(parts, " ")
+}
+
+func commandLabel(c *command) string {
+	return fmt.Sprintf("%s/%s", strings.Trim(c.ClientID, "()"), c.CommandID)
+}
+
+func participantID(a Addr) string {
+	name := strings.ToLower(a.Type)
+	if name != "" {
+		name = strings.ToUpper(name[:1]) + name[1:]
+	}
+	return fmt.Sprintf("%s%d", name, a.ID)
+}
+
+// Mermaid - write the deliveries as a Mermaid sequence diagram
+func Mermaid(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	participants, msgs := arrows(entries)
+	fmt.Fprintln(bw, "sequenceDiagram")
+	for _, p := range participants {
+		fmt.Fprintf(bw, "    participant %s as %s\n", participantID(p), p)
+	}
+	for _, m := range msgs {
+		fmt.Fprintf(bw, "    %s->>%s: %s\n", participantID(m.src), participantID(m.dest), m.label)
+	}
+	return bw.Flush()
+}
+
+// PlantUML - write the deliveries as a PlantUML sequence diagram
+func PlantUML(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	participants, msgs := arrows(entries)
+	fmt.Fprintln(bw, "@startuml")
+	for _, p := range participants {
+		fmt.Fprintf(bw, "participant \"%s\" as %s\n", p, participantID(p))
+	}
+	for _, m := range msgs {
+		fmt.Fprintf(bw, "%s -> %s : %s\n", participantID(m.src), participantID(m.dest), m.label)
+	}
+	fmt.Fprintln(bw, "@enduml")
+	return bw.Flush()
+}
+
+// dimensions of the SVG diagram
+const (
+	svgLaneWidth  = 150
+	svgRowHeight  = 28
+	svgHeadHeight = 40
+	svgMargin     = 20
+)
+
+// SVG - write the deliveries as a standalone SVG sequence diagram
+func SVG(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	participants, msgs := arrows(entries)
+	x := make(map[Addr]int)
+	for i, p := range participants {
+		x[p] = svgMargin + i*svgLaneWidth + svgLaneWidth/2
+	}
+	width := 2*svgMargin + len(participants)*svgLaneWidth
+	height := 2*svgMargin + svgHeadHeight + (len(msgs)+1)*svgRowHeight
+
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="11">`+"\n", width, height)
+	fmt.Fprintln(bw, `<defs><marker id="head" markerWidth="8" markerHeight="8" refX="8" refY="4" orient="auto">`+
+		`<path d="M0,0 L8,4 L0,8 z" fill="black"/></marker></defs>`)
+	fmt.Fprintf(bw, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	for _, p := range participants {
+		px := x[p]
+		fmt.Fprintf(bw, `<rect x="%d" y="%d" width="%d" height="%d" fill="#eef" stroke="black"/>`+"\n",
+			px-svgLaneWidth/2+10, svgMargin, svgLaneWidth-20, svgHeadHeight-10)
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n",
+			px, svgMargin+(svgHeadHeight-10)/2+4, html.EscapeString(p.String()))
+		fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="gray" stroke-dasharray="4,4"/>`+"\n",
+			px, svgMargin+svgHeadHeight-10, px, height-svgMargin)
+	}
+	for i, m := range msgs {
+		y := svgMargin + svgHeadHeight + (i+1)*svgRowHeight
+		x1, x2 := x[m.src], x[m.dest]
+		if x1 == x2 {
+			fmt.Fprintf(bw, `<path d="M%d,%d h30 v10 h-30" fill="none" stroke="black" marker-end="url(#head)"/>`+"\n", x1, y-5)
+		} else {
+			fmt.Fprintf(bw, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="black" marker-end="url(#head)"/>`+"\n", x1, y, x2, y)
+		}
+		fmt.Fprintf(bw, `<text x="%d" y="%d" text-anchor="middle">%s</text>`+"\n",
+			(x1+x2)/2, y-4, html.EscapeString(m.label))
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"bytes"
+	v1 "github.com/1xyz/paxossim/v1"
+	"github.com/1xyz/paxossim/v1/messages"
+	"github.com/1xyz/paxossim/v1/types"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func newTestEntries() []Entry {
+	sink := NewMemory()
+	exchange := NewExchange(v1.NewMessageExchange(), sink)
+	acceptor := v1.NewProcess(0, v1.Acceptor)
+	commander := v1.NewProcess(3, v1.Commander)
+	exchange.Register(acceptor)
+	exchange.Register(commander)
+
+	bn := types.BallotNumber{Round: 2, LeaderID: v1.NewAddress(1, v1.Leader)}
+	command := types.BasicCommand{ClientID: "(Client-0)", CommandID: "5", Op: "OP"}
+	exchange.Send(acceptor, messages.NewPhase2aMessage(commander, types.PValue{BN: bn, Slot: 4, Command: command}))
+	exchange.Send(commander, messages.NewPhase2bMessage(acceptor, bn))
+	return sink.Entries()
+}
+
+func TestDiagrams(t *testing.T) {
+	Convey("Given a trace of a phase 2 exchange", t, func() {
+		entries := newTestEntries()
+
+		Convey("the mermaid diagram has a lane per process, commanders left of acceptors", func() {
+			buf := &bytes.Buffer{}
+			So(Mermaid(buf, entries), ShouldBeNil)
+			out := buf.String()
+			So(strings.Index(out, "participant Commander3"), ShouldBeLessThan, strings.Index(out, "participant Acceptor0"))
+
+			Convey("and arrows annotated with the ballot, slot and command", func() {
+				So(out, ShouldContainSubstring, "Commander3->>Acceptor0: Phase2a b=(2,1) s=4 c=Client-0/5")
+				So(out, ShouldContainSubstring, "Acceptor0->>Commander3: Phase2b b=(2,1)")
+			})
+		})
+
+		Convey("the plantuml diagram is enclosed in start & end markers", func() {
+			buf := &bytes.Buffer{}
+			So(PlantUML(buf, entries), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "@startuml")
+			So(buf.String(), ShouldContainSubstring, "Commander3 -> Acceptor0 : Phase2a")
+		})
+
+		Convey("the svg diagram is a standalone document", func() {
+			buf := &bytes.Buffer{}
+			So(SVG(buf, entries), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "<svg")
+			So(strings.Count(buf.String(), "marker-end"), ShouldEqual, 2)
+		})
+
+		Convey("a window excludes registrations and steps out of range", func() {
+			So(len(Window(entries, 0, 0)), ShouldEqual, 2)
+			So(len(Window(entries, 4, 0)), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,136 @@
+package trace
+
+import (
+	"fmt"
+	v1 "github.com/1xyz/paxossim/v1"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// Exchange - A MessageExchange which records every registration and
+// every message delivery to a Sink, before forwarding it to the wrapped exchange.
+//
+// Deliveries are recorded under a lock, in the order of their steps, and forwarded once it is
+// released: a sender blocked on a full inbox does not hold up the senders to other processes.
+// Concurrent senders to a process may then enqueue their messages in another order than the one
+// recorded, which replay follows.
+type Exchange struct {
+	inner v1.MessageExchange
+
+	sink Sink
+
+	mu *sync.Mutex
+
+	step uint64
+
+	// processes registered via this exchange, used to expand SendAll
+	inboxes map[v1.ProcessType][]v1.ProcessInbox
+}
+
+func NewExchange(inner v1.MessageExchange, sink Sink) *Exchange {
+	return &Exchange{
+		inner:   inner,
+		sink:    sink,
+		mu:      &sync.Mutex{},
+		inboxes: make(map[v1.ProcessType][]v1.ProcessInbox),
+	}
+}
+
+func (te *Exchange) Send(dest v1.Addr, m v1.Message) error {
+	if err := te.recordDeliveries([]v1.Addr{dest}, m); err != nil {
+		return err
+	}
+	return te.inner.Send(dest, m)
+}
+
+// IDs - the allocator of the wrapped exchange
+func (te *Exchange) IDs() *v1.IDAllocator {
+	return te.inner.IDs()
+}
+
+func (te *Exchange) SendAll(pt v1.ProcessType, m v1.Message) error {
+	te.mu.Lock()
+	entries := te.inboxes[pt]
+	dests := make([]v1.Addr, len(entries))
+	for i, p := range entries {
+		dests[i] = p
+	}
+	te.mu.Unlock()
+	if len(dests) == 0 {
+		return fmt.Errorf("not-found: No process(es) with type:%v found", pt)
+	}
+	if err := te.recordDeliveries(dests, m); err != nil {
+		return err
+	}
+	for _, p := range dests {
+		if err := te.inner.Send(p, m); err != nil {
+			return fmt.Errorf("send failed: to process=%v %v", p, err)
+		}
+	}
+	return nil
+}
+
+// recordDeliveries - record the delivery of the message to each of the destinations, in order
+func (te *Exchange) recordDeliveries(dests []v1.Addr, m v1.Message) error {
+	name, data, err := Encode(m)
+	if err != nil {
+		return err
+	}
+	src := NewAddr(m.Src())
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	for _, dest := range dests {
+		te.record(Entry{Kind: KindDeliver, Src: &src, Dest: NewAddr(dest), Type: name, Payload: data})
+	}
+	return nil
+}
+
+// RecordCluster - record the configuration of the cluster, once its processes are registered
+func (te *Exchange) RecordCluster(c Cluster) error {
+	e, err := c.Entry()
+	if err != nil {
+		return err
+	}
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	te.record(e)
+	return nil
+}
+
+func (te *Exchange) Register(p v1.ProcessInbox) error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	if err := te.inner.Register(p); err != nil {
+		return err
+	}
+	te.inboxes[p.Type()] = append(te.inboxes[p.Type()], p)
+	te.record(Entry{Kind: KindRegister, Dest: NewAddr(p)})
+	return nil
+}
+
+func (te *Exchange) UnRegister(p v1.ProcessInbox) error {
+	te.mu.Lock()
+	defer te.mu.Unlock()
+	if err := te.inner.UnRegister(p); err != nil {
+		return err
+	}
+	entries := te.inboxes[p.Type()]
+	for i, e := range entries {
+		if e.ID() == p.ID() {
+			te.inboxes[p.Type()] = append(entries[:i:i], entries[i+1:]...)
+			break
+		}
+	}
+	te.record(Entry{Kind: KindUnRegister, Dest: NewAddr(p)})
+	return nil
+}
+
+func (te *Exchange) record(e Entry) {
+	te.step++
+	e.Step = te.step
+	e.Time = time.Now()
+	if err := te.sink.Record(e); err != nil {
+		log.Warnf("trace.record failed %v", err)
+	}
+}
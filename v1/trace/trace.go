@@ -0,0 +1,178 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Kinds of trace entries
+const (
+	// A process registered with the exchange
+	KindRegister = "register"
+	// A process unregistered from the exchange
+	KindUnRegister = "unregister"
+	// A message delivered to the inbox of a process
+	KindDeliver = "deliver"
+	// The configuration of the cluster, see Cluster
+	KindCluster = "cluster"
+)
+
+// Entry - A single recorded event of a run
+type Entry struct {
+	// Logical step, entries are totally ordered by step
+	Step uint64 `json:"step"`
+
+	Time time.Time `json:"time"`
+
+	Kind string `json:"kind"`
+
+	// Source of the message; empty for registrations
+	Src *Addr `json:"src,omitempty"`
+
+	// Destination of the message, or the (un)registered process
+	Dest Addr `json:"dest"`
+
+	// Message type, e.g. Phase1aMessage
+	Type string `json:"type,omitempty"`
+
+	// Encoded message, see Encode
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func (e Entry) String() string {
+	if e.Kind == KindCluster {
+		return fmt.Sprintf("#%d %s %s", e.Step, e.Kind, e.Payload)
+	}
+	if e.Kind != KindDeliver {
+		return fmt.Sprintf("#%d %s %v", e.Step, e.Kind, e.Dest)
+	}
+	return fmt.Sprintf("#%d %v -> %v %s %s", e.Step, e.Src, e.Dest, e.Type, e.Payload)
+}
+
+// Sink - receives the entries of a trace, in step order
+type Sink interface {
+	Record(e Entry) error
+}
+
+// Tee - a Sink recording every entry to all of the sinks, stopping at the first error
+func Tee(sinks ...Sink) Sink {
+	return tee(sinks)
+}
+
+type tee []Sink
+
+func (t tee) Record(e Entry) error {
+	for _, s := range t {
+		if err := s.Record(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writer - a Sink writing entries as JSON lines
+type Writer struct {
+	mu *sync.Mutex
+
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		mu:  &sync.Mutex{},
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (w *Writer) Record(e Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(e)
+}
+
+// FileWriter - a Writer to a buffered file, which must be closed once the run completes
+type FileWriter struct {
+	*Writer
+
+	f *os.File
+
+	buf *bufio.Writer
+}
+
+func CreateFile(path string) (*FileWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &FileWriter{Writer: NewWriter(buf), f: f, buf: buf}, nil
+}
+
+func (fw *FileWriter) Close() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if err := fw.buf.Flush(); err != nil {
+		fw.f.Close()
+		return err
+	}
+	return fw.f.Close()
+}
+
+// Memory - a Sink capturing entries in memory
+type Memory struct {
+	mu *sync.Mutex
+
+	entries []Entry
+}
+
+func NewMemory() *Memory {
+	return &Memory{mu: &sync.Mutex{}, entries: make([]Entry, 0)}
+}
+
+func (m *Memory) Record(e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+// Entries - a copy of the entries recorded so far
+func (m *Memory) Entries() []Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make([]Entry, len(m.entries))
+	copy(result, m.entries)
+	return result
+}
+
+// Read - decode all the JSON line entries from r
+func Read(r io.Reader) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	dec := json.NewDecoder(r)
+	for {
+		var e Entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", len(entries), err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// Load - read all the entries of a trace file
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(bufio.NewReader(f))
+}
@@ -53,11 +53,16 @@ func (b BasicCommand) String() string {
 }
 
 // A Reconfiguration Command issued
+// Note: the leader list is not comparable, so this command is always
+// passed by reference (*ReConfigCommand) to keep commands usable as map keys
 type ReConfigCommand struct {
 	BasicCommand
 
-	// New leader configuration
+	// New leader configuration, unchanged if nil
 	NewLeaders []v1.Addr
+
+	// New main acceptors contacted by the leaders (Cheap Paxos), unchanged if nil
+	NewAcceptors []v1.Addr
 }
 
 type SlotCommandMap map[Slot]Command
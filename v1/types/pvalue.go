@@ -37,3 +37,10 @@ func (pvalues PValues) Update(values PValues) {
 		pvalues.Set(v)
 	}
 }
+
+// Copy - a shallow copy of this set
+func (pvalues PValues) Copy() PValues {
+	result := make(PValues, len(pvalues))
+	result.Update(pvalues)
+	return result
+}
@@ -8,6 +8,16 @@ import (
 )
 
 type FakeMessageExchange struct {
+	IDsStub        func() *v1.IDAllocator
+	iDsMutex       sync.RWMutex
+	iDsArgsForCall []struct {
+	}
+	iDsReturns struct {
+		result1 *v1.IDAllocator
+	}
+	iDsReturnsOnCall map[int]struct {
+		result1 *v1.IDAllocator
+	}
 	RegisterStub        func(v1.ProcessInbox) error
 	registerMutex       sync.RWMutex
 	registerArgsForCall []struct {
@@ -58,6 +68,58 @@ type FakeMessageExchange struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeMessageExchange) IDs() *v1.IDAllocator {
+	fake.iDsMutex.Lock()
+	ret, specificReturn := fake.iDsReturnsOnCall[len(fake.iDsArgsForCall)]
+	fake.iDsArgsForCall = append(fake.iDsArgsForCall, struct {
+	}{})
+	fake.recordInvocation("IDs", []interface{}{})
+	fake.iDsMutex.Unlock()
+	if fake.IDsStub != nil {
+		return fake.IDsStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.iDsReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeMessageExchange) IDsCallCount() int {
+	fake.iDsMutex.RLock()
+	defer fake.iDsMutex.RUnlock()
+	return len(fake.iDsArgsForCall)
+}
+
+func (fake *FakeMessageExchange) IDsCalls(stub func() *v1.IDAllocator) {
+	fake.iDsMutex.Lock()
+	defer fake.iDsMutex.Unlock()
+	fake.IDsStub = stub
+}
+
+func (fake *FakeMessageExchange) IDsReturns(result1 *v1.IDAllocator) {
+	fake.iDsMutex.Lock()
+	defer fake.iDsMutex.Unlock()
+	fake.IDsStub = nil
+	fake.iDsReturns = struct {
+		result1 *v1.IDAllocator
+	}{result1}
+}
+
+func (fake *FakeMessageExchange) IDsReturnsOnCall(i int, result1 *v1.IDAllocator) {
+	fake.iDsMutex.Lock()
+	defer fake.iDsMutex.Unlock()
+	fake.IDsStub = nil
+	if fake.iDsReturnsOnCall == nil {
+		fake.iDsReturnsOnCall = make(map[int]struct {
+			result1 *v1.IDAllocator
+		})
+	}
+	fake.iDsReturnsOnCall[i] = struct {
+		result1 *v1.IDAllocator
+	}{result1}
+}
+
 func (fake *FakeMessageExchange) Register(arg1 v1.ProcessInbox) error {
 	fake.registerMutex.Lock()
 	ret, specificReturn := fake.registerReturnsOnCall[len(fake.registerArgsForCall)]
@@ -303,6 +365,8 @@ func (fake *FakeMessageExchange) UnRegisterReturnsOnCall(i int, result1 error) {
 func (fake *FakeMessageExchange) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.iDsMutex.RLock()
+	defer fake.iDsMutex.RUnlock()
 	fake.registerMutex.RLock()
 	defer fake.registerMutex.RUnlock()
 	fake.sendMutex.RLock()
@@ -8,6 +8,10 @@ import (
 )
 
 type FakeProcess struct {
+	CloseStub        func()
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct {
+	}
 	GetAddrStub        func() v1.Addr
 	getAddrMutex       sync.RWMutex
 	getAddrArgsForCall []struct {
@@ -28,6 +32,16 @@ type FakeProcess struct {
 	iDReturnsOnCall map[int]struct {
 		result1 v1.ProcessID
 	}
+	InboxLenStub        func() int
+	inboxLenMutex       sync.RWMutex
+	inboxLenArgsForCall []struct {
+	}
+	inboxLenReturns struct {
+		result1 int
+	}
+	inboxLenReturnsOnCall map[int]struct {
+		result1 int
+	}
 	RecvStub        func() (v1.Message, error)
 	recvMutex       sync.RWMutex
 	recvArgsForCall []struct {
@@ -65,6 +79,29 @@ type FakeProcess struct {
 	invocationsMutex sync.RWMutex
 }
 
+func (fake *FakeProcess) Close() {
+	fake.closeMutex.Lock()
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct {
+	}{})
+	fake.recordInvocation("Close", []interface{}{})
+	fake.closeMutex.Unlock()
+	if fake.CloseStub != nil {
+		fake.CloseStub()
+	}
+}
+
+func (fake *FakeProcess) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeProcess) CloseCalls(stub func()) {
+	fake.closeMutex.Lock()
+	defer fake.closeMutex.Unlock()
+	fake.CloseStub = stub
+}
+
 func (fake *FakeProcess) GetAddr() v1.Addr {
 	fake.getAddrMutex.Lock()
 	ret, specificReturn := fake.getAddrReturnsOnCall[len(fake.getAddrArgsForCall)]
@@ -169,6 +206,58 @@ func (fake *FakeProcess) IDReturnsOnCall(i int, result1 v1.ProcessID) {
 	}{result1}
 }
 
+func (fake *FakeProcess) InboxLen() int {
+	fake.inboxLenMutex.Lock()
+	ret, specificReturn := fake.inboxLenReturnsOnCall[len(fake.inboxLenArgsForCall)]
+	fake.inboxLenArgsForCall = append(fake.inboxLenArgsForCall, struct {
+	}{})
+	fake.recordInvocation("InboxLen", []interface{}{})
+	fake.inboxLenMutex.Unlock()
+	if fake.InboxLenStub != nil {
+		return fake.InboxLenStub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	fakeReturns := fake.inboxLenReturns
+	return fakeReturns.result1
+}
+
+func (fake *FakeProcess) InboxLenCallCount() int {
+	fake.inboxLenMutex.RLock()
+	defer fake.inboxLenMutex.RUnlock()
+	return len(fake.inboxLenArgsForCall)
+}
+
+func (fake *FakeProcess) InboxLenCalls(stub func() int) {
+	fake.inboxLenMutex.Lock()
+	defer fake.inboxLenMutex.Unlock()
+	fake.InboxLenStub = stub
+}
+
+func (fake *FakeProcess) InboxLenReturns(result1 int) {
+	fake.inboxLenMutex.Lock()
+	defer fake.inboxLenMutex.Unlock()
+	fake.InboxLenStub = nil
+	fake.inboxLenReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *FakeProcess) InboxLenReturnsOnCall(i int, result1 int) {
+	fake.inboxLenMutex.Lock()
+	defer fake.inboxLenMutex.Unlock()
+	fake.InboxLenStub = nil
+	if fake.inboxLenReturnsOnCall == nil {
+		fake.inboxLenReturnsOnCall = make(map[int]struct {
+			result1 int
+		})
+	}
+	fake.inboxLenReturnsOnCall[i] = struct {
+		result1 int
+	}{result1}
+}
+
 func (fake *FakeProcess) Recv() (v1.Message, error) {
 	fake.recvMutex.Lock()
 	ret, specificReturn := fake.recvReturnsOnCall[len(fake.recvArgsForCall)]
@@ -339,10 +428,14 @@ func (fake *FakeProcess) TypeReturnsOnCall(i int, result1 v1.ProcessType) {
 func (fake *FakeProcess) Invocations() map[string][][]interface{} {
 	fake.invocationsMutex.RLock()
 	defer fake.invocationsMutex.RUnlock()
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
 	fake.getAddrMutex.RLock()
 	defer fake.getAddrMutex.RUnlock()
 	fake.iDMutex.RLock()
 	defer fake.iDMutex.RUnlock()
+	fake.inboxLenMutex.RLock()
+	defer fake.inboxLenMutex.RUnlock()
 	fake.recvMutex.RLock()
 	defer fake.recvMutex.RUnlock()
 	fake.sendMutex.RLock()